@@ -0,0 +1,98 @@
+// Command rotate-keys moves workspace data keys onto the current master key.
+//
+// To rotate the master key, set DOCUMENT_ENCRYPTION_KEY to the new key, add the old one to
+// DOCUMENT_ENCRYPTION_PREVIOUS_KEYS and run rotate-keys. Once it reports that every data key is
+// rewrapped, the old key can be removed from DOCUMENT_ENCRYPTION_PREVIOUS_KEYS unless files
+// written before data keys existed still need it (run with -reencrypt first).
+//
+// With ENCRYPTION_KEY_PROVIDER=aws-kms or vault-transit, run rotate-keys after pointing
+// AWS_KMS_KEY_ID at a new key or rotating the Transit key in Vault. It also moves data keys
+// wrapped by DOCUMENT_ENCRYPTION_KEY onto the KMS key when switching providers.
+//
+// With -new-data-keys every workspace also gets a new data key; the retired ones keep
+// decrypting existing data. With -reencrypt all stored files, form values and the prefilled
+// values of pending bulk sends are rewritten with their workspace's active data key.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os/signal"
+	"syscall"
+
+	_ "github.com/joho/godotenv/autoload"
+
+	"finalsign/internal/database"
+	"finalsign/internal/storage"
+)
+
+func main() {
+	newDataKeys := flag.Bool("new-data-keys", false, "retire every workspace's data key so new data gets a new one")
+	reencrypt := flag.Bool("reencrypt", false, "rewrite stored files and form values with the active data keys")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	db := database.New()
+	defer db.Close()
+
+	keyring, err := storage.KeyringFromEnv(ctx, db)
+	if err != nil {
+		log.Fatalf("Failed to load master keys: %v", err)
+	}
+
+	keys, err := db.ListDataKeysToRewrap(keyring.MasterKeyID())
+	if err != nil {
+		log.Fatalf("Failed to list data keys: %v", err)
+	}
+
+	failed := 0
+	for _, key := range keys {
+		wrapped, err := keyring.Rewrap(ctx, &key)
+		if err == nil {
+			err = db.RewrapDataKey(key.ID, key.MasterKeyID, wrapped, keyring.MasterKeyID())
+		}
+		if err != nil {
+			log.Printf("Failed to rewrap data key %s: %v", key.ID, err)
+			failed++
+		}
+	}
+	log.Printf("Rewrapped %d of %d data keys with master key %s", len(keys)-failed, len(keys), keyring.MasterKeyID())
+	if failed > 0 {
+		log.Fatalf("%d data keys are still wrapped by an old master key; keep that key available", failed)
+	}
+
+	if *newDataKeys {
+		retired, err := db.RetireActiveDataKeys()
+		if err != nil {
+			log.Fatalf("Failed to retire data keys: %v", err)
+		}
+		log.Printf("Retired %d data keys; running servers switch to new keys once DATA_KEY_CACHE_TTL passes", retired)
+	}
+
+	if *reencrypt {
+		fileStorage, err := storage.NewServiceFromEnv(db)
+		if err != nil {
+			log.Fatalf("Failed to initialize file storage: %v", err)
+		}
+
+		var pass storage.ReencryptionPass
+		total := 0
+		for !pass.Done {
+			count, err := fileStorage.ReencryptPending(ctx, db, &pass)
+			if err != nil {
+				log.Fatalf("Re-encryption stopped after %d items: %v", total, err)
+			}
+			if count > 0 {
+				total += count
+				log.Printf("Re-encrypted %d items", total)
+			}
+		}
+		if pass.Failed > 0 {
+			log.Fatalf("Re-encryption rewrote %d items but %d failed and still use an old key; keep it available and run again", total, pass.Failed)
+		}
+		log.Printf("Re-encryption finished: %d items rewritten", total)
+	}
+}
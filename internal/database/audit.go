@@ -0,0 +1,120 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AuditEntry is a single row of document_audit_log
+type AuditEntry struct {
+	ID         uuid.UUID              `json:"id"`
+	DocumentID *uuid.UUID             `json:"document_id,omitempty"`
+	TemplateID *uuid.UUID             `json:"template_id,omitempty"`
+	UserID     *int                   `json:"user_id,omitempty"`
+	UserName   string                 `json:"user_name,omitempty"`
+	UserEmail  string                 `json:"user_email,omitempty"`
+	Action     string                 `json:"action"`
+	Details    map[string]interface{} `json:"details"`
+	IPAddress  string                 `json:"ip_address,omitempty"`
+	UserAgent  string                 `json:"user_agent,omitempty"`
+	CreatedAt  time.Time              `json:"created_at"`
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// recordAudit writes an entry to document_audit_log. Audit failures never fail the operation
+// being audited; inside a transaction the insert runs in a savepoint so a rejected row does not
+// abort the surrounding transaction.
+func recordAudit(exec execer, entry AuditEntry) {
+	details := entry.Details
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		detailsJSON = []byte("{}")
+	}
+
+	_, inTransaction := exec.(*sql.Tx)
+	if inTransaction {
+		if _, err := exec.Exec(`SAVEPOINT audit_log`); err != nil {
+			return
+		}
+	}
+
+	auditQuery := `
+		INSERT INTO document_audit_log (document_id, template_id, user_id, action, details,
+			ip_address, user_agent, created_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, '')::inet, NULLIF($7, ''), NOW())`
+
+	_, err = exec.Exec(auditQuery, entry.DocumentID, entry.TemplateID, entry.UserID, entry.Action,
+		string(detailsJSON), entry.IPAddress, entry.UserAgent)
+
+	if inTransaction {
+		if err != nil {
+			exec.Exec(`ROLLBACK TO SAVEPOINT audit_log`)
+		}
+		exec.Exec(`RELEASE SAVEPOINT audit_log`)
+	}
+}
+
+// GetDocumentAuditLog retrieves every audit entry for a document with workspace access check
+func (s *service) GetDocumentAuditLog(documentID uuid.UUID, userID int) ([]AuditEntry, error) {
+	// First verify user has access to this document
+	_, err := s.GetDocumentByID(documentID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.documentAuditTrail(documentID)
+}
+
+// documentAuditTrail returns a document's audit entries in the order they happened
+func (s *service) documentAuditTrail(documentID uuid.UUID) ([]AuditEntry, error) {
+	query := `
+		SELECT al.id, al.document_id, al.template_id, al.user_id, COALESCE(u.name, ''), COALESCE(u.email, ''),
+			   al.action, COALESCE(al.details, '{}'), COALESCE(host(al.ip_address), ''),
+			   COALESCE(al.user_agent, ''), al.created_at
+		FROM document_audit_log al
+		LEFT JOIN users u ON al.user_id = u.id
+		WHERE al.document_id = $1
+		ORDER BY al.created_at ASC, al.id ASC`
+
+	rows, err := s.db.Query(query, documentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		var details []byte
+		err := rows.Scan(
+			&entry.ID, &entry.DocumentID, &entry.TemplateID, &entry.UserID, &entry.UserName,
+			&entry.UserEmail, &entry.Action, &details, &entry.IPAddress, &entry.UserAgent,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+
+		if err := json.Unmarshal(details, &entry.Details); err != nil {
+			entry.Details = map[string]interface{}{}
+		}
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	return entries, nil
+}
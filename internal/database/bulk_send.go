@@ -0,0 +1,430 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// bulkSendRowBatchSize caps how many rows one run of the bulk send job turns into documents
+const bulkSendRowBatchSize = 50
+
+// BulkSendBatch is a CSV upload that creates one document per row from the same template
+type BulkSendBatch struct {
+	ID                   uuid.UUID     `json:"id"`
+	WorkspaceID          uuid.UUID     `json:"workspace_id"`
+	TemplateID           uuid.UUID     `json:"template_id"`
+	TemplateVersionID    uuid.UUID     `json:"template_version_id"`
+	TemplateSnapshotHash string        `json:"template_snapshot_hash"`
+	CreatedBy            int           `json:"created_by"`
+	Status               string        `json:"status"` // pending, processing, completed
+	TotalRows            int           `json:"total_rows"`
+	PendingRows          int           `json:"pending_rows"`
+	SentRows             int           `json:"sent_rows"`
+	FailedRows           int           `json:"failed_rows"`
+	ExpiresAt            *time.Time    `json:"expires_at,omitempty"`
+	ParallelSigning      bool          `json:"parallel_signing"`
+	CreatedAt            time.Time     `json:"created_at"`
+	UpdatedAt            time.Time     `json:"updated_at"`
+	CompletedAt          *time.Time    `json:"completed_at,omitempty"`
+	Rows                 []BulkSendRow `json:"rows,omitempty"`
+}
+
+// BulkSendRow is one CSV row and the document created from it
+type BulkSendRow struct {
+	ID           uuid.UUID           `json:"id"`
+	BatchID      uuid.UUID           `json:"batch_id"`
+	RowNumber    int                 `json:"row_number"`
+	DocumentName string              `json:"document_name"`
+	Recipients   []BulkSendRecipient `json:"recipients"`
+	Prefill      []BulkSendPrefill   `json:"-"`
+	Status       string              `json:"status"` // pending, sent, failed
+	DocumentID   *uuid.UUID          `json:"document_id,omitempty"`
+	Error        *string             `json:"error,omitempty"`
+	ProcessedAt  *time.Time          `json:"processed_at,omitempty"`
+}
+
+// BulkSendRecipient assigns a person to one of the template's signer roles
+type BulkSendRecipient struct {
+	TemplateSignerID uuid.UUID `json:"template_signer_id"`
+	SignerOrder      int       `json:"signer_order"`
+	Email            string    `json:"email"`
+	Name             string    `json:"name"`
+}
+
+// BulkSendPrefill is an already validated and encrypted value for one template field. It is
+// saved as a form submission of the signer the field belongs to when the document is created.
+type BulkSendPrefill struct {
+	FieldID         uuid.UUID `json:"field_id"`
+	FieldName       string    `json:"field_name"`
+	FieldType       string    `json:"field_type"`
+	SignerOrder     int       `json:"signer_order"`
+	EncryptedValue  string    `json:"encrypted_value"`
+	EncryptionKeyID string    `json:"encryption_key_id"`
+}
+
+// CreateBulkSendBatch stores a validated batch and its rows for the bulk send job to process
+func (s *service) CreateBulkSendBatch(batch *BulkSendBatch, rows []BulkSendRow) (*BulkSendBatch, error) {
+	// Check if user has permission to create documents (member or higher)
+	permissionQuery := `
+		SELECT role FROM workspace_memberships
+		WHERE workspace_id = $1 AND user_id = $2 AND status = 'active'`
+
+	var role string
+	err := s.db.QueryRow(permissionQuery, batch.WorkspaceID, batch.CreatedBy).Scan(&role)
+	if err != nil {
+		return nil, fmt.Errorf("user does not have access to this workspace")
+	}
+
+	if role == "viewer" {
+		return nil, fmt.Errorf("insufficient permissions to create documents")
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	batchQuery := `
+		INSERT INTO bulk_send_batches (workspace_id, template_id, template_version_id, template_snapshot_hash,
+			created_by, total_rows, expires_at, parallel_signing)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, status, created_at, updated_at`
+
+	err = tx.QueryRow(
+		batchQuery,
+		batch.WorkspaceID,
+		batch.TemplateID,
+		batch.TemplateVersionID,
+		batch.TemplateSnapshotHash,
+		batch.CreatedBy,
+		len(rows),
+		batch.ExpiresAt,
+		batch.ParallelSigning,
+	).Scan(&batch.ID, &batch.Status, &batch.CreatedAt, &batch.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bulk send batch: %w", err)
+	}
+
+	rowQuery := `
+		INSERT INTO bulk_send_rows (batch_id, row_number, document_name, recipients, prefill)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, status`
+
+	for i := range rows {
+		recipientsJSON, err := json.Marshal(rows[i].Recipients)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode recipients for row %d: %w", rows[i].RowNumber, err)
+		}
+		prefill := rows[i].Prefill
+		if prefill == nil {
+			prefill = []BulkSendPrefill{}
+		}
+		prefillJSON, err := json.Marshal(prefill)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode prefill values for row %d: %w", rows[i].RowNumber, err)
+		}
+
+		rows[i].BatchID = batch.ID
+		err = tx.QueryRow(rowQuery, batch.ID, rows[i].RowNumber, rows[i].DocumentName,
+			string(recipientsJSON), string(prefillJSON)).Scan(&rows[i].ID, &rows[i].Status)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create bulk send row %d: %w", rows[i].RowNumber, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	batch.TotalRows = len(rows)
+	batch.PendingRows = len(rows)
+	batch.Rows = rows
+	return batch, nil
+}
+
+// GetBulkSendBatch returns a batch with per-row progress, with a workspace access check
+func (s *service) GetBulkSendBatch(batchID uuid.UUID, userID int) (*BulkSendBatch, error) {
+	batch := &BulkSendBatch{}
+	query := `
+		SELECT b.id, b.workspace_id, b.template_id, b.template_version_id, b.template_snapshot_hash, b.created_by, b.status,
+			   b.total_rows, b.expires_at, b.parallel_signing, b.created_at, b.updated_at, b.completed_at
+		FROM bulk_send_batches b
+		JOIN workspace_memberships wm ON b.workspace_id = wm.workspace_id
+		WHERE b.id = $1 AND wm.user_id = $2 AND wm.status = 'active'`
+
+	err := s.db.QueryRow(query, batchID, userID).Scan(
+		&batch.ID, &batch.WorkspaceID, &batch.TemplateID, &batch.TemplateVersionID, &batch.TemplateSnapshotHash,
+		&batch.CreatedBy, &batch.Status, &batch.TotalRows, &batch.ExpiresAt,
+		&batch.ParallelSigning, &batch.CreatedAt, &batch.UpdatedAt, &batch.CompletedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("bulk send batch not found or access denied: %w", err)
+	}
+
+	rowsQuery := `
+		SELECT id, batch_id, row_number, document_name, recipients, status, document_id, error, processed_at
+		FROM bulk_send_rows
+		WHERE batch_id = $1
+		ORDER BY row_number ASC`
+
+	rows, err := s.db.Query(rowsQuery, batchID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bulk send rows: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row BulkSendRow
+		var recipientsJSON []byte
+		err := rows.Scan(&row.ID, &row.BatchID, &row.RowNumber, &row.DocumentName, &recipientsJSON,
+			&row.Status, &row.DocumentID, &row.Error, &row.ProcessedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan bulk send row: %w", err)
+		}
+		if err := json.Unmarshal(recipientsJSON, &row.Recipients); err != nil {
+			return nil, fmt.Errorf("failed to decode recipients for row %d: %w", row.RowNumber, err)
+		}
+
+		switch row.Status {
+		case "pending":
+			batch.PendingRows++
+		case "sent":
+			batch.SentRows++
+		case "failed":
+			batch.FailedRows++
+		}
+		batch.Rows = append(batch.Rows, row)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	return batch, nil
+}
+
+// pendingBulkSendRow is a row waiting to become a document, with the batch settings it needs
+type pendingBulkSendRow struct {
+	BulkSendRow
+	batch BulkSendBatch
+}
+
+// ProcessBulkSendRows creates and sends the documents for the oldest pending bulk send rows.
+// Each row gets its own transaction, so one bad row is marked failed without holding up the rest.
+// The job's advisory lock keeps two replicas from claiming the same rows.
+func (s *service) ProcessBulkSendRows(ctx context.Context) (int, error) {
+	query := `
+		SELECT r.id, r.batch_id, r.row_number, r.document_name, r.recipients, r.prefill,
+			   b.workspace_id, b.template_id, b.template_version_id, b.template_snapshot_hash, b.created_by,
+			   b.expires_at, b.parallel_signing
+		FROM bulk_send_rows r
+		JOIN bulk_send_batches b ON r.batch_id = b.id
+		WHERE r.status = 'pending'
+		ORDER BY b.created_at ASC, r.row_number ASC
+		LIMIT $1`
+
+	rows, err := s.db.QueryContext(ctx, query, bulkSendRowBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find pending bulk send rows: %w", err)
+	}
+
+	var pending []pendingBulkSendRow
+	for rows.Next() {
+		var row pendingBulkSendRow
+		var recipientsJSON, prefillJSON []byte
+		err := rows.Scan(&row.ID, &row.BatchID, &row.RowNumber, &row.DocumentName, &recipientsJSON,
+			&prefillJSON, &row.batch.WorkspaceID, &row.batch.TemplateID, &row.batch.TemplateVersionID,
+			&row.batch.TemplateSnapshotHash,
+			&row.batch.CreatedBy, &row.batch.ExpiresAt, &row.batch.ParallelSigning)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan bulk send row: %w", err)
+		}
+		if err := json.Unmarshal(recipientsJSON, &row.Recipients); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to decode recipients for row %s: %w", row.ID, err)
+		}
+		if err := json.Unmarshal(prefillJSON, &row.Prefill); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to decode prefill values for row %s: %w", row.ID, err)
+		}
+		pending = append(pending, row)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	processed := 0
+	for _, row := range pending {
+		if ctx.Err() != nil {
+			break
+		}
+
+		if rowErr := s.sendBulkSendRow(ctx, row); rowErr != nil {
+			_, err := s.db.ExecContext(ctx, `
+				UPDATE bulk_send_rows
+				SET status = 'failed', error = $2, processed_at = NOW()
+				WHERE id = $1 AND status = 'pending'`, row.ID, rowErr.Error())
+			if err != nil {
+				return processed, fmt.Errorf("failed to record bulk send row failure: %w", err)
+			}
+			if err := updateBulkSendBatchStatus(s.db, row.BatchID); err != nil {
+				return processed, err
+			}
+		}
+		processed++
+	}
+
+	return processed, nil
+}
+
+// sendBulkSendRow creates, prefills and sends the document for one row in a single transaction
+func (s *service) sendBulkSendRow(ctx context.Context, row pendingBulkSendRow) error {
+	if row.batch.ExpiresAt != nil && !row.batch.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("the batch expiration date has passed")
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The uploader's membership and the template are checked again; either may have changed
+	// since the CSV was validated
+	var role string
+	err = tx.QueryRow(`
+		SELECT role FROM workspace_memberships
+		WHERE workspace_id = $1 AND user_id = $2 AND status = 'active'`,
+		row.batch.WorkspaceID, row.batch.CreatedBy).Scan(&role)
+	if err != nil || role == "viewer" {
+		return fmt.Errorf("the uploader no longer has permission to create documents")
+	}
+
+	var active bool
+	err = tx.QueryRow(`SELECT is_active FROM templates WHERE id = $1`, row.batch.TemplateID).Scan(&active)
+	if err != nil || !active {
+		return fmt.Errorf("the template is no longer available")
+	}
+
+	document := &Document{
+		TemplateID:           row.batch.TemplateID,
+		TemplateVersionID:    row.batch.TemplateVersionID,
+		Name:                 row.DocumentName,
+		TemplateSnapshotHash: row.batch.TemplateSnapshotHash,
+		CreatedBy:            row.batch.CreatedBy,
+		WorkspaceID:          row.batch.WorkspaceID,
+		ExpiresAt:            row.batch.ExpiresAt,
+		ParallelSigning:      row.batch.ParallelSigning,
+	}
+
+	signers := make([]DocumentSigner, 0, len(row.Recipients))
+	for _, recipient := range row.Recipients {
+		signers = append(signers, DocumentSigner{
+			TemplateSignerID: recipient.TemplateSignerID,
+			SignerOrder:      recipient.SignerOrder,
+			SignerEmail:      recipient.Email,
+			SignerName:       recipient.Name,
+		})
+	}
+
+	if err = insertDocumentWithSigners(tx, document, signers); err != nil {
+		return err
+	}
+
+	if err = insertBulkSendPrefill(tx, document.ID, signers, row.Prefill); err != nil {
+		return err
+	}
+
+	if _, err = sendDraftDocument(tx, document.ID, row.batch.CreatedBy); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE bulk_send_rows
+		SET status = 'sent', document_id = $2, error = NULL, processed_at = NOW()
+		WHERE id = $1`, row.ID, document.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update bulk send row: %w", err)
+	}
+
+	if err = updateBulkSendBatchStatus(tx, row.BatchID); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// insertBulkSendPrefill saves prefilled values as form submissions of the signers that own the
+// fields. Signers see them as already filled in and can still change them.
+func insertBulkSendPrefill(tx *sql.Tx, documentID uuid.UUID, signers []DocumentSigner, prefill []BulkSendPrefill) error {
+	if len(prefill) == 0 {
+		return nil
+	}
+
+	signerIDs := make(map[int]uuid.UUID, len(signers))
+	for _, signer := range signers {
+		signerIDs[signer.SignerOrder] = signer.ID
+	}
+
+	submissionQuery := `
+		INSERT INTO form_submissions (document_id, document_signer_id, field_id, field_name, field_type,
+			encrypted_value, encryption_key_id, submitted_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())`
+
+	fieldNames := make([]string, 0, len(prefill))
+	for _, value := range prefill {
+		signerID, exists := signerIDs[value.SignerOrder]
+		if !exists {
+			return fmt.Errorf("field %s belongs to a signer that is not on the document", value.FieldName)
+		}
+
+		_, err := tx.Exec(submissionQuery, documentID, signerID, value.FieldID, value.FieldName,
+			value.FieldType, value.EncryptedValue, value.EncryptionKeyID)
+		if err != nil {
+			return fmt.Errorf("failed to prefill field %s: %w", value.FieldName, err)
+		}
+		fieldNames = append(fieldNames, value.FieldName)
+	}
+
+	recordAudit(tx, AuditEntry{
+		DocumentID: &documentID,
+		Action:     "field_filled",
+		Details: map[string]interface{}{
+			"prefilled": true,
+			"fields":    fieldNames,
+		},
+	})
+
+	return nil
+}
+
+// updateBulkSendBatchStatus marks a batch completed once none of its rows are pending
+func updateBulkSendBatchStatus(exec execer, batchID uuid.UUID) error {
+	_, err := exec.Exec(`
+		UPDATE bulk_send_batches b
+		SET status = CASE WHEN pending.remaining THEN 'processing' ELSE 'completed' END,
+			completed_at = CASE WHEN pending.remaining THEN NULL ELSE NOW() END,
+			updated_at = NOW()
+		FROM (
+			SELECT EXISTS (
+				SELECT 1 FROM bulk_send_rows WHERE batch_id = $1 AND status = 'pending'
+			) AS remaining
+		) pending
+		WHERE b.id = $1`, batchID)
+	if err != nil {
+		return fmt.Errorf("failed to update bulk send batch status: %w", err)
+	}
+	return nil
+}
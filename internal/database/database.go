@@ -65,12 +65,111 @@ type Service interface {
 	GetTemplateSigners(templateID uuid.UUID, userID int) ([]TemplateSigner, error)
 	GetTemplateFields(templateID uuid.UUID, userID int) ([]TemplateField, error)
 	GetWorkspaceTemplatesList(workspaceID uuid.UUID, userID int) ([]TemplateListItem, error)
-	UpdateTemplate(templateID uuid.UUID, name, description string, userID int) error
+	UpdateTemplate(templateID uuid.UUID, name, description string, parallelSigning, allowDelegation *bool, userID int) error
 	DeactivateTemplate(templateID uuid.UUID, userID int) error
 	
 	// Template field operations - UPDATED  
-	ReplaceTemplateFields(templateID uuid.UUID, fields []TemplateField, userID int) error
-	ReplaceTemplateSigners(templateID uuid.UUID, signers []TemplateSigner, userID int) error
+	ReplaceTemplateFields(templateID uuid.UUID, fields []TemplateField, userID int) (*TemplateVersion, error)
+	ReplaceTemplateSigners(templateID uuid.UUID, signers []TemplateSigner, userID int) (*TemplateVersion, error)
+
+	// Template version operations
+	ListTemplateVersions(templateID uuid.UUID, userID int) ([]TemplateVersion, error)
+	GetTemplateVersion(templateID uuid.UUID, version int, userID int) (*TemplateVersionWithSignersAndFields, error)
+	GetEditableTemplateVersion(templateID uuid.UUID, userID int) (*TemplateVersionWithSignersAndFields, error)
+	PublishTemplateDraft(templateID uuid.UUID, userID int) (*TemplateVersion, error)
+	DiscardTemplateDraft(templateID uuid.UUID, userID int) (string, error)
+	ReplaceTemplatePDF(templateID uuid.UUID, pdf TemplatePDF, userID int) (*TemplatePDFReplacement, error)
+
+	// Document operations
+	CreateDocumentWithSigners(document *Document, signers []DocumentSigner) (*DocumentWithSigners, error)
+	GetDocumentByID(documentID uuid.UUID, userID int) (*Document, error)
+	GetDocumentSigners(documentID uuid.UUID, userID int) ([]DocumentSigner, error)
+	GetDocumentWithSigners(documentID uuid.UUID, userID int) (*DocumentWithSigners, error)
+	ListWorkspaceDocuments(workspaceID uuid.UUID, userID int, filter DocumentListFilter) (*DocumentList, error)
+	SendDocument(documentID uuid.UUID, userID int) ([]DocumentSigner, error)
+	VoidDocument(documentID uuid.UUID, userID int, reason string) ([]DocumentSigner, error)
+	ReassignDocumentSigner(documentID, signerID uuid.UUID, userID int, email, name string) (*DocumentSigner, error)
+
+	// Embedded signing operations
+	CreateEmbeddedSigningSession(documentID, signerID uuid.UUID, userID int, returnURL string, expiresAt time.Time) (*EmbeddedSigningSession, error)
+	GetEmbeddedSigningSession(sessionID uuid.UUID) (*EmbeddedSigningSession, error)
+	RedeemEmbeddedSigningSession(sessionID uuid.UUID, tokenExpiresAt time.Time) (*EmbeddedSigningSession, error)
+	GetWorkspaceEmbedOrigins(workspaceID uuid.UUID) ([]string, error)
+	UpdateWorkspaceEmbedOrigins(workspaceID uuid.UUID, origins []string, userID int) error
+	ListEmbedOrigins() ([]string, error)
+
+	// Webhook operations
+	CreateWebhookEndpoint(endpoint *WebhookEndpoint, userID int) (*WebhookEndpoint, error)
+	ListWebhookEndpoints(workspaceID uuid.UUID, userID int) ([]WebhookEndpoint, error)
+	GetWebhookEndpoint(workspaceID, endpointID uuid.UUID, userID int) (*WebhookEndpoint, error)
+	UpdateWebhookEndpoint(endpoint *WebhookEndpoint, rotateSecret bool, userID int) (*WebhookEndpoint, error)
+	DeleteWebhookEndpoint(workspaceID, endpointID uuid.UUID, userID int) error
+	ListWebhookDeliveries(workspaceID, endpointID uuid.UUID, userID int, limit int) ([]WebhookDelivery, error)
+	RedeliverWebhook(workspaceID, endpointID, deliveryID uuid.UUID, userID int) (*WebhookDelivery, error)
+	ClaimPendingWebhookDeliveries(ctx context.Context, limit int) ([]PendingWebhookDelivery, error)
+	MarkWebhookDeliverySucceeded(ctx context.Context, deliveryID uuid.UUID, responseStatus int, responseBody string) error
+	MarkWebhookDeliveryFailed(ctx context.Context, deliveryID uuid.UUID, responseStatus int, responseBody, lastError string, retryAt *time.Time) error
+
+	// Verification operations
+	VerifyDocumentHash(hash, ipAddress, userAgent string) (*DocumentVerification, error)
+
+	// Encryption key operations
+	GetActiveDataKey(workspaceID uuid.UUID) (*WorkspaceDataKey, error)
+	CreateDataKey(key *WorkspaceDataKey) (*WorkspaceDataKey, error)
+	GetDataKey(keyID uuid.UUID) (*WorkspaceDataKey, error)
+	ListDataKeysToRewrap(masterKeyID string) ([]WorkspaceDataKey, error)
+	RewrapDataKey(keyID uuid.UUID, previousMasterKeyID string, wrappedKey []byte, masterKeyID string) error
+	RetireActiveDataKeys() (int, error)
+	ListObjectsToReencrypt(after EncryptedObject, limit int) ([]EncryptedObject, error)
+	MarkObjectReencrypted(object EncryptedObject, keyID string) error
+	ListFormValuesToReencrypt(after uuid.UUID, limit int) ([]EncryptedFormValue, error)
+	UpdateFormValueEncryption(value EncryptedFormValue, encryptedValue, keyID string) error
+	ListBulkSendPrefillToReencrypt(after uuid.UUID, limit int) ([]EncryptedBulkSendPrefill, error)
+	UpdateBulkSendPrefillEncryption(row EncryptedBulkSendPrefill, prefill []BulkSendPrefill) error
+
+	// Bulk send operations
+	CreateBulkSendBatch(batch *BulkSendBatch, rows []BulkSendRow) (*BulkSendBatch, error)
+	GetBulkSendBatch(batchID uuid.UUID, userID int) (*BulkSendBatch, error)
+	ProcessBulkSendRows(ctx context.Context) (int, error)
+
+	// Reminder operations
+	RemindDocumentSigner(documentID, signerID uuid.UUID, userID int) (*DocumentSigner, error)
+	SendDueReminders(ctx context.Context) (int, error)
+
+	// Signing session operations (token-based, no user account required)
+	GetSigningSessionByToken(token string) (*SigningSession, error)
+	GetTemplateFieldsForSigner(templateSignerID uuid.UUID) ([]TemplateField, error)
+	MarkDocumentSignerViewed(signerID uuid.UUID, ipAddress, userAgent string) error
+	StartDocumentSigner(signerID uuid.UUID) error
+	CompleteDocumentSigner(signerID uuid.UUID, ipAddress, userAgent string) (*SigningProgress, error)
+	DeclineDocumentSigner(signerID uuid.UUID, reason, ipAddress, userAgent string) error
+	DelegateDocumentSigner(signerID uuid.UUID, email, name, reason, ipAddress, userAgent string) (*DocumentSigner, error)
+
+	// Form submission operations
+	UpsertFormSubmissions(documentSignerID uuid.UUID, submissions []FormSubmission) error
+	GetSignerFormSubmissions(documentSignerID uuid.UUID) ([]FormSubmission, error)
+	GetMissingRequiredFields(documentSignerID uuid.UUID) ([]string, error)
+
+	// Document finalization operations
+	GetDocumentFinalizationInput(documentID uuid.UUID) (*FinalizationInput, error)
+	RecordFinalDocument(documentID uuid.UUID, s3Bucket, s3Key, finalHash, encryptionKeyID string, signature *FinalSignature) error
+	ClaimPendingFinalizations(ctx context.Context, limit int) ([]PendingFinalization, error)
+	ClaimDocumentFinalization(ctx context.Context, documentID uuid.UUID) (*PendingFinalization, error)
+	MarkFinalizationFailed(ctx context.Context, documentID uuid.UUID, lastError string, retryAt *time.Time) error
+
+	// Audit log operations
+	GetDocumentAuditLog(documentID uuid.UUID, userID int) ([]AuditEntry, error)
+
+	// Background maintenance operations
+	WithAdvisoryLock(ctx context.Context, key int64, fn func(ctx context.Context) error) (bool, error)
+	CleanupExpiredInvitations(ctx context.Context) (int, error)
+	CleanupOldNotifications(ctx context.Context) (int, error)
+	ExpireOverdueDocuments(ctx context.Context) (int, error)
+
+	// Email outbox operations
+	ClaimPendingEmails(ctx context.Context, limit int) ([]OutboxEmail, error)
+	MarkEmailSent(ctx context.Context, emailID uuid.UUID) error
+	MarkEmailFailed(ctx context.Context, emailID uuid.UUID, lastError string, retryAt *time.Time) error
 }
 
 type service struct {
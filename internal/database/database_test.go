@@ -2,12 +2,19 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/golang-migrate/migrate/v4"
+	migratepostgres "github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/google/uuid"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/modules/postgres"
 	"github.com/testcontainers/testcontainers-go/wait"
@@ -255,3 +262,830 @@ func TestCreateOrUpdateUser_WithMigrations(t *testing.T) {
 // These tests will also need migrations to be run first.
 // Consider a test suite structure (e.g., using t.Run with subtests) where migrations
 // are run once for the suite.
+
+// migratedDB is a connection to the test database with every migration applied. It is kept apart
+// from dbInstance, which TestClose closes.
+var migratedDB *sql.DB
+
+// migratedService returns a service on migratedDB, opening it and running the migrations on
+// first use
+func migratedService(t *testing.T) *service {
+	t.Helper()
+
+	if migratedDB == nil {
+		db, err := sql.Open("pgx", os.Getenv("DB_STRING"))
+		if err != nil {
+			t.Fatalf("failed to open test database: %v", err)
+		}
+
+		driver, err := migratepostgres.WithInstance(db, &migratepostgres.Config{})
+		if err != nil {
+			t.Fatalf("could not create migration driver: %v", err)
+		}
+		m, err := migrate.NewWithDatabaseInstance("file://../../migrations", "postgres", driver)
+		if err != nil {
+			t.Fatalf("could not create migration instance: %v", err)
+		}
+		if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+			t.Fatalf("could not run migrations: %v", err)
+		}
+
+		migratedDB = db
+	}
+
+	return &service{db: migratedDB}
+}
+
+// testEmail returns an address no other test uses
+func testEmail(name string) string {
+	return fmt.Sprintf("%s-%s@example.com", name, uuid.NewString()[:8])
+}
+
+// signingFixture is a workspace owner with a published template that has one signer role per
+// signer order
+type signingFixture struct {
+	s         *service
+	owner     *User
+	workspace *Workspace
+	template  *Template
+	roles     []TemplateSigner
+}
+
+func newSigningFixture(t *testing.T, roles int, parallel, allowDelegation bool) *signingFixture {
+	t.Helper()
+	f := &signingFixture{s: migratedService(t)}
+
+	f.owner = &User{
+		Provider:   "google",
+		ProviderID: uuid.NewString(),
+		Email:      testEmail("owner"),
+		Name:       "Document Owner",
+	}
+	if err := f.s.CreateOrUpdateUser(f.owner); err != nil {
+		t.Fatalf("CreateOrUpdateUser failed: %v", err)
+	}
+
+	var err error
+	f.workspace, err = f.s.CreateWorkspaceForUser(f.owner.ID, "Signing Tests")
+	if err != nil {
+		t.Fatalf("CreateWorkspaceForUser failed: %v", err)
+	}
+
+	for i := 1; i <= roles; i++ {
+		f.roles = append(f.roles, TemplateSigner{
+			SignerOrder: i,
+			SignerName:  fmt.Sprintf("Signer %d", i),
+			SignerColor: "#3B82F6",
+		})
+	}
+
+	f.template, err = f.s.CreateTemplateWithSignersAndFields(&Template{
+		Name:            "Agreement",
+		S3Bucket:        "test-bucket",
+		S3Key:           "templates/" + uuid.NewString() + ".pdf",
+		PDFHash:         strings.Repeat("a", 64),
+		FileSize:        1024,
+		MimeType:        "application/pdf",
+		TotalPages:      1,
+		CreatedBy:       f.owner.ID,
+		WorkspaceID:     f.workspace.ID,
+		IsActive:        true,
+		Version:         1,
+		ParallelSigning: parallel,
+		AllowDelegation: allowDelegation,
+	}, f.roles, nil)
+	if err != nil {
+		t.Fatalf("CreateTemplateWithSignersAndFields failed: %v", err)
+	}
+
+	return f
+}
+
+// createDocument creates a draft document from the published template with one signer per email,
+// assigned to the template's roles in order
+func (f *signingFixture) createDocument(t *testing.T, emails ...string) *DocumentWithSigners {
+	t.Helper()
+
+	var signers []DocumentSigner
+	for i, email := range emails {
+		signers = append(signers, DocumentSigner{
+			TemplateSignerID: f.roles[i].ID,
+			SignerOrder:      f.roles[i].SignerOrder,
+			SignerEmail:      email,
+			SignerName:       f.roles[i].SignerName,
+		})
+	}
+
+	document, err := f.s.CreateDocumentWithSigners(&Document{
+		TemplateID:           f.template.ID,
+		TemplateVersionID:    *f.template.PublishedVersionID,
+		Name:                 "Agreement for signing",
+		TemplateSnapshotHash: strings.Repeat("b", 64),
+		CreatedBy:            f.owner.ID,
+		WorkspaceID:          f.workspace.ID,
+		ParallelSigning:      f.template.ParallelSigning,
+	}, signers)
+	if err != nil {
+		t.Fatalf("CreateDocumentWithSigners failed: %v", err)
+	}
+
+	return document
+}
+
+// sendDocument creates and sends a document, returning it with the signers that were notified
+func (f *signingFixture) sendDocument(t *testing.T, emails ...string) (*DocumentWithSigners, []DocumentSigner) {
+	t.Helper()
+
+	document := f.createDocument(t, emails...)
+	notified, err := f.s.SendDocument(document.ID, f.owner.ID)
+	if err != nil {
+		t.Fatalf("SendDocument failed: %v", err)
+	}
+
+	return document, notified
+}
+
+// assertAudited fails unless the document's audit log has an entry for every action. Audit
+// inserts are discarded rather than failing the audited change, so an action missing from the
+// document_audit_log_valid_action constraint only shows up here.
+func (f *signingFixture) assertAudited(t *testing.T, documentID uuid.UUID, actions ...string) {
+	t.Helper()
+
+	entries, err := f.s.GetDocumentAuditLog(documentID, f.owner.ID)
+	if err != nil {
+		t.Fatalf("GetDocumentAuditLog failed: %v", err)
+	}
+
+	recorded := make(map[string]bool)
+	for _, entry := range entries {
+		recorded[entry.Action] = true
+	}
+	for _, action := range actions {
+		if !recorded[action] {
+			t.Errorf("audit log has no %s entry", action)
+		}
+	}
+}
+
+func TestCreateDocumentWithSigners(t *testing.T) {
+	f := newSigningFixture(t, 2, false, false)
+	document := f.createDocument(t, testEmail("first"), testEmail("second"))
+
+	if document.Status != "draft" {
+		t.Errorf("expected a draft document, got %s", document.Status)
+	}
+	if len(document.Signers) != 2 {
+		t.Fatalf("expected 2 signers, got %d", len(document.Signers))
+	}
+	first, second := document.Signers[0], document.Signers[1]
+	if first.AccessToken == "" || first.AccessToken == second.AccessToken {
+		t.Errorf("expected distinct access tokens, got %q and %q", first.AccessToken, second.AccessToken)
+	}
+
+	body, err := json.Marshal(document)
+	if err != nil {
+		t.Fatalf("failed to encode document: %v", err)
+	}
+	if strings.Contains(string(body), first.AccessToken) {
+		t.Error("document JSON contains a signer access token")
+	}
+
+	// A draft cannot be signed yet
+	if _, err := f.s.GetSigningSessionByToken(first.AccessToken); err == nil || !strings.Contains(err.Error(), "not been sent") {
+		t.Errorf("expected a draft to refuse signing, got %v", err)
+	}
+
+	// Signer roles must come from the document's template version
+	other := newSigningFixture(t, 1, false, false)
+	_, err = f.s.CreateDocumentWithSigners(&Document{
+		TemplateID:           f.template.ID,
+		TemplateVersionID:    *f.template.PublishedVersionID,
+		Name:                 "Mismatched roles",
+		TemplateSnapshotHash: strings.Repeat("b", 64),
+		CreatedBy:            f.owner.ID,
+		WorkspaceID:          f.workspace.ID,
+	}, []DocumentSigner{{
+		TemplateSignerID: other.roles[0].ID,
+		SignerOrder:      1,
+		SignerEmail:      testEmail("stranger"),
+	}})
+	if err == nil || !strings.Contains(err.Error(), "not part of the template version") {
+		t.Errorf("expected a role from another template to be rejected, got %v", err)
+	}
+
+	f.assertAudited(t, document.ID, "document_created")
+}
+
+func TestSigningSessionByToken(t *testing.T) {
+	f := newSigningFixture(t, 2, true, false)
+	document, notified := f.sendDocument(t, testEmail("first"), testEmail("second"))
+
+	if len(notified) != 2 {
+		t.Fatalf("expected every signer to be notified in parallel mode, got %d", len(notified))
+	}
+	first, second := document.Signers[0], document.Signers[1]
+
+	session, err := f.s.GetSigningSessionByToken(first.AccessToken)
+	if err != nil {
+		t.Fatalf("GetSigningSessionByToken failed: %v", err)
+	}
+	if session.Signer.ID != first.ID || session.Document.ID != document.ID {
+		t.Errorf("token resolved to signer %s of document %s", session.Signer.ID, session.Document.ID)
+	}
+	if session.WaitingOnSignerOrder != nil {
+		t.Errorf("expected no waiting in parallel mode, got order %d", *session.WaitingOnSignerOrder)
+	}
+
+	// Only the selector prefix is indexed; the rest of the token must match too
+	forged := first.AccessToken[:accessTokenSelectorLength] + strings.Repeat("x", len(first.AccessToken)-accessTokenSelectorLength)
+	if _, err := f.s.GetSigningSessionByToken(forged); err == nil {
+		t.Error("expected a token with only a matching selector to be rejected")
+	}
+
+	if _, err := f.s.CompleteDocumentSigner(first.ID, "203.0.113.7", "test"); err == nil {
+		t.Error("expected completing before viewing to fail")
+	}
+
+	if err := f.s.MarkDocumentSignerViewed(first.ID, "203.0.113.7", "test"); err != nil {
+		t.Fatalf("MarkDocumentSignerViewed failed: %v", err)
+	}
+	if err := f.s.StartDocumentSigner(first.ID); err != nil {
+		t.Fatalf("StartDocumentSigner failed: %v", err)
+	}
+
+	progress, err := f.s.CompleteDocumentSigner(first.ID, "203.0.113.7", "test")
+	if err != nil {
+		t.Fatalf("CompleteDocumentSigner failed: %v", err)
+	}
+	if progress.DocumentCompleted {
+		t.Error("expected the document to wait for the second signer")
+	}
+	if _, err := f.s.CompleteDocumentSigner(first.ID, "203.0.113.7", "test"); err == nil {
+		t.Error("expected completing twice to fail")
+	}
+
+	current, err := f.s.GetDocumentByID(document.ID, f.owner.ID)
+	if err != nil {
+		t.Fatalf("GetDocumentByID failed: %v", err)
+	}
+	if current.Status != "in_progress" {
+		t.Errorf("expected the document to be in_progress, got %s", current.Status)
+	}
+
+	if err := f.s.MarkDocumentSignerViewed(second.ID, "203.0.113.8", "test"); err != nil {
+		t.Fatalf("MarkDocumentSignerViewed failed: %v", err)
+	}
+	progress, err = f.s.CompleteDocumentSigner(second.ID, "203.0.113.8", "test")
+	if err != nil {
+		t.Fatalf("CompleteDocumentSigner failed: %v", err)
+	}
+	if !progress.DocumentCompleted {
+		t.Error("expected the last signature to complete the document")
+	}
+
+	f.assertAudited(t, document.ID, "document_sent", "document_viewed", "document_signed", "document_completed")
+}
+
+// queuedEmails counts the emails queued for a recipient with the given template and status
+func (f *signingFixture) queuedEmails(t *testing.T, recipient, template, status string) int {
+	t.Helper()
+
+	var count int
+	err := f.s.db.QueryRow(`
+		SELECT COUNT(*) FROM email_outbox
+		WHERE recipient_email = $1 AND template = $2 AND status = $3`,
+		recipient, template, status).Scan(&count)
+	if err != nil {
+		t.Fatalf("failed to count queued emails: %v", err)
+	}
+	return count
+}
+
+func TestSequentialSigningOrder(t *testing.T) {
+	f := newSigningFixture(t, 2, false, false)
+	document, notified := f.sendDocument(t, testEmail("first"), testEmail("second"))
+	first, second := document.Signers[0], document.Signers[1]
+
+	if len(notified) != 1 || notified[0].ID != first.ID {
+		t.Fatalf("expected only the first signer to be notified, got %d signers", len(notified))
+	}
+	if n := f.queuedEmails(t, second.SignerEmail, EmailSignatureRequest, "pending"); n != 0 {
+		t.Errorf("expected no signing request for the second signer yet, got %d", n)
+	}
+
+	session, err := f.s.GetSigningSessionByToken(second.AccessToken)
+	if err != nil {
+		t.Fatalf("GetSigningSessionByToken failed: %v", err)
+	}
+	if session.WaitingOnSignerOrder == nil || *session.WaitingOnSignerOrder != 1 {
+		t.Errorf("expected the second signer to wait on order 1, got %v", session.WaitingOnSignerOrder)
+	}
+
+	if err := f.s.MarkDocumentSignerViewed(first.ID, "203.0.113.7", "test"); err != nil {
+		t.Fatalf("MarkDocumentSignerViewed failed: %v", err)
+	}
+	progress, err := f.s.CompleteDocumentSigner(first.ID, "203.0.113.7", "test")
+	if err != nil {
+		t.Fatalf("CompleteDocumentSigner failed: %v", err)
+	}
+	if progress.DocumentCompleted || len(progress.NextSigners) != 1 || progress.NextSigners[0].ID != second.ID {
+		t.Fatalf("expected the second signer to be next, got %+v", progress)
+	}
+	if n := f.queuedEmails(t, second.SignerEmail, EmailSignatureRequest, "pending"); n != 1 {
+		t.Errorf("expected one signing request for the second signer, got %d", n)
+	}
+
+	session, err = f.s.GetSigningSessionByToken(second.AccessToken)
+	if err != nil {
+		t.Fatalf("GetSigningSessionByToken failed: %v", err)
+	}
+	if session.WaitingOnSignerOrder != nil {
+		t.Errorf("expected the second signer's turn, still waiting on order %d", *session.WaitingOnSignerOrder)
+	}
+
+	if err := f.s.MarkDocumentSignerViewed(second.ID, "203.0.113.8", "test"); err != nil {
+		t.Fatalf("MarkDocumentSignerViewed failed: %v", err)
+	}
+	progress, err = f.s.CompleteDocumentSigner(second.ID, "203.0.113.8", "test")
+	if err != nil {
+		t.Fatalf("CompleteDocumentSigner failed: %v", err)
+	}
+	if !progress.DocumentCompleted {
+		t.Error("expected the last signature to complete the document")
+	}
+	if n := f.queuedEmails(t, f.owner.Email, EmailDocumentCompleted, "pending"); n != 1 {
+		t.Errorf("expected one completion email to the sender, got %d", n)
+	}
+
+	f.assertAudited(t, document.ID, "document_signed", "document_completed")
+}
+
+// completeDocument sends a document and has every signer sign it
+func (f *signingFixture) completeDocument(t *testing.T, emails ...string) *DocumentWithSigners {
+	t.Helper()
+
+	document, _ := f.sendDocument(t, emails...)
+	for _, signer := range document.Signers {
+		if err := f.s.MarkDocumentSignerViewed(signer.ID, "203.0.113.7", "test"); err != nil {
+			t.Fatalf("MarkDocumentSignerViewed failed: %v", err)
+		}
+		if _, err := f.s.CompleteDocumentSigner(signer.ID, "203.0.113.7", "test"); err != nil {
+			t.Fatalf("CompleteDocumentSigner failed: %v", err)
+		}
+	}
+
+	return document
+}
+
+func TestFinalizationClaimLease(t *testing.T) {
+	ctx := context.Background()
+	f := newSigningFixture(t, 1, false, false)
+	pending := f.createDocument(t, testEmail("pending"))
+	document := f.completeDocument(t, testEmail("signer"))
+
+	claimed, err := f.s.ClaimPendingFinalizations(ctx, 1000)
+	if err != nil {
+		t.Fatalf("ClaimPendingFinalizations failed: %v", err)
+	}
+	var found *PendingFinalization
+	for i := range claimed {
+		switch claimed[i].DocumentID {
+		case document.ID:
+			found = &claimed[i]
+		case pending.ID:
+			t.Error("claimed a document that has not completed")
+		}
+	}
+	if found == nil || found.Attempts != 1 {
+		t.Fatalf("expected the completed document to be claimed on its first attempt, got %+v", found)
+	}
+
+	// The claim hides the document from other workers until its lease runs out
+	again, err := f.s.ClaimDocumentFinalization(ctx, document.ID)
+	if err != nil {
+		t.Fatalf("ClaimDocumentFinalization failed: %v", err)
+	}
+	if again != nil {
+		t.Error("expected a leased document not to be claimed again")
+	}
+
+	retryAt := time.Now().Add(-time.Second)
+	if err := f.s.MarkFinalizationFailed(ctx, document.ID, "render failed", &retryAt); err != nil {
+		t.Fatalf("MarkFinalizationFailed failed: %v", err)
+	}
+	again, err = f.s.ClaimDocumentFinalization(ctx, document.ID)
+	if err != nil {
+		t.Fatalf("ClaimDocumentFinalization failed: %v", err)
+	}
+	if again == nil || again.Attempts != 2 {
+		t.Fatalf("expected a due retry to be claimed on its second attempt, got %+v", again)
+	}
+
+	err = f.s.RecordFinalDocument(document.ID, "test-bucket", "documents/final.pdf", strings.Repeat("c", 64), "", nil)
+	if err != nil {
+		t.Fatalf("RecordFinalDocument failed: %v", err)
+	}
+	err = f.s.RecordFinalDocument(document.ID, "test-bucket", "documents/final.pdf", strings.Repeat("c", 64), "", nil)
+	if err == nil || !strings.Contains(err.Error(), "already finalized") {
+		t.Errorf("expected a second final document to be rejected, got %v", err)
+	}
+
+	// A failure reported after another worker finished must not schedule a retry
+	if err := f.s.MarkFinalizationFailed(ctx, document.ID, "late failure", &retryAt); err != nil {
+		t.Fatalf("MarkFinalizationFailed failed: %v", err)
+	}
+	again, err = f.s.ClaimDocumentFinalization(ctx, document.ID)
+	if err != nil {
+		t.Fatalf("ClaimDocumentFinalization failed: %v", err)
+	}
+	if again != nil {
+		t.Error("expected a finalized document not to be claimed")
+	}
+
+	f.assertAudited(t, document.ID, "document_finalized")
+}
+
+// claimEmailsTo claims every due email and returns those sent to recipient
+func (f *signingFixture) claimEmailsTo(t *testing.T, recipient string) []OutboxEmail {
+	t.Helper()
+
+	claimed, err := f.s.ClaimPendingEmails(context.Background(), 1000)
+	if err != nil {
+		t.Fatalf("ClaimPendingEmails failed: %v", err)
+	}
+
+	var emails []OutboxEmail
+	for _, email := range claimed {
+		if email.RecipientEmail == recipient {
+			emails = append(emails, email)
+		}
+	}
+	return emails
+}
+
+func TestEmailOutboxClaim(t *testing.T) {
+	ctx := context.Background()
+	f := newSigningFixture(t, 1, false, false)
+	document, _ := f.sendDocument(t, testEmail("signer"))
+	signer := document.Signers[0]
+
+	emails := f.claimEmailsTo(t, signer.SignerEmail)
+	if len(emails) != 1 {
+		t.Fatalf("expected one signing request, got %d", len(emails))
+	}
+	email := emails[0]
+	if email.Template != EmailSignatureRequest || email.Attempts != 1 {
+		t.Errorf("expected a first attempt at %s, got %s attempt %d", EmailSignatureRequest, email.Template, email.Attempts)
+	}
+	if email.Data["access_token"] != signer.AccessToken {
+		t.Error("expected the signing request to carry the signer's access token")
+	}
+
+	// The claim hides the email from other workers until its lease runs out
+	if emails := f.claimEmailsTo(t, signer.SignerEmail); len(emails) != 0 {
+		t.Errorf("expected a leased email not to be claimed again, got %d", len(emails))
+	}
+
+	retryAt := time.Now().Add(-time.Second)
+	if err := f.s.MarkEmailFailed(ctx, email.ID, "connection refused", &retryAt); err != nil {
+		t.Fatalf("MarkEmailFailed failed: %v", err)
+	}
+	emails = f.claimEmailsTo(t, signer.SignerEmail)
+	if len(emails) != 1 || emails[0].Attempts != 2 {
+		t.Fatalf("expected a due retry to be claimed on its second attempt, got %+v", emails)
+	}
+
+	// Giving up leaves the email failed
+	if err := f.s.MarkEmailFailed(ctx, email.ID, "mailbox unavailable", nil); err != nil {
+		t.Fatalf("MarkEmailFailed failed: %v", err)
+	}
+	if n := f.queuedEmails(t, signer.SignerEmail, EmailSignatureRequest, "failed"); n != 1 {
+		t.Errorf("expected the email to have failed, got %d failed", n)
+	}
+	if emails := f.claimEmailsTo(t, signer.SignerEmail); len(emails) != 0 {
+		t.Errorf("expected a failed email not to be claimed, got %d", len(emails))
+	}
+
+	if err := f.s.MarkEmailSent(ctx, email.ID); err != nil {
+		t.Fatalf("MarkEmailSent failed: %v", err)
+	}
+	if n := f.queuedEmails(t, signer.SignerEmail, EmailSignatureRequest, "sent"); n != 1 {
+		t.Errorf("expected the email to be sent, got %d sent", n)
+	}
+}
+
+// reminderCount returns how many reminders a signer has been sent
+func (f *signingFixture) reminderCount(t *testing.T, signerID uuid.UUID) int {
+	t.Helper()
+
+	var count int
+	err := f.s.db.QueryRow(`SELECT reminder_count FROM document_signers WHERE id = $1`, signerID).Scan(&count)
+	if err != nil {
+		t.Fatalf("failed to get reminder count: %v", err)
+	}
+	return count
+}
+
+func TestSendDueReminders(t *testing.T) {
+	ctx := context.Background()
+	f := newSigningFixture(t, 2, false, false)
+	document, _ := f.sendDocument(t, testEmail("first"), testEmail("second"))
+	first, second := document.Signers[0], document.Signers[1]
+
+	// Remind after one day and every two days after that, sent three days ago
+	_, err := f.s.db.Exec(`
+		UPDATE documents
+		SET reminder_first_after_days = 1, reminder_repeat_days = 2, sent_at = NOW() - INTERVAL '3 days'
+		WHERE id = $1`, document.ID)
+	if err != nil {
+		t.Fatalf("failed to set reminder policy: %v", err)
+	}
+
+	if _, err := f.s.SendDueReminders(ctx); err != nil {
+		t.Fatalf("SendDueReminders failed: %v", err)
+	}
+	if n := f.reminderCount(t, first.ID); n != 1 {
+		t.Errorf("expected the first signer to be reminded once, got %d", n)
+	}
+	if n := f.reminderCount(t, second.ID); n != 0 {
+		t.Errorf("expected the second signer to wait for their turn, got %d reminders", n)
+	}
+
+	if _, err := f.s.SendDueReminders(ctx); err != nil {
+		t.Fatalf("SendDueReminders failed: %v", err)
+	}
+	if n := f.reminderCount(t, first.ID); n != 1 {
+		t.Errorf("expected no repeat reminder before two days, got %d reminders", n)
+	}
+
+	// A signer locked by another transaction is skipped rather than waited on
+	_, err = f.s.db.Exec(`
+		UPDATE document_signers SET last_reminded_at = NOW() - INTERVAL '3 days' WHERE id = $1`, first.ID)
+	if err != nil {
+		t.Fatalf("failed to backdate reminder: %v", err)
+	}
+	tx, err := f.s.db.Begin()
+	if err != nil {
+		t.Fatalf("failed to start transaction: %v", err)
+	}
+	if _, err := tx.Exec(`SELECT 1 FROM document_signers WHERE id = $1 FOR UPDATE`, first.ID); err != nil {
+		tx.Rollback()
+		t.Fatalf("failed to lock signer: %v", err)
+	}
+
+	lockedCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	_, err = f.s.SendDueReminders(lockedCtx)
+	cancel()
+	if err != nil {
+		tx.Rollback()
+		t.Fatalf("SendDueReminders blocked on a locked signer: %v", err)
+	}
+	if n := f.reminderCount(t, first.ID); n != 1 {
+		t.Errorf("expected a locked signer to be skipped, got %d reminders", n)
+	}
+	tx.Rollback()
+
+	if _, err := f.s.SendDueReminders(ctx); err != nil {
+		t.Fatalf("SendDueReminders failed: %v", err)
+	}
+	if n := f.reminderCount(t, first.ID); n != 2 {
+		t.Errorf("expected the repeat reminder once the lock was released, got %d reminders", n)
+	}
+	if n := f.queuedEmails(t, first.SignerEmail, EmailSigningReminder, "pending"); n != 2 {
+		t.Errorf("expected two reminder emails, got %d", n)
+	}
+
+	// Manual reminders respect the cooldown and the signing order
+	var rateLimited *ReminderRateLimitError
+	if _, err := f.s.RemindDocumentSigner(document.ID, first.ID, f.owner.ID); !errors.As(err, &rateLimited) {
+		t.Errorf("expected a reminder within the cooldown to be rate limited, got %v", err)
+	}
+	if _, err := f.s.RemindDocumentSigner(document.ID, second.ID, f.owner.ID); err == nil || !strings.Contains(err.Error(), "waiting on a previous signer") {
+		t.Errorf("expected the second signer to be waiting, got %v", err)
+	}
+
+	f.assertAudited(t, document.ID, "reminder_sent")
+}
+
+func TestVoidDocument(t *testing.T) {
+	f := newSigningFixture(t, 2, true, false)
+	document, _ := f.sendDocument(t, testEmail("viewer"), testEmail("untouched"))
+	viewer, untouched := document.Signers[0], document.Signers[1]
+
+	if err := f.s.MarkDocumentSignerViewed(viewer.ID, "203.0.113.7", "test"); err != nil {
+		t.Fatalf("MarkDocumentSignerViewed failed: %v", err)
+	}
+
+	acted, err := f.s.VoidDocument(document.ID, f.owner.ID, "Terms changed")
+	if err != nil {
+		t.Fatalf("VoidDocument failed: %v", err)
+	}
+	if len(acted) != 1 || acted[0].ID != viewer.ID {
+		t.Errorf("expected only the signer who opened the document to be notified, got %d signers", len(acted))
+	}
+
+	// Signing links stop working and queued requests carrying them are dropped
+	for _, signer := range document.Signers {
+		if _, err := f.s.GetSigningSessionByToken(signer.AccessToken); err == nil {
+			t.Errorf("expected the access token of %s to be revoked", signer.SignerEmail)
+		}
+	}
+	if n := f.queuedEmails(t, untouched.SignerEmail, EmailSignatureRequest, "pending"); n != 0 {
+		t.Errorf("expected queued signing requests to be dropped, got %d pending", n)
+	}
+	if n := f.queuedEmails(t, viewer.SignerEmail, EmailDocumentVoided, "pending"); n != 1 {
+		t.Errorf("expected a void notice to the signer who opened the document, got %d", n)
+	}
+	if n := f.queuedEmails(t, untouched.SignerEmail, EmailDocumentVoided, "pending"); n != 0 {
+		t.Errorf("expected no void notice to a signer who never opened the document, got %d", n)
+	}
+
+	voided, err := f.s.GetDocumentByID(document.ID, f.owner.ID)
+	if err != nil {
+		t.Fatalf("GetDocumentByID failed: %v", err)
+	}
+	if voided.Status != "cancelled" || voided.VoidReason == nil || *voided.VoidReason != "Terms changed" {
+		t.Errorf("expected a cancelled document with its reason, got %s", voided.Status)
+	}
+
+	if _, err := f.s.VoidDocument(document.ID, f.owner.ID, "Again"); err == nil || !strings.Contains(err.Error(), "can no longer be voided") {
+		t.Errorf("expected voiding twice to fail, got %v", err)
+	}
+
+	f.assertAudited(t, document.ID, "document_cancelled")
+}
+
+func TestReassignAndDelegateSigner(t *testing.T) {
+	f := newSigningFixture(t, 2, true, true)
+	document, _ := f.sendDocument(t, testEmail("original"), testEmail("other"))
+	original, other := document.Signers[0], document.Signers[1]
+
+	if _, err := f.s.ReassignDocumentSigner(document.ID, original.ID, f.owner.ID, other.SignerEmail, "Other"); err == nil {
+		t.Error("expected reassigning to an existing signer to fail")
+	}
+
+	reassignedEmail := testEmail("reassigned")
+	reassigned, err := f.s.ReassignDocumentSigner(document.ID, original.ID, f.owner.ID, reassignedEmail, "Reassigned")
+	if err != nil {
+		t.Fatalf("ReassignDocumentSigner failed: %v", err)
+	}
+	if reassigned.AccessToken == "" || reassigned.AccessToken == original.AccessToken {
+		t.Fatal("expected reassignment to rotate the access token")
+	}
+	if _, err := f.s.GetSigningSessionByToken(original.AccessToken); err == nil {
+		t.Error("expected the previous signer's link to stop working")
+	}
+	if _, err := f.s.GetSigningSessionByToken(reassigned.AccessToken); err != nil {
+		t.Errorf("expected the new signer's link to work, got %v", err)
+	}
+	if n := f.queuedEmails(t, original.SignerEmail, EmailSignatureRequest, "pending"); n != 0 {
+		t.Errorf("expected the previous signer's queued request to be dropped, got %d pending", n)
+	}
+	if n := f.queuedEmails(t, reassignedEmail, EmailSignatureRequest, "pending"); n != 1 {
+		t.Errorf("expected a signing request to the new signer, got %d", n)
+	}
+
+	// Once started, only the signer themselves can hand the document on
+	if err := f.s.StartDocumentSigner(reassigned.ID); err != nil {
+		t.Fatalf("StartDocumentSigner failed: %v", err)
+	}
+	if _, err := f.s.ReassignDocumentSigner(document.ID, reassigned.ID, f.owner.ID, testEmail("late"), "Late"); err == nil {
+		t.Error("expected reassigning a signer who started to fail")
+	}
+
+	delegate, err := f.s.DelegateDocumentSigner(reassigned.ID, testEmail("delegate"), "Delegate", "On leave", "203.0.113.7", "test")
+	if err != nil {
+		t.Fatalf("DelegateDocumentSigner failed: %v", err)
+	}
+	if delegate.Status != "pending" || delegate.AccessToken == reassigned.AccessToken {
+		t.Errorf("expected the delegate to start over with a new token, got status %s", delegate.Status)
+	}
+	if _, err := f.s.GetSigningSessionByToken(reassigned.AccessToken); err == nil {
+		t.Error("expected the delegating signer's link to stop working")
+	}
+
+	f.assertAudited(t, document.ID, "signer_reassigned", "signer_delegated")
+}
+
+func TestDeclineDocumentSigner(t *testing.T) {
+	f := newSigningFixture(t, 2, true, false)
+	document, _ := f.sendDocument(t, testEmail("decliner"), testEmail("other"))
+	decliner, other := document.Signers[0], document.Signers[1]
+
+	if _, err := f.s.DelegateDocumentSigner(decliner.ID, testEmail("delegate"), "", "", "", ""); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("expected delegation to be refused by the template, got %v", err)
+	}
+
+	if err := f.s.DeclineDocumentSigner(decliner.ID, "Wrong amount", "203.0.113.7", "test"); err != nil {
+		t.Fatalf("DeclineDocumentSigner failed: %v", err)
+	}
+	if err := f.s.DeclineDocumentSigner(decliner.ID, "Again", "203.0.113.7", "test"); err == nil {
+		t.Error("expected declining twice to fail")
+	}
+
+	// Declining ends the document for every signer
+	if _, err := f.s.GetSigningSessionByToken(other.AccessToken); err == nil || !strings.Contains(err.Error(), "declined") {
+		t.Errorf("expected the other signer to see the document declined, got %v", err)
+	}
+	if n := f.queuedEmails(t, other.SignerEmail, EmailSignatureRequest, "pending"); n != 0 {
+		t.Errorf("expected queued signing requests to be dropped, got %d pending", n)
+	}
+	if n := f.queuedEmails(t, f.owner.Email, EmailDocumentDeclined, "pending"); n != 1 {
+		t.Errorf("expected the sender to be told, got %d emails", n)
+	}
+
+	f.assertAudited(t, document.ID, "signer_declined")
+}
+
+func TestPublishTemplateDraft(t *testing.T) {
+	f := newSigningFixture(t, 1, false, false)
+	firstVersionID := *f.template.PublishedVersionID
+	pinned := f.createDocument(t, testEmail("pinned"))
+
+	if _, err := f.s.PublishTemplateDraft(f.template.ID, f.owner.ID); err == nil || !strings.Contains(err.Error(), "no draft") {
+		t.Errorf("expected publishing without a draft to fail, got %v", err)
+	}
+
+	// Fields may reference the published signers; they move to the draft's copies
+	draft, err := f.s.ReplaceTemplateFields(f.template.ID, []TemplateField{{
+		SignerID:        f.roles[0].ID,
+		FieldName:       "signature",
+		FieldType:       "signature",
+		PositionData:    `{"x": 0.1, "y": 0.1, "width": 0.2, "height": 0.05, "page": 1}`,
+		ValidationRules: "{}",
+		Required:        true,
+	}}, f.owner.ID)
+	if err != nil {
+		t.Fatalf("ReplaceTemplateFields failed: %v", err)
+	}
+	if draft.Status != "draft" || draft.Version != 2 {
+		t.Fatalf("expected draft version 2, got %s version %d", draft.Status, draft.Version)
+	}
+
+	editable, err := f.s.GetEditableTemplateVersion(f.template.ID, f.owner.ID)
+	if err != nil {
+		t.Fatalf("GetEditableTemplateVersion failed: %v", err)
+	}
+	if editable.ID != draft.ID || len(editable.Fields) != 1 || len(editable.Signers) != 1 {
+		t.Fatalf("expected the draft with its field and signer, got version %d", editable.Version)
+	}
+	if editable.Fields[0].SignerID != editable.Signers[0].ID {
+		t.Error("expected the field to move to the draft's signer")
+	}
+
+	// Editing the draft leaves the published version alone
+	published, err := f.s.GetTemplateWithSignersAndFields(f.template.ID, f.owner.ID)
+	if err != nil {
+		t.Fatalf("GetTemplateWithSignersAndFields failed: %v", err)
+	}
+	if *published.PublishedVersionID != firstVersionID || len(published.Fields) != 0 {
+		t.Errorf("expected version 1 without fields to stay published, got %d fields", len(published.Fields))
+	}
+
+	version, err := f.s.PublishTemplateDraft(f.template.ID, f.owner.ID)
+	if err != nil {
+		t.Fatalf("PublishTemplateDraft failed: %v", err)
+	}
+	if version.ID != draft.ID || version.Status != "published" {
+		t.Errorf("expected the draft to be published, got %s", version.Status)
+	}
+
+	versions, err := f.s.ListTemplateVersions(f.template.ID, f.owner.ID)
+	if err != nil {
+		t.Fatalf("ListTemplateVersions failed: %v", err)
+	}
+	statuses := make(map[int]string)
+	for _, v := range versions {
+		statuses[v.Version] = v.Status
+	}
+	if statuses[1] != "superseded" || statuses[2] != "published" {
+		t.Errorf("expected version 1 superseded and version 2 published, got %v", statuses)
+	}
+
+	// Documents stay on the version they were created from
+	document, err := f.s.GetDocumentByID(pinned.ID, f.owner.ID)
+	if err != nil {
+		t.Fatalf("GetDocumentByID failed: %v", err)
+	}
+	if document.TemplateVersionID != firstVersionID {
+		t.Error("expected the document to stay on version 1")
+	}
+
+	// A draft can be discarded, leaving the published version editable
+	if _, err := f.s.ReplaceTemplateFields(f.template.ID, nil, f.owner.ID); err != nil {
+		t.Fatalf("ReplaceTemplateFields failed: %v", err)
+	}
+	if _, err := f.s.DiscardTemplateDraft(f.template.ID, f.owner.ID); err != nil {
+		t.Fatalf("DiscardTemplateDraft failed: %v", err)
+	}
+	editable, err = f.s.GetEditableTemplateVersion(f.template.ID, f.owner.ID)
+	if err != nil {
+		t.Fatalf("GetEditableTemplateVersion failed: %v", err)
+	}
+	if editable.ID != draft.ID || len(editable.Fields) != 1 {
+		t.Errorf("expected the published version 2 to be editable again, got version %d", editable.Version)
+	}
+	if _, err := f.s.DiscardTemplateDraft(f.template.ID, f.owner.ID); err == nil || !strings.Contains(err.Error(), "no draft") {
+		t.Errorf("expected discarding without a draft to fail, got %v", err)
+	}
+}
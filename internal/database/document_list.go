@@ -0,0 +1,237 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultDocumentListLimit = 25
+	MaxDocumentListLimit     = 100
+)
+
+// documentSortColumns are the columns a document list can be ordered by. Ties are broken by id
+// so every row has a unique position for the cursor.
+var documentSortColumns = map[string]string{
+	"created_at": "d.created_at",
+	"updated_at": "d.updated_at",
+	"name":       "d.name",
+}
+
+// DocumentListFilter narrows and orders a workspace's documents. Zero values mean "no filter".
+type DocumentListFilter struct {
+	Statuses    []string
+	TemplateID  *uuid.UUID
+	CreatedBy   *int
+	SignerEmail string
+	CreatedFrom *time.Time // inclusive
+	CreatedTo   *time.Time // exclusive
+	Search      string     // case-insensitive match anywhere in the document name
+	SortBy      string     // created_at (default), updated_at or name
+	Ascending   bool       // descending by default
+	Cursor      string     // NextCursor from the previous page
+	Limit       int
+}
+
+// DocumentListItem is a document with what a list view needs to show about it
+type DocumentListItem struct {
+	Document
+	TemplateName string `json:"template_name"`
+	CreatorName  string `json:"creator_name"`
+	CreatorEmail string `json:"creator_email"`
+	SignerCount  int    `json:"signer_count"`
+	SignedCount  int    `json:"signed_count"`
+}
+
+// DocumentList is one page of documents. NextCursor is empty on the last page.
+type DocumentList struct {
+	Documents  []DocumentListItem `json:"documents"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+// documentCursor is the position of the last document on a page. It records the sort it was
+// issued for so it cannot be replayed against a different ordering.
+type documentCursor struct {
+	SortBy    string    `json:"s"`
+	Ascending bool      `json:"a"`
+	Value     string    `json:"v"`
+	ID        uuid.UUID `json:"i"`
+}
+
+func encodeDocumentCursor(cursor documentCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeDocumentCursor(encoded string) (*documentCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var cursor documentCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &cursor, nil
+}
+
+// ListWorkspaceDocuments returns a page of a workspace's documents with each one's signing
+// progress. Pagination is keyset based, so pages stay stable while documents are being added.
+func (s *service) ListWorkspaceDocuments(workspaceID uuid.UUID, userID int, filter DocumentListFilter) (*DocumentList, error) {
+	// First check if user has access to this workspace
+	accessQuery := `
+		SELECT role FROM workspace_memberships
+		WHERE workspace_id = $1 AND user_id = $2 AND status = 'active'`
+
+	var role string
+	err := s.db.QueryRow(accessQuery, workspaceID, userID).Scan(&role)
+	if err != nil {
+		return nil, fmt.Errorf("user does not have access to this workspace")
+	}
+
+	if filter.SortBy == "" {
+		filter.SortBy = "created_at"
+	}
+	sortColumn, ok := documentSortColumns[filter.SortBy]
+	if !ok {
+		return nil, fmt.Errorf("invalid sort field '%s'", filter.SortBy)
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultDocumentListLimit
+	}
+	if filter.Limit > MaxDocumentListLimit {
+		filter.Limit = MaxDocumentListLimit
+	}
+
+	args := []interface{}{workspaceID}
+	param := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	conditions := []string{"d.workspace_id = $1"}
+	if len(filter.Statuses) > 0 {
+		conditions = append(conditions, "d.status = ANY("+param(filter.Statuses)+")")
+	}
+	if filter.TemplateID != nil {
+		conditions = append(conditions, "d.template_id = "+param(*filter.TemplateID))
+	}
+	if filter.CreatedBy != nil {
+		conditions = append(conditions, "d.created_by = "+param(*filter.CreatedBy))
+	}
+	if filter.SignerEmail != "" {
+		// Signer emails are stored lower-cased, so this can use idx_document_signers_email
+		conditions = append(conditions, `EXISTS (
+			SELECT 1 FROM document_signers es
+			WHERE es.document_id = d.id AND es.signer_email = `+param(strings.ToLower(filter.SignerEmail))+`)`)
+	}
+	if filter.CreatedFrom != nil {
+		conditions = append(conditions, "d.created_at >= "+param(filter.CreatedFrom.UTC()))
+	}
+	if filter.CreatedTo != nil {
+		conditions = append(conditions, "d.created_at < "+param(filter.CreatedTo.UTC()))
+	}
+	if filter.Search != "" {
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(filter.Search)
+		conditions = append(conditions, "d.name ILIKE "+param("%"+escaped+"%"))
+	}
+
+	direction, comparison := "DESC", "<"
+	if filter.Ascending {
+		direction, comparison = "ASC", ">"
+	}
+
+	if filter.Cursor != "" {
+		cursor, err := decodeDocumentCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.SortBy != filter.SortBy || cursor.Ascending != filter.Ascending {
+			return nil, fmt.Errorf("invalid cursor: it was issued for a different sort order")
+		}
+
+		var value interface{} = cursor.Value
+		if filter.SortBy != "name" {
+			timestamp, err := time.Parse(time.RFC3339Nano, cursor.Value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid cursor")
+			}
+			value = timestamp
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s, d.id) %s (%s, %s)",
+			sortColumn, comparison, param(value), param(cursor.ID)))
+	}
+
+	// One extra row tells us whether there is another page
+	query := fmt.Sprintf(`
+		SELECT d.id, d.template_id, d.template_version_id, d.name, d.created_by, d.workspace_id, d.status, d.expires_at,
+			   d.sent_at, d.created_at, d.updated_at, d.completed_at, d.parallel_signing,
+			   d.reminder_first_after_days, d.reminder_repeat_days, d.void_reason, d.voided_at, d.voided_by,
+			   t.name, COALESCE(u.name, ''), u.email, progress.signer_count, progress.signed_count
+		FROM documents d
+		JOIN templates t ON d.template_id = t.id
+		JOIN users u ON d.created_by = u.id
+		CROSS JOIN LATERAL (
+			SELECT COUNT(*) AS signer_count,
+				   COUNT(*) FILTER (WHERE ps.status = 'completed') AS signed_count
+			FROM document_signers ps
+			WHERE ps.document_id = d.id
+		) progress
+		WHERE %s
+		ORDER BY %s %s, d.id %s
+		LIMIT %s`,
+		strings.Join(conditions, " AND "), sortColumn, direction, direction, param(filter.Limit+1))
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list documents: %w", err)
+	}
+	defer rows.Close()
+
+	list := &DocumentList{Documents: []DocumentListItem{}}
+	for rows.Next() {
+		var item DocumentListItem
+		document := &item.Document
+		err := rows.Scan(
+			&document.ID, &document.TemplateID, &document.TemplateVersionID, &document.Name, &document.CreatedBy,
+			&document.WorkspaceID, &document.Status, &document.ExpiresAt, &document.SentAt,
+			&document.CreatedAt, &document.UpdatedAt, &document.CompletedAt, &document.ParallelSigning,
+			&document.ReminderFirstAfterDays, &document.ReminderRepeatDays,
+			&document.VoidReason, &document.VoidedAt, &document.VoidedBy,
+			&item.TemplateName, &item.CreatorName, &item.CreatorEmail,
+			&item.SignerCount, &item.SignedCount,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan document: %w", err)
+		}
+		list.Documents = append(list.Documents, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	if len(list.Documents) > filter.Limit {
+		list.Documents = list.Documents[:filter.Limit]
+		last := list.Documents[len(list.Documents)-1]
+
+		cursor := documentCursor{SortBy: filter.SortBy, Ascending: filter.Ascending, ID: last.ID}
+		switch filter.SortBy {
+		case "name":
+			cursor.Value = last.Name
+		case "updated_at":
+			cursor.Value = last.UpdatedAt.Format(time.RFC3339Nano)
+		default:
+			cursor.Value = last.CreatedAt.Format(time.RFC3339Nano)
+		}
+		list.NextCursor = encodeDocumentCursor(cursor)
+	}
+
+	return list, nil
+}
@@ -0,0 +1,338 @@
+package database
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Document is a template instantiated for a specific set of recipients
+type Document struct {
+	ID                   uuid.UUID  `json:"id"`
+	TemplateID           uuid.UUID  `json:"template_id"`
+	TemplateVersionID    uuid.UUID  `json:"template_version_id"` // the template version it was created from
+	Name                 string     `json:"name"`
+	S3Bucket             *string    `json:"s3_bucket,omitempty"`
+	S3Key                *string    `json:"s3_key,omitempty"`
+	TemplateSnapshotHash string     `json:"template_snapshot_hash"`
+	FinalDocumentHash    *string    `json:"final_document_hash,omitempty"`
+	CreatedBy            int        `json:"created_by"`
+	WorkspaceID          uuid.UUID  `json:"workspace_id"`
+	Status               string     `json:"status"` // draft, scheduled, sent, in_progress, completed, expired, cancelled, declined
+	ExpiresAt            *time.Time `json:"expires_at,omitempty"`
+	SentAt               *time.Time `json:"sent_at,omitempty"`
+	CreatedAt            time.Time  `json:"created_at"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+	CompletedAt          *time.Time `json:"completed_at,omitempty"`
+	ParallelSigning      bool       `json:"parallel_signing"` // copied from the template at creation
+	// Reminder policy; a nil ReminderFirstAfterDays means no automatic reminders
+	ReminderFirstAfterDays *int `json:"reminder_first_after_days,omitempty"`
+	ReminderRepeatDays     *int `json:"reminder_repeat_days,omitempty"`
+	// Set when the document was voided
+	VoidReason *string    `json:"void_reason,omitempty"`
+	VoidedAt   *time.Time `json:"voided_at,omitempty"`
+	VoidedBy   *int       `json:"voided_by,omitempty"`
+}
+
+// DocumentSigner is a real person assigned to one of the template's signer roles
+type DocumentSigner struct {
+	ID               uuid.UUID  `json:"id"`
+	DocumentID       uuid.UUID  `json:"document_id"`
+	TemplateSignerID uuid.UUID  `json:"template_signer_id"`
+	SignerOrder      int        `json:"signer_order"`
+	SignerEmail      string     `json:"signer_email"`
+	SignerName       string     `json:"signer_name"`
+	AccessToken      string     `json:"-"`      // a signing credential, only ever sent to the signer by email
+	Status           string     `json:"status"` // pending, viewed, in_progress, completed, declined
+	ViewedAt         *time.Time `json:"viewed_at,omitempty"`
+	CompletedAt      *time.Time `json:"completed_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	LastRemindedAt   *time.Time `json:"last_reminded_at,omitempty"`
+	DeclinedAt       *time.Time `json:"declined_at,omitempty"`
+	DeclineReason    *string    `json:"decline_reason,omitempty"`
+}
+
+type DocumentWithSigners struct {
+	Document
+	Signers []DocumentSigner `json:"signers"`
+}
+
+// CreateDocumentWithSigners creates a draft document and its signers in a single transaction.
+// Access tokens are generated here for any signer that does not already have one.
+func (s *service) CreateDocumentWithSigners(document *Document, signers []DocumentSigner) (*DocumentWithSigners, error) {
+	// Check if user has permission to create documents (member or higher)
+	permissionQuery := `
+		SELECT role FROM workspace_memberships
+		WHERE workspace_id = $1 AND user_id = $2 AND status = 'active'`
+
+	var role string
+	err := s.db.QueryRow(permissionQuery, document.WorkspaceID, document.CreatedBy).Scan(&role)
+	if err != nil {
+		return nil, fmt.Errorf("user does not have access to this workspace")
+	}
+
+	if role == "viewer" {
+		return nil, fmt.Errorf("insufficient permissions to create documents")
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err = insertDocumentWithSigners(tx, document, signers); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return &DocumentWithSigners{
+		Document: *document,
+		Signers:  signers,
+	}, nil
+}
+
+// insertDocumentWithSigners inserts a draft document and its signers inside tx, generating access
+// tokens for signers that do not already have one.
+func insertDocumentWithSigners(tx *sql.Tx, document *Document, signers []DocumentSigner) error {
+	// Insert document
+	documentQuery := `
+		INSERT INTO documents (template_id, template_version_id, name, template_snapshot_hash, created_by,
+			workspace_id, status, expires_at, parallel_signing, reminder_first_after_days,
+			reminder_repeat_days, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, 'draft', $7, $8, $9, $10, NOW(), NOW())
+		RETURNING id, status, created_at, updated_at`
+
+	err := tx.QueryRow(
+		documentQuery,
+		document.TemplateID,
+		document.TemplateVersionID,
+		document.Name,
+		document.TemplateSnapshotHash,
+		document.CreatedBy,
+		document.WorkspaceID,
+		document.ExpiresAt,
+		document.ParallelSigning,
+		document.ReminderFirstAfterDays,
+		document.ReminderRepeatDays,
+	).Scan(&document.ID, &document.Status, &document.CreatedAt, &document.UpdatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create document: %w", err)
+	}
+
+	// Insert signers; each must be one of the roles of the document's template version
+	signerQuery := `
+		INSERT INTO document_signers (document_id, template_signer_id, signer_order, signer_email,
+			signer_name, access_token, status, created_at)
+		SELECT $1, ts.id, $3, $4, $5, $6, 'pending', NOW()
+		FROM template_signers ts
+		WHERE ts.id = $2 AND ts.template_version_id = $7
+		RETURNING id, status, created_at`
+
+	for i := range signers {
+		signers[i].DocumentID = document.ID
+		if signers[i].AccessToken == "" {
+			signers[i].AccessToken, err = generateAccessToken()
+			if err != nil {
+				return err
+			}
+		}
+
+		err = tx.QueryRow(
+			signerQuery,
+			signers[i].DocumentID,
+			signers[i].TemplateSignerID,
+			signers[i].SignerOrder,
+			signers[i].SignerEmail,
+			signers[i].SignerName,
+			signers[i].AccessToken,
+			document.TemplateVersionID,
+		).Scan(&signers[i].ID, &signers[i].Status, &signers[i].CreatedAt)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("signer role for %s is not part of the template version", signers[i].SignerEmail)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create document signer %s: %w", signers[i].SignerEmail, err)
+		}
+	}
+
+	recordAudit(tx, AuditEntry{
+		DocumentID: &document.ID,
+		TemplateID: &document.TemplateID,
+		UserID:     &document.CreatedBy,
+		Action:     "document_created",
+		Details: map[string]interface{}{
+			"document_name":       document.Name,
+			"signer_count":        len(signers),
+			"template_version_id": document.TemplateVersionID,
+		},
+	})
+
+	return nil
+}
+
+// GetDocumentByID retrieves a document by ID with workspace access check
+func (s *service) GetDocumentByID(documentID uuid.UUID, userID int) (*Document, error) {
+	document := &Document{}
+	query := `
+		SELECT d.id, d.template_id, d.template_version_id, d.name, d.s3_bucket, d.s3_key, d.template_snapshot_hash,
+			   d.final_document_hash, d.created_by, d.workspace_id, d.status, d.expires_at,
+			   d.sent_at, d.created_at, d.updated_at, d.completed_at, d.parallel_signing,
+			   d.reminder_first_after_days, d.reminder_repeat_days, d.void_reason, d.voided_at, d.voided_by
+		FROM documents d
+		JOIN workspace_memberships wm ON d.workspace_id = wm.workspace_id
+		WHERE d.id = $1 AND wm.user_id = $2 AND wm.status = 'active'`
+
+	err := s.db.QueryRow(query, documentID, userID).Scan(
+		&document.ID, &document.TemplateID, &document.TemplateVersionID, &document.Name, &document.S3Bucket,
+		&document.S3Key, &document.TemplateSnapshotHash, &document.FinalDocumentHash,
+		&document.CreatedBy, &document.WorkspaceID, &document.Status, &document.ExpiresAt,
+		&document.SentAt, &document.CreatedAt, &document.UpdatedAt, &document.CompletedAt,
+		&document.ParallelSigning, &document.ReminderFirstAfterDays, &document.ReminderRepeatDays,
+		&document.VoidReason, &document.VoidedAt, &document.VoidedBy,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("document not found or access denied: %w", err)
+	}
+
+	return document, nil
+}
+
+// GetDocumentSigners retrieves all signers for a document
+func (s *service) GetDocumentSigners(documentID uuid.UUID, userID int) ([]DocumentSigner, error) {
+	// First verify user has access to this document
+	_, err := s.GetDocumentByID(documentID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.documentSigners(documentID)
+}
+
+// documentSigners returns a document's signers in signing order without an access check
+func (s *service) documentSigners(documentID uuid.UUID) ([]DocumentSigner, error) {
+	query := `
+		SELECT id, document_id, template_signer_id, signer_order, signer_email,
+			   COALESCE(signer_name, ''), COALESCE(access_token, ''), status, viewed_at, completed_at, created_at,
+			   last_reminded_at, declined_at, decline_reason
+		FROM document_signers
+		WHERE document_id = $1
+		ORDER BY signer_order ASC`
+
+	rows, err := s.db.Query(query, documentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document signers: %w", err)
+	}
+	defer rows.Close()
+
+	var signers []DocumentSigner
+	for rows.Next() {
+		var signer DocumentSigner
+		err := rows.Scan(
+			&signer.ID, &signer.DocumentID, &signer.TemplateSignerID, &signer.SignerOrder,
+			&signer.SignerEmail, &signer.SignerName, &signer.AccessToken, &signer.Status,
+			&signer.ViewedAt, &signer.CompletedAt, &signer.CreatedAt, &signer.LastRemindedAt,
+			&signer.DeclinedAt, &signer.DeclineReason,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan document signer: %w", err)
+		}
+		signers = append(signers, signer)
+	}
+
+	return signers, nil
+}
+
+// GetDocumentWithSigners retrieves a document with all of its signers
+func (s *service) GetDocumentWithSigners(documentID uuid.UUID, userID int) (*DocumentWithSigners, error) {
+	document, err := s.GetDocumentByID(documentID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	signers, err := s.GetDocumentSigners(documentID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DocumentWithSigners{
+		Document: *document,
+		Signers:  signers,
+	}, nil
+}
+
+// TemplateSnapshotHash returns a SHA-256 over the template's PDF hash and its
+// signer/field layout, so a document records exactly what it was created from.
+func TemplateSnapshotHash(template *TemplateWithSignersAndFields) (string, error) {
+	type snapshotSigner struct {
+		ID    uuid.UUID `json:"id"`
+		Order int       `json:"order"`
+		Name  string    `json:"name"`
+	}
+	type snapshotField struct {
+		Name            string          `json:"name"`
+		Type            string          `json:"type"`
+		SignerID        uuid.UUID       `json:"signer_id"`
+		Required        bool            `json:"required"`
+		PositionData    json.RawMessage `json:"position_data"`
+		ValidationRules json.RawMessage `json:"validation_rules"`
+	}
+
+	snapshot := struct {
+		PDFHash string           `json:"pdf_hash"`
+		Signers []snapshotSigner `json:"signers"`
+		Fields  []snapshotField  `json:"fields"`
+	}{PDFHash: template.PDFHash}
+
+	for _, signer := range template.Signers {
+		snapshot.Signers = append(snapshot.Signers, snapshotSigner{
+			ID:    signer.ID,
+			Order: signer.SignerOrder,
+			Name:  signer.SignerName,
+		})
+	}
+
+	for _, field := range template.Fields {
+		validationRules := field.ValidationRules
+		if validationRules == "" {
+			validationRules = "{}"
+		}
+		snapshot.Fields = append(snapshot.Fields, snapshotField{
+			Name:            field.FieldName,
+			Type:            field.FieldType,
+			SignerID:        field.SignerID,
+			Required:        field.Required,
+			PositionData:    json.RawMessage(field.PositionData),
+			ValidationRules: json.RawMessage(validationRules),
+		})
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal template snapshot: %w", err)
+	}
+
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// generateAccessToken returns a random URL-safe token for signer access links
+func generateAccessToken() (string, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", fmt.Errorf("failed to generate access token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(tokenBytes), nil
+}
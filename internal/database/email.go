@@ -0,0 +1,131 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Email templates understood by the mail package
+const (
+	EmailWorkspaceInvitation = "workspace_invitation"
+	EmailSignatureRequest    = "signature_request"
+	EmailDocumentCompleted   = "document_completed"
+	EmailSigningReminder     = "signing_reminder"
+	EmailDocumentVoided      = "document_voided"
+	EmailDocumentDeclined    = "document_declined"
+)
+
+// emailClaimLease is how long a claimed email is hidden from other workers. A worker that
+// crashes mid-send leaves the row to be retried once the lease runs out.
+const emailClaimLease = 10 * time.Minute
+
+// OutboxEmail is a queued email waiting to be rendered and delivered
+type OutboxEmail struct {
+	ID             uuid.UUID              `json:"id"`
+	Template       string                 `json:"template"`
+	RecipientEmail string                 `json:"recipient_email"`
+	Data           map[string]interface{} `json:"data"`
+	Attempts       int                    `json:"attempts"`
+	CreatedAt      time.Time              `json:"created_at"`
+}
+
+// enqueueEmail queues an email for background delivery. Call it inside the transaction that
+// makes the change the email describes so the two commit or roll back together.
+func enqueueEmail(exec execer, template, recipientEmail string, data map[string]interface{}) error {
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	dataJSON, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode email data: %w", err)
+	}
+
+	_, err = exec.Exec(`
+		INSERT INTO email_outbox (template, recipient_email, data)
+		VALUES ($1, $2, $3)`, template, recipientEmail, string(dataJSON))
+	if err != nil {
+		return fmt.Errorf("failed to queue email: %w", err)
+	}
+
+	return nil
+}
+
+// ClaimPendingEmails takes up to limit due emails for delivery and counts the attempt.
+// Rows locked by another worker are skipped.
+func (s *service) ClaimPendingEmails(ctx context.Context, limit int) ([]OutboxEmail, error) {
+	query := `
+		UPDATE email_outbox
+		SET attempts = attempts + 1, next_attempt_at = NOW() + $2 * INTERVAL '1 second'
+		WHERE id IN (
+			SELECT id FROM email_outbox
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at ASC
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, template, recipient_email, data, attempts, created_at`
+
+	rows, err := s.db.QueryContext(ctx, query, limit, emailClaimLease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim emails: %w", err)
+	}
+	defer rows.Close()
+
+	var emails []OutboxEmail
+	for rows.Next() {
+		var email OutboxEmail
+		var data []byte
+		err := rows.Scan(&email.ID, &email.Template, &email.RecipientEmail, &data, &email.Attempts, &email.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan email: %w", err)
+		}
+		if err := json.Unmarshal(data, &email.Data); err != nil {
+			email.Data = map[string]interface{}{}
+		}
+		emails = append(emails, email)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	return emails, nil
+}
+
+// MarkEmailSent records a successful delivery
+func (s *service) MarkEmailSent(ctx context.Context, emailID uuid.UUID) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE email_outbox
+		SET status = 'sent', sent_at = NOW(), last_error = NULL
+		WHERE id = $1`, emailID)
+	if err != nil {
+		return fmt.Errorf("failed to mark email as sent: %w", err)
+	}
+	return nil
+}
+
+// MarkEmailFailed records a failed delivery. A nil retryAt gives up on the email.
+func (s *service) MarkEmailFailed(ctx context.Context, emailID uuid.UUID, lastError string, retryAt *time.Time) error {
+	query := `
+		UPDATE email_outbox
+		SET status = 'pending', last_error = $2, next_attempt_at = $3
+		WHERE id = $1`
+	args := []any{emailID, lastError, retryAt}
+
+	if retryAt == nil {
+		query = `
+			UPDATE email_outbox
+			SET status = 'failed', last_error = $2
+			WHERE id = $1`
+		args = args[:2]
+	}
+
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to mark email as failed: %w", err)
+	}
+	return nil
+}
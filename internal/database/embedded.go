@@ -0,0 +1,243 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EmbeddedSigningSession is a single-use link into the signing experience for one signer, shown
+// inside the sender's own application instead of being emailed
+type EmbeddedSigningSession struct {
+	ID         uuid.UUID  `json:"id"`
+	SignerID   uuid.UUID  `json:"signer_id"`
+	DocumentID uuid.UUID  `json:"document_id"`
+	ReturnURL  string     `json:"return_url"`
+	CreatedBy  int        `json:"created_by"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RedeemedAt *time.Time `json:"redeemed_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	// AccessToken lets the embedding page act as the signer until AccessTokenExpiresAt. It is
+	// only returned when the session is redeemed.
+	AccessToken          string     `json:"-"`
+	AccessTokenExpiresAt *time.Time `json:"access_token_expires_at,omitempty"`
+}
+
+// CreateEmbeddedSigningSession mints an embedded session for a signer who can still sign. Only the
+// document creator or a workspace owner or admin can create one.
+func (s *service) CreateEmbeddedSigningSession(documentID, signerID uuid.UUID, userID int, returnURL string, expiresAt time.Time) (*EmbeddedSigningSession, error) {
+	// Check if user has permission (creator, workspace owner, or admin)
+	permissionQuery := `
+		SELECT d.created_by, wm.role, d.status
+		FROM documents d
+		JOIN workspace_memberships wm ON d.workspace_id = wm.workspace_id
+		WHERE d.id = $1 AND wm.user_id = $2 AND wm.status = 'active'`
+
+	var createdBy int
+	var role, documentStatus string
+	err := s.db.QueryRow(permissionQuery, documentID, userID).Scan(&createdBy, &role, &documentStatus)
+	if err != nil {
+		return nil, fmt.Errorf("document not found or access denied")
+	}
+
+	if createdBy != userID && role != "owner" && role != "admin" {
+		return nil, fmt.Errorf("insufficient permissions to create embedded signing sessions")
+	}
+
+	if documentStatus != "sent" && documentStatus != "in_progress" {
+		return nil, fmt.Errorf("document is not awaiting signatures")
+	}
+
+	var signerStatus string
+	err = s.db.QueryRow(`
+		SELECT status FROM document_signers
+		WHERE id = $1 AND document_id = $2`, signerID, documentID).Scan(&signerStatus)
+	if err != nil {
+		return nil, fmt.Errorf("signer not found")
+	}
+
+	if signerStatus == "completed" || signerStatus == "declined" {
+		return nil, fmt.Errorf("signer has already completed or declined")
+	}
+
+	session := &EmbeddedSigningSession{SignerID: signerID, DocumentID: documentID, ReturnURL: returnURL, CreatedBy: userID}
+	err = s.db.QueryRow(`
+		INSERT INTO embedded_signing_sessions (signer_id, return_url, created_by, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, expires_at, created_at`,
+		signerID, returnURL, userID, expiresAt.UTC()).Scan(&session.ID, &session.ExpiresAt, &session.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embedded signing session: %w", err)
+	}
+
+	return session, nil
+}
+
+// GetEmbeddedSigningSession returns an embedded session without redeeming it
+func (s *service) GetEmbeddedSigningSession(sessionID uuid.UUID) (*EmbeddedSigningSession, error) {
+	session := &EmbeddedSigningSession{}
+	err := s.db.QueryRow(`
+		SELECT es.id, es.signer_id, ds.document_id, es.return_url, es.created_by,
+			   es.expires_at, es.redeemed_at, es.created_at
+		FROM embedded_signing_sessions es
+		JOIN document_signers ds ON es.signer_id = ds.id
+		WHERE es.id = $1`, sessionID).Scan(
+		&session.ID, &session.SignerID, &session.DocumentID, &session.ReturnURL, &session.CreatedBy,
+		&session.ExpiresAt, &session.RedeemedAt, &session.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("embedded signing session not found")
+	}
+
+	return session, nil
+}
+
+// RedeemEmbeddedSigningSession marks an embedded session as used and issues it an access token
+// that works until tokenExpiresAt. The signer's own access token is never handed out. A session
+// can only be redeemed once, and not after it expires.
+func (s *service) RedeemEmbeddedSigningSession(sessionID uuid.UUID, tokenExpiresAt time.Time) (*EmbeddedSigningSession, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	session := &EmbeddedSigningSession{}
+	var revoked bool
+	err = tx.QueryRow(`
+		SELECT es.id, es.signer_id, ds.document_id, es.return_url, es.created_by,
+			   es.expires_at, es.created_at, ds.access_token IS NULL
+		FROM embedded_signing_sessions es
+		JOIN document_signers ds ON es.signer_id = ds.id
+		WHERE es.id = $1 AND es.redeemed_at IS NULL AND es.expires_at > NOW()
+		FOR UPDATE OF es`, sessionID).Scan(
+		&session.ID, &session.SignerID, &session.DocumentID, &session.ReturnURL, &session.CreatedBy,
+		&session.ExpiresAt, &session.CreatedAt, &revoked,
+	)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("embedded signing session not found, expired or already used")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to redeem embedded signing session: %w", err)
+	}
+
+	// Voiding a document revokes its signers' access
+	if revoked {
+		return nil, fmt.Errorf("signer access has been revoked")
+	}
+
+	accessToken, err := generateAccessToken()
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRow(`
+		UPDATE embedded_signing_sessions
+		SET redeemed_at = NOW(), access_token = $2, access_token_expires_at = $3
+		WHERE id = $1
+		RETURNING redeemed_at, access_token_expires_at`,
+		sessionID, accessToken, tokenExpiresAt.UTC()).Scan(&session.RedeemedAt, &session.AccessTokenExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to redeem embedded signing session: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	session.AccessToken = accessToken
+	return session, nil
+}
+
+// GetWorkspaceEmbedOrigins returns the origins allowed to embed a workspace's signing sessions
+func (s *service) GetWorkspaceEmbedOrigins(workspaceID uuid.UUID) ([]string, error) {
+	rows, err := s.db.Query(`
+		SELECT unnest(embed_allowed_origins) FROM workspaces WHERE id = $1`, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get embed origins: %w", err)
+	}
+	defer rows.Close()
+
+	origins := []string{}
+	for rows.Next() {
+		var origin string
+		if err := rows.Scan(&origin); err != nil {
+			return nil, fmt.Errorf("failed to scan embed origin: %w", err)
+		}
+		origins = append(origins, origin)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	return origins, nil
+}
+
+// UpdateWorkspaceEmbedOrigins replaces the origins allowed to embed a workspace's signing sessions
+func (s *service) UpdateWorkspaceEmbedOrigins(workspaceID uuid.UUID, origins []string, userID int) error {
+	// First check if user has permission (owner or admin)
+	permissionQuery := `
+		SELECT role FROM workspace_memberships
+		WHERE workspace_id = $1 AND user_id = $2 AND status = 'active'`
+
+	var role string
+	err := s.db.QueryRow(permissionQuery, workspaceID, userID).Scan(&role)
+	if err != nil {
+		return fmt.Errorf("user does not have access to this workspace")
+	}
+
+	if role != "owner" && role != "admin" {
+		return fmt.Errorf("insufficient permissions to update workspace")
+	}
+
+	if origins == nil {
+		origins = []string{}
+	}
+
+	result, err := s.db.Exec(`
+		UPDATE workspaces
+		SET embed_allowed_origins = $1, updated_at = NOW()
+		WHERE id = $2`, origins, workspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to update embed origins: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("workspace not found")
+	}
+
+	return nil
+}
+
+// ListEmbedOrigins returns every origin any active workspace allows to embed signing sessions
+func (s *service) ListEmbedOrigins() ([]string, error) {
+	rows, err := s.db.Query(`
+		SELECT DISTINCT unnest(embed_allowed_origins) FROM workspaces WHERE is_active = true`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list embed origins: %w", err)
+	}
+	defer rows.Close()
+
+	var origins []string
+	for rows.Next() {
+		var origin string
+		if err := rows.Scan(&origin); err != nil {
+			return nil, fmt.Errorf("failed to scan embed origin: %w", err)
+		}
+		origins = append(origins, origin)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	return origins, nil
+}
@@ -0,0 +1,353 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WorkspaceDataKey is a workspace's data encryption key, wrapped by a master key. Only the
+// storage layer ever sees the unwrapped key.
+type WorkspaceDataKey struct {
+	ID          uuid.UUID  `json:"id"`
+	WorkspaceID uuid.UUID  `json:"workspace_id"`
+	WrappedKey  []byte     `json:"-"`
+	MasterKeyID string     `json:"master_key_id"`
+	Status      string     `json:"status"` // active, retired
+	CreatedAt   time.Time  `json:"created_at"`
+	RewrappedAt *time.Time `json:"rewrapped_at,omitempty"`
+	RetiredAt   *time.Time `json:"retired_at,omitempty"`
+}
+
+// EncryptedObject is a stored PDF waiting to be re-encrypted with its workspace's active data key
+type EncryptedObject struct {
+	Kind        string // template_version, document
+	WorkspaceID uuid.UUID
+	S3Key       string
+}
+
+// EncryptedFormValue is a submitted value waiting to be re-encrypted with its workspace's active
+// data key
+type EncryptedFormValue struct {
+	ID              uuid.UUID
+	WorkspaceID     uuid.UUID
+	EncryptedValue  string
+	EncryptionKeyID string
+}
+
+// EncryptedBulkSendPrefill is the prefilled values of a pending bulk send row, waiting to be
+// re-encrypted with its workspace's active data key
+type EncryptedBulkSendPrefill struct {
+	RowID       uuid.UUID
+	WorkspaceID uuid.UUID
+	Prefill     []BulkSendPrefill
+}
+
+const dataKeyColumns = `id, workspace_id, wrapped_key, master_key_id, status, created_at, rewrapped_at, retired_at`
+
+func scanDataKey(row rowScanner) (*WorkspaceDataKey, error) {
+	key := &WorkspaceDataKey{}
+	err := row.Scan(&key.ID, &key.WorkspaceID, &key.WrappedKey, &key.MasterKeyID, &key.Status,
+		&key.CreatedAt, &key.RewrappedAt, &key.RetiredAt)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// GetActiveDataKey returns the key new data in the workspace is encrypted with, or nil if the
+// workspace does not have one yet
+func (s *service) GetActiveDataKey(workspaceID uuid.UUID) (*WorkspaceDataKey, error) {
+	key, err := scanDataKey(s.db.QueryRow(`
+		SELECT `+dataKeyColumns+`
+		FROM workspace_data_keys
+		WHERE workspace_id = $1 AND status = 'active'`, workspaceID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace data key: %w", err)
+	}
+	return key, nil
+}
+
+// CreateDataKey stores a new active data key for the workspace. If another request created one
+// first, that key is returned instead and the new one is discarded.
+func (s *service) CreateDataKey(key *WorkspaceDataKey) (*WorkspaceDataKey, error) {
+	created, err := scanDataKey(s.db.QueryRow(`
+		INSERT INTO workspace_data_keys (workspace_id, wrapped_key, master_key_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (workspace_id) WHERE status = 'active' DO NOTHING
+		RETURNING `+dataKeyColumns, key.WorkspaceID, key.WrappedKey, key.MasterKeyID))
+	if err == sql.ErrNoRows {
+		existing, err := s.GetActiveDataKey(key.WorkspaceID)
+		if err == nil && existing == nil {
+			err = fmt.Errorf("workspace data key was retired while it was being created")
+		}
+		return existing, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace data key: %w", err)
+	}
+	return created, nil
+}
+
+// GetDataKey returns an active or retired data key
+func (s *service) GetDataKey(keyID uuid.UUID) (*WorkspaceDataKey, error) {
+	key, err := scanDataKey(s.db.QueryRow(`
+		SELECT `+dataKeyColumns+`
+		FROM workspace_data_keys
+		WHERE id = $1`, keyID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("data key not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get data key: %w", err)
+	}
+	return key, nil
+}
+
+// ListDataKeysToRewrap returns every data key that is not wrapped by the given master key
+func (s *service) ListDataKeysToRewrap(masterKeyID string) ([]WorkspaceDataKey, error) {
+	rows, err := s.db.Query(`
+		SELECT `+dataKeyColumns+`
+		FROM workspace_data_keys
+		WHERE master_key_id <> $1
+		ORDER BY created_at ASC`, masterKeyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list data keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []WorkspaceDataKey
+	for rows.Next() {
+		key, err := scanDataKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan data key: %w", err)
+		}
+		keys = append(keys, *key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	return keys, nil
+}
+
+// RewrapDataKey replaces a data key's wrapping, as long as it is still wrapped by
+// previousMasterKeyID
+func (s *service) RewrapDataKey(keyID uuid.UUID, previousMasterKeyID string, wrappedKey []byte, masterKeyID string) error {
+	result, err := s.db.Exec(`
+		UPDATE workspace_data_keys
+		SET wrapped_key = $3, master_key_id = $4, rewrapped_at = NOW()
+		WHERE id = $1 AND master_key_id = $2`, keyID, previousMasterKeyID, wrappedKey, masterKeyID)
+	if err != nil {
+		return fmt.Errorf("failed to rewrap data key: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("data key not found or already rewrapped")
+	}
+	return nil
+}
+
+// RetireActiveDataKeys retires every workspace's active data key. Retired keys still decrypt;
+// each workspace gets a new key the next time it encrypts something.
+func (s *service) RetireActiveDataKeys() (int, error) {
+	result, err := s.db.Exec(`
+		UPDATE workspace_data_keys
+		SET status = 'retired', retired_at = NOW()
+		WHERE status = 'active'`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to retire data keys: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return int(rowsAffected), nil
+}
+
+// ListObjectsToReencrypt returns stored PDFs that are not known to be encrypted with their
+// workspace's active data key, in order of S3 key starting after the given object. A PDF shared
+// by several template versions is listed once.
+func (s *service) ListObjectsToReencrypt(after EncryptedObject, limit int) ([]EncryptedObject, error) {
+	query := `
+		SELECT kind, workspace_id, s3_key FROM (
+			SELECT 'template_version' AS kind, t.workspace_id, tv.s3_key
+			FROM template_versions tv
+			JOIN templates t ON tv.template_id = t.id
+			LEFT JOIN workspace_data_keys k ON k.workspace_id = t.workspace_id AND k.status = 'active'
+			WHERE tv.encryption_key_id IS NULL OR tv.encryption_key_id <> COALESCE(k.id::text, '')
+			UNION
+			SELECT 'document', d.workspace_id, d.s3_key
+			FROM documents d
+			LEFT JOIN workspace_data_keys k ON k.workspace_id = d.workspace_id AND k.status = 'active'
+			WHERE d.s3_key IS NOT NULL
+			AND (d.encryption_key_id IS NULL OR d.encryption_key_id <> COALESCE(k.id::text, ''))
+		) objects
+		WHERE (s3_key, kind) > ($1, $2)
+		ORDER BY s3_key, kind
+		LIMIT $3`
+
+	rows, err := s.db.Query(query, after.S3Key, after.Kind, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects to re-encrypt: %w", err)
+	}
+	defer rows.Close()
+
+	var objects []EncryptedObject
+	for rows.Next() {
+		var object EncryptedObject
+		if err := rows.Scan(&object.Kind, &object.WorkspaceID, &object.S3Key); err != nil {
+			return nil, fmt.Errorf("failed to scan object: %w", err)
+		}
+		objects = append(objects, object)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	return objects, nil
+}
+
+// MarkObjectReencrypted records the data key a stored PDF is now encrypted with
+func (s *service) MarkObjectReencrypted(object EncryptedObject, keyID string) error {
+	query := `UPDATE template_versions SET encryption_key_id = $2 WHERE s3_key = $1`
+	if object.Kind == "document" {
+		query = `UPDATE documents SET encryption_key_id = $2 WHERE s3_key = $1`
+	}
+
+	if _, err := s.db.Exec(query, object.S3Key, keyID); err != nil {
+		return fmt.Errorf("failed to record object encryption key: %w", err)
+	}
+	return nil
+}
+
+// ListFormValuesToReencrypt returns submitted values that are not encrypted with their
+// workspace's active data key, in order of ID starting after the given one
+func (s *service) ListFormValuesToReencrypt(after uuid.UUID, limit int) ([]EncryptedFormValue, error) {
+	query := `
+		SELECT fs.id, d.workspace_id, fs.encrypted_value, COALESCE(fs.encryption_key_id, '')
+		FROM form_submissions fs
+		JOIN documents d ON fs.document_id = d.id
+		LEFT JOIN workspace_data_keys k ON k.workspace_id = d.workspace_id AND k.status = 'active'
+		WHERE fs.encrypted_value IS NOT NULL
+		AND (fs.encryption_key_id IS NULL OR fs.encryption_key_id <> COALESCE(k.id::text, ''))
+		AND fs.id > $1
+		ORDER BY fs.id
+		LIMIT $2`
+
+	rows, err := s.db.Query(query, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list form values to re-encrypt: %w", err)
+	}
+	defer rows.Close()
+
+	var values []EncryptedFormValue
+	for rows.Next() {
+		var value EncryptedFormValue
+		err := rows.Scan(&value.ID, &value.WorkspaceID, &value.EncryptedValue, &value.EncryptionKeyID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan form value: %w", err)
+		}
+		values = append(values, value)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	return values, nil
+}
+
+// UpdateFormValueEncryption replaces a submitted value with its re-encrypted form, unless the
+// signer changed it in the meantime
+func (s *service) UpdateFormValueEncryption(value EncryptedFormValue, encryptedValue, keyID string) error {
+	_, err := s.db.Exec(`
+		UPDATE form_submissions
+		SET encrypted_value = $3, encryption_key_id = $4
+		WHERE id = $1 AND encrypted_value = $2`, value.ID, value.EncryptedValue, encryptedValue, keyID)
+	if err != nil {
+		return fmt.Errorf("failed to update form value: %w", err)
+	}
+	return nil
+}
+
+// ListBulkSendPrefillToReencrypt returns pending bulk send rows with a prefilled value that is not
+// encrypted with their workspace's active data key, in order of ID starting after the given one.
+// Rows that were already sent or failed are skipped; their values were copied to form_submissions
+// or will never be used.
+func (s *service) ListBulkSendPrefillToReencrypt(after uuid.UUID, limit int) ([]EncryptedBulkSendPrefill, error) {
+	query := `
+		SELECT r.id, b.workspace_id, r.prefill
+		FROM bulk_send_rows r
+		JOIN bulk_send_batches b ON r.batch_id = b.id
+		LEFT JOIN workspace_data_keys k ON k.workspace_id = b.workspace_id AND k.status = 'active'
+		WHERE r.status = 'pending'
+		AND EXISTS (
+			SELECT 1 FROM jsonb_array_elements(r.prefill) p
+			WHERE p->>'encryption_key_id' IS DISTINCT FROM k.id::text
+		)
+		AND r.id > $1
+		ORDER BY r.id
+		LIMIT $2`
+
+	rows, err := s.db.Query(query, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bulk send prefill to re-encrypt: %w", err)
+	}
+	defer rows.Close()
+
+	var pending []EncryptedBulkSendPrefill
+	for rows.Next() {
+		var row EncryptedBulkSendPrefill
+		var prefillJSON []byte
+		if err := rows.Scan(&row.RowID, &row.WorkspaceID, &prefillJSON); err != nil {
+			return nil, fmt.Errorf("failed to scan bulk send row: %w", err)
+		}
+		if err := json.Unmarshal(prefillJSON, &row.Prefill); err != nil {
+			return nil, fmt.Errorf("failed to decode prefill values for row %s: %w", row.RowID, err)
+		}
+		pending = append(pending, row)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	return pending, nil
+}
+
+// UpdateBulkSendPrefillEncryption replaces a pending bulk send row's prefilled values with their
+// re-encrypted form, unless the row was processed in the meantime
+func (s *service) UpdateBulkSendPrefillEncryption(row EncryptedBulkSendPrefill, prefill []BulkSendPrefill) error {
+	previousJSON, err := json.Marshal(row.Prefill)
+	if err != nil {
+		return fmt.Errorf("failed to encode prefill values: %w", err)
+	}
+	prefillJSON, err := json.Marshal(prefill)
+	if err != nil {
+		return fmt.Errorf("failed to encode prefill values: %w", err)
+	}
+
+	_, err = s.db.Exec(`
+		UPDATE bulk_send_rows
+		SET prefill = $3
+		WHERE id = $1 AND status = 'pending' AND prefill = $2::jsonb`,
+		row.RowID, string(previousJSON), string(prefillJSON))
+	if err != nil {
+		return fmt.Errorf("failed to update bulk send prefill: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FinalizationValue is one submitted field value together with where it belongs on the page
+type FinalizationValue struct {
+	FieldID        uuid.UUID `json:"field_id"`
+	FieldName      string    `json:"field_name"`
+	FieldType      string    `json:"field_type"`
+	PositionData   string    `json:"position_data"`
+	EncryptedValue string    `json:"-"`
+}
+
+// FinalizationInput is everything needed to render the final PDF of a completed document
+type FinalizationInput struct {
+	Document        Document            `json:"document"`
+	TemplateS3Key   string              `json:"-"`
+	TemplatePDFHash string              `json:"-"`
+	Values          []FinalizationValue `json:"values"`
+	Signers         []DocumentSigner    `json:"signers"`
+	AuditTrail      []AuditEntry        `json:"audit_trail"`
+}
+
+// FinalSignature is the cryptographic signature applied to a final PDF
+type FinalSignature struct {
+	DigitalSignature   string // base64 DER PKCS#7 SignedData
+	Certificate        string // PEM certificate chain
+	SignatureAlgorithm string
+}
+
+// finalizationClaimLease is how long a claimed document is hidden from other workers. A worker
+// that crashes mid-render leaves the document to be retried once the lease runs out.
+const finalizationClaimLease = 10 * time.Minute
+
+// PendingFinalization is a completed document claimed for rendering its final PDF
+type PendingFinalization struct {
+	DocumentID uuid.UUID `json:"document_id"`
+	Attempts   int       `json:"attempts"`
+}
+
+// GetDocumentFinalizationInput loads a completed document, its template PDF location, every
+// non-empty submitted value, its signers and its audit trail. It is called by the system once
+// the last signer completes, so it does not check workspace membership.
+func (s *service) GetDocumentFinalizationInput(documentID uuid.UUID) (*FinalizationInput, error) {
+	input := &FinalizationInput{}
+	document := &input.Document
+
+	documentQuery := `
+		SELECT d.id, d.template_id, d.template_version_id, d.name, d.s3_bucket, d.s3_key, d.template_snapshot_hash,
+			   d.final_document_hash, d.created_by, d.workspace_id, d.status, d.expires_at,
+			   d.sent_at, d.created_at, d.updated_at, d.completed_at, d.parallel_signing,
+			   tv.s3_key, tv.pdf_hash
+		FROM documents d
+		JOIN template_versions tv ON d.template_version_id = tv.id
+		WHERE d.id = $1`
+
+	err := s.db.QueryRow(documentQuery, documentID).Scan(
+		&document.ID, &document.TemplateID, &document.TemplateVersionID, &document.Name, &document.S3Bucket,
+		&document.S3Key, &document.TemplateSnapshotHash, &document.FinalDocumentHash,
+		&document.CreatedBy, &document.WorkspaceID, &document.Status, &document.ExpiresAt,
+		&document.SentAt, &document.CreatedAt, &document.UpdatedAt, &document.CompletedAt,
+		&document.ParallelSigning, &input.TemplateS3Key, &input.TemplatePDFHash,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("document not found: %w", err)
+	}
+
+	if document.Status != "completed" {
+		return nil, fmt.Errorf("document is not completed")
+	}
+
+	valuesQuery := `
+		SELECT fs.field_id, fs.field_name, fs.field_type, tf.position_data, fs.encrypted_value
+		FROM form_submissions fs
+		JOIN template_fields tf ON fs.field_id = tf.id
+		JOIN document_signers ds ON fs.document_signer_id = ds.id
+		WHERE fs.document_id = $1 AND fs.encrypted_value IS NOT NULL
+		ORDER BY ds.signer_order ASC, tf.created_at ASC, fs.field_name ASC`
+
+	rows, err := s.db.Query(valuesQuery, documentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get submitted values: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var value FinalizationValue
+		err := rows.Scan(&value.FieldID, &value.FieldName, &value.FieldType, &value.PositionData, &value.EncryptedValue)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan submitted value: %w", err)
+		}
+		input.Values = append(input.Values, value)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	input.Signers, err = s.documentSigners(documentID)
+	if err != nil {
+		return nil, err
+	}
+
+	input.AuditTrail, err = s.documentAuditTrail(documentID)
+	if err != nil {
+		return nil, err
+	}
+
+	return input, nil
+}
+
+// RecordFinalDocument stores the location and hash of a completed document's final PDF.
+// When the PDF was cryptographically signed, one digital_signatures row is written per signer
+// with the IP address and user agent they completed from. A document can only be finalized once.
+func (s *service) RecordFinalDocument(documentID uuid.UUID, s3Bucket, s3Key, finalHash, encryptionKeyID string, signature *FinalSignature) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	updateQuery := `
+		UPDATE documents
+		SET s3_bucket = $2, s3_key = $3, final_document_hash = $4, encryption_key_id = NULLIF($5, ''),
+			completed_at = COALESCE(completed_at, NOW()), finalization_next_attempt_at = NULL,
+			finalization_error = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = 'completed' AND final_document_hash IS NULL`
+
+	result, err := tx.Exec(updateQuery, documentID, s3Bucket, s3Key, finalHash, encryptionKeyID)
+	if err != nil {
+		return fmt.Errorf("failed to record final document: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("document not found or already finalized")
+	}
+
+	if signature != nil {
+		signatureQuery := `
+			INSERT INTO digital_signatures (document_id, document_signer_id, signer_email, signer_name,
+				final_document_hash, digital_signature, certificate, signature_algorithm, signed_at,
+				ip_address, user_agent)
+			SELECT ds.document_id, ds.id, ds.signer_email, ds.signer_name, $2, $3, $4, $5,
+				COALESCE(ds.completed_at, NOW()), signed.ip_address, signed.user_agent
+			FROM document_signers ds
+			LEFT JOIN LATERAL (
+				SELECT al.ip_address, al.user_agent
+				FROM document_audit_log al
+				WHERE al.document_id = ds.document_id AND al.action = 'document_signed'
+				AND al.details->>'signer_id' = ds.id::text
+				ORDER BY al.created_at DESC
+				LIMIT 1
+			) signed ON true
+			WHERE ds.document_id = $1`
+
+		_, err = tx.Exec(signatureQuery, documentID, finalHash, signature.DigitalSignature,
+			signature.Certificate, signature.SignatureAlgorithm)
+		if err != nil {
+			return fmt.Errorf("failed to record digital signatures: %w", err)
+		}
+	}
+
+	recordAudit(tx, AuditEntry{
+		DocumentID: &documentID,
+		Action:     "document_finalized",
+		Details: map[string]interface{}{
+			"final_document_hash": finalHash,
+			"digitally_signed":    signature != nil,
+		},
+	})
+
+	return tx.Commit()
+}
+
+// ClaimPendingFinalizations takes up to limit completed documents that are due a final PDF and
+// counts the attempt. Documents locked by another worker are skipped.
+func (s *service) ClaimPendingFinalizations(ctx context.Context, limit int) ([]PendingFinalization, error) {
+	return s.claimFinalizations(ctx, nil, limit)
+}
+
+// ClaimDocumentFinalization claims one completed document for rendering its final PDF. It
+// returns nil when the document already has one or another worker is rendering it.
+func (s *service) ClaimDocumentFinalization(ctx context.Context, documentID uuid.UUID) (*PendingFinalization, error) {
+	claimed, err := s.claimFinalizations(ctx, &documentID, 1)
+	if err != nil || len(claimed) == 0 {
+		return nil, err
+	}
+	return &claimed[0], nil
+}
+
+func (s *service) claimFinalizations(ctx context.Context, documentID *uuid.UUID, limit int) ([]PendingFinalization, error) {
+	query := `
+		UPDATE documents
+		SET finalization_attempts = finalization_attempts + 1,
+			finalization_next_attempt_at = NOW() + $2 * INTERVAL '1 second'
+		WHERE id IN (
+			SELECT id FROM documents
+			WHERE status = 'completed' AND final_document_hash IS NULL
+			AND finalization_next_attempt_at <= NOW()
+			AND ($3::uuid IS NULL OR id = $3)
+			ORDER BY finalization_next_attempt_at ASC
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, finalization_attempts`
+
+	rows, err := s.db.QueryContext(ctx, query, limit, finalizationClaimLease.Seconds(), documentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim documents for finalization: %w", err)
+	}
+	defer rows.Close()
+
+	var claimed []PendingFinalization
+	for rows.Next() {
+		var pending PendingFinalization
+		if err := rows.Scan(&pending.DocumentID, &pending.Attempts); err != nil {
+			return nil, fmt.Errorf("failed to scan document: %w", err)
+		}
+		claimed = append(claimed, pending)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	return claimed, nil
+}
+
+// MarkFinalizationFailed records a failed attempt at rendering a document's final PDF. A nil
+// retryAt gives up on the document.
+func (s *service) MarkFinalizationFailed(ctx context.Context, documentID uuid.UUID, lastError string, retryAt *time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE documents
+		SET finalization_error = $2, finalization_next_attempt_at = $3
+		WHERE id = $1 AND final_document_hash IS NULL`, documentID, lastError, retryAt)
+	if err != nil {
+		return fmt.Errorf("failed to mark finalization as failed: %w", err)
+	}
+	return nil
+}
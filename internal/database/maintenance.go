@@ -0,0 +1,125 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// WithAdvisoryLock runs fn only if the session-level Postgres advisory lock key can be taken
+// without waiting. It reports whether the lock was acquired, so when several API replicas run
+// the same job only one of them does the work.
+func (s *service) WithAdvisoryLock(ctx context.Context, key int64, fn func(ctx context.Context) error) (bool, error) {
+	// Advisory locks belong to a session, so hold one connection for the lock's lifetime
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	var acquired bool
+	err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&acquired)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire advisory lock: %w", err)
+	}
+	if !acquired {
+		return false, nil
+	}
+
+	defer func() {
+		// Unlock on a fresh context so a cancelled job still releases the lock
+		conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, key)
+	}()
+
+	return true, fn(ctx)
+}
+
+// CleanupExpiredInvitations marks pending invitations past their expiry as expired
+func (s *service) CleanupExpiredInvitations(ctx context.Context) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, `SELECT cleanup_expired_invitations()`).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clean up expired invitations: %w", err)
+	}
+	return count, nil
+}
+
+// CleanupOldNotifications deletes notifications past their expiry
+func (s *service) CleanupOldNotifications(ctx context.Context) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, `SELECT cleanup_old_notifications()`).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clean up old notifications: %w", err)
+	}
+	return count, nil
+}
+
+// ExpireOverdueDocuments moves sent and in-progress documents past their expires_at to expired,
+// records a document_expired audit entry and notifies each document's creator.
+func (s *service) ExpireOverdueDocuments(ctx context.Context) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		UPDATE documents
+		SET status = 'expired', updated_at = NOW()
+		WHERE status IN ('sent', 'in_progress') AND expires_at IS NOT NULL AND expires_at < NOW()
+		RETURNING id, template_id, name, created_by`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire documents: %w", err)
+	}
+
+	type expiredDocument struct {
+		id         uuid.UUID
+		templateID uuid.UUID
+		name       string
+		createdBy  int
+	}
+
+	var expired []expiredDocument
+	for rows.Next() {
+		var document expiredDocument
+		if err := rows.Scan(&document.id, &document.templateID, &document.name, &document.createdBy); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan expired document: %w", err)
+		}
+		expired = append(expired, document)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	notificationQuery := `
+		INSERT INTO notifications (user_id, type, title, message, data)
+		VALUES ($1, 'document_expired', $2, $3, $4)`
+
+	for _, document := range expired {
+		recordAudit(tx, AuditEntry{
+			DocumentID: &document.id,
+			TemplateID: &document.templateID,
+			Action:     "document_expired",
+		})
+
+		if err = enqueueDocumentWebhookEvent(tx, document.id, WebhookDocumentExpired, nil); err != nil {
+			return 0, err
+		}
+
+		_, err = tx.ExecContext(ctx, notificationQuery, document.createdBy, "Document Expired",
+			fmt.Sprintf("%s expired before all signers completed it", document.name),
+			fmt.Sprintf(`{"document_id": "%s"}`, document.id))
+		if err != nil {
+			// Don't fail the whole operation for notification errors
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit expired documents: %w", err)
+	}
+
+	return len(expired), nil
+}
@@ -0,0 +1,319 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// DeclineDocumentSigner records that a signer refuses to sign. Declining ends the document for
+// everyone: it moves to declined, queued signing emails are dropped and the sender is notified.
+func (s *service) DeclineDocumentSigner(signerID uuid.UUID, reason, ipAddress, userAgent string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var documentID uuid.UUID
+	var signerEmail, signerName string
+	err = tx.QueryRow(`
+		UPDATE document_signers
+		SET status = 'declined', declined_at = NOW(), decline_reason = $2
+		WHERE id = $1 AND status IN ('pending', 'viewed', 'in_progress')
+		RETURNING document_id, signer_email, COALESCE(signer_name, '')`,
+		signerID, reason).Scan(&documentID, &signerEmail, &signerName)
+	if err != nil {
+		return fmt.Errorf("signer has already completed or declined")
+	}
+
+	var templateID uuid.UUID
+	var name string
+	var createdBy int
+	err = tx.QueryRow(`
+		UPDATE documents
+		SET status = 'declined', updated_at = NOW()
+		WHERE id = $1 AND status IN ('sent', 'in_progress')
+		RETURNING template_id, name, created_by`, documentID).Scan(&templateID, &name, &createdBy)
+	if err != nil {
+		return fmt.Errorf("document is no longer awaiting signatures")
+	}
+
+	if err = cancelQueuedSigningEmails(tx, documentID, nil, "document declined"); err != nil {
+		return err
+	}
+
+	recordAudit(tx, AuditEntry{
+		DocumentID: &documentID,
+		TemplateID: &templateID,
+		Action:     "signer_declined",
+		Details: map[string]interface{}{
+			"signer_id":    signerID,
+			"signer_email": signerEmail,
+			"reason":       reason,
+		},
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+	})
+
+	err = enqueueDocumentWebhookEvent(tx, documentID, WebhookDocumentDeclined, map[string]interface{}{
+		"signer_id":    signerID,
+		"signer_email": signerEmail,
+		"reason":       reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	var senderEmail, senderName string
+	err = tx.QueryRow(`SELECT email, COALESCE(name, '') FROM users WHERE id = $1`, createdBy).Scan(&senderEmail, &senderName)
+	if err != nil {
+		return fmt.Errorf("failed to load document sender: %w", err)
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"document_id":  documentID,
+		"signer_email": signerEmail,
+		"reason":       reason,
+	})
+
+	_, err = tx.Exec(`
+		INSERT INTO notifications (user_id, type, title, message, data)
+		VALUES ($1, 'document_declined', $2, $3, $4)`,
+		createdBy, "Document Declined", fmt.Sprintf("%s declined to sign %s", signerEmail, name), string(data))
+	if err != nil {
+		// Don't fail the whole operation for notification errors
+	}
+
+	err = enqueueEmail(tx, EmailDocumentDeclined, senderEmail, map[string]interface{}{
+		"document_id":   documentID,
+		"document_name": name,
+		"sender_name":   senderName,
+		"signer_name":   signerName,
+		"signer_email":  signerEmail,
+		"reason":        reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DelegateDocumentSigner lets a signer hand their part of the document to someone else, if the
+// template allows delegation. The delegate gets a fresh access token and the old link stops working.
+func (s *service) DelegateDocumentSigner(signerID uuid.UUID, email, name, reason, ipAddress, userAgent string) (*DocumentSigner, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var documentID, templateID uuid.UUID
+	var status string
+	var allowDelegation bool
+	err = tx.QueryRow(`
+		SELECT ds.document_id, ds.status, d.template_id, t.allow_delegation
+		FROM document_signers ds
+		JOIN documents d ON ds.document_id = d.id
+		JOIN templates t ON d.template_id = t.id
+		WHERE ds.id = $1
+		FOR UPDATE OF ds`, signerID).Scan(&documentID, &status, &templateID, &allowDelegation)
+	if err != nil {
+		return nil, fmt.Errorf("signer not found")
+	}
+
+	if !allowDelegation {
+		return nil, fmt.Errorf("delegation is not allowed for this document")
+	}
+	if status == "completed" || status == "declined" {
+		return nil, fmt.Errorf("signer has already completed or declined")
+	}
+
+	signer, previousEmail, err := replaceDocumentSigner(tx, documentID, signerID, email, name, "signer delegated")
+	if err != nil {
+		return nil, err
+	}
+
+	recordAudit(tx, AuditEntry{
+		DocumentID: &documentID,
+		TemplateID: &templateID,
+		Action:     "signer_delegated",
+		Details: map[string]interface{}{
+			"signer_id":  signerID,
+			"from_email": previousEmail,
+			"to_email":   signer.SignerEmail,
+			"reason":     reason,
+		},
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+	})
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return signer, nil
+}
+
+// ReassignDocumentSigner lets the document creator or a workspace owner or admin replace a signer
+// who has not started signing. The new signer gets a fresh access token and the old link stops working.
+func (s *service) ReassignDocumentSigner(documentID, signerID uuid.UUID, userID int, email, name string) (*DocumentSigner, error) {
+	// Check if user has permission (creator, workspace owner, or admin)
+	permissionQuery := `
+		SELECT d.created_by, wm.role, d.template_id
+		FROM documents d
+		JOIN workspace_memberships wm ON d.workspace_id = wm.workspace_id
+		WHERE d.id = $1 AND wm.user_id = $2 AND wm.status = 'active'`
+
+	var createdBy int
+	var role string
+	var templateID uuid.UUID
+	err := s.db.QueryRow(permissionQuery, documentID, userID).Scan(&createdBy, &role, &templateID)
+	if err != nil {
+		return nil, fmt.Errorf("document not found or access denied")
+	}
+
+	if createdBy != userID && role != "owner" && role != "admin" {
+		return nil, fmt.Errorf("insufficient permissions to reassign signers")
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = tx.QueryRow(`
+		SELECT status FROM document_signers
+		WHERE id = $1 AND document_id = $2
+		FOR UPDATE`, signerID, documentID).Scan(&status)
+	if err != nil {
+		return nil, fmt.Errorf("signer not found")
+	}
+
+	if status != "pending" && status != "viewed" {
+		return nil, fmt.Errorf("signer has already started signing")
+	}
+
+	signer, previousEmail, err := replaceDocumentSigner(tx, documentID, signerID, email, name, "signer reassigned")
+	if err != nil {
+		return nil, err
+	}
+
+	recordAudit(tx, AuditEntry{
+		DocumentID: &documentID,
+		TemplateID: &templateID,
+		UserID:     &userID,
+		Action:     "signer_reassigned",
+		Details: map[string]interface{}{
+			"signer_id":  signerID,
+			"from_email": previousEmail,
+			"to_email":   signer.SignerEmail,
+		},
+	})
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return signer, nil
+}
+
+// replaceDocumentSigner points a signer role at a new person. The old access token is replaced,
+// queued emails and embedded sessions for it are dropped and the signer starts over as pending.
+// Values the previous signer already entered stay on the role for the new signer to review. If
+// it is the signer's turn on a sent document they are sent their signing link. It returns the
+// updated signer and the email it replaced.
+func replaceDocumentSigner(tx *sql.Tx, documentID, signerID uuid.UUID, email, name, reason string) (*DocumentSigner, string, error) {
+	var documentName, documentStatus string
+	var parallel bool
+	err := tx.QueryRow(`
+		SELECT name, status, parallel_signing FROM documents
+		WHERE id = $1
+		FOR UPDATE`, documentID).Scan(&documentName, &documentStatus, &parallel)
+	if err != nil {
+		return nil, "", fmt.Errorf("document not found")
+	}
+
+	if documentStatus != "draft" && documentStatus != "sent" && documentStatus != "in_progress" {
+		return nil, "", fmt.Errorf("document is no longer awaiting signatures")
+	}
+
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	var previousEmail string
+	err = tx.QueryRow(`SELECT signer_email FROM document_signers WHERE id = $1`, signerID).Scan(&previousEmail)
+	if err != nil {
+		return nil, "", fmt.Errorf("signer not found")
+	}
+	if previousEmail == email {
+		return nil, "", fmt.Errorf("new signer email is the same as the current one")
+	}
+
+	var exists bool
+	err = tx.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM document_signers WHERE document_id = $1 AND signer_email = $2)`,
+		documentID, email).Scan(&exists)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to check document signers: %w", err)
+	}
+	if exists {
+		return nil, "", fmt.Errorf("%s is already a signer on this document", email)
+	}
+
+	if err = cancelQueuedSigningEmails(tx, documentID, &signerID, reason); err != nil {
+		return nil, "", err
+	}
+
+	// Embedded sessions were minted for the previous signer
+	_, err = tx.Exec(`DELETE FROM embedded_signing_sessions WHERE signer_id = $1`, signerID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to revoke embedded signing sessions: %w", err)
+	}
+
+	accessToken, err := generateAccessToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	signer := &DocumentSigner{}
+	err = tx.QueryRow(`
+		UPDATE document_signers
+		SET signer_email = $2, signer_name = NULLIF($3, ''), access_token = $4, status = 'pending',
+			viewed_at = NULL, last_reminded_at = NULL, reminder_count = 0
+		WHERE id = $1
+		RETURNING id, document_id, template_signer_id, signer_order, signer_email,
+			COALESCE(signer_name, ''), access_token, status, viewed_at, completed_at, created_at`,
+		signerID, email, strings.TrimSpace(name), accessToken).Scan(
+		&signer.ID, &signer.DocumentID, &signer.TemplateSignerID, &signer.SignerOrder,
+		&signer.SignerEmail, &signer.SignerName, &signer.AccessToken, &signer.Status,
+		&signer.ViewedAt, &signer.CompletedAt, &signer.CreatedAt,
+	)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to update signer: %w", err)
+	}
+
+	if documentStatus == "draft" {
+		return signer, previousEmail, nil
+	}
+
+	active, err := activeSigners(tx, documentID, parallel)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, candidate := range active {
+		if candidate.ID == signer.ID {
+			if err = notifySignatureRequested(tx, documentID, documentName, []DocumentSigner{*signer}); err != nil {
+				return nil, "", err
+			}
+			break
+		}
+	}
+
+	return signer, previousEmail, nil
+}
@@ -0,0 +1,282 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReminderCooldown is the minimum time between manual reminders to the same signer
+const ReminderCooldown = 24 * time.Hour
+
+// reminderBatchSize caps how many automatic reminders one job run sends
+const reminderBatchSize = 500
+
+// ReminderRateLimitError is returned when a signer was reminded too recently
+type ReminderRateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ReminderRateLimitError) Error() string {
+	return fmt.Sprintf("reminder rate limited: try again in %s", e.RetryAfter.Round(time.Minute))
+}
+
+// signerReminder is one reminder about to be sent
+type signerReminder struct {
+	signerID     uuid.UUID
+	documentID   uuid.UUID
+	signerEmail  string
+	signerName   string
+	accessToken  string
+	documentName string
+	senderName   string
+	expiresAt    *time.Time
+}
+
+// sendSignerReminder records a reminder against the signer, notifies them in-app if they have an
+// account, queues the reminder email and writes the audit entry. userID is nil for reminders
+// sent by the scheduler.
+func sendSignerReminder(tx *sql.Tx, reminder signerReminder, userID *int) error {
+	_, err := tx.Exec(`
+		UPDATE document_signers
+		SET last_reminded_at = NOW(), reminder_count = reminder_count + 1
+		WHERE id = $1`, reminder.signerID)
+	if err != nil {
+		return fmt.Errorf("failed to record reminder: %w", err)
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"document_id":   reminder.documentID,
+		"document_name": reminder.documentName,
+		"signer_id":     reminder.signerID,
+		"access_token":  reminder.accessToken,
+	})
+
+	_, err = tx.Exec(`
+		INSERT INTO notifications (user_id, type, title, message, data)
+		SELECT u.id, 'signature_reminder', $2, $3, $4
+		FROM users u
+		WHERE lower(u.email) = lower($1)`, reminder.signerEmail, "Signature Reminder",
+		fmt.Sprintf("%s is still waiting for your signature", reminder.documentName), string(data))
+	if err != nil {
+		// Don't fail the whole operation for notification errors
+	}
+
+	err = enqueueEmail(tx, EmailSigningReminder, reminder.signerEmail, map[string]interface{}{
+		"document_name": reminder.documentName,
+		"sender_name":   reminder.senderName,
+		"signer_name":   reminder.signerName,
+		"access_token":  reminder.accessToken,
+		"expires_at":    reminder.expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	trigger := "manual"
+	if userID == nil {
+		trigger = "automatic"
+	}
+	recordAudit(tx, AuditEntry{
+		DocumentID: &reminder.documentID,
+		UserID:     userID,
+		Action:     "reminder_sent",
+		Details: map[string]interface{}{
+			"signer_id":    reminder.signerID,
+			"signer_email": reminder.signerEmail,
+			"trigger":      trigger,
+		},
+	})
+
+	return nil
+}
+
+// SendDueReminders reminds every signer whose turn it is, who has not started signing and whose
+// document's reminder policy says a reminder is due. Reminders stop once the document expires.
+func (s *service) SendDueReminders(ctx context.Context) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// A signer's turn starts when the document is sent, or in sequential mode when the last
+	// lower-order signer completed. The first reminder is measured from then and later ones
+	// from the previous reminder.
+	query := `
+		SELECT ds.id, ds.document_id, ds.signer_email, COALESCE(ds.signer_name, ''),
+			   COALESCE(ds.access_token, ''), d.name, COALESCE(u.name, u.email), d.expires_at
+		FROM document_signers ds
+		JOIN documents d ON ds.document_id = d.id
+		JOIN users u ON d.created_by = u.id
+		CROSS JOIN LATERAL (
+			SELECT CASE WHEN d.parallel_signing THEN d.sent_at
+				ELSE COALESCE((
+					SELECT MAX(prev.completed_at) FROM document_signers prev
+					WHERE prev.document_id = ds.document_id AND prev.signer_order < ds.signer_order
+				), d.sent_at)
+			END AS started_at
+		) turn
+		WHERE d.status IN ('sent', 'in_progress')
+		AND d.reminder_first_after_days IS NOT NULL
+		AND (d.expires_at IS NULL OR d.expires_at > NOW())
+		AND ds.status IN ('pending', 'viewed')
+		AND (d.parallel_signing OR NOT EXISTS (
+			SELECT 1 FROM document_signers prev
+			WHERE prev.document_id = ds.document_id AND prev.signer_order < ds.signer_order
+			AND prev.status <> 'completed'
+		))
+		AND CASE
+			WHEN ds.last_reminded_at IS NULL OR ds.last_reminded_at < turn.started_at
+				THEN turn.started_at + d.reminder_first_after_days * INTERVAL '1 day'
+			ELSE ds.last_reminded_at + d.reminder_repeat_days * INTERVAL '1 day'
+		END <= NOW()
+		ORDER BY ds.document_id, ds.signer_order
+		LIMIT $1
+		FOR UPDATE OF ds SKIP LOCKED`
+
+	rows, err := tx.QueryContext(ctx, query, reminderBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find due reminders: %w", err)
+	}
+
+	var due []signerReminder
+	for rows.Next() {
+		var reminder signerReminder
+		err := rows.Scan(&reminder.signerID, &reminder.documentID, &reminder.signerEmail, &reminder.signerName,
+			&reminder.accessToken, &reminder.documentName, &reminder.senderName, &reminder.expiresAt)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan due reminder: %w", err)
+		}
+		due = append(due, reminder)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	for _, reminder := range due {
+		if err := sendSignerReminder(tx, reminder, nil); err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit reminders: %w", err)
+	}
+
+	return len(due), nil
+}
+
+// RemindDocumentSigner sends a reminder to one signer on behalf of a user. Only the document
+// creator or a workspace owner or admin can send reminders, only to a signer whose turn it is,
+// and at most once per ReminderCooldown.
+func (s *service) RemindDocumentSigner(documentID, signerID uuid.UUID, userID int) (*DocumentSigner, error) {
+	// Check if user has permission (creator, workspace owner, or admin)
+	permissionQuery := `
+		SELECT d.created_by, wm.role
+		FROM documents d
+		JOIN workspace_memberships wm ON d.workspace_id = wm.workspace_id
+		WHERE d.id = $1 AND wm.user_id = $2 AND wm.status = 'active'`
+
+	var createdBy int
+	var role string
+	err := s.db.QueryRow(permissionQuery, documentID, userID).Scan(&createdBy, &role)
+	if err != nil {
+		return nil, fmt.Errorf("document not found or access denied")
+	}
+
+	if createdBy != userID && role != "owner" && role != "admin" {
+		return nil, fmt.Errorf("insufficient permissions to remind signers")
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the signer so two concurrent requests cannot both pass the rate limit
+	query := `
+		SELECT ds.id, ds.document_id, ds.template_signer_id, ds.signer_order, ds.signer_email,
+			   COALESCE(ds.signer_name, ''), COALESCE(ds.access_token, ''), ds.status, ds.viewed_at,
+			   ds.completed_at, ds.created_at, ds.last_reminded_at,
+			   d.name, d.status, d.expires_at, d.parallel_signing, COALESCE(u.name, u.email),
+			   COALESCE(EXTRACT(EPOCH FROM ds.last_reminded_at + $3 * INTERVAL '1 second' - NOW()), 0)::float8
+		FROM document_signers ds
+		JOIN documents d ON ds.document_id = d.id
+		JOIN users u ON d.created_by = u.id
+		WHERE ds.id = $1 AND ds.document_id = $2
+		FOR UPDATE OF ds`
+
+	signer := &DocumentSigner{}
+	var documentName, documentStatus, senderName string
+	var expiresAt *time.Time
+	var parallel bool
+	var waitSeconds float64
+	err = tx.QueryRow(query, signerID, documentID, ReminderCooldown.Seconds()).Scan(
+		&signer.ID, &signer.DocumentID, &signer.TemplateSignerID, &signer.SignerOrder, &signer.SignerEmail,
+		&signer.SignerName, &signer.AccessToken, &signer.Status, &signer.ViewedAt,
+		&signer.CompletedAt, &signer.CreatedAt, &signer.LastRemindedAt,
+		&documentName, &documentStatus, &expiresAt, &parallel, &senderName, &waitSeconds,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("signer not found")
+	}
+
+	if documentStatus != "sent" && documentStatus != "in_progress" {
+		return nil, fmt.Errorf("document is not awaiting signatures")
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("document is not awaiting signatures")
+	}
+	if signer.Status == "completed" {
+		return nil, fmt.Errorf("signer has already completed")
+	}
+
+	if !parallel {
+		var waiting bool
+		err = tx.QueryRow(`
+			SELECT EXISTS (
+				SELECT 1 FROM document_signers
+				WHERE document_id = $1 AND signer_order < $2 AND status <> 'completed'
+			)`, documentID, signer.SignerOrder).Scan(&waiting)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check signing order: %w", err)
+		}
+		if waiting {
+			return nil, fmt.Errorf("signer is waiting on a previous signer")
+		}
+	}
+
+	if waitSeconds > 0 {
+		return nil, &ReminderRateLimitError{RetryAfter: time.Duration(waitSeconds * float64(time.Second))}
+	}
+
+	err = sendSignerReminder(tx, signerReminder{
+		signerID:     signer.ID,
+		documentID:   documentID,
+		signerEmail:  signer.SignerEmail,
+		signerName:   signer.SignerName,
+		accessToken:  signer.AccessToken,
+		documentName: documentName,
+		senderName:   senderName,
+		expiresAt:    expiresAt,
+	}, &userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	now := time.Now()
+	signer.LastRemindedAt = &now
+	return signer, nil
+}
@@ -0,0 +1,246 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SigningProgress describes what happened to a document after one of its signers completed
+type SigningProgress struct {
+	DocumentID        uuid.UUID        `json:"document_id"`
+	DocumentCompleted bool             `json:"document_completed"`
+	NextSigners       []DocumentSigner `json:"next_signers"`
+}
+
+// activeSigners returns the signers whose turn it currently is. In parallel mode that is every
+// signer who has not completed; otherwise it is the incomplete signer with the lowest signer_order.
+func activeSigners(tx *sql.Tx, documentID uuid.UUID, parallel bool) ([]DocumentSigner, error) {
+	query := `
+		SELECT id, document_id, template_signer_id, signer_order, signer_email,
+			   COALESCE(signer_name, ''), COALESCE(access_token, ''), status, viewed_at, completed_at, created_at
+		FROM document_signers
+		WHERE document_id = $1 AND status <> 'completed'
+		ORDER BY signer_order ASC`
+
+	rows, err := tx.Query(query, documentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get active signers: %w", err)
+	}
+	defer rows.Close()
+
+	var signers []DocumentSigner
+	for rows.Next() {
+		var signer DocumentSigner
+		err := rows.Scan(
+			&signer.ID, &signer.DocumentID, &signer.TemplateSignerID, &signer.SignerOrder,
+			&signer.SignerEmail, &signer.SignerName, &signer.AccessToken, &signer.Status,
+			&signer.ViewedAt, &signer.CompletedAt, &signer.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan document signer: %w", err)
+		}
+
+		if !parallel && len(signers) > 0 && signer.SignerOrder != signers[0].SignerOrder {
+			break
+		}
+		signers = append(signers, signer)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	return signers, nil
+}
+
+// notifySignatureRequested emails every signer their signing link and creates an in-app
+// notification for those who have a FinalSign account.
+func notifySignatureRequested(tx *sql.Tx, documentID uuid.UUID, documentName string, signers []DocumentSigner) error {
+	var senderName string
+	var expiresAt *time.Time
+	err := tx.QueryRow(`
+		SELECT COALESCE(u.name, u.email), d.expires_at
+		FROM documents d
+		JOIN users u ON d.created_by = u.id
+		WHERE d.id = $1`, documentID).Scan(&senderName, &expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to load document sender: %w", err)
+	}
+
+	notificationQuery := `
+		INSERT INTO notifications (user_id, type, title, message, data)
+		SELECT u.id, 'signature_requested', $2, $3, $4
+		FROM users u
+		WHERE lower(u.email) = lower($1)`
+
+	for _, signer := range signers {
+		data, _ := json.Marshal(map[string]interface{}{
+			"document_id":   documentID,
+			"document_name": documentName,
+			"signer_id":     signer.ID,
+			"access_token":  signer.AccessToken,
+		})
+
+		_, err := tx.Exec(notificationQuery, signer.SignerEmail, "Signature Requested",
+			fmt.Sprintf("You have been asked to sign %s", documentName), string(data))
+		if err != nil {
+			// Don't fail the whole operation for notification errors
+		}
+
+		err = enqueueEmail(tx, EmailSignatureRequest, signer.SignerEmail, map[string]interface{}{
+			"document_name": documentName,
+			"sender_name":   senderName,
+			"signer_name":   signer.SignerName,
+			"access_token":  signer.AccessToken,
+			"expires_at":    expiresAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// emailDocumentCompleted sends a completion notice to the sender and every signer, once per address
+func emailDocumentCompleted(tx *sql.Tx, documentID uuid.UUID, documentName string, createdBy int) error {
+	rows, err := tx.Query(`
+		SELECT DISTINCT ON (lower(email)) email, name, is_sender
+		FROM (
+			SELECT u.email, COALESCE(u.name, '') AS name, true AS is_sender
+			FROM users u WHERE u.id = $2
+			UNION ALL
+			SELECT signer_email, COALESCE(signer_name, ''), false
+			FROM document_signers WHERE document_id = $1
+		) recipients
+		ORDER BY lower(email), is_sender DESC`, documentID, createdBy)
+	if err != nil {
+		return fmt.Errorf("failed to get completion recipients: %w", err)
+	}
+
+	type recipient struct {
+		email    string
+		name     string
+		isSender bool
+	}
+
+	var recipients []recipient
+	for rows.Next() {
+		var r recipient
+		if err := rows.Scan(&r.email, &r.name, &r.isSender); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan completion recipient: %w", err)
+		}
+		recipients = append(recipients, r)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	for _, r := range recipients {
+		err = enqueueEmail(tx, EmailDocumentCompleted, r.email, map[string]interface{}{
+			"document_id":    documentID,
+			"document_name":  documentName,
+			"recipient_name": r.name,
+			"is_sender":      r.isSender,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// markDocumentInProgress moves a sent document to in_progress once any signer starts working on it
+func markDocumentInProgress(tx *sql.Tx, documentID uuid.UUID) error {
+	_, err := tx.Exec(`
+		UPDATE documents
+		SET status = 'in_progress', updated_at = NOW()
+		WHERE id = $1 AND status = 'sent'`, documentID)
+	if err != nil {
+		return fmt.Errorf("failed to update document status: %w", err)
+	}
+
+	return nil
+}
+
+// advanceDocument is called after a signer completes. It either completes the document or
+// activates and notifies the signers whose turn has come.
+func advanceDocument(tx *sql.Tx, documentID uuid.UUID) (*SigningProgress, error) {
+	// Lock the document so two signers completing at once cannot both activate the next signer
+	var name string
+	var createdBy int
+	var parallel bool
+	err := tx.QueryRow(`
+		SELECT name, created_by, parallel_signing FROM documents
+		WHERE id = $1
+		FOR UPDATE`, documentID).Scan(&name, &createdBy, &parallel)
+	if err != nil {
+		return nil, fmt.Errorf("document not found")
+	}
+
+	remaining, err := activeSigners(tx, documentID, parallel)
+	if err != nil {
+		return nil, err
+	}
+
+	progress := &SigningProgress{DocumentID: documentID}
+
+	if len(remaining) == 0 {
+		_, err = tx.Exec(`
+			UPDATE documents
+			SET status = 'completed', completed_at = NOW(), updated_at = NOW()
+			WHERE id = $1`, documentID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to complete document: %w", err)
+		}
+		progress.DocumentCompleted = true
+
+		recordAudit(tx, AuditEntry{
+			DocumentID: &documentID,
+			Action:     "document_completed",
+		})
+
+		if err = enqueueDocumentWebhookEvent(tx, documentID, WebhookDocumentCompleted, nil); err != nil {
+			return nil, err
+		}
+
+		// Let the sender know everyone has signed
+		notificationQuery := `
+			INSERT INTO notifications (user_id, type, title, message, data)
+			VALUES ($1, 'document_completed', $2, $3, $4)`
+
+		_, err = tx.Exec(notificationQuery, createdBy, "Document Completed",
+			fmt.Sprintf("All signers have completed %s", name),
+			fmt.Sprintf(`{"document_id": "%s"}`, documentID))
+		if err != nil {
+			// Don't fail the whole operation for notification errors
+		}
+
+		if err = emailDocumentCompleted(tx, documentID, name, createdBy); err != nil {
+			return nil, err
+		}
+
+		return progress, nil
+	}
+
+	if err = markDocumentInProgress(tx, documentID); err != nil {
+		return nil, err
+	}
+
+	// In parallel mode everyone was notified when the document was sent
+	if !parallel {
+		progress.NextSigners = remaining
+		if err = notifySignatureRequested(tx, documentID, name, remaining); err != nil {
+			return nil, err
+		}
+	}
+
+	return progress, nil
+}
@@ -0,0 +1,390 @@
+package database
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// accessTokenSelectorLength is the prefix of an access token used for the indexed lookup.
+// The remainder is only ever compared in constant time.
+const accessTokenSelectorLength = 16
+
+// SigningSession is everything an external signer needs, resolved from their access token
+type SigningSession struct {
+	Signer          DocumentSigner `json:"signer"`
+	Document        Document       `json:"document"`
+	TemplateS3Key   string         `json:"-"`
+	TemplatePDFHash string         `json:"-"`
+	// WaitingOnSignerOrder is set when a lower-order signer must complete before this one can sign
+	WaitingOnSignerOrder *int `json:"waiting_on_signer_order,omitempty"`
+	// EmbedOrigins are the origins the document's workspace allows to frame the signing experience
+	EmbedOrigins []string `json:"-"`
+	// EmbedReturnURL is set when the session was resolved from an embedded session's token
+	EmbedReturnURL string `json:"-"`
+}
+
+// SendDocument moves a draft document to sent and notifies the signers whose turn it is:
+// every signer in parallel mode, otherwise only the first in signer_order.
+// It returns the signers that were notified.
+func (s *service) SendDocument(documentID uuid.UUID, userID int) ([]DocumentSigner, error) {
+	// Check if user has permission (creator, workspace owner, or admin)
+	permissionQuery := `
+		SELECT d.created_by, wm.role
+		FROM documents d
+		JOIN workspace_memberships wm ON d.workspace_id = wm.workspace_id
+		WHERE d.id = $1 AND wm.user_id = $2 AND wm.status = 'active'`
+
+	var createdBy int
+	var role string
+	err := s.db.QueryRow(permissionQuery, documentID, userID).Scan(&createdBy, &role)
+	if err != nil {
+		return nil, fmt.Errorf("document not found or access denied")
+	}
+
+	if createdBy != userID && role != "owner" && role != "admin" {
+		return nil, fmt.Errorf("insufficient permissions to send document")
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	signers, err := sendDraftDocument(tx, documentID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return signers, nil
+}
+
+// sendDraftDocument moves a draft document to sent inside tx and notifies the signers whose
+// turn it is. It returns those signers.
+func sendDraftDocument(tx *sql.Tx, documentID uuid.UUID, userID int) ([]DocumentSigner, error) {
+	updateQuery := `
+		UPDATE documents
+		SET status = 'sent', sent_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status = 'draft' AND (expires_at IS NULL OR expires_at > NOW())
+		RETURNING template_id, name, parallel_signing`
+
+	var templateID uuid.UUID
+	var name string
+	var parallel bool
+	err := tx.QueryRow(updateQuery, documentID).Scan(&templateID, &name, &parallel)
+	if err != nil {
+		return nil, fmt.Errorf("document not found or already sent")
+	}
+
+	recordAudit(tx, AuditEntry{
+		DocumentID: &documentID,
+		TemplateID: &templateID,
+		UserID:     &userID,
+		Action:     "document_sent",
+	})
+
+	signers, err := activeSigners(tx, documentID, parallel)
+	if err != nil {
+		return nil, err
+	}
+
+	err = enqueueDocumentWebhookEvent(tx, documentID, WebhookDocumentSent, map[string]interface{}{
+		"sent_by": userID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err = notifySignatureRequested(tx, documentID, name, signers); err != nil {
+		return nil, err
+	}
+
+	return signers, nil
+}
+
+// GetSigningSessionByToken resolves a signer access token or the token of a redeemed embedded
+// session. The indexed lookup only uses the token's selector prefix; the full token is compared
+// in constant time.
+func (s *service) GetSigningSessionByToken(token string) (*SigningSession, error) {
+	if len(token) <= accessTokenSelectorLength {
+		return nil, fmt.Errorf("signing session not found")
+	}
+
+	// Voiding a document clears its signers' access tokens, which also ends their embedded sessions
+	query := `
+		SELECT ds.id, ds.document_id, ds.template_signer_id, ds.signer_order, ds.signer_email,
+			   COALESCE(ds.signer_name, ''), ds.access_token, ds.status, ds.viewed_at, ds.completed_at, ds.created_at,
+			   d.id, d.template_id, d.template_version_id, d.name, d.s3_bucket, d.s3_key, d.template_snapshot_hash,
+			   d.final_document_hash, d.created_by, d.workspace_id, d.status, d.expires_at,
+			   d.sent_at, d.created_at, d.updated_at, d.completed_at, d.parallel_signing,
+			   tv.s3_key, tv.pdf_hash, array_to_string(w.embed_allowed_origins, ' '),
+			   candidate.token, candidate.return_url
+		FROM (
+			SELECT id AS signer_id, access_token AS token, '' AS return_url
+			FROM document_signers
+			WHERE left(access_token, 16) = $1
+			UNION ALL
+			SELECT signer_id, access_token, return_url
+			FROM embedded_signing_sessions
+			WHERE left(access_token, 16) = $1 AND access_token_expires_at > NOW()
+		) candidate
+		JOIN document_signers ds ON candidate.signer_id = ds.id
+		JOIN documents d ON ds.document_id = d.id
+		JOIN template_versions tv ON d.template_version_id = tv.id
+		JOIN workspaces w ON d.workspace_id = w.id
+		WHERE ds.access_token IS NOT NULL`
+
+	rows, err := s.db.Query(query, token[:accessTokenSelectorLength])
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up signing session: %w", err)
+	}
+	defer rows.Close()
+
+	var found *SigningSession
+	for rows.Next() {
+		session := &SigningSession{}
+		signer := &session.Signer
+		document := &session.Document
+		var embedOrigins, candidateToken string
+		err := rows.Scan(
+			&signer.ID, &signer.DocumentID, &signer.TemplateSignerID, &signer.SignerOrder,
+			&signer.SignerEmail, &signer.SignerName, &signer.AccessToken, &signer.Status,
+			&signer.ViewedAt, &signer.CompletedAt, &signer.CreatedAt,
+			&document.ID, &document.TemplateID, &document.TemplateVersionID, &document.Name, &document.S3Bucket,
+			&document.S3Key, &document.TemplateSnapshotHash, &document.FinalDocumentHash,
+			&document.CreatedBy, &document.WorkspaceID, &document.Status, &document.ExpiresAt,
+			&document.SentAt, &document.CreatedAt, &document.UpdatedAt, &document.CompletedAt,
+			&document.ParallelSigning, &session.TemplateS3Key, &session.TemplatePDFHash,
+			&embedOrigins, &candidateToken, &session.EmbedReturnURL,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan signing session: %w", err)
+		}
+		// Origins never contain spaces, so the array round-trips through a space-separated string
+		session.EmbedOrigins = strings.Fields(embedOrigins)
+
+		if subtle.ConstantTimeCompare([]byte(candidateToken), []byte(token)) == 1 {
+			found = session
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	if found == nil {
+		return nil, fmt.Errorf("signing session not found")
+	}
+
+	switch found.Document.Status {
+	case "cancelled":
+		return nil, fmt.Errorf("document has been cancelled")
+	case "declined":
+		return nil, fmt.Errorf("document has been declined")
+	case "expired":
+		return nil, fmt.Errorf("document has expired")
+	case "draft", "scheduled":
+		return nil, fmt.Errorf("document has not been sent")
+	}
+
+	if found.Document.ExpiresAt != nil && found.Document.ExpiresAt.Before(time.Now()) {
+		return nil, fmt.Errorf("document has expired")
+	}
+
+	// In sequential mode a signer must wait until every lower-order signer has completed
+	if !found.Document.ParallelSigning && found.Signer.Status != "completed" {
+		var waitingOn sql.NullInt64
+		err = s.db.QueryRow(`
+			SELECT MIN(signer_order) FROM document_signers
+			WHERE document_id = $1 AND signer_order < $2 AND status <> 'completed'`,
+			found.Document.ID, found.Signer.SignerOrder).Scan(&waitingOn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check signing order: %w", err)
+		}
+		if waitingOn.Valid {
+			order := int(waitingOn.Int64)
+			found.WaitingOnSignerOrder = &order
+		}
+	}
+
+	return found, nil
+}
+
+// GetTemplateFieldsForSigner retrieves the fields assigned to a single template signer role
+func (s *service) GetTemplateFieldsForSigner(templateSignerID uuid.UUID) ([]TemplateField, error) {
+	query := `
+		SELECT id, template_id, signer_id, field_name, field_type, COALESCE(field_label, ''),
+			   COALESCE(placeholder_text, ''), position_data, COALESCE(validation_rules, '{}'), COALESCE(required, false),
+			   created_at, version
+		FROM template_fields
+		WHERE signer_id = $1
+		ORDER BY created_at ASC`
+
+	rows, err := s.db.Query(query, templateSignerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get signer fields: %w", err)
+	}
+	defer rows.Close()
+
+	var fields []TemplateField
+	for rows.Next() {
+		var field TemplateField
+		err := rows.Scan(
+			&field.ID, &field.TemplateID, &field.SignerID, &field.FieldName, &field.FieldType,
+			&field.FieldLabel, &field.PlaceholderText, &field.PositionData,
+			&field.ValidationRules, &field.Required, &field.CreatedAt, &field.Version,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan template field: %w", err)
+		}
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
+
+// MarkDocumentSignerViewed records the first time a signer opens their document
+func (s *service) MarkDocumentSignerViewed(signerID uuid.UUID, ipAddress, userAgent string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var documentID uuid.UUID
+	var signerEmail string
+	err = tx.QueryRow(`
+		UPDATE document_signers
+		SET status = 'viewed', viewed_at = NOW()
+		WHERE id = $1 AND status = 'pending'
+		RETURNING document_id, signer_email`, signerID).Scan(&documentID, &signerEmail)
+	if err == sql.ErrNoRows {
+		// Already viewed; only the first view is recorded
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to mark signer as viewed: %w", err)
+	}
+
+	recordAudit(tx, AuditEntry{
+		DocumentID: &documentID,
+		Action:     "document_viewed",
+		Details: map[string]interface{}{
+			"signer_id":    signerID,
+			"signer_email": signerEmail,
+		},
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+	})
+
+	err = enqueueDocumentWebhookEvent(tx, documentID, WebhookDocumentViewed, map[string]interface{}{
+		"signer_id":    signerID,
+		"signer_email": signerEmail,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// StartDocumentSigner moves a signer to in_progress once they begin filling fields.
+// The document itself moves from sent to in_progress at the same time.
+func (s *service) StartDocumentSigner(signerID uuid.UUID) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var documentID uuid.UUID
+	var status string
+	err = tx.QueryRow(`
+		SELECT document_id, status FROM document_signers
+		WHERE id = $1
+		FOR UPDATE`, signerID).Scan(&documentID, &status)
+	if err != nil {
+		return fmt.Errorf("signer not found")
+	}
+
+	if status == "completed" {
+		return fmt.Errorf("signer has already completed")
+	}
+
+	_, err = tx.Exec(`
+		UPDATE document_signers
+		SET status = 'in_progress', viewed_at = COALESCE(viewed_at, NOW())
+		WHERE id = $1 AND status IN ('pending', 'viewed')`, signerID)
+	if err != nil {
+		return fmt.Errorf("failed to start signing: %w", err)
+	}
+
+	if err = markDocumentInProgress(tx, documentID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CompleteDocumentSigner marks a signer as finished and routes the document onward:
+// the next signer in order is notified, or the document is completed once everyone has signed.
+// The IP address and user agent are kept with the signing event for the digital signature record.
+func (s *service) CompleteDocumentSigner(signerID uuid.UUID, ipAddress, userAgent string) (*SigningProgress, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	updateQuery := `
+		UPDATE document_signers
+		SET status = 'completed', completed_at = NOW()
+		WHERE id = $1 AND status IN ('viewed', 'in_progress')
+		RETURNING document_id, signer_email`
+
+	var documentID uuid.UUID
+	var signerEmail string
+	err = tx.QueryRow(updateQuery, signerID).Scan(&documentID, &signerEmail)
+	if err != nil {
+		return nil, fmt.Errorf("signer has already completed or has not opened the document")
+	}
+
+	recordAudit(tx, AuditEntry{
+		DocumentID: &documentID,
+		Action:     "document_signed",
+		Details: map[string]interface{}{
+			"signer_id":    signerID,
+			"signer_email": signerEmail,
+		},
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+	})
+
+	progress, err := advanceDocument(tx, documentID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Queued after advanceDocument so the event carries the document's new status
+	err = enqueueDocumentWebhookEvent(tx, documentID, WebhookDocumentSigned, map[string]interface{}{
+		"signer_id":    signerID,
+		"signer_email": signerEmail,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return progress, nil
+}
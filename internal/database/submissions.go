@@ -0,0 +1,171 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FormSubmission is a single encrypted field value entered by a document signer
+type FormSubmission struct {
+	ID               uuid.UUID `json:"id"`
+	DocumentID       uuid.UUID `json:"document_id"`
+	DocumentSignerID uuid.UUID `json:"document_signer_id"`
+	FieldID          uuid.UUID `json:"field_id"`
+	FieldName        string    `json:"field_name"`
+	FieldType        string    `json:"field_type"`
+	EncryptedValue   *string   `json:"-"` // null for empty optional fields
+	EncryptionKeyID  string    `json:"encryption_key_id"`
+	SubmittedAt      time.Time `json:"submitted_at"`
+	IPAddress        string    `json:"ip_address"`
+	UserAgent        string    `json:"user_agent"`
+}
+
+// UpsertFormSubmissions saves a signer's field values, replacing any earlier value for the same field.
+// The signer is moved to in_progress if they have not started yet.
+func (s *service) UpsertFormSubmissions(documentSignerID uuid.UUID, submissions []FormSubmission) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the signer row so a concurrent completion cannot race the submission
+	var documentID uuid.UUID
+	var status string
+	err = tx.QueryRow(`
+		SELECT document_id, status FROM document_signers
+		WHERE id = $1
+		FOR UPDATE`, documentSignerID).Scan(&documentID, &status)
+	if err != nil {
+		return fmt.Errorf("signer not found")
+	}
+
+	if status == "completed" {
+		return fmt.Errorf("signer has already completed")
+	}
+
+	submissionQuery := `
+		INSERT INTO form_submissions (document_id, document_signer_id, field_id, field_name, field_type,
+			encrypted_value, encryption_key_id, submitted_at, ip_address, user_agent)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), NULLIF($8, '')::inet, $9)
+		ON CONFLICT ON CONSTRAINT form_submissions_unique_field_per_document_signer
+		DO UPDATE SET
+			encrypted_value = EXCLUDED.encrypted_value,
+			encryption_key_id = EXCLUDED.encryption_key_id,
+			submitted_at = NOW(),
+			ip_address = EXCLUDED.ip_address,
+			user_agent = EXCLUDED.user_agent`
+
+	fieldNames := make([]string, 0, len(submissions))
+	for _, submission := range submissions {
+		_, err = tx.Exec(
+			submissionQuery,
+			documentID,
+			documentSignerID,
+			submission.FieldID,
+			submission.FieldName,
+			submission.FieldType,
+			submission.EncryptedValue,
+			submission.EncryptionKeyID,
+			submission.IPAddress,
+			submission.UserAgent,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save field %s: %w", submission.FieldName, err)
+		}
+		fieldNames = append(fieldNames, submission.FieldName)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE document_signers
+		SET status = 'in_progress', viewed_at = COALESCE(viewed_at, NOW())
+		WHERE id = $1 AND status IN ('pending', 'viewed')`, documentSignerID)
+	if err != nil {
+		return fmt.Errorf("failed to update signer status: %w", err)
+	}
+
+	if err = markDocumentInProgress(tx, documentID); err != nil {
+		return err
+	}
+
+	if len(submissions) > 0 {
+		recordAudit(tx, AuditEntry{
+			DocumentID: &documentID,
+			Action:     "field_filled",
+			Details: map[string]interface{}{
+				"signer_id": documentSignerID,
+				"fields":    fieldNames,
+			},
+			IPAddress: submissions[0].IPAddress,
+			UserAgent: submissions[0].UserAgent,
+		})
+	}
+
+	return tx.Commit()
+}
+
+// GetSignerFormSubmissions retrieves all submitted values for a document signer
+func (s *service) GetSignerFormSubmissions(documentSignerID uuid.UUID) ([]FormSubmission, error) {
+	query := `
+		SELECT id, document_id, document_signer_id, field_id, field_name, field_type,
+			   encrypted_value, COALESCE(encryption_key_id, ''), submitted_at,
+			   COALESCE(host(ip_address), ''), COALESCE(user_agent, '')
+		FROM form_submissions
+		WHERE document_signer_id = $1
+		ORDER BY submitted_at ASC`
+
+	rows, err := s.db.Query(query, documentSignerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get form submissions: %w", err)
+	}
+	defer rows.Close()
+
+	var submissions []FormSubmission
+	for rows.Next() {
+		var submission FormSubmission
+		err := rows.Scan(
+			&submission.ID, &submission.DocumentID, &submission.DocumentSignerID, &submission.FieldID,
+			&submission.FieldName, &submission.FieldType, &submission.EncryptedValue,
+			&submission.EncryptionKeyID, &submission.SubmittedAt, &submission.IPAddress, &submission.UserAgent,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan form submission: %w", err)
+		}
+		submissions = append(submissions, submission)
+	}
+
+	return submissions, nil
+}
+
+// GetMissingRequiredFields returns the names of required fields the signer has not filled in yet
+func (s *service) GetMissingRequiredFields(documentSignerID uuid.UUID) ([]string, error) {
+	query := `
+		SELECT tf.field_name
+		FROM document_signers ds
+		JOIN template_fields tf ON tf.signer_id = ds.template_signer_id
+		WHERE ds.id = $1 AND (tf.required = true OR tf.validation_rules->>'required' = 'true')
+		AND NOT EXISTS (
+			SELECT 1 FROM form_submissions fs
+			WHERE fs.document_signer_id = ds.id AND fs.field_id = tf.id AND fs.encrypted_value IS NOT NULL
+		)
+		ORDER BY tf.created_at ASC`
+
+	rows, err := s.db.Query(query, documentSignerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check required fields: %w", err)
+	}
+	defer rows.Close()
+
+	missing := []string{}
+	for rows.Next() {
+		var fieldName string
+		if err := rows.Scan(&fieldName); err != nil {
+			return nil, fmt.Errorf("failed to scan field name: %w", err)
+		}
+		missing = append(missing, fieldName)
+	}
+
+	return missing, nil
+}
@@ -0,0 +1,711 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TemplateVersion is one version of a template's PDF, signers and fields. A template has at most
+// one draft, which is the only version that can be edited, and one published version, which new
+// documents are created from. Published versions are never changed; publishing a draft
+// supersedes the previous one.
+type TemplateVersion struct {
+	ID            uuid.UUID               `json:"id"`
+	TemplateID    uuid.UUID               `json:"template_id"`
+	Version       int                     `json:"version"`
+	Status        string                  `json:"status"` // draft, published, superseded
+	S3Bucket      string                  `json:"s3_bucket"`
+	S3Key         string                  `json:"s3_key"`
+	PDFHash       string                  `json:"pdf_hash"`
+	FileSize      int64                   `json:"file_size"`
+	MimeType      string                  `json:"mime_type"`
+	TotalPages    int                     `json:"total_pages"`
+	Pages         []TemplatePage          `json:"pages,omitempty"` // nil for PDFs uploaded before pages were inspected
+	Changes       []TemplateVersionChange `json:"changes"`
+	CreatedBy     int                     `json:"created_by"`
+	CreatorName   string                  `json:"creator_name"`
+	CreatorEmail  string                  `json:"creator_email"`
+	CreatedAt     time.Time               `json:"created_at"`
+	UpdatedAt     time.Time               `json:"updated_at"`
+	PublishedBy   *int                    `json:"published_by,omitempty"`
+	PublisherName *string                 `json:"publisher_name,omitempty"`
+	PublishedAt   *time.Time              `json:"published_at,omitempty"`
+}
+
+// TemplateVersionChange is one edit made to a version while it was a draft
+type TemplateVersionChange struct {
+	Change    string                 `json:"change"` // created, signers, fields, pdf
+	UserID    int                    `json:"user_id"`
+	UserName  string                 `json:"user_name"`
+	ChangedAt time.Time              `json:"changed_at"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+type TemplateVersionWithSignersAndFields struct {
+	TemplateVersion
+	Signers []TemplateSigner `json:"signers"`
+	Fields  []TemplateField  `json:"fields"`
+}
+
+// TemplatePage is the size of one page of a template PDF, as read from the file on upload.
+// Width and Height are in points, as the page is displayed after Rotation.
+type TemplatePage struct {
+	Page     int        `json:"page"`
+	Width    float64    `json:"width"`
+	Height   float64    `json:"height"`
+	Rotation int        `json:"rotation"`
+	MediaBox [4]float64 `json:"media_box"`
+}
+
+// encodeTemplatePages returns the JSON stored in template_versions.pages, or nil for no pages
+func encodeTemplatePages(pages []TemplatePage) ([]byte, error) {
+	if len(pages) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(pages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode template pages: %w", err)
+	}
+	return data, nil
+}
+
+// TemplatePDF is an uploaded PDF that replaces a template's draft PDF
+type TemplatePDF struct {
+	S3Bucket   string
+	S3Key      string
+	PDFHash    string
+	FileSize   int64
+	MimeType   string
+	TotalPages int
+	Pages      []TemplatePage
+	// EncryptionKeyID is the data key the PDF was encrypted with
+	EncryptionKeyID string
+}
+
+// TemplatePDFReplacement is the result of replacing a draft's PDF
+type TemplatePDFReplacement struct {
+	Version *TemplateVersion
+	// FieldsOffPage are the draft's fields placed on pages the new PDF does not have. The draft
+	// cannot be published until they are moved or removed.
+	FieldsOffPage []TemplateFieldOffPage
+	// OrphanedS3Key is the replaced PDF's key when no other version uses it, so the caller can
+	// delete the file
+	OrphanedS3Key string
+}
+
+// TemplateFieldOffPage is a field positioned beyond the last page of its version's PDF
+type TemplateFieldOffPage struct {
+	FieldID   uuid.UUID `json:"field_id"`
+	FieldName string    `json:"field_name"`
+	SignerID  uuid.UUID `json:"signer_id"`
+	Page      int       `json:"page"`
+}
+
+// fieldsOffPage returns a version's fields that are on pages after totalPages
+func fieldsOffPage(tx *sql.Tx, versionID uuid.UUID, totalPages int) ([]TemplateFieldOffPage, error) {
+	rows, err := tx.Query(`
+		SELECT id, field_name, signer_id, CEIL((position_data->>'page')::numeric)::int
+		FROM template_fields
+		WHERE template_version_id = $1 AND COALESCE((position_data->>'page')::numeric, 1) > $2
+		ORDER BY created_at ASC`, versionID, totalPages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check field pages: %w", err)
+	}
+	defer rows.Close()
+
+	fields := []TemplateFieldOffPage{}
+	for rows.Next() {
+		var field TemplateFieldOffPage
+		if err := rows.Scan(&field.FieldID, &field.FieldName, &field.SignerID, &field.Page); err != nil {
+			return nil, fmt.Errorf("failed to scan template field: %w", err)
+		}
+		fields = append(fields, field)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	return fields, nil
+}
+
+const templateVersionColumns = `
+	tv.id, tv.template_id, tv.version, tv.status, tv.s3_bucket, tv.s3_key, tv.pdf_hash, tv.file_size,
+	COALESCE(tv.mime_type, 'application/pdf'), tv.total_pages, tv.pages, tv.changes, tv.created_by, cu.name, cu.email,
+	tv.created_at, tv.updated_at, tv.published_by, pu.name, tv.published_at
+	FROM template_versions tv
+	JOIN users cu ON tv.created_by = cu.id
+	LEFT JOIN users pu ON tv.published_by = pu.id`
+
+func scanTemplateVersion(row rowScanner) (*TemplateVersion, error) {
+	version := &TemplateVersion{}
+	var pages, changes []byte
+	err := row.Scan(
+		&version.ID, &version.TemplateID, &version.Version, &version.Status, &version.S3Bucket,
+		&version.S3Key, &version.PDFHash, &version.FileSize, &version.MimeType, &version.TotalPages,
+		&pages, &changes, &version.CreatedBy, &version.CreatorName, &version.CreatorEmail,
+		&version.CreatedAt, &version.UpdatedAt, &version.PublishedBy, &version.PublisherName,
+		&version.PublishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if pages != nil {
+		if err := json.Unmarshal(pages, &version.Pages); err != nil {
+			return nil, fmt.Errorf("failed to decode template pages: %w", err)
+		}
+	}
+
+	version.Changes = []TemplateVersionChange{}
+	if err := json.Unmarshal(changes, &version.Changes); err != nil {
+		return nil, fmt.Errorf("failed to decode template version changes: %w", err)
+	}
+	return version, nil
+}
+
+// checkTemplateEditor returns the template if the user may edit it: its creator, or a workspace
+// owner or admin
+func (s *service) checkTemplateEditor(templateID uuid.UUID, userID int) (*Template, error) {
+	template, err := s.GetTemplateByID(templateID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	permissionQuery := `
+		SELECT wm.role
+		FROM workspace_memberships wm
+		WHERE wm.workspace_id = $1 AND wm.user_id = $2 AND wm.status = 'active'`
+
+	var role string
+	err = s.db.QueryRow(permissionQuery, template.WorkspaceID, userID).Scan(&role)
+	if err != nil {
+		return nil, fmt.Errorf("access denied")
+	}
+
+	if template.CreatedBy != userID && role != "owner" && role != "admin" {
+		return nil, fmt.Errorf("insufficient permissions to modify template")
+	}
+
+	return template, nil
+}
+
+// ensureTemplateDraft returns the template's draft version, creating one as a copy of the
+// published version if there is none. signerIDs maps each published signer ID to the ID of the
+// draft signer with the same signer_order.
+func ensureTemplateDraft(tx *sql.Tx, templateID uuid.UUID, userID int) (draftID uuid.UUID, draftVersion int, signerIDs map[uuid.UUID]uuid.UUID, err error) {
+	// Serializes draft creation and publishing for the template
+	var publishedID uuid.UUID
+	err = tx.QueryRow(`SELECT published_version_id FROM templates WHERE id = $1 FOR UPDATE`, templateID).Scan(&publishedID)
+	if err != nil {
+		return uuid.Nil, 0, nil, fmt.Errorf("template not found")
+	}
+
+	err = tx.QueryRow(`
+		SELECT id, version FROM template_versions
+		WHERE template_id = $1 AND status = 'draft'`, templateID).Scan(&draftID, &draftVersion)
+	switch {
+	case err == nil:
+		signerIDs, err = mapDraftSigners(tx, publishedID, draftID)
+		return draftID, draftVersion, signerIDs, err
+	case err != sql.ErrNoRows:
+		return uuid.Nil, 0, nil, fmt.Errorf("failed to find template draft: %w", err)
+	}
+
+	draftQuery := `
+		INSERT INTO template_versions (template_id, version, status, s3_bucket, s3_key, pdf_hash,
+			file_size, mime_type, total_pages, pages, created_by, encryption_key_id)
+		SELECT template_id,
+			   (SELECT MAX(version) + 1 FROM template_versions WHERE template_id = $1),
+			   'draft', s3_bucket, s3_key, pdf_hash, file_size, mime_type, total_pages, pages, $3,
+			   encryption_key_id
+		FROM template_versions
+		WHERE id = $2
+		RETURNING id, version`
+
+	err = tx.QueryRow(draftQuery, templateID, publishedID, userID).Scan(&draftID, &draftVersion)
+	if err != nil {
+		return uuid.Nil, 0, nil, fmt.Errorf("failed to create template draft: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO template_signers (template_id, template_version_id, signer_order, signer_name,
+			signer_color, created_at)
+		SELECT template_id, $2, signer_order, signer_name, signer_color, created_at
+		FROM template_signers
+		WHERE template_version_id = $1`, publishedID, draftID)
+	if err != nil {
+		return uuid.Nil, 0, nil, fmt.Errorf("failed to copy template signers: %w", err)
+	}
+
+	// Fields keep their creation time so they stay in the same order
+	_, err = tx.Exec(`
+		INSERT INTO template_fields (template_id, template_version_id, signer_id, field_name, field_type,
+			field_label, placeholder_text, position_data, validation_rules, required, created_at, version)
+		SELECT tf.template_id, $2, draft_signer.id, tf.field_name, tf.field_type, tf.field_label,
+			   tf.placeholder_text, tf.position_data, tf.validation_rules, tf.required, tf.created_at, $3
+		FROM template_fields tf
+		JOIN template_signers published_signer ON tf.signer_id = published_signer.id
+		JOIN template_signers draft_signer ON draft_signer.template_version_id = $2
+			AND draft_signer.signer_order = published_signer.signer_order
+		WHERE tf.template_version_id = $1`, publishedID, draftID, draftVersion)
+	if err != nil {
+		return uuid.Nil, 0, nil, fmt.Errorf("failed to copy template fields: %w", err)
+	}
+
+	signerIDs, err = mapDraftSigners(tx, publishedID, draftID)
+	return draftID, draftVersion, signerIDs, err
+}
+
+// mapDraftSigners maps each published signer ID to the draft signer with the same signer_order
+func mapDraftSigners(tx *sql.Tx, publishedID, draftID uuid.UUID) (map[uuid.UUID]uuid.UUID, error) {
+	rows, err := tx.Query(`
+		SELECT published_signer.id, draft_signer.id
+		FROM template_signers published_signer
+		JOIN template_signers draft_signer ON draft_signer.template_version_id = $2
+			AND draft_signer.signer_order = published_signer.signer_order
+		WHERE published_signer.template_version_id = $1`, publishedID, draftID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map template signers: %w", err)
+	}
+	defer rows.Close()
+
+	signerIDs := make(map[uuid.UUID]uuid.UUID)
+	for rows.Next() {
+		var publishedSignerID, draftSignerID uuid.UUID
+		if err := rows.Scan(&publishedSignerID, &draftSignerID); err != nil {
+			return nil, fmt.Errorf("failed to scan template signer: %w", err)
+		}
+		signerIDs[publishedSignerID] = draftSignerID
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	return signerIDs, nil
+}
+
+// recordTemplateVersionChange appends an entry to a draft's change history
+func recordTemplateVersionChange(exec execer, versionID uuid.UUID, userID int, change string, details map[string]interface{}) error {
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return fmt.Errorf("failed to encode template change: %w", err)
+	}
+
+	_, err = exec.Exec(`
+		UPDATE template_versions
+		SET changes = changes || jsonb_build_array(jsonb_build_object(
+				'change', $3::text,
+				'user_id', $2::int,
+				'user_name', COALESCE((SELECT name FROM users WHERE id = $2), ''),
+				'changed_at', NOW(),
+				'details', $4::jsonb
+			)),
+			updated_at = NOW()
+		WHERE id = $1`, versionID, userID, change, string(detailsJSON))
+	if err != nil {
+		return fmt.Errorf("failed to record template change: %w", err)
+	}
+	return nil
+}
+
+// getTemplateVersionByID returns a version without its signers and fields
+func (s *service) getTemplateVersionByID(versionID uuid.UUID) (*TemplateVersion, error) {
+	version, err := scanTemplateVersion(s.db.QueryRow(`
+		SELECT`+templateVersionColumns+`
+		WHERE tv.id = $1`, versionID))
+	if err != nil {
+		return nil, fmt.Errorf("template version not found")
+	}
+	return version, nil
+}
+
+// getTemplateVersionSigners returns a version's signers in signing order
+func (s *service) getTemplateVersionSigners(versionID uuid.UUID) ([]TemplateSigner, error) {
+	query := `
+		SELECT id, template_id, template_version_id, signer_order, signer_name, signer_color, created_at
+		FROM template_signers
+		WHERE template_version_id = $1
+		ORDER BY signer_order ASC`
+
+	rows, err := s.db.Query(query, versionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get template signers: %w", err)
+	}
+	defer rows.Close()
+
+	var signers []TemplateSigner
+	for rows.Next() {
+		var signer TemplateSigner
+		err := rows.Scan(
+			&signer.ID, &signer.TemplateID, &signer.TemplateVersionID, &signer.SignerOrder,
+			&signer.SignerName, &signer.SignerColor, &signer.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan template signer: %w", err)
+		}
+		signers = append(signers, signer)
+	}
+
+	return signers, nil
+}
+
+// getTemplateVersionFields returns a version's fields grouped by signer
+func (s *service) getTemplateVersionFields(versionID uuid.UUID) ([]TemplateField, error) {
+	query := `
+		SELECT tf.id, tf.template_id, tf.template_version_id, tf.signer_id, tf.field_name, tf.field_type,
+			   tf.field_label, tf.placeholder_text, tf.position_data, tf.validation_rules, tf.required,
+			   tf.created_at, tf.version
+		FROM template_fields tf
+		JOIN template_signers ts ON tf.signer_id = ts.id
+		WHERE tf.template_version_id = $1
+		ORDER BY ts.signer_order ASC, tf.created_at ASC`
+
+	rows, err := s.db.Query(query, versionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get template fields: %w", err)
+	}
+	defer rows.Close()
+
+	var fields []TemplateField
+	for rows.Next() {
+		var field TemplateField
+		err := rows.Scan(
+			&field.ID, &field.TemplateID, &field.TemplateVersionID, &field.SignerID, &field.FieldName,
+			&field.FieldType, &field.FieldLabel, &field.PlaceholderText, &field.PositionData,
+			&field.ValidationRules, &field.Required, &field.CreatedAt, &field.Version,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan template field: %w", err)
+		}
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
+
+// withSignersAndFields loads a version's signers and fields
+func (s *service) withSignersAndFields(version *TemplateVersion) (*TemplateVersionWithSignersAndFields, error) {
+	signers, err := s.getTemplateVersionSigners(version.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := s.getTemplateVersionFields(version.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TemplateVersionWithSignersAndFields{
+		TemplateVersion: *version,
+		Signers:         signers,
+		Fields:          fields,
+	}, nil
+}
+
+// ListTemplateVersions returns a template's version history, newest first, with who created,
+// changed and published each version
+func (s *service) ListTemplateVersions(templateID uuid.UUID, userID int) ([]TemplateVersion, error) {
+	if _, err := s.GetTemplateByID(templateID, userID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT`+templateVersionColumns+`
+		WHERE tv.template_id = $1
+		ORDER BY tv.version DESC`, templateID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list template versions: %w", err)
+	}
+	defer rows.Close()
+
+	versions := []TemplateVersion{}
+	for rows.Next() {
+		version, err := scanTemplateVersion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan template version: %w", err)
+		}
+		versions = append(versions, *version)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	return versions, nil
+}
+
+// GetTemplateVersion returns one version of a template, including superseded versions and the
+// draft, with its signers and fields
+func (s *service) GetTemplateVersion(templateID uuid.UUID, versionNumber int, userID int) (*TemplateVersionWithSignersAndFields, error) {
+	if _, err := s.GetTemplateByID(templateID, userID); err != nil {
+		return nil, err
+	}
+
+	version, err := scanTemplateVersion(s.db.QueryRow(`
+		SELECT`+templateVersionColumns+`
+		WHERE tv.template_id = $1 AND tv.version = $2`, templateID, versionNumber))
+	if err != nil {
+		return nil, fmt.Errorf("template version not found")
+	}
+
+	return s.withSignersAndFields(version)
+}
+
+// GetEditableTemplateVersion returns the template's draft if it has one, otherwise its published
+// version. Edits are made to this version's signers and fields.
+func (s *service) GetEditableTemplateVersion(templateID uuid.UUID, userID int) (*TemplateVersionWithSignersAndFields, error) {
+	if _, err := s.GetTemplateByID(templateID, userID); err != nil {
+		return nil, err
+	}
+
+	version, err := scanTemplateVersion(s.db.QueryRow(`
+		SELECT`+templateVersionColumns+`
+		WHERE tv.template_id = $1 AND tv.status IN ('draft', 'published')
+		ORDER BY tv.status = 'draft' DESC
+		LIMIT 1`, templateID))
+	if err != nil {
+		return nil, fmt.Errorf("template version not found")
+	}
+
+	return s.withSignersAndFields(version)
+}
+
+// PublishTemplateDraft makes the template's draft the version new documents are created from.
+// Documents created from earlier versions keep using them.
+func (s *service) PublishTemplateDraft(templateID uuid.UUID, userID int) (*TemplateVersion, error) {
+	if _, err := s.checkTemplateEditor(templateID, userID); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`SELECT 1 FROM templates WHERE id = $1 FOR UPDATE`, templateID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock template: %w", err)
+	}
+
+	var draftID uuid.UUID
+	var draftVersion, signerCount, totalPages int
+	err = tx.QueryRow(`
+		SELECT tv.id, tv.version, tv.total_pages,
+			   (SELECT COUNT(*) FROM template_signers ts WHERE ts.template_version_id = tv.id)
+		FROM template_versions tv
+		WHERE tv.template_id = $1 AND tv.status = 'draft'`, templateID).Scan(&draftID, &draftVersion, &totalPages, &signerCount)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("template has no draft to publish")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find template draft: %w", err)
+	}
+
+	if signerCount == 0 {
+		return nil, fmt.Errorf("template draft has no signers")
+	}
+
+	offPage, err := fieldsOffPage(tx, draftID, totalPages)
+	if err != nil {
+		return nil, err
+	}
+	if len(offPage) > 0 {
+		return nil, fmt.Errorf("%d fields are on pages the template PDF does not have", len(offPage))
+	}
+
+	_, err = tx.Exec(`
+		UPDATE template_versions SET status = 'superseded', updated_at = NOW()
+		WHERE template_id = $1 AND status = 'published'`, templateID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to supersede published version: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE template_versions
+		SET status = 'published', published_by = $2, published_at = NOW(), updated_at = NOW()
+		WHERE id = $1`, draftID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to publish template draft: %w", err)
+	}
+
+	// The template row mirrors the published version's PDF
+	_, err = tx.Exec(`
+		UPDATE templates t
+		SET published_version_id = tv.id, version = tv.version, s3_bucket = tv.s3_bucket,
+			s3_key = tv.s3_key, pdf_hash = tv.pdf_hash, file_size = tv.file_size,
+			mime_type = tv.mime_type, total_pages = tv.total_pages, updated_at = NOW()
+		FROM template_versions tv
+		WHERE t.id = $1 AND tv.id = $2`, templateID, draftID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update template: %w", err)
+	}
+
+	recordAudit(tx, AuditEntry{
+		TemplateID: &templateID,
+		UserID:     &userID,
+		Action:     "template_updated",
+		Details: map[string]interface{}{
+			"change":  "published",
+			"version": draftVersion,
+		},
+	})
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return s.getTemplateVersionByID(draftID)
+}
+
+// DiscardTemplateDraft deletes the template's draft. It returns the S3 key of the draft's PDF
+// when no other version uses it, so the caller can delete the file.
+func (s *service) DiscardTemplateDraft(templateID uuid.UUID, userID int) (string, error) {
+	if _, err := s.checkTemplateEditor(templateID, userID); err != nil {
+		return "", err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var draftVersion int
+	var s3Key string
+	err = tx.QueryRow(`
+		DELETE FROM template_versions
+		WHERE template_id = $1 AND status = 'draft'
+		RETURNING version, s3_key`, templateID).Scan(&draftVersion, &s3Key)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("template has no draft to discard")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to discard template draft: %w", err)
+	}
+
+	orphanedKey, err := unreferencedTemplatePDF(tx, s3Key)
+	if err != nil {
+		return "", err
+	}
+
+	recordAudit(tx, AuditEntry{
+		TemplateID: &templateID,
+		UserID:     &userID,
+		Action:     "template_updated",
+		Details: map[string]interface{}{
+			"change":  "draft_discarded",
+			"version": draftVersion,
+		},
+	})
+
+	if err = tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return orphanedKey, nil
+}
+
+// ReplaceTemplatePDF puts a new PDF on the template's draft, creating the draft if needed. Fields
+// keep their positions; any that end up on pages the new PDF does not have are reported rather
+// than removed.
+func (s *service) ReplaceTemplatePDF(templateID uuid.UUID, pdf TemplatePDF, userID int) (*TemplatePDFReplacement, error) {
+	if _, err := s.checkTemplateEditor(templateID, userID); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	draftID, draftVersion, _, err := ensureTemplateDraft(tx, templateID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	pages, err := encodeTemplatePages(pdf.Pages)
+	if err != nil {
+		return nil, err
+	}
+
+	var previousKey string
+	err = tx.QueryRow(`
+		UPDATE template_versions tv
+		SET s3_bucket = $2, s3_key = $3, pdf_hash = $4, file_size = $5, mime_type = $6,
+			total_pages = $7, encryption_key_id = NULLIF($8, ''), pages = $9, updated_at = NOW()
+		FROM template_versions previous
+		WHERE tv.id = $1 AND previous.id = tv.id
+		RETURNING previous.s3_key`,
+		draftID, pdf.S3Bucket, pdf.S3Key, pdf.PDFHash, pdf.FileSize, pdf.MimeType, pdf.TotalPages,
+		pdf.EncryptionKeyID, pages,
+	).Scan(&previousKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to replace template PDF: %w", err)
+	}
+
+	result := &TemplatePDFReplacement{}
+	result.FieldsOffPage, err = fieldsOffPage(tx, draftID, pdf.TotalPages)
+	if err != nil {
+		return nil, err
+	}
+
+	result.OrphanedS3Key, err = unreferencedTemplatePDF(tx, previousKey)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordTemplateVersionChange(tx, draftID, userID, "pdf", map[string]interface{}{
+		"pdf_hash":        pdf.PDFHash,
+		"total_pages":     pdf.TotalPages,
+		"fields_off_page": len(result.FieldsOffPage),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	recordAudit(tx, AuditEntry{
+		TemplateID: &templateID,
+		UserID:     &userID,
+		Action:     "template_updated",
+		Details: map[string]interface{}{
+			"change":      "pdf",
+			"version":     draftVersion,
+			"pdf_hash":    pdf.PDFHash,
+			"total_pages": pdf.TotalPages,
+		},
+	})
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	result.Version, err = s.getTemplateVersionByID(draftID)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// unreferencedTemplatePDF returns s3Key if no template version uses it any more
+func unreferencedTemplatePDF(tx *sql.Tx, s3Key string) (string, error) {
+	var referenced bool
+	err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM template_versions WHERE s3_key = $1)`, s3Key).Scan(&referenced)
+	if err != nil {
+		return "", fmt.Errorf("failed to check template PDF references: %w", err)
+	}
+	if referenced {
+		return "", nil
+	}
+	return s3Key, nil
+}
@@ -24,7 +24,20 @@ type Template struct {
 	IsActive    bool      `json:"is_active"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
-	Version     int       `json:"version"`
+	Version     int       `json:"version"` // the published version
+	// PublishedVersionID is the version new documents are created from
+	PublishedVersionID *uuid.UUID `json:"published_version_id,omitempty"`
+	// DraftVersion is the number of the template's unpublished draft, if it has one
+	DraftVersion *int `json:"draft_version,omitempty"`
+	// ParallelSigning lets every signer sign at once instead of in signer_order
+	ParallelSigning bool `json:"parallel_signing"`
+	// AllowDelegation lets a signer hand their part of a document to another email
+	AllowDelegation bool `json:"allow_delegation"`
+	// EncryptionKeyID is the data key the uploaded PDF was encrypted with
+	EncryptionKeyID string `json:"-"`
+	// Pages is the size of each page, read from the PDF on upload. It is only set when creating
+	// a template; template versions carry it afterwards.
+	Pages []TemplatePage `json:"pages,omitempty"`
 }
 
 type TemplateListItem struct {
@@ -45,28 +58,30 @@ type TemplateListItem struct {
 
 // NEW: TemplateSigner struct to represent signers
 type TemplateSigner struct {
-	ID           uuid.UUID `json:"id"`
-	TemplateID   uuid.UUID `json:"template_id"`
-	SignerOrder  int       `json:"signer_order"`
-	SignerName   string    `json:"signer_name"`
-	SignerColor  string    `json:"signer_color"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID                uuid.UUID `json:"id"`
+	TemplateID        uuid.UUID `json:"template_id"`
+	TemplateVersionID uuid.UUID `json:"template_version_id"`
+	SignerOrder       int       `json:"signer_order"`
+	SignerName        string    `json:"signer_name"`
+	SignerColor       string    `json:"signer_color"`
+	CreatedAt         time.Time `json:"created_at"`
 }
 
 // TemplateField struct - add SignerID to link fields to signers
 type TemplateField struct {
-	ID              uuid.UUID `json:"id"`
-	TemplateID      uuid.UUID `json:"template_id"`
-	SignerID        uuid.UUID `json:"signer_id"`
-	FieldName       string    `json:"field_name"`
-	FieldType       string    `json:"field_type"`       // Maps to "type" in your JSON
-	FieldLabel      string    `json:"field_label"`      // Maps to "label" in your JSON
-	PlaceholderText string    `json:"placeholder_text"`
-	PositionData    string    `json:"position_data"`    // JSON string of position + page
-	ValidationRules string    `json:"validation_rules"` // JSON string
-	Required        bool      `json:"required"`         // Maps to "required" in your JSON
-	CreatedAt       time.Time `json:"created_at"`
-	Version         int       `json:"version"`
+	ID                uuid.UUID `json:"id"`
+	TemplateID        uuid.UUID `json:"template_id"`
+	TemplateVersionID uuid.UUID `json:"template_version_id"`
+	SignerID          uuid.UUID `json:"signer_id"`
+	FieldName         string    `json:"field_name"`
+	FieldType         string    `json:"field_type"`       // Maps to "type" in your JSON
+	FieldLabel        string    `json:"field_label"`      // Maps to "label" in your JSON
+	PlaceholderText   string    `json:"placeholder_text"`
+	PositionData      string    `json:"position_data"`    // JSON string of position + page
+	ValidationRules   string    `json:"validation_rules"` // JSON string
+	Required          bool      `json:"required"`         // Maps to "required" in your JSON
+	CreatedAt         time.Time `json:"created_at"`
+	Version           int       `json:"version"`
 }
 
 // Updated: TemplateWithSignersAndFields to include signers
@@ -107,8 +122,9 @@ func (s *service) CreateTemplateWithSignersAndFields(template *Template, signers
 	// Insert template
 	templateQuery := `
 		INSERT INTO templates (name, description, s3_bucket, s3_key, pdf_hash, file_size, 
-			mime_type, total_pages, created_by, workspace_id, is_active, created_at, updated_at, version)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NOW(), NOW(), $12)
+			mime_type, total_pages, created_by, workspace_id, is_active, created_at, updated_at, version, parallel_signing,
+			allow_delegation)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NOW(), NOW(), $12, $13, $14)
 		RETURNING id, created_at, updated_at`
 
 	err = tx.QueryRow(
@@ -125,27 +141,78 @@ func (s *service) CreateTemplateWithSignersAndFields(template *Template, signers
 		template.WorkspaceID,
 		template.IsActive,
 		template.Version,
+		template.ParallelSigning,
+		template.AllowDelegation,
 	).Scan(&template.ID, &template.CreatedAt, &template.UpdatedAt)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to create template: %w", err)
 	}
 
+	pages, err := encodeTemplatePages(template.Pages)
+	if err != nil {
+		return nil, err
+	}
+
+	// The first version is published straight away
+	versionQuery := `
+		INSERT INTO template_versions (template_id, version, status, s3_bucket, s3_key, pdf_hash,
+			file_size, mime_type, total_pages, created_by, published_by, published_at, encryption_key_id,
+			pages)
+		VALUES ($1, $2, 'published', $3, $4, $5, $6, $7, $8, $9, $9, NOW(), NULLIF($10, ''), $11)
+		RETURNING id`
+
+	var versionID uuid.UUID
+	err = tx.QueryRow(
+		versionQuery,
+		template.ID,
+		template.Version,
+		template.S3Bucket,
+		template.S3Key,
+		template.PDFHash,
+		template.FileSize,
+		template.MimeType,
+		template.TotalPages,
+		template.CreatedBy,
+		template.EncryptionKeyID,
+		pages,
+	).Scan(&versionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create template version: %w", err)
+	}
+
+	_, err = tx.Exec(`UPDATE templates SET published_version_id = $2 WHERE id = $1`, template.ID, versionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to publish template version: %w", err)
+	}
+	template.PublishedVersionID = &versionID
+
+	err = recordTemplateVersionChange(tx, versionID, template.CreatedBy, "created", map[string]interface{}{
+		"signer_count": len(signers),
+		"field_count":  len(fields),
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	// Create map to store signer order -> signer ID mapping
 	signerOrderToID := make(map[int]uuid.UUID)
 
 	// Insert signers
 	if len(signers) > 0 {
 		signerQuery := `
-			INSERT INTO template_signers (template_id, signer_order, signer_name, signer_color, created_at)
-			VALUES ($1, $2, $3, $4, NOW())
+			INSERT INTO template_signers (template_id, template_version_id, signer_order, signer_name,
+				signer_color, created_at)
+			VALUES ($1, $2, $3, $4, $5, NOW())
 			RETURNING id`
 
 		for i := range signers {
 			signers[i].TemplateID = template.ID
+			signers[i].TemplateVersionID = versionID
 			err = tx.QueryRow(
 				signerQuery,
 				signers[i].TemplateID,
+				signers[i].TemplateVersionID,
 				signers[i].SignerOrder,
 				signers[i].SignerName,
 				signers[i].SignerColor,
@@ -162,14 +229,15 @@ func (s *service) CreateTemplateWithSignersAndFields(template *Template, signers
 	// Insert fields if any
 	if len(fields) > 0 {
 		fieldQuery := `
-			INSERT INTO template_fields (template_id, signer_id, field_name, field_type, field_label, 
-				placeholder_text, position_data, validation_rules, required, created_at, version)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW(), $10)`
+			INSERT INTO template_fields (template_id, template_version_id, signer_id, field_name, field_type,
+				field_label, placeholder_text, position_data, validation_rules, required, created_at, version)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW(), $11)`
 
 		for _, field := range fields {
 			_, err = tx.Exec(
 				fieldQuery,
 				template.ID,
+				versionID,
 				field.SignerID, // This should be set by the calling code using signerOrderToID
 				field.FieldName,
 				field.FieldType,
@@ -178,7 +246,7 @@ func (s *service) CreateTemplateWithSignersAndFields(template *Template, signers
 				field.PositionData,
 				field.ValidationRules,
 				field.Required,
-				field.Version,
+				template.Version,
 			)
 			if err != nil {
 				return nil, fmt.Errorf("failed to create template field %s: %w", field.FieldName, err)
@@ -186,17 +254,16 @@ func (s *service) CreateTemplateWithSignersAndFields(template *Template, signers
 		}
 	}
 
-	// Create audit log entry
-	auditQuery := `
-		INSERT INTO document_audit_log (template_id, user_id, action, details, created_at)
-		VALUES ($1, $2, 'template_created', $3, NOW())`
-
-	auditDetails := fmt.Sprintf(`{"template_name": "%s", "signer_count": %d, "field_count": %d}`, 
-		template.Name, len(signers), len(fields))
-	_, err = tx.Exec(auditQuery, template.ID, template.CreatedBy, auditDetails)
-	if err != nil {
-		// Don't fail the whole operation for audit log errors
-	}
+	recordAudit(tx, AuditEntry{
+		TemplateID: &template.ID,
+		UserID:     &template.CreatedBy,
+		Action:     "template_created",
+		Details: map[string]interface{}{
+			"template_name": template.Name,
+			"signer_count":  len(signers),
+			"field_count":   len(fields),
+		},
+	})
 
 	if err = tx.Commit(); err != nil {
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
@@ -211,7 +278,9 @@ func (s *service) GetTemplateByID(templateID uuid.UUID, userID int) (*Template,
 	query := `
 		SELECT t.id, t.name, t.description, t.s3_bucket, t.s3_key, t.pdf_hash, 
 			   t.file_size, t.mime_type, t.total_pages, t.created_by, t.workspace_id, t.is_active, 
-			   t.created_at, t.updated_at, t.version
+			   t.created_at, t.updated_at, t.version, t.parallel_signing, t.allow_delegation,
+			   t.published_version_id,
+			   (SELECT tv.version FROM template_versions tv WHERE tv.template_id = t.id AND tv.status = 'draft')
 		FROM templates t
 		JOIN workspace_memberships wm ON t.workspace_id = wm.workspace_id
 		WHERE t.id = $1 AND wm.user_id = $2 AND wm.status = 'active' AND t.is_active = true`
@@ -220,7 +289,8 @@ func (s *service) GetTemplateByID(templateID uuid.UUID, userID int) (*Template,
 		&template.ID, &template.Name, &template.Description, &template.S3Bucket,
 		&template.S3Key, &template.PDFHash, &template.FileSize, &template.MimeType,
 		&template.TotalPages, &template.CreatedBy, &template.WorkspaceID, &template.IsActive,
-		&template.CreatedAt, &template.UpdatedAt, &template.Version,
+		&template.CreatedAt, &template.UpdatedAt, &template.Version, &template.ParallelSigning,
+		&template.AllowDelegation, &template.PublishedVersionID, &template.DraftVersion,
 	)
 
 	if err != nil {
@@ -230,7 +300,8 @@ func (s *service) GetTemplateByID(templateID uuid.UUID, userID int) (*Template,
 	return template, nil
 }
 
-// GetTemplateWithSignersAndFields retrieves a template with all signers and fields
+// GetTemplateWithSignersAndFields retrieves a template with the signers and fields of its
+// published version
 func (s *service) GetTemplateWithSignersAndFields(templateID uuid.UUID, userID int) (*TemplateWithSignersAndFields, error) {
 	// First get the template
 	template, err := s.GetTemplateByID(templateID, userID)
@@ -238,14 +309,18 @@ func (s *service) GetTemplateWithSignersAndFields(templateID uuid.UUID, userID i
 		return nil, err
 	}
 
+	if template.PublishedVersionID == nil {
+		return nil, fmt.Errorf("template not found: no published version")
+	}
+
 	// Get the signers
-	signers, err := s.GetTemplateSigners(templateID, userID)
+	signers, err := s.getTemplateVersionSigners(*template.PublishedVersionID)
 	if err != nil {
 		return nil, err
 	}
 
 	// Get the fields
-	fields, err := s.GetTemplateFields(templateID, userID)
+	fields, err := s.getTemplateVersionFields(*template.PublishedVersionID)
 	if err != nil {
 		return nil, err
 	}
@@ -257,80 +332,34 @@ func (s *service) GetTemplateWithSignersAndFields(templateID uuid.UUID, userID i
 	}, nil
 }
 
-// GetTemplateSigners retrieves all signers for a template
+// GetTemplateSigners retrieves the signers of a template's published version
 func (s *service) GetTemplateSigners(templateID uuid.UUID, userID int) ([]TemplateSigner, error) {
 	// First verify user has access to this template
-	_, err := s.GetTemplateByID(templateID, userID)
+	template, err := s.GetTemplateByID(templateID, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	query := `
-		SELECT id, template_id, signer_order, signer_name, signer_color, created_at
-		FROM template_signers
-		WHERE template_id = $1
-		ORDER BY signer_order ASC`
-
-	rows, err := s.db.Query(query, templateID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get template signers: %w", err)
-	}
-	defer rows.Close()
-
-	var signers []TemplateSigner
-	for rows.Next() {
-		var signer TemplateSigner
-		err := rows.Scan(
-			&signer.ID, &signer.TemplateID, &signer.SignerOrder,
-			&signer.SignerName, &signer.SignerColor, &signer.CreatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan template signer: %w", err)
-		}
-		signers = append(signers, signer)
+	if template.PublishedVersionID == nil {
+		return nil, nil
 	}
 
-	return signers, nil
+	return s.getTemplateVersionSigners(*template.PublishedVersionID)
 }
 
-// GetTemplateFields retrieves all fields for a template
+// GetTemplateFields retrieves the fields of a template's published version
 func (s *service) GetTemplateFields(templateID uuid.UUID, userID int) ([]TemplateField, error) {
 	// First verify user has access to this template
-	_, err := s.GetTemplateByID(templateID, userID)
+	template, err := s.GetTemplateByID(templateID, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	query := `
-		SELECT tf.id, tf.template_id, tf.signer_id, tf.field_name, tf.field_type, tf.field_label, 
-			   tf.placeholder_text, tf.position_data, tf.validation_rules, tf.required, 
-			   tf.created_at, tf.version
-		FROM template_fields tf
-		JOIN template_signers ts ON tf.signer_id = ts.id
-		WHERE tf.template_id = $1
-		ORDER BY ts.signer_order ASC, tf.created_at ASC`
-
-	rows, err := s.db.Query(query, templateID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get template fields: %w", err)
+	if template.PublishedVersionID == nil {
+		return nil, nil
 	}
-	defer rows.Close()
 
-	var fields []TemplateField
-	for rows.Next() {
-		var field TemplateField
-		err := rows.Scan(
-			&field.ID, &field.TemplateID, &field.SignerID, &field.FieldName, &field.FieldType,
-			&field.FieldLabel, &field.PlaceholderText, &field.PositionData,
-			&field.ValidationRules, &field.Required, &field.CreatedAt, &field.Version,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan template field: %w", err)
-		}
-		fields = append(fields, field)
-	}
-
-	return fields, nil
+	return s.getTemplateVersionFields(*template.PublishedVersionID)
 }
 
 // GetWorkspaceTemplates retrieves all templates for a workspace that user has access to
@@ -366,15 +395,15 @@ func (s *service) GetWorkspaceTemplatesList(workspaceID uuid.UUID, userID int) (
 		FROM templates t
 		JOIN users u ON t.created_by = u.id
 		LEFT JOIN (
-			SELECT template_id, COUNT(*) as signer_count
+			SELECT template_version_id, COUNT(*) as signer_count
 			FROM template_signers
-			GROUP BY template_id
-		) signer_counts ON t.id = signer_counts.template_id
+			GROUP BY template_version_id
+		) signer_counts ON t.published_version_id = signer_counts.template_version_id
 		LEFT JOIN (
-			SELECT template_id, COUNT(*) as field_count
+			SELECT template_version_id, COUNT(*) as field_count
 			FROM template_fields
-			GROUP BY template_id
-		) field_counts ON t.id = field_counts.template_id
+			GROUP BY template_version_id
+		) field_counts ON t.published_version_id = field_counts.template_version_id
 		WHERE t.workspace_id = $1 AND t.is_active = true
 		ORDER BY t.created_at DESC`
 	
@@ -420,8 +449,9 @@ func (s *service) GetWorkspaceTemplatesList(workspaceID uuid.UUID, userID int) (
 	return templates, nil
 }
 
-// UpdateTemplate updates template metadata (not the PDF file)
-func (s *service) UpdateTemplate(templateID uuid.UUID, name, description string, userID int) error {
+// UpdateTemplate updates template metadata (not the PDF file).
+// A nil parallelSigning leaves the signing mode unchanged.
+func (s *service) UpdateTemplate(templateID uuid.UUID, name, description string, parallelSigning, allowDelegation *bool, userID int) error {
 	// Check if user has permission (creator, workspace owner, or admin)
 	permissionQuery := `
 		SELECT t.created_by, wm.role
@@ -444,10 +474,11 @@ func (s *service) UpdateTemplate(templateID uuid.UUID, name, description string,
 	// Update the template
 	updateQuery := `
 		UPDATE templates 
-		SET name = $1, description = $2, updated_at = NOW()
-		WHERE id = $3`
+		SET name = $1, description = $2, parallel_signing = COALESCE($3, parallel_signing),
+			allow_delegation = COALESCE($4, allow_delegation), updated_at = NOW()
+		WHERE id = $5`
 
-	result, err := s.db.Exec(updateQuery, name, description, templateID)
+	result, err := s.db.Exec(updateQuery, name, description, parallelSigning, allowDelegation, templateID)
 	if err != nil {
 		return fmt.Errorf("failed to update template: %w", err)
 	}
@@ -461,6 +492,18 @@ func (s *service) UpdateTemplate(templateID uuid.UUID, name, description string,
 		return fmt.Errorf("template not found")
 	}
 
+	recordAudit(s.db, AuditEntry{
+		TemplateID: &templateID,
+		UserID:     &userID,
+		Action:     "template_updated",
+		Details: map[string]interface{}{
+			"change":           "metadata",
+			"template_name":    name,
+			"parallel_signing": parallelSigning,
+			"allow_delegation": allowDelegation,
+		},
+	})
+
 	return nil
 }
 
@@ -505,56 +548,84 @@ func (s *service) DeactivateTemplate(templateID uuid.UUID, userID int) error {
 		return fmt.Errorf("template not found")
 	}
 
+	recordAudit(s.db, AuditEntry{
+		TemplateID: &templateID,
+		UserID:     &userID,
+		Action:     "template_updated",
+		Details: map[string]interface{}{
+			"change": "deactivated",
+		},
+	})
+
 	return nil
 }
 
-// ReplaceTemplateFields removes all existing fields and replaces them with new ones
-func (s *service) ReplaceTemplateFields(templateID uuid.UUID, fields []TemplateField, userID int) error {
-	// Check permissions first
-	template, err := s.GetTemplateByID(templateID, userID)
-	if err != nil {
-		return err
+// ReplaceTemplateFields replaces the fields of the template's draft, creating the draft from the
+// published version if there is none. Fields may reference the signers of either the draft or
+// the published version; the latter are mapped to their copies in a new draft. Documents are
+// unaffected until the draft is published.
+func (s *service) ReplaceTemplateFields(templateID uuid.UUID, fields []TemplateField, userID int) (*TemplateVersion, error) {
+	if _, err := s.checkTemplateEditor(templateID, userID); err != nil {
+		return nil, err
 	}
 
-	// Check if user has permission to modify this template
-	permissionQuery := `
-		SELECT wm.role
-		FROM workspace_memberships wm
-		WHERE wm.workspace_id = $1 AND wm.user_id = $2 AND wm.status = 'active'`
-
-	var role string
-	err = s.db.QueryRow(permissionQuery, template.WorkspaceID, userID).Scan(&role)
+	tx, err := s.db.Begin()
 	if err != nil {
-		return fmt.Errorf("access denied")
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	if template.CreatedBy != userID && role != "owner" && role != "admin" {
-		return fmt.Errorf("insufficient permissions to modify template")
+	draftID, draftVersion, signerIDs, err := ensureTemplateDraft(tx, templateID, userID)
+	if err != nil {
+		return nil, err
 	}
 
-	tx, err := s.db.Begin()
+	// Every field must belong to one of the draft's signers
+	draftSigners := make(map[uuid.UUID]bool)
+	rows, err := tx.Query(`SELECT id FROM template_signers WHERE template_version_id = $1`, draftID)
 	if err != nil {
-		return fmt.Errorf("failed to start transaction: %w", err)
+		return nil, fmt.Errorf("failed to get draft signers: %w", err)
+	}
+	for rows.Next() {
+		var signerID uuid.UUID
+		if err := rows.Scan(&signerID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan draft signer: %w", err)
+		}
+		draftSigners[signerID] = true
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
 	}
-	defer tx.Rollback()
 
-	// Delete all existing fields
-	_, err = tx.Exec(`DELETE FROM template_fields WHERE template_id = $1`, templateID)
+	for i := range fields {
+		if draftSignerID, found := signerIDs[fields[i].SignerID]; found {
+			fields[i].SignerID = draftSignerID
+		}
+		if !draftSigners[fields[i].SignerID] {
+			return nil, fmt.Errorf("field %s references a signer that is not in the template draft", fields[i].FieldName)
+		}
+	}
+
+	// Delete the draft's existing fields
+	_, err = tx.Exec(`DELETE FROM template_fields WHERE template_version_id = $1`, draftID)
 	if err != nil {
-		return fmt.Errorf("failed to delete existing fields: %w", err)
+		return nil, fmt.Errorf("failed to delete existing fields: %w", err)
 	}
 
 	// Insert new fields if any
 	if len(fields) > 0 {
 		fieldQuery := `
-			INSERT INTO template_fields (template_id, signer_id, field_name, field_type, field_label, 
-				placeholder_text, position_data, validation_rules, required, created_at, version)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW(), $10)`
+			INSERT INTO template_fields (template_id, template_version_id, signer_id, field_name, field_type,
+				field_label, placeholder_text, position_data, validation_rules, required, created_at, version)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW(), $11)`
 
 		for _, field := range fields {
 			_, err = tx.Exec(
 				fieldQuery,
 				templateID,
+				draftID,
 				field.SignerID,
 				field.FieldName,
 				field.FieldType,
@@ -563,99 +634,116 @@ func (s *service) ReplaceTemplateFields(templateID uuid.UUID, fields []TemplateF
 				field.PositionData,
 				field.ValidationRules,
 				field.Required,
-				field.Version,
+				draftVersion,
 			)
 			if err != nil {
-				return fmt.Errorf("failed to create template field %s: %w", field.FieldName, err)
+				return nil, fmt.Errorf("failed to create template field %s: %w", field.FieldName, err)
 			}
 		}
 	}
 
-	// Update template version and timestamp
-	_, err = tx.Exec(`
-		UPDATE templates 
-		SET version = version + 1, updated_at = NOW()
-		WHERE id = $1`, templateID)
+	err = recordTemplateVersionChange(tx, draftID, userID, "fields", map[string]interface{}{
+		"field_count": len(fields),
+	})
 	if err != nil {
-		return fmt.Errorf("failed to update template version: %w", err)
+		return nil, err
 	}
 
-	return tx.Commit()
-}
+	recordAudit(tx, AuditEntry{
+		TemplateID: &templateID,
+		UserID:     &userID,
+		Action:     "template_updated",
+		Details: map[string]interface{}{
+			"change":      "fields",
+			"version":     draftVersion,
+			"field_count": len(fields),
+		},
+	})
 
-// ReplaceTemplateSigners removes all existing signers and replaces them with new ones
-// WARNING: This will also delete all fields since fields are linked to signers
-func (s *service) ReplaceTemplateSigners(templateID uuid.UUID, signers []TemplateSigner, userID int) error {
-	// Check permissions first
-	template, err := s.GetTemplateByID(templateID, userID)
-	if err != nil {
-		return err
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	// Check if user has permission to modify this template
-	permissionQuery := `
-		SELECT wm.role
-		FROM workspace_memberships wm
-		WHERE wm.workspace_id = $1 AND wm.user_id = $2 AND wm.status = 'active'`
-
-	var role string
-	err = s.db.QueryRow(permissionQuery, template.WorkspaceID, userID).Scan(&role)
-	if err != nil {
-		return fmt.Errorf("access denied")
-	}
+	return s.getTemplateVersionByID(draftID)
+}
 
-	if template.CreatedBy != userID && role != "owner" && role != "admin" {
-		return fmt.Errorf("insufficient permissions to modify template")
+// ReplaceTemplateSigners replaces the signers of the template's draft, creating the draft from
+// the published version if there is none.
+// WARNING: This will also delete the draft's fields since fields are linked to signers
+func (s *service) ReplaceTemplateSigners(templateID uuid.UUID, signers []TemplateSigner, userID int) (*TemplateVersion, error) {
+	if _, err := s.checkTemplateEditor(templateID, userID); err != nil {
+		return nil, err
 	}
 
 	tx, err := s.db.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to start transaction: %w", err)
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	// Delete all existing fields first (due to foreign key constraint)
-	_, err = tx.Exec(`DELETE FROM template_fields WHERE template_id = $1`, templateID)
+	draftID, draftVersion, _, err := ensureTemplateDraft(tx, templateID, userID)
 	if err != nil {
-		return fmt.Errorf("failed to delete existing fields: %w", err)
+		return nil, err
+	}
+
+	// Delete the draft's fields first (due to foreign key constraint)
+	_, err = tx.Exec(`DELETE FROM template_fields WHERE template_version_id = $1`, draftID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete existing fields: %w", err)
 	}
 
-	// Delete all existing signers
-	_, err = tx.Exec(`DELETE FROM template_signers WHERE template_id = $1`, templateID)
+	// Delete the draft's signers
+	_, err = tx.Exec(`DELETE FROM template_signers WHERE template_version_id = $1`, draftID)
 	if err != nil {
-		return fmt.Errorf("failed to delete existing signers: %w", err)
+		return nil, fmt.Errorf("failed to delete existing signers: %w", err)
 	}
 
 	// Insert new signers if any
 	if len(signers) > 0 {
 		signerQuery := `
-			INSERT INTO template_signers (template_id, signer_order, signer_name, signer_color, created_at)
-			VALUES ($1, $2, $3, $4, NOW())
+			INSERT INTO template_signers (template_id, template_version_id, signer_order, signer_name,
+				signer_color, created_at)
+			VALUES ($1, $2, $3, $4, $5, NOW())
 			RETURNING id`
 
 		for i := range signers {
 			signers[i].TemplateID = templateID
+			signers[i].TemplateVersionID = draftID
 			err = tx.QueryRow(
 				signerQuery,
 				signers[i].TemplateID,
+				signers[i].TemplateVersionID,
 				signers[i].SignerOrder,
 				signers[i].SignerName,
 				signers[i].SignerColor,
 			).Scan(&signers[i].ID)
 			if err != nil {
-				return fmt.Errorf("failed to create template signer %s: %w", signers[i].SignerName, err)
+				return nil, fmt.Errorf("failed to create template signer %s: %w", signers[i].SignerName, err)
 			}
 		}
 	}
 
-	// Update template version and timestamp
-	_, err = tx.Exec(`
-		UPDATE templates 
-		SET version = version + 1, updated_at = NOW()
-		WHERE id = $1`, templateID)
+	err = recordTemplateVersionChange(tx, draftID, userID, "signers", map[string]interface{}{
+		"signer_count": len(signers),
+	})
 	if err != nil {
-		return fmt.Errorf("failed to update template version: %w", err)
+		return nil, err
 	}
 
-	return tx.Commit()
-}
\ No newline at end of file
+	recordAudit(tx, AuditEntry{
+		TemplateID: &templateID,
+		UserID:     &userID,
+		Action:     "template_updated",
+		Details: map[string]interface{}{
+			"change":       "signers",
+			"version":      draftVersion,
+			"signer_count": len(signers),
+		},
+	})
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return s.getTemplateVersionByID(draftID)
+}
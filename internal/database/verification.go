@@ -0,0 +1,103 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DocumentVerification is what anyone holding a completed document's final PDF can learn about
+// it. It deliberately leaves out the workspace, the template and everything signers entered.
+type DocumentVerification struct {
+	DocumentID         uuid.UUID        `json:"-"`
+	DocumentName       string           `json:"document_name"`
+	CompletedAt        *time.Time       `json:"completed_at"`
+	DigitallySigned    bool             `json:"digitally_signed"`
+	SignatureAlgorithm string           `json:"signature_algorithm,omitempty"`
+	Signers            []VerifiedSigner `json:"signers"`
+}
+
+// VerifiedSigner is a signer of a verified document. Routes mask the name and email before
+// returning them.
+type VerifiedSigner struct {
+	Name     string     `json:"name"`
+	Email    string     `json:"email"`
+	SignedAt *time.Time `json:"signed_at"`
+}
+
+// VerifyDocumentHash looks up the completed document whose final PDF has the given SHA-256 hash,
+// matching either the document's recorded hash or one of its digital signatures. A match is
+// written to the document's audit log with the requester's IP address and user agent.
+func (s *service) VerifyDocumentHash(hash, ipAddress, userAgent string) (*DocumentVerification, error) {
+	query := `
+		SELECT d.id, d.name, d.completed_at, sig.signature_algorithm
+		FROM documents d
+		LEFT JOIN LATERAL (
+			SELECT ds.signature_algorithm
+			FROM digital_signatures ds
+			WHERE ds.document_id = d.id
+			ORDER BY ds.signed_at DESC
+			LIMIT 1
+		) sig ON true
+		WHERE d.status = 'completed'
+		AND (
+			d.final_document_hash = $1
+			OR EXISTS (
+				SELECT 1 FROM digital_signatures ds
+				WHERE ds.document_id = d.id AND ds.final_document_hash = $1
+			)
+		)
+		ORDER BY d.completed_at DESC
+		LIMIT 1`
+
+	verification := &DocumentVerification{}
+	var algorithm sql.NullString
+	err := s.db.QueryRow(query, hash).Scan(
+		&verification.DocumentID, &verification.DocumentName, &verification.CompletedAt, &algorithm,
+	)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("document not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify document: %w", err)
+	}
+	verification.DigitallySigned = algorithm.Valid
+	verification.SignatureAlgorithm = algorithm.String
+
+	signersQuery := `
+		SELECT COALESCE(signer_name, ''), signer_email, completed_at
+		FROM document_signers
+		WHERE document_id = $1 AND status = 'completed'
+		ORDER BY signer_order ASC`
+
+	rows, err := s.db.Query(signersQuery, verification.DocumentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get signers: %w", err)
+	}
+	defer rows.Close()
+
+	verification.Signers = []VerifiedSigner{}
+	for rows.Next() {
+		var signer VerifiedSigner
+		if err := rows.Scan(&signer.Name, &signer.Email, &signer.SignedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan signer: %w", err)
+		}
+		verification.Signers = append(verification.Signers, signer)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	recordAudit(s.db, AuditEntry{
+		DocumentID: &verification.DocumentID,
+		Action:     "document_verified",
+		Details:    map[string]interface{}{"final_document_hash": hash},
+		IPAddress:  ipAddress,
+		UserAgent:  userAgent,
+	})
+
+	return verification, nil
+}
@@ -0,0 +1,166 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// VoidDocument cancels a document that has not completed. Every signer's access token is
+// revoked so signing links stop working, and emails still queued for those links are dropped.
+// Form submissions are kept for the audit trail. Signers who had already opened, started or
+// completed the document are notified and returned.
+func (s *service) VoidDocument(documentID uuid.UUID, userID int, reason string) ([]DocumentSigner, error) {
+	// Check if user has permission (creator, workspace owner, or admin)
+	permissionQuery := `
+		SELECT d.created_by, wm.role
+		FROM documents d
+		JOIN workspace_memberships wm ON d.workspace_id = wm.workspace_id
+		WHERE d.id = $1 AND wm.user_id = $2 AND wm.status = 'active'`
+
+	var createdBy int
+	var role string
+	err := s.db.QueryRow(permissionQuery, documentID, userID).Scan(&createdBy, &role)
+	if err != nil {
+		return nil, fmt.Errorf("document not found or access denied")
+	}
+
+	if createdBy != userID && role != "owner" && role != "admin" {
+		return nil, fmt.Errorf("insufficient permissions to void document")
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	updateQuery := `
+		UPDATE documents
+		SET status = 'cancelled', void_reason = $2, voided_at = NOW(), voided_by = $3, updated_at = NOW()
+		WHERE id = $1 AND status IN ('draft', 'scheduled', 'sent', 'in_progress')
+		RETURNING template_id, name`
+
+	var templateID uuid.UUID
+	var name string
+	err = tx.QueryRow(updateQuery, documentID, reason, userID).Scan(&templateID, &name)
+	if err != nil {
+		return nil, fmt.Errorf("document not found or can no longer be voided")
+	}
+
+	// Drop queued signing requests and reminders; their links are about to stop working
+	if err = cancelQueuedSigningEmails(tx, documentID, nil, "document voided"); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(`
+		UPDATE document_signers
+		SET access_token = NULL
+		WHERE document_id = $1
+		RETURNING id, document_id, template_signer_id, signer_order, signer_email,
+			COALESCE(signer_name, ''), status, viewed_at, completed_at, created_at`, documentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke signer access: %w", err)
+	}
+
+	var acted []DocumentSigner
+	for rows.Next() {
+		var signer DocumentSigner
+		err := rows.Scan(
+			&signer.ID, &signer.DocumentID, &signer.TemplateSignerID, &signer.SignerOrder,
+			&signer.SignerEmail, &signer.SignerName, &signer.Status,
+			&signer.ViewedAt, &signer.CompletedAt, &signer.CreatedAt,
+		)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan document signer: %w", err)
+		}
+		if signer.Status != "pending" {
+			acted = append(acted, signer)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	recordAudit(tx, AuditEntry{
+		DocumentID: &documentID,
+		TemplateID: &templateID,
+		UserID:     &userID,
+		Action:     "document_cancelled",
+		Details: map[string]interface{}{
+			"reason":           reason,
+			"notified_signers": len(acted),
+		},
+	})
+
+	err = enqueueDocumentWebhookEvent(tx, documentID, WebhookDocumentVoided, map[string]interface{}{
+		"voided_by": userID,
+		"reason":    reason,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var senderName string
+	err = tx.QueryRow(`SELECT COALESCE(name, email) FROM users WHERE id = $1`, createdBy).Scan(&senderName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load document sender: %w", err)
+	}
+
+	notificationQuery := `
+		INSERT INTO notifications (user_id, type, title, message, data)
+		SELECT u.id, 'document_voided', $2, $3, $4
+		FROM users u
+		WHERE lower(u.email) = lower($1)`
+
+	for _, signer := range acted {
+		data, _ := json.Marshal(map[string]interface{}{
+			"document_id":   documentID,
+			"document_name": name,
+			"reason":        reason,
+		})
+
+		_, err = tx.Exec(notificationQuery, signer.SignerEmail, "Document Voided",
+			fmt.Sprintf("%s has been voided and no longer needs your signature", name), string(data))
+		if err != nil {
+			// Don't fail the whole operation for notification errors
+		}
+
+		err = enqueueEmail(tx, EmailDocumentVoided, signer.SignerEmail, map[string]interface{}{
+			"document_name": name,
+			"sender_name":   senderName,
+			"signer_name":   signer.SignerName,
+			"reason":        reason,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return acted, nil
+}
+
+// cancelQueuedSigningEmails drops queued signing requests and reminders carrying the access token
+// of one signer, or of every signer on the document when signerID is nil. Call it before the
+// token is replaced or revoked.
+func cancelQueuedSigningEmails(tx *sql.Tx, documentID uuid.UUID, signerID *uuid.UUID, reason string) error {
+	_, err := tx.Exec(`
+		UPDATE email_outbox
+		SET status = 'failed', last_error = $3
+		WHERE status = 'pending' AND data->>'access_token' IN (
+			SELECT access_token FROM document_signers
+			WHERE document_id = $1 AND ($2::uuid IS NULL OR id = $2) AND access_token IS NOT NULL
+		)`, documentID, signerID, reason)
+	if err != nil {
+		return fmt.Errorf("failed to cancel queued emails: %w", err)
+	}
+	return nil
+}
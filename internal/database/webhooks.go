@@ -0,0 +1,523 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Webhook event types
+const (
+	WebhookDocumentSent        = "document.sent"
+	WebhookDocumentViewed      = "document.viewed"
+	WebhookDocumentSigned      = "document.signed"
+	WebhookDocumentCompleted   = "document.completed"
+	WebhookDocumentDeclined    = "document.declined"
+	WebhookDocumentExpired     = "document.expired"
+	WebhookDocumentVoided      = "document.voided"
+	WebhookMemberJoined        = "member.joined"
+	WebhookMemberRoleChanged   = "member.role_changed"
+	WebhookMemberRemoved       = "member.removed"
+	WebhookInvitationCreated   = "invitation.created"
+	WebhookInvitationAccepted  = "invitation.accepted"
+	WebhookInvitationDeclined  = "invitation.declined"
+	WebhookInvitationCancelled = "invitation.cancelled"
+)
+
+// WebhookEventTypes lists every event an endpoint can subscribe to
+var WebhookEventTypes = []string{
+	WebhookDocumentSent, WebhookDocumentViewed, WebhookDocumentSigned, WebhookDocumentCompleted,
+	WebhookDocumentDeclined, WebhookDocumentExpired, WebhookDocumentVoided,
+	WebhookMemberJoined, WebhookMemberRoleChanged, WebhookMemberRemoved,
+	WebhookInvitationCreated, WebhookInvitationAccepted, WebhookInvitationDeclined, WebhookInvitationCancelled,
+}
+
+const (
+	// webhookClaimLease is how long a claimed delivery is hidden from other workers
+	webhookClaimLease = 5 * time.Minute
+	// webhookResponseBodyLimit caps how much of an endpoint's response is kept in the delivery log
+	webhookResponseBodyLimit = 4096
+)
+
+// WebhookEndpoint is a URL that receives a workspace's events
+type WebhookEndpoint struct {
+	ID          uuid.UUID `json:"id"`
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+	URL         string    `json:"url"`
+	Description string    `json:"description"`
+	Secret      string    `json:"secret,omitempty"` // only returned when created or rotated
+	Events      []string  `json:"events"`           // empty means every event
+	IsActive    bool      `json:"is_active"`
+	CreatedBy   int       `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// WebhookDelivery is one entry in an endpoint's delivery log
+type WebhookDelivery struct {
+	ID             uuid.UUID  `json:"id"`
+	EndpointID     uuid.UUID  `json:"endpoint_id"`
+	EventID        uuid.UUID  `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	RedeliveryOf   *uuid.UUID `json:"redelivery_of,omitempty"`
+	Status         string     `json:"status"` // pending, succeeded, failed
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	LastError      *string    `json:"last_error,omitempty"`
+	ResponseStatus *int       `json:"response_status,omitempty"`
+	ResponseBody   *string    `json:"response_body,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// PendingWebhookDelivery is a claimed delivery with everything needed to send it
+type PendingWebhookDelivery struct {
+	ID             uuid.UUID       `json:"id"`
+	EventID        uuid.UUID       `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	WorkspaceID    uuid.UUID       `json:"workspace_id"`
+	Data           json.RawMessage `json:"data"`
+	EventCreatedAt time.Time       `json:"event_created_at"`
+	URL            string          `json:"url"`
+	Secret         string          `json:"-"`
+	Attempts       int             `json:"attempts"`
+}
+
+// enqueueWebhookEvent records a workspace event and queues a delivery to every active endpoint
+// subscribed to it. Call it inside the transaction that makes the change the event describes.
+func enqueueWebhookEvent(exec execer, workspaceID uuid.UUID, eventType string, data map[string]interface{}) error {
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	dataJSON, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook event: %w", err)
+	}
+
+	_, err = exec.Exec(`
+		WITH endpoints AS (
+			SELECT id FROM webhook_endpoints
+			WHERE workspace_id = $1 AND is_active = true
+			  AND (cardinality(events) = 0 OR $2::text = ANY(events))
+		), event AS (
+			INSERT INTO webhook_events (workspace_id, event_type, data)
+			SELECT $1, $2, $3::jsonb
+			WHERE EXISTS (SELECT 1 FROM endpoints)
+			RETURNING id
+		)
+		INSERT INTO webhook_deliveries (endpoint_id, event_id)
+		SELECT endpoints.id, event.id FROM endpoints, event`,
+		workspaceID, eventType, string(dataJSON))
+	if err != nil {
+		return fmt.Errorf("failed to queue webhook event: %w", err)
+	}
+
+	return nil
+}
+
+// enqueueDocumentWebhookEvent is enqueueWebhookEvent for a document event. The document's ID,
+// name, template and current status are added to data.
+func enqueueDocumentWebhookEvent(exec execer, documentID uuid.UUID, eventType string, data map[string]interface{}) error {
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	dataJSON, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook event: %w", err)
+	}
+
+	_, err = exec.Exec(`
+		WITH document AS (
+			SELECT workspace_id,
+				   jsonb_build_object('document_id', id, 'document_name', name,
+									  'template_id', template_id, 'status', status) || $3::jsonb AS data
+			FROM documents WHERE id = $1
+		), endpoints AS (
+			SELECT e.id FROM webhook_endpoints e
+			JOIN document ON e.workspace_id = document.workspace_id
+			WHERE e.is_active = true AND (cardinality(e.events) = 0 OR $2::text = ANY(e.events))
+		), event AS (
+			INSERT INTO webhook_events (workspace_id, event_type, data)
+			SELECT workspace_id, $2, data FROM document
+			WHERE EXISTS (SELECT 1 FROM endpoints)
+			RETURNING id
+		)
+		INSERT INTO webhook_deliveries (endpoint_id, event_id)
+		SELECT endpoints.id, event.id FROM endpoints, event`,
+		documentID, eventType, string(dataJSON))
+	if err != nil {
+		return fmt.Errorf("failed to queue webhook event: %w", err)
+	}
+
+	return nil
+}
+
+// generateWebhookSecret returns a random signing secret for a webhook endpoint
+func generateWebhookSecret() (string, error) {
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return "whsec_" + base64.RawURLEncoding.EncodeToString(secretBytes), nil
+}
+
+// checkWebhookAdmin returns an error unless the user is an active owner or admin of the workspace
+func (s *service) checkWebhookAdmin(workspaceID uuid.UUID, userID int) error {
+	permissionQuery := `
+		SELECT role FROM workspace_memberships
+		WHERE workspace_id = $1 AND user_id = $2 AND status = 'active'`
+
+	var role string
+	err := s.db.QueryRow(permissionQuery, workspaceID, userID).Scan(&role)
+	if err != nil {
+		return fmt.Errorf("user does not have access to this workspace")
+	}
+
+	if role != "owner" && role != "admin" {
+		return fmt.Errorf("insufficient permissions to manage webhooks")
+	}
+
+	return nil
+}
+
+const webhookEndpointColumns = `
+	id, workspace_id, url, description, array_to_string(events, ' '), is_active,
+	created_by, created_at, updated_at`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanWebhookEndpoint(row rowScanner) (*WebhookEndpoint, error) {
+	endpoint := &WebhookEndpoint{}
+	var events string
+	err := row.Scan(
+		&endpoint.ID, &endpoint.WorkspaceID, &endpoint.URL, &endpoint.Description, &events,
+		&endpoint.IsActive, &endpoint.CreatedBy, &endpoint.CreatedAt, &endpoint.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	// Event types never contain spaces, so the array round-trips through a space-separated string
+	endpoint.Events = strings.Fields(events)
+	return endpoint, nil
+}
+
+// CreateWebhookEndpoint adds an endpoint to a workspace with a freshly generated secret, which is
+// returned on the endpoint. Only workspace owners and admins can manage webhooks.
+func (s *service) CreateWebhookEndpoint(endpoint *WebhookEndpoint, userID int) (*WebhookEndpoint, error) {
+	if err := s.checkWebhookAdmin(endpoint.WorkspaceID, userID); err != nil {
+		return nil, err
+	}
+
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	events := endpoint.Events
+	if events == nil {
+		events = []string{}
+	}
+
+	created, err := scanWebhookEndpoint(s.db.QueryRow(`
+		INSERT INTO webhook_endpoints (workspace_id, url, description, secret, events, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING`+webhookEndpointColumns,
+		endpoint.WorkspaceID, endpoint.URL, endpoint.Description, secret, events, userID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webhook endpoint: %w", err)
+	}
+
+	created.Secret = secret
+	return created, nil
+}
+
+// ListWebhookEndpoints returns a workspace's endpoints, newest first, without their secrets
+func (s *service) ListWebhookEndpoints(workspaceID uuid.UUID, userID int) ([]WebhookEndpoint, error) {
+	if err := s.checkWebhookAdmin(workspaceID, userID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT`+webhookEndpointColumns+`
+		FROM webhook_endpoints
+		WHERE workspace_id = $1
+		ORDER BY created_at DESC`, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook endpoints: %w", err)
+	}
+	defer rows.Close()
+
+	endpoints := []WebhookEndpoint{}
+	for rows.Next() {
+		endpoint, err := scanWebhookEndpoint(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook endpoint: %w", err)
+		}
+		endpoints = append(endpoints, *endpoint)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	return endpoints, nil
+}
+
+// GetWebhookEndpoint returns one of a workspace's endpoints without its secret
+func (s *service) GetWebhookEndpoint(workspaceID, endpointID uuid.UUID, userID int) (*WebhookEndpoint, error) {
+	if err := s.checkWebhookAdmin(workspaceID, userID); err != nil {
+		return nil, err
+	}
+
+	endpoint, err := scanWebhookEndpoint(s.db.QueryRow(`
+		SELECT`+webhookEndpointColumns+`
+		FROM webhook_endpoints
+		WHERE id = $1 AND workspace_id = $2`, endpointID, workspaceID))
+	if err != nil {
+		return nil, fmt.Errorf("webhook endpoint not found")
+	}
+
+	return endpoint, nil
+}
+
+// UpdateWebhookEndpoint replaces an endpoint's URL, description, events and active flag. With
+// rotateSecret a new secret is generated and returned on the endpoint.
+func (s *service) UpdateWebhookEndpoint(endpoint *WebhookEndpoint, rotateSecret bool, userID int) (*WebhookEndpoint, error) {
+	if err := s.checkWebhookAdmin(endpoint.WorkspaceID, userID); err != nil {
+		return nil, err
+	}
+
+	var secret string
+	if rotateSecret {
+		var err error
+		if secret, err = generateWebhookSecret(); err != nil {
+			return nil, err
+		}
+	}
+
+	events := endpoint.Events
+	if events == nil {
+		events = []string{}
+	}
+
+	updated, err := scanWebhookEndpoint(s.db.QueryRow(`
+		UPDATE webhook_endpoints
+		SET url = $3, description = $4, events = $5, is_active = $6,
+			secret = COALESCE(NULLIF($7, ''), secret), updated_at = NOW()
+		WHERE id = $1 AND workspace_id = $2
+		RETURNING`+webhookEndpointColumns,
+		endpoint.ID, endpoint.WorkspaceID, endpoint.URL, endpoint.Description, events, endpoint.IsActive, secret))
+	if err != nil {
+		return nil, fmt.Errorf("webhook endpoint not found")
+	}
+
+	updated.Secret = secret
+	return updated, nil
+}
+
+// DeleteWebhookEndpoint removes an endpoint and its delivery log
+func (s *service) DeleteWebhookEndpoint(workspaceID, endpointID uuid.UUID, userID int) error {
+	if err := s.checkWebhookAdmin(workspaceID, userID); err != nil {
+		return err
+	}
+
+	result, err := s.db.Exec(`
+		DELETE FROM webhook_endpoints WHERE id = $1 AND workspace_id = $2`, endpointID, workspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook endpoint: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("webhook endpoint not found")
+	}
+
+	return nil
+}
+
+const webhookDeliveryColumns = `
+	wd.id, wd.endpoint_id, wd.event_id, we.event_type, wd.redelivery_of, wd.status, wd.attempts,
+	CASE WHEN wd.status = 'pending' THEN wd.next_attempt_at END, wd.last_error,
+	wd.response_status, wd.response_body, wd.delivered_at, wd.created_at`
+
+func scanWebhookDelivery(row rowScanner) (*WebhookDelivery, error) {
+	delivery := &WebhookDelivery{}
+	err := row.Scan(
+		&delivery.ID, &delivery.EndpointID, &delivery.EventID, &delivery.EventType, &delivery.RedeliveryOf,
+		&delivery.Status, &delivery.Attempts, &delivery.NextAttemptAt, &delivery.LastError,
+		&delivery.ResponseStatus, &delivery.ResponseBody, &delivery.DeliveredAt, &delivery.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// ListWebhookDeliveries returns an endpoint's most recent deliveries, newest first
+func (s *service) ListWebhookDeliveries(workspaceID, endpointID uuid.UUID, userID int, limit int) ([]WebhookDelivery, error) {
+	if _, err := s.GetWebhookEndpoint(workspaceID, endpointID, userID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT`+webhookDeliveryColumns+`
+		FROM webhook_deliveries wd
+		JOIN webhook_events we ON wd.event_id = we.id
+		WHERE wd.endpoint_id = $1
+		ORDER BY wd.created_at DESC, wd.id DESC
+		LIMIT $2`, endpointID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// RedeliverWebhook queues the event of an earlier delivery to be sent to its endpoint again.
+// The earlier delivery is left in the log as it was.
+func (s *service) RedeliverWebhook(workspaceID, endpointID, deliveryID uuid.UUID, userID int) (*WebhookDelivery, error) {
+	if _, err := s.GetWebhookEndpoint(workspaceID, endpointID, userID); err != nil {
+		return nil, err
+	}
+
+	delivery, err := scanWebhookDelivery(s.db.QueryRow(`
+		WITH wd AS (
+			INSERT INTO webhook_deliveries (endpoint_id, event_id, redelivery_of)
+			SELECT endpoint_id, event_id, id FROM webhook_deliveries
+			WHERE id = $1 AND endpoint_id = $2
+			RETURNING *
+		)
+		SELECT`+webhookDeliveryColumns+`
+		FROM wd
+		JOIN webhook_events we ON wd.event_id = we.id`, deliveryID, endpointID))
+	if err != nil {
+		return nil, fmt.Errorf("webhook delivery not found")
+	}
+
+	return delivery, nil
+}
+
+// ClaimPendingWebhookDeliveries takes up to limit due deliveries to active endpoints and counts
+// the attempt. Rows locked by another worker are skipped.
+func (s *service) ClaimPendingWebhookDeliveries(ctx context.Context, limit int) ([]PendingWebhookDelivery, error) {
+	query := `
+		WITH claimed AS (
+			UPDATE webhook_deliveries
+			SET attempts = attempts + 1, next_attempt_at = NOW() + $2 * INTERVAL '1 second'
+			WHERE id IN (
+				SELECT wd.id FROM webhook_deliveries wd
+				JOIN webhook_endpoints e ON wd.endpoint_id = e.id
+				WHERE wd.status = 'pending' AND wd.next_attempt_at <= NOW() AND e.is_active = true
+				ORDER BY wd.next_attempt_at ASC
+				LIMIT $1
+				FOR UPDATE OF wd SKIP LOCKED
+			)
+			RETURNING id, endpoint_id, event_id, attempts
+		)
+		SELECT c.id, c.event_id, we.event_type, we.workspace_id, we.data, we.created_at,
+			   e.url, e.secret, c.attempts
+		FROM claimed c
+		JOIN webhook_events we ON c.event_id = we.id
+		JOIN webhook_endpoints e ON c.endpoint_id = e.id`
+
+	rows, err := s.db.QueryContext(ctx, query, limit, webhookClaimLease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []PendingWebhookDelivery
+	for rows.Next() {
+		var delivery PendingWebhookDelivery
+		var data []byte
+		err := rows.Scan(
+			&delivery.ID, &delivery.EventID, &delivery.EventType, &delivery.WorkspaceID, &data,
+			&delivery.EventCreatedAt, &delivery.URL, &delivery.Secret, &delivery.Attempts,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		delivery.Data = json.RawMessage(data)
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// MarkWebhookDeliverySucceeded records a delivery the endpoint accepted
+func (s *service) MarkWebhookDeliverySucceeded(ctx context.Context, deliveryID uuid.UUID, responseStatus int, responseBody string) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = 'succeeded', delivered_at = NOW(), last_error = NULL,
+			response_status = $2, response_body = $3
+		WHERE id = $1`, deliveryID, responseStatus, truncateResponseBody(responseBody))
+	if err != nil {
+		return fmt.Errorf("failed to mark webhook delivery as succeeded: %w", err)
+	}
+	return nil
+}
+
+// MarkWebhookDeliveryFailed records a failed attempt. responseStatus is 0 when the endpoint
+// could not be reached. A nil retryAt gives up on the delivery.
+func (s *service) MarkWebhookDeliveryFailed(ctx context.Context, deliveryID uuid.UUID, responseStatus int, responseBody, lastError string, retryAt *time.Time) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = 'pending', response_status = NULLIF($2, 0), response_body = NULLIF($3, ''),
+			last_error = $4, next_attempt_at = $5
+		WHERE id = $1`
+	args := []any{deliveryID, responseStatus, truncateResponseBody(responseBody), lastError, retryAt}
+
+	if retryAt == nil {
+		query = `
+			UPDATE webhook_deliveries
+			SET status = 'failed', response_status = NULLIF($2, 0), response_body = NULLIF($3, ''),
+				last_error = $4
+			WHERE id = $1`
+		args = args[:4]
+	}
+
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to mark webhook delivery as failed: %w", err)
+	}
+	return nil
+}
+
+// truncateResponseBody shortens a response body for the delivery log and makes it storable as
+// text: Postgres rejects NUL bytes and invalid UTF-8, which arbitrary endpoints may send
+func truncateResponseBody(body string) string {
+	if len(body) > webhookResponseBodyLimit {
+		body = body[:webhookResponseBodyLimit]
+	}
+	return strings.ToValidUTF8(strings.ReplaceAll(body, "\x00", ""), "")
+}
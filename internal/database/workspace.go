@@ -1,6 +1,7 @@
 package database
 
 import (
+	"database/sql"
 	"fmt"
 	"time"
 
@@ -328,19 +329,62 @@ func (s *service) InviteUserToWorkspace(workspaceID uuid.UUID, invitedEmail stri
 		return fmt.Errorf("invitation already sent to this email")
 	}
 
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	// Create the invitation (token will be auto-generated by trigger)
 	inviteQuery := `
 		INSERT INTO workspace_invitations (workspace_id, inviter_id, invitee_email, invitee_id, role)
 		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id, token`
+		RETURNING id, token, expires_at`
 
 	var invitationID uuid.UUID
 	var token string
-	err = s.db.QueryRow(inviteQuery, workspaceID, inviterUserID, invitedEmail, invitedUserID, role).Scan(&invitationID, &token)
+	var expiresAt time.Time
+	err = tx.QueryRow(inviteQuery, workspaceID, inviterUserID, invitedEmail, invitedUserID, role).Scan(&invitationID, &token, &expiresAt)
 	if err != nil {
 		return fmt.Errorf("failed to create invitation: %w", err)
 	}
 
+	// Email the invitation so people without an account hear about it too
+	var workspaceName, inviterName string
+	err = tx.QueryRow(`
+		SELECT w.name, COALESCE(u.name, u.email)
+		FROM workspaces w, users u
+		WHERE w.id = $1 AND u.id = $2`, workspaceID, inviterUserID).Scan(&workspaceName, &inviterName)
+	if err != nil {
+		return fmt.Errorf("failed to load invitation details: %w", err)
+	}
+
+	err = enqueueEmail(tx, EmailWorkspaceInvitation, invitedEmail, map[string]interface{}{
+		"workspace_name": workspaceName,
+		"inviter_name":   inviterName,
+		"role":           role,
+		"token":          token,
+		"expires_at":     expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = enqueueWebhookEvent(tx, workspaceID, WebhookInvitationCreated, map[string]interface{}{
+		"invitation_id": invitationID,
+		"email":         invitedEmail,
+		"role":          role,
+		"invited_by":    inviterUserID,
+		"expires_at":    expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit invitation: %w", err)
+	}
+
 	// Create notification if user exists
 	if invitedUserID != nil {
 		notification := &Notification{
@@ -407,6 +451,24 @@ func (s *service) AcceptWorkspaceInvitationByToken(token string, userID int) err
 		return fmt.Errorf("failed to create membership: %w", err)
 	}
 
+	err = enqueueWebhookEvent(tx, invitation.WorkspaceID, WebhookInvitationAccepted, map[string]interface{}{
+		"invitation_id": invitation.ID,
+		"email":         invitation.InviteeEmail,
+		"user_id":       userID,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = enqueueWebhookEvent(tx, invitation.WorkspaceID, WebhookMemberJoined, map[string]interface{}{
+		"user_id":       userID,
+		"role":          invitation.Role,
+		"invitation_id": invitation.ID,
+	})
+	if err != nil {
+		return err
+	}
+
 	// Create notification for inviter
 	inviterNotification := &Notification{
 		UserID:  invitation.InviterID,
@@ -445,13 +507,19 @@ func (s *service) DeclineWorkspaceInvitation(token string, userID int) error {
 		return fmt.Errorf("invitation is not for this user")
 	}
 
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	// Update invitation status
 	query := `
 		UPDATE workspace_invitations 
 		SET status = 'declined', updated_at = NOW(), invitee_id = $1
 		WHERE token = $2 AND status = 'pending'`
 
-	result, err := s.db.Exec(query, userID, token)
+	result, err := tx.Exec(query, userID, token)
 	if err != nil {
 		return fmt.Errorf("failed to decline invitation: %w", err)
 	}
@@ -465,6 +533,19 @@ func (s *service) DeclineWorkspaceInvitation(token string, userID int) error {
 		return fmt.Errorf("invitation not found or already processed")
 	}
 
+	err = enqueueWebhookEvent(tx, invitation.WorkspaceID, WebhookInvitationDeclined, map[string]interface{}{
+		"invitation_id": invitation.ID,
+		"email":         invitation.InviteeEmail,
+		"user_id":       userID,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
 	// Create notification for inviter
 	notification := &Notification{
 		UserID:  invitation.InviterID,
@@ -659,13 +740,19 @@ func (s *service) UpdateMemberRole(workspaceID uuid.UUID, memberUserID int, newR
 		return fmt.Errorf("invalid role")
 	}
 
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	// Update member role
 	updateQuery := `
 		UPDATE workspace_memberships 
 		SET role = $1 
 		WHERE workspace_id = $2 AND user_id = $3`
 
-	result, err := s.db.Exec(updateQuery, newRole, workspaceID, memberUserID)
+	result, err := tx.Exec(updateQuery, newRole, workspaceID, memberUserID)
 	if err != nil {
 		return fmt.Errorf("failed to update member role: %w", err)
 	}
@@ -679,7 +766,17 @@ func (s *service) UpdateMemberRole(workspaceID uuid.UUID, memberUserID int, newR
 		return fmt.Errorf("member not found")
 	}
 
-	return nil
+	err = enqueueWebhookEvent(tx, workspaceID, WebhookMemberRoleChanged, map[string]interface{}{
+		"user_id":       memberUserID,
+		"previous_role": currentRole,
+		"role":          newRole,
+		"changed_by":    updaterUserID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 // RemoveMemberFromWorkspace removes a member from a workspace
@@ -728,13 +825,19 @@ func (s *service) RemoveMemberFromWorkspace(workspaceID uuid.UUID, memberUserID
 		}
 	}
 
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	// Remove member
 	removeQuery := `
 		UPDATE workspace_memberships 
 		SET status = 'removed' 
 		WHERE workspace_id = $1 AND user_id = $2`
 
-	result, err := s.db.Exec(removeQuery, workspaceID, memberUserID)
+	result, err := tx.Exec(removeQuery, workspaceID, memberUserID)
 	if err != nil {
 		return fmt.Errorf("failed to remove member: %w", err)
 	}
@@ -748,7 +851,16 @@ func (s *service) RemoveMemberFromWorkspace(workspaceID uuid.UUID, memberUserID
 		return fmt.Errorf("member not found")
 	}
 
-	return nil
+	err = enqueueWebhookEvent(tx, workspaceID, WebhookMemberRemoved, map[string]interface{}{
+		"user_id":    memberUserID,
+		"role":       memberRole,
+		"removed_by": removerUserID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 // CancelWorkspaceInvitation cancels a pending workspace invitation
@@ -774,25 +886,36 @@ func (s *service) CancelWorkspaceInvitation(invitationID uuid.UUID, userID int)
 		return fmt.Errorf("insufficient permissions to cancel invitation")
 	}
 
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	// Cancel the invitation
 	cancelQuery := `
 		UPDATE workspace_invitations 
 		SET status = 'cancelled', updated_at = NOW()
-		WHERE id = $1 AND status = 'pending'`
+		WHERE id = $1 AND status = 'pending'
+		RETURNING invitee_email`
 
-	result, err := s.db.Exec(cancelQuery, invitationID)
+	var inviteeEmail string
+	err = tx.QueryRow(cancelQuery, invitationID).Scan(&inviteeEmail)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("invitation not found or already processed")
+	}
 	if err != nil {
 		return fmt.Errorf("failed to cancel invitation: %w", err)
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	err = enqueueWebhookEvent(tx, workspaceID, WebhookInvitationCancelled, map[string]interface{}{
+		"invitation_id": invitationID,
+		"email":         inviteeEmail,
+		"cancelled_by":  userID,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+		return err
 	}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("invitation not found or already processed")
-	}
-
-	return nil
+	return tx.Commit()
 }
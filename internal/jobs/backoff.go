@@ -0,0 +1,29 @@
+package jobs
+
+import "time"
+
+// Backoff is the retry schedule of a queue: a failed item waits Base after its first attempt,
+// twice as long after each further attempt up to Max, and is given up on after MaxAttempts
+type Backoff struct {
+	Base        time.Duration
+	Max         time.Duration
+	MaxAttempts int
+}
+
+// RetryAt returns when to try again after the given number of attempts, or nil to give up
+func (b Backoff) RetryAt(attempts int, now time.Time) *time.Time {
+	if attempts >= b.MaxAttempts {
+		return nil
+	}
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	// Compare before shifting so a large attempt count cannot overflow
+	backoff := b.Max
+	if shift := attempts - 1; shift < 63 && b.Base <= b.Max>>shift {
+		backoff = b.Base << shift
+	}
+	retry := now.Add(backoff)
+	return &retry
+}
@@ -0,0 +1,33 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffRetryAt(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	backoff := Backoff{Base: time.Minute, Max: 6 * time.Hour, MaxAttempts: 100}
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, time.Minute},
+		{1, time.Minute},
+		{3, 4 * time.Minute},
+		{9, 256 * time.Minute},
+		{10, 6 * time.Hour},
+		{64, 6 * time.Hour},
+		{99, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if retryAt := backoff.RetryAt(tt.attempts, now); retryAt == nil || retryAt.Sub(now) != tt.want {
+			t.Errorf("RetryAt(%d) = %v, want now+%s", tt.attempts, retryAt, tt.want)
+		}
+	}
+
+	if retryAt := backoff.RetryAt(100, now); retryAt != nil {
+		t.Errorf("RetryAt(100) = %v, want nil", retryAt)
+	}
+}
@@ -0,0 +1,120 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"finalsign/internal/database"
+)
+
+// Advisory lock keys, one per job so different jobs can run concurrently
+const (
+	expireDocumentsLockKey      int64 = 0x46530001
+	expireInvitationsLockKey    int64 = 0x46530002
+	cleanupNotificationsLockKey int64 = 0x46530003
+	deliverEmailLockKey         int64 = 0x46530004
+	sendRemindersLockKey        int64 = 0x46530005
+	processBulkSendsLockKey     int64 = 0x46530006
+	deliverWebhooksLockKey      int64 = 0x46530007
+	reencryptObjectsLockKey     int64 = 0x46530008
+	finalizeDocumentsLockKey    int64 = 0x46530009
+)
+
+// MaintenanceJobs returns the bulk send, expiry, reminder and cleanup jobs. Intervals can be
+// overridden with JOB_PROCESS_BULK_SENDS_INTERVAL, JOB_EXPIRE_DOCUMENTS_INTERVAL,
+// JOB_SEND_REMINDERS_INTERVAL, JOB_EXPIRE_INVITATIONS_INTERVAL and
+// JOB_CLEANUP_NOTIFICATIONS_INTERVAL using Go duration syntax (e.g. "10m").
+func MaintenanceJobs(db database.Service) []Job {
+	return []Job{
+		{
+			Name:     "process_bulk_sends",
+			Interval: intervalFromEnv("JOB_PROCESS_BULK_SENDS_INTERVAL", 10*time.Second),
+			LockKey:  processBulkSendsLockKey,
+			Run:      db.ProcessBulkSendRows,
+		},
+		{
+			Name:     "expire_documents",
+			Interval: intervalFromEnv("JOB_EXPIRE_DOCUMENTS_INTERVAL", 5*time.Minute),
+			LockKey:  expireDocumentsLockKey,
+			Run:      db.ExpireOverdueDocuments,
+		},
+		{
+			Name:     "send_reminders",
+			Interval: intervalFromEnv("JOB_SEND_REMINDERS_INTERVAL", 15*time.Minute),
+			LockKey:  sendRemindersLockKey,
+			Run:      db.SendDueReminders,
+		},
+		{
+			Name:     "expire_invitations",
+			Interval: intervalFromEnv("JOB_EXPIRE_INVITATIONS_INTERVAL", time.Hour),
+			LockKey:  expireInvitationsLockKey,
+			Run:      db.CleanupExpiredInvitations,
+		},
+		{
+			Name:     "cleanup_notifications",
+			Interval: intervalFromEnv("JOB_CLEANUP_NOTIFICATIONS_INTERVAL", time.Hour),
+			LockKey:  cleanupNotificationsLockKey,
+			Run:      db.CleanupOldNotifications,
+		},
+	}
+}
+
+func intervalFromEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval <= 0 {
+		log.Printf("Ignoring invalid %s=%q, using %s", name, value, fallback)
+		return fallback
+	}
+	return interval
+}
+
+// EmailDeliveryJob drains the email outbox. The interval can be overridden with
+// JOB_DELIVER_EMAIL_INTERVAL.
+func EmailDeliveryJob(deliver func(ctx context.Context) (int, error)) Job {
+	return Job{
+		Name:     "deliver_email",
+		Interval: intervalFromEnv("JOB_DELIVER_EMAIL_INTERVAL", 15*time.Second),
+		LockKey:  deliverEmailLockKey,
+		Run:      deliver,
+	}
+}
+
+// WebhookDeliveryJob sends queued webhook deliveries. The interval can be overridden with
+// JOB_DELIVER_WEBHOOKS_INTERVAL.
+func WebhookDeliveryJob(deliver func(ctx context.Context) (int, error)) Job {
+	return Job{
+		Name:     "deliver_webhooks",
+		Interval: intervalFromEnv("JOB_DELIVER_WEBHOOKS_INTERVAL", 15*time.Second),
+		LockKey:  deliverWebhooksLockKey,
+		Run:      deliver,
+	}
+}
+
+// ReencryptionJob moves stored files and form values onto their workspace's active data key after
+// a key rotation. The interval can be overridden with JOB_REENCRYPT_OBJECTS_INTERVAL.
+func ReencryptionJob(reencrypt func(ctx context.Context) (int, error)) Job {
+	return Job{
+		Name:     "reencrypt_objects",
+		Interval: intervalFromEnv("JOB_REENCRYPT_OBJECTS_INTERVAL", 10*time.Minute),
+		LockKey:  reencryptObjectsLockKey,
+		Run:      reencrypt,
+	}
+}
+
+// FinalizationJob renders the final PDF of completed documents whose render failed or was never
+// attempted. The interval can be overridden with JOB_FINALIZE_DOCUMENTS_INTERVAL.
+func FinalizationJob(finalize func(ctx context.Context) (int, error)) Job {
+	return Job{
+		Name:     "finalize_documents",
+		Interval: intervalFromEnv("JOB_FINALIZE_DOCUMENTS_INTERVAL", 2*time.Minute),
+		LockKey:  finalizeDocumentsLockKey,
+		Run:      finalize,
+	}
+}
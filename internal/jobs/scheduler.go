@@ -0,0 +1,168 @@
+// Package jobs runs periodic background maintenance inside the API process.
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Locker guarantees a job runs on at most one API replica at a time.
+// database.Service implements it with Postgres advisory locks.
+type Locker interface {
+	WithAdvisoryLock(ctx context.Context, key int64, fn func(ctx context.Context) error) (bool, error)
+}
+
+// Job is a unit of periodic work. Run returns the number of rows it affected.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	LockKey  int64
+	Run      func(ctx context.Context) (int, error)
+}
+
+// RunStats records how a job has behaved since the scheduler started
+type RunStats struct {
+	Runs         int64         `json:"runs"`
+	Skipped      int64         `json:"skipped"` // another replica held the lock
+	Failures     int64         `json:"failures"`
+	LastRun      time.Time     `json:"last_run"`
+	LastDuration time.Duration `json:"last_duration"`
+	LastAffected int           `json:"last_affected"`
+	LastError    string        `json:"last_error,omitempty"`
+}
+
+// String summarises the stats for the health endpoint
+func (rs RunStats) String() string {
+	status := "ok"
+	if rs.LastError != "" {
+		status = "error: " + rs.LastError
+	}
+	return fmt.Sprintf("%s (runs=%d skipped=%d failures=%d last_affected=%d last_run=%s)",
+		status, rs.Runs, rs.Skipped, rs.Failures, rs.LastAffected, rs.LastRun.UTC().Format(time.RFC3339))
+}
+
+// Scheduler runs each job on its own interval until stopped
+type Scheduler struct {
+	locker Locker
+	jobs   []Job
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu    sync.Mutex
+	stats map[string]*RunStats
+}
+
+func NewScheduler(locker Locker, jobs []Job) *Scheduler {
+	stats := make(map[string]*RunStats, len(jobs))
+	for _, job := range jobs {
+		stats[job.Name] = &RunStats{}
+	}
+	return &Scheduler{locker: locker, jobs: jobs, stats: stats}
+}
+
+// Start launches every job. Each job runs once immediately and then on its interval.
+func (s *Scheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(ctx, job)
+	}
+	log.Printf("Background scheduler started with %d jobs", len(s.jobs))
+}
+
+// Stop cancels running jobs and waits for them to return or for ctx to expire
+func (s *Scheduler) Stop(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Println("Background scheduler stopped")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("background jobs did not stop in time: %w", ctx.Err())
+	}
+}
+
+// Stats returns a snapshot of every job's stats keyed by job name
+func (s *Scheduler) Stats() map[string]RunStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := make(map[string]RunStats, len(s.stats))
+	for name, stats := range s.stats {
+		snapshot[name] = *stats
+	}
+	return snapshot
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.runOnce(ctx, job)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runOnce runs a job under its advisory lock and records the outcome
+func (s *Scheduler) runOnce(ctx context.Context, job Job) {
+	// A run never overlaps the next tick
+	runCtx, cancel := context.WithTimeout(ctx, job.Interval)
+	defer cancel()
+
+	started := time.Now()
+	affected := 0
+	acquired, err := s.locker.WithAdvisoryLock(runCtx, job.LockKey, func(ctx context.Context) error {
+		var err error
+		affected, err = job.Run(ctx)
+		return err
+	})
+	duration := time.Since(started)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats[job.Name]
+
+	if err == nil && !acquired {
+		stats.Skipped++
+		return
+	}
+
+	stats.Runs++
+	stats.LastRun = started
+	stats.LastDuration = duration
+	stats.LastAffected = affected
+	stats.LastError = ""
+
+	if err != nil {
+		stats.Failures++
+		stats.LastError = err.Error()
+		log.Printf("Background job %s failed after %s: %v", job.Name, duration, err)
+		return
+	}
+
+	log.Printf("Background job %s affected %d rows in %s", job.Name, affected, duration)
+}
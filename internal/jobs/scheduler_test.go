@@ -0,0 +1,170 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLocker hands out each key to one caller at a time, like pg_try_advisory_lock
+type fakeLocker struct {
+	mu   sync.Mutex
+	held map[int64]bool
+}
+
+func (l *fakeLocker) WithAdvisoryLock(ctx context.Context, key int64, fn func(ctx context.Context) error) (bool, error) {
+	l.mu.Lock()
+	if l.held == nil {
+		l.held = map[int64]bool{}
+	}
+	if l.held[key] {
+		l.mu.Unlock()
+		return false, nil
+	}
+	l.held[key] = true
+	l.mu.Unlock()
+
+	defer func() {
+		l.mu.Lock()
+		delete(l.held, key)
+		l.mu.Unlock()
+	}()
+	return true, fn(ctx)
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSchedulerRunsJobsAndRecordsStats(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+
+	scheduler := NewScheduler(&fakeLocker{}, []Job{
+		{
+			Name:     "counting",
+			Interval: 10 * time.Millisecond,
+			LockKey:  1,
+			Run: func(ctx context.Context) (int, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				calls++
+				return 2, nil
+			},
+		},
+		{
+			Name:     "failing",
+			Interval: time.Hour,
+			LockKey:  2,
+			Run: func(ctx context.Context) (int, error) {
+				return 0, errors.New("boom")
+			},
+		},
+	})
+	scheduler.Start()
+
+	waitFor(t, func() bool {
+		return scheduler.Stats()["counting"].Runs >= 3 && scheduler.Stats()["failing"].Runs == 1
+	})
+
+	if err := scheduler.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+
+	stats := scheduler.Stats()
+	if stats["counting"].LastAffected != 2 || stats["counting"].Failures != 0 {
+		t.Errorf("counting stats = %+v", stats["counting"])
+	}
+	if stats["failing"].Failures != 1 || stats["failing"].LastError != "boom" {
+		t.Errorf("failing stats = %+v", stats["failing"])
+	}
+
+	// No run may start after Stop returns
+	mu.Lock()
+	stopped := calls
+	mu.Unlock()
+	time.Sleep(30 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != stopped {
+		t.Errorf("job ran %d more times after Stop", calls-stopped)
+	}
+}
+
+func TestSchedulerSkipsJobHeldByAnotherReplica(t *testing.T) {
+	locker := &fakeLocker{held: map[int64]bool{7: true}}
+	ran := false
+
+	scheduler := NewScheduler(locker, []Job{{
+		Name:     "locked",
+		Interval: 10 * time.Millisecond,
+		LockKey:  7,
+		Run: func(ctx context.Context) (int, error) {
+			ran = true
+			return 0, nil
+		},
+	}})
+	scheduler.Start()
+
+	waitFor(t, func() bool { return scheduler.Stats()["locked"].Skipped >= 2 })
+	if err := scheduler.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+
+	if ran {
+		t.Error("job ran while another replica held its lock")
+	}
+	if runs := scheduler.Stats()["locked"].Runs; runs != 0 {
+		t.Errorf("Runs = %d, want 0", runs)
+	}
+}
+
+func TestSchedulerStopCancelsRunningJob(t *testing.T) {
+	started := make(chan struct{})
+
+	scheduler := NewScheduler(&fakeLocker{}, []Job{{
+		Name:     "slow",
+		Interval: time.Hour,
+		LockKey:  3,
+		Run: func(ctx context.Context) (int, error) {
+			close(started)
+			<-ctx.Done()
+			return 0, ctx.Err()
+		},
+	}})
+	scheduler.Start()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := scheduler.Stop(ctx); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+}
+
+func TestIntervalFromEnv(t *testing.T) {
+	t.Setenv("JOB_TEST_INTERVAL", "")
+	if got := intervalFromEnv("JOB_TEST_INTERVAL", time.Minute); got != time.Minute {
+		t.Errorf("unset interval = %s", got)
+	}
+
+	t.Setenv("JOB_TEST_INTERVAL", "90s")
+	if got := intervalFromEnv("JOB_TEST_INTERVAL", time.Minute); got != 90*time.Second {
+		t.Errorf("interval = %s, want 90s", got)
+	}
+
+	t.Setenv("JOB_TEST_INTERVAL", "-5m")
+	if got := intervalFromEnv("JOB_TEST_INTERVAL", time.Minute); got != time.Minute {
+		t.Errorf("invalid interval = %s, want fallback", got)
+	}
+}
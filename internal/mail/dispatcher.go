@@ -0,0 +1,86 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"finalsign/internal/database"
+	"finalsign/internal/jobs"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// MaxAttempts is how many times an email is tried before it is marked failed
+	MaxAttempts = 8
+	batchSize   = 50
+	baseBackoff = time.Minute
+	maxBackoff  = 6 * time.Hour
+)
+
+var retryBackoff = jobs.Backoff{Base: baseBackoff, Max: maxBackoff, MaxAttempts: MaxAttempts}
+
+// Outbox is the email queue. database.Service implements it.
+type Outbox interface {
+	ClaimPendingEmails(ctx context.Context, limit int) ([]database.OutboxEmail, error)
+	MarkEmailSent(ctx context.Context, emailID uuid.UUID) error
+	MarkEmailFailed(ctx context.Context, emailID uuid.UUID, lastError string, retryAt *time.Time) error
+}
+
+// Dispatcher delivers queued email, retrying failures with exponential backoff
+type Dispatcher struct {
+	outbox   Outbox
+	renderer *Renderer
+	mailer   Mailer
+	now      func() time.Time
+}
+
+func NewDispatcher(outbox Outbox, renderer *Renderer, mailer Mailer) *Dispatcher {
+	return &Dispatcher{outbox: outbox, renderer: renderer, mailer: mailer, now: time.Now}
+}
+
+// DeliverPending sends every due email and returns how many it processed. It is meant to
+// run as a background job.
+func (d *Dispatcher) DeliverPending(ctx context.Context) (int, error) {
+	processed := 0
+	for {
+		emails, err := d.outbox.ClaimPendingEmails(ctx, batchSize)
+		if err != nil {
+			return processed, err
+		}
+
+		for _, email := range emails {
+			if err := d.deliver(ctx, email); err != nil {
+				return processed, err
+			}
+			processed++
+		}
+
+		if len(emails) < batchSize || ctx.Err() != nil {
+			return processed, ctx.Err()
+		}
+	}
+}
+
+// deliver sends one email and records the outcome. Only failures to record the outcome are
+// returned; a failed send is rescheduled.
+func (d *Dispatcher) deliver(ctx context.Context, email database.OutboxEmail) error {
+	message, err := d.renderer.Render(email.Template, email.RecipientEmail, email.Data)
+	if err != nil {
+		// A template error will not fix itself, so give up straight away
+		log.Printf("Email %s cannot be rendered: %v", email.ID, err)
+		return d.outbox.MarkEmailFailed(ctx, email.ID, err.Error(), nil)
+	}
+
+	if err := d.mailer.Send(ctx, message); err != nil {
+		retryAt := retryBackoff.RetryAt(email.Attempts, d.now())
+		if retryAt == nil {
+			log.Printf("Email %s to %s failed permanently after %d attempts: %v", email.ID, email.RecipientEmail, email.Attempts, err)
+		}
+		return d.outbox.MarkEmailFailed(ctx, email.ID, fmt.Sprintf("attempt %d: %v", email.Attempts, err), retryAt)
+	}
+
+	return d.outbox.MarkEmailSent(ctx, email.ID)
+}
@@ -0,0 +1,431 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"finalsign/internal/database"
+
+	"github.com/google/uuid"
+)
+
+func newTestRenderer(t *testing.T) *Renderer {
+	t.Helper()
+
+	renderer, err := NewRenderer("https://app.example.com/")
+	if err != nil {
+		t.Fatalf("NewRenderer() error = %v", err)
+	}
+	return renderer
+}
+
+// templateData is representative queued data for each template, as it comes back from JSONB
+var templateData = map[string]map[string]interface{}{
+	"workspace_invitation": {
+		"workspace_name": "Acme <Legal>",
+		"inviter_name":   "Ada",
+		"role":           "member",
+		"token":          "invite-token",
+		"expires_at":     "2024-05-08T09:00:00Z",
+	},
+	"signature_request": {
+		"document_name": "Lease",
+		"sender_name":   "Ada",
+		"signer_name":   "Grace",
+		"access_token":  "access-token",
+		"expires_at":    nil,
+	},
+	"document_completed": {
+		"document_id":    "6f1c2a4e-0000-4000-8000-000000000001",
+		"document_name":  "Lease",
+		"recipient_name": "Ada",
+		"is_sender":      true,
+	},
+	"document_voided": {
+		"document_name": "Lease",
+		"sender_name":   "Ada",
+		"signer_name":   "Grace",
+		"reason":        "Terms changed",
+	},
+	"document_declined": {
+		"document_id":   "6f1c2a4e-0000-4000-8000-000000000001",
+		"document_name": "Lease",
+		"sender_name":   "Ada",
+		"signer_name":   "Grace",
+		"signer_email":  "grace@example.com",
+		"reason":        "Wrong start date",
+	},
+	"signing_reminder": {
+		"document_name": "Lease",
+		"sender_name":   "Ada",
+		"signer_name":   "",
+		"access_token":  "access-token",
+		"expires_at":    "2024-05-08T09:00:00Z",
+	},
+}
+
+func TestRenderAllTemplates(t *testing.T) {
+	renderer := newTestRenderer(t)
+
+	for _, name := range Templates {
+		data, ok := templateData[name]
+		if !ok {
+			t.Fatalf("no test data for template %s", name)
+		}
+
+		message, err := renderer.Render(name, "grace@example.com", data)
+		if err != nil {
+			t.Errorf("Render(%s) error = %v", name, err)
+			continue
+		}
+		if message.Subject == "" || message.Text == "" || message.HTML == "" {
+			t.Errorf("Render(%s) produced an empty part: %+v", name, message)
+		}
+		for _, part := range []string{message.Subject, message.Text, message.HTML} {
+			if strings.Contains(part, "<no value>") {
+				t.Errorf("Render(%s) left a variable unfilled", name)
+			}
+		}
+	}
+}
+
+func TestRenderSignatureRequest(t *testing.T) {
+	message, err := newTestRenderer(t).Render("signature_request", "grace@example.com", templateData["signature_request"])
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+
+	if message.Subject != "Ada sent you Lease to sign" {
+		t.Errorf("Subject = %q", message.Subject)
+	}
+	if !strings.Contains(message.Text, "https://app.example.com/sign/access-token") {
+		t.Errorf("text part is missing the signing link:\n%s", message.Text)
+	}
+	if !strings.Contains(message.HTML, `href="https://app.example.com/sign/access-token"`) {
+		t.Errorf("HTML part is missing the signing link")
+	}
+	if strings.Contains(message.Text, "must be signed by") {
+		t.Errorf("documents without an expiry should not mention a deadline")
+	}
+}
+
+func TestRenderEscapesHTML(t *testing.T) {
+	message, err := newTestRenderer(t).Render("workspace_invitation", "grace@example.com", templateData["workspace_invitation"])
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+
+	if !strings.Contains(message.HTML, "Acme &lt;Legal&gt;") {
+		t.Error("workspace name should be HTML escaped")
+	}
+	if !strings.Contains(message.Text, "Acme <Legal>") {
+		t.Error("text part should not be escaped")
+	}
+	if !strings.Contains(message.Text, "May 8, 2024") {
+		t.Errorf("expiry date not formatted:\n%s", message.Text)
+	}
+}
+
+func TestRenderRejectsBadInput(t *testing.T) {
+	renderer := newTestRenderer(t)
+
+	if _, err := renderer.Render("no_such_template", "a@example.com", nil); err == nil {
+		t.Error("expected an error for an unknown template")
+	}
+	if _, err := renderer.Render("signature_request", "a@example.com", map[string]interface{}{}); err == nil {
+		t.Error("expected an error when template variables are missing")
+	}
+}
+
+func TestMessageBytes(t *testing.T) {
+	message := Message{
+		To:      "grace@example.com",
+		Subject: "Café contract\r\nBcc: attacker@example.com",
+		Text:    "Plain body",
+		HTML:    "<p>HTML body</p>",
+	}
+
+	data, err := message.Bytes("FinalSign <no-reply@finalsign.io>", time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Bytes() error = %v", err)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatalf("failed to parse message: %v", err)
+	}
+	if parsed.Header.Get("Bcc") != "" {
+		t.Error("subject must not be able to inject headers")
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || !strings.HasPrefix(subject, "Café contract") {
+		t.Errorf("Subject = %q, %v", subject, err)
+	}
+	if !strings.HasSuffix(parsed.Header.Get("Message-ID"), "@finalsign.io>") {
+		t.Errorf("Message-ID = %q", parsed.Header.Get("Message-ID"))
+	}
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, %v", mediaType, err)
+	}
+
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	var parts []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read part: %v", err)
+		}
+		body, _ := io.ReadAll(quotedprintable.NewReader(part))
+		parts = append(parts, part.Header.Get("Content-Type")+"|"+string(body))
+	}
+
+	want := []string{"text/plain; charset=UTF-8|Plain body", "text/html; charset=UTF-8|<p>HTML body</p>"}
+	if strings.Join(parts, "\n") != strings.Join(want, "\n") {
+		t.Errorf("parts = %q, want %q", parts, want)
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	mailer, err := NewFileMailer(dir, defaultFrom)
+	if err != nil {
+		t.Fatalf("NewFileMailer() error = %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := mailer.Send(context.Background(), Message{To: "grace@example.com", Subject: "Hi", Text: "Hello"}); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("outbox files = %v, %v", files, err)
+	}
+	data, _ := os.ReadFile(files[0])
+	if !strings.Contains(string(data), "To: grace@example.com") {
+		t.Errorf("unexpected message file:\n%s", data)
+	}
+}
+
+// fakeOutbox records what the dispatcher did with each email
+type fakeOutbox struct {
+	pending []database.OutboxEmail
+	sent    []uuid.UUID
+	failed  map[uuid.UUID]*time.Time
+}
+
+func (o *fakeOutbox) ClaimPendingEmails(ctx context.Context, limit int) ([]database.OutboxEmail, error) {
+	n := min(limit, len(o.pending))
+	claimed := o.pending[:n]
+	o.pending = o.pending[n:]
+	for i := range claimed {
+		claimed[i].Attempts++
+	}
+	return claimed, nil
+}
+
+func (o *fakeOutbox) MarkEmailSent(ctx context.Context, emailID uuid.UUID) error {
+	o.sent = append(o.sent, emailID)
+	return nil
+}
+
+func (o *fakeOutbox) MarkEmailFailed(ctx context.Context, emailID uuid.UUID, lastError string, retryAt *time.Time) error {
+	if o.failed == nil {
+		o.failed = map[uuid.UUID]*time.Time{}
+	}
+	o.failed[emailID] = retryAt
+	return nil
+}
+
+// failingMailer fails for one recipient and delegates everything else
+type failingMailer struct {
+	Mailer
+	failFor string
+}
+
+func (m failingMailer) Send(ctx context.Context, message Message) error {
+	if message.To == m.failFor {
+		return errors.New("mailbox unavailable")
+	}
+	return m.Mailer.Send(ctx, message)
+}
+
+func TestDispatcherDeliverPending(t *testing.T) {
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	ok, retry, exhausted, broken := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+
+	outbox := &fakeOutbox{pending: []database.OutboxEmail{
+		{ID: ok, Template: "signature_request", RecipientEmail: "ok@example.com", Data: templateData["signature_request"]},
+		{ID: retry, Template: "signature_request", RecipientEmail: "down@example.com", Data: templateData["signature_request"], Attempts: 2},
+		{ID: exhausted, Template: "signature_request", RecipientEmail: "down@example.com", Data: templateData["signature_request"], Attempts: MaxAttempts - 1},
+		{ID: broken, Template: "signature_request", RecipientEmail: "ok@example.com", Data: map[string]interface{}{}},
+	}}
+	memory := NewMemoryMailer()
+
+	dispatcher := NewDispatcher(outbox, newTestRenderer(t), failingMailer{Mailer: memory, failFor: "down@example.com"})
+	dispatcher.now = func() time.Time { return now }
+
+	delivered, err := dispatcher.DeliverPending(context.Background())
+	if err != nil {
+		t.Fatalf("DeliverPending() error = %v", err)
+	}
+	if delivered != 4 {
+		t.Errorf("delivered = %d, want 4 processed", delivered)
+	}
+
+	if len(outbox.sent) != 1 || outbox.sent[0] != ok {
+		t.Errorf("sent = %v, want only %s", outbox.sent, ok)
+	}
+	if messages := memory.Messages(); len(messages) != 1 || messages[0].To != "ok@example.com" {
+		t.Errorf("mailer received %+v", messages)
+	}
+
+	// Third attempt backs off 4 minutes
+	if retryAt := outbox.failed[retry]; retryAt == nil || !retryAt.Equal(now.Add(4*time.Minute)) {
+		t.Errorf("retry scheduled at %v, want %v", retryAt, now.Add(4*time.Minute))
+	}
+	if retryAt, failed := outbox.failed[exhausted]; !failed || retryAt != nil {
+		t.Errorf("email out of attempts should fail permanently, got retry %v", retryAt)
+	}
+	if retryAt, failed := outbox.failed[broken]; !failed || retryAt != nil {
+		t.Errorf("unrenderable email should fail permanently, got retry %v", retryAt)
+	}
+}
+
+func TestRetryBackoffIsCapped(t *testing.T) {
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+
+	if retryAt := retryBackoff.RetryAt(1, now); !retryAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("first retry at %v", retryAt)
+	}
+	if retryAt := retryBackoff.RetryAt(MaxAttempts-1, now); retryAt.Sub(now) > maxBackoff {
+		t.Errorf("backoff %v exceeds cap", retryAt.Sub(now))
+	}
+}
+
+// fakeSMTPServer accepts a single message without TLS or authentication
+func fakeSMTPServer(t *testing.T) (int, <-chan string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan string, 1)
+	var once sync.Once
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost ESMTP")
+
+		var data strings.Builder
+		inData := false
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					once.Do(func() { received <- data.String() })
+					reply("250 OK")
+					continue
+				}
+				data.WriteString(line)
+				continue
+			}
+
+			switch command := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(command, "DATA"):
+				inData = true
+				reply("354 End data with <CR><LF>.<CR><LF>")
+			case strings.HasPrefix(command, "QUIT"):
+				reply("221 Bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port, received
+}
+
+func TestSMTPMailer(t *testing.T) {
+	port, received := fakeSMTPServer(t)
+
+	mailer, err := NewSMTPMailer("127.0.0.1", port, "", "", defaultFrom)
+	if err != nil {
+		t.Fatalf("NewSMTPMailer() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = mailer.Send(ctx, Message{To: "Grace <grace@example.com>", Subject: "Hello", Text: "Body"})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	select {
+	case data := <-received:
+		if !strings.Contains(data, "Subject: Hello") {
+			t.Errorf("unexpected message:\n%s", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("SMTP server did not receive a message")
+	}
+}
+
+func TestNewMailerFromEnv(t *testing.T) {
+	t.Setenv("MAIL_BACKEND", "memory")
+	if mailer, err := NewMailerFromEnv(); err != nil {
+		t.Fatalf("NewMailerFromEnv() error = %v", err)
+	} else if _, ok := mailer.(*MemoryMailer); !ok {
+		t.Errorf("mailer = %T, want *MemoryMailer", mailer)
+	}
+
+	t.Setenv("MAIL_BACKEND", "smtp")
+	t.Setenv("SMTP_HOST", "smtp.example.com")
+	t.Setenv("SMTP_PORT", strconv.Itoa(2525))
+	if mailer, err := NewMailerFromEnv(); err != nil {
+		t.Fatalf("NewMailerFromEnv() error = %v", err)
+	} else if smtpMailer, ok := mailer.(*SMTPMailer); !ok || smtpMailer.port != 2525 {
+		t.Errorf("mailer = %#v", mailer)
+	}
+
+	t.Setenv("MAIL_BACKEND", "carrier-pigeon")
+	if _, err := NewMailerFromEnv(); err == nil {
+		t.Error("expected an error for an unknown backend")
+	}
+}
@@ -0,0 +1,110 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+//go:embed templates/*.html templates/*.txt
+var templateFiles embed.FS
+
+// Templates lists every email the renderer knows. Each has a .txt file that also defines the
+// "subject" template and an .html file that defines "content" for the shared layout.
+var Templates = []string{
+	"workspace_invitation",
+	"signature_request",
+	"document_completed",
+	"signing_reminder",
+	"document_voided",
+	"document_declined",
+}
+
+var templateFuncs = map[string]any{
+	"date": formatDate,
+}
+
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// Renderer turns a template name and its data into a Message. A variable missing from the
+// data is an error rather than an empty string in the email.
+type Renderer struct {
+	appURL    string
+	templates map[string]emailTemplate
+}
+
+// NewRenderer parses the embedded templates. appURL is the frontend base URL used in links.
+func NewRenderer(appURL string) (*Renderer, error) {
+	renderer := &Renderer{
+		appURL:    strings.TrimRight(appURL, "/"),
+		templates: make(map[string]emailTemplate, len(Templates)),
+	}
+
+	for _, name := range Templates {
+		text, err := texttemplate.New(name+".txt").Funcs(templateFuncs).Option("missingkey=error").ParseFS(templateFiles, "templates/"+name+".txt")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s text template: %w", name, err)
+		}
+		html, err := htmltemplate.New("layout.html").Funcs(templateFuncs).Option("missingkey=error").ParseFS(templateFiles, "templates/layout.html", "templates/"+name+".html")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s HTML template: %w", name, err)
+		}
+		renderer.templates[name] = emailTemplate{text: text, html: html}
+	}
+
+	return renderer, nil
+}
+
+// Render builds the message for one queued email
+func (r *Renderer) Render(name, to string, data map[string]interface{}) (Message, error) {
+	tmpl, ok := r.templates[name]
+	if !ok {
+		return Message{}, fmt.Errorf("unknown email template %q", name)
+	}
+
+	values := make(map[string]interface{}, len(data)+1)
+	for key, value := range data {
+		values[key] = value
+	}
+	values["app_url"] = r.appURL
+
+	var subject, text, html bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", values); err != nil {
+		return Message{}, fmt.Errorf("failed to render %s subject: %w", name, err)
+	}
+	if err := tmpl.text.Execute(&text, values); err != nil {
+		return Message{}, fmt.Errorf("failed to render %s text: %w", name, err)
+	}
+	if err := tmpl.html.ExecuteTemplate(&html, "layout", values); err != nil {
+		return Message{}, fmt.Errorf("failed to render %s HTML: %w", name, err)
+	}
+
+	return Message{
+		To:      to,
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+		HTML:    html.String(),
+	}, nil
+}
+
+// formatDate renders a timestamp from queued JSON data (an RFC 3339 string) as a readable date
+func formatDate(value any) string {
+	switch v := value.(type) {
+	case time.Time:
+		return v.UTC().Format("January 2, 2006")
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return t.UTC().Format("January 2, 2006")
+		}
+		return v
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,237 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/font"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+const (
+	certificateFont     = "Helvetica"
+	certificateBoldFont = "Helvetica-Bold"
+	certificatePageW    = 612.0 // US Letter
+	certificatePageH    = 792.0
+	certificateMargin   = 54.0
+	certificateTimeFmt  = "2006-01-02 15:04:05 UTC"
+)
+
+// CertificateSigner is one signer as listed on a certificate of completion
+type CertificateSigner struct {
+	Order       int
+	Name        string
+	Email       string
+	Status      string
+	ViewedAt    *time.Time
+	CompletedAt *time.Time
+}
+
+// CertificateEvent is one audit trail entry as listed on a certificate of completion
+type CertificateEvent struct {
+	Time      time.Time
+	Action    string
+	Actor     string
+	IPAddress string
+	UserAgent string
+}
+
+// CompletionCertificate summarises how a document was signed
+type CompletionCertificate struct {
+	DocumentID   string
+	DocumentName string
+	DocumentHash string // SHA-256 of the original template PDF
+	CreatedAt    time.Time
+	CompletedAt  time.Time
+	Signers      []CertificateSigner
+	Events       []CertificateEvent
+}
+
+// certificateLine is a single line of certificate text
+type certificateLine struct {
+	bold   bool
+	size   float64
+	indent float64
+	text   string
+	before float64 // extra space above the line
+}
+
+// RenderCertificate lays out a certificate of completion as a standalone PDF.
+// Output is deterministic for a given certificate.
+func RenderCertificate(certificate CompletionCertificate) []byte {
+	var lines []certificateLine
+	add := func(line certificateLine) {
+		lines = append(lines, line)
+	}
+	heading := func(text string) {
+		add(certificateLine{bold: true, size: 12, text: text, before: 14})
+	}
+	detail := func(indent float64, text string) {
+		for _, wrapped := range wrapText(text, certificateFont, 9, certificatePageW-2*certificateMargin-indent) {
+			add(certificateLine{size: 9, indent: indent, text: wrapped})
+		}
+	}
+
+	add(certificateLine{bold: true, size: 18, text: "Certificate of Completion"})
+	add(certificateLine{size: 10, text: "Issued by FinalSign", before: 4})
+
+	heading("Document")
+	detail(0, "Name: "+certificate.DocumentName)
+	detail(0, "Document ID: "+certificate.DocumentID)
+	if certificate.DocumentHash != "" {
+		detail(0, "Original SHA-256: "+certificate.DocumentHash)
+	}
+	detail(0, "Created: "+formatCertificateTime(&certificate.CreatedAt))
+	detail(0, "Completed: "+formatCertificateTime(&certificate.CompletedAt))
+
+	heading("Signers")
+	for _, signer := range certificate.Signers {
+		name := signer.Email
+		if signer.Name != "" {
+			name = fmt.Sprintf("%s <%s>", signer.Name, signer.Email)
+		}
+		add(certificateLine{bold: true, size: 9, text: fmt.Sprintf("%d. %s", signer.Order, name), before: 4})
+		detail(12, "Status: "+signer.Status)
+		detail(12, "Viewed: "+formatCertificateTime(signer.ViewedAt))
+		detail(12, "Signed: "+formatCertificateTime(signer.CompletedAt))
+	}
+
+	heading("Audit Trail")
+	for _, event := range certificate.Events {
+		summary := formatCertificateTime(&event.Time) + "  " + event.Action
+		if event.Actor != "" {
+			summary += " - " + event.Actor
+		}
+		add(certificateLine{bold: true, size: 9, text: summary, before: 4})
+		if event.IPAddress != "" {
+			detail(12, "IP address: "+event.IPAddress)
+		}
+		if event.UserAgent != "" {
+			detail(12, "User agent: "+event.UserAgent)
+		}
+	}
+
+	return writeCertificatePDF(paginate(lines))
+}
+
+// AppendPDF returns doc followed by every page of extra
+func AppendPDF(doc, extra []byte) ([]byte, error) {
+	var out bytes.Buffer
+	readers := []io.ReadSeeker{bytes.NewReader(doc), bytes.NewReader(extra)}
+	if err := api.MergeRaw(readers, &out, false, model.NewDefaultConfiguration()); err != nil {
+		return nil, fmt.Errorf("failed to append pages: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// paginate converts lines into one content stream per page
+func paginate(lines []certificateLine) [][]byte {
+	var pages [][]byte
+	var content bytes.Buffer
+	y := certificatePageH - certificateMargin
+
+	for _, line := range lines {
+		leading := line.size*1.35 + line.before
+		if content.Len() > 0 && y-leading < certificateMargin {
+			pages = append(pages, append([]byte(nil), content.Bytes()...))
+			content.Reset()
+			y = certificatePageH - certificateMargin
+		}
+		y -= leading
+
+		fontID := "F1"
+		if line.bold {
+			fontID = "F2"
+		}
+		fmt.Fprintf(&content, "BT /%s %s Tf 0 g %s %s Td (%s) Tj ET\n",
+			fontID, num(line.size), num(certificateMargin+line.indent), num(y), escapeString(encodeWinAnsi(line.text)))
+	}
+
+	return append(pages, content.Bytes())
+}
+
+// writeCertificatePDF assembles a minimal PDF around the page content streams
+func writeCertificatePDF(pages [][]byte) []byte {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.7\n")
+
+	// 1 catalog, 2 page tree, 3-4 fonts, then a page and content stream pair per page
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", certificateFont))
+	object(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", certificateBoldFont))
+	for i, content := range pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			num(certificatePageW), num(certificatePageH), 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content)+1, content))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return out.Bytes()
+}
+
+// wrapText breaks text into lines no wider than width. Words longer than a line are split.
+func wrapText(text, fontName string, size, width float64) []string {
+	textWidth := func(s string) float64 {
+		return font.TextWidth(encodeWinAnsi(s), fontName, int(size*1000)) / 1000
+	}
+
+	var lines []string
+	current := ""
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if current != "" {
+			candidate = current + " " + word
+		}
+		if textWidth(candidate) <= width {
+			current = candidate
+			continue
+		}
+		if current != "" {
+			lines = append(lines, current)
+		}
+		// Hard-break words that cannot fit on a line of their own
+		runes := []rune(word)
+		for textWidth(string(runes)) > width {
+			cut := len(runes) - 1
+			for cut > 1 && textWidth(string(runes[:cut])) > width {
+				cut--
+			}
+			lines = append(lines, string(runes[:cut]))
+			runes = runes[cut:]
+		}
+		current = string(runes)
+	}
+	if current != "" || len(lines) == 0 {
+		lines = append(lines, current)
+	}
+	return lines
+}
+
+func formatCertificateTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(certificateTimeFmt)
+}
@@ -0,0 +1,116 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/font"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+func testCertificate(events int) CompletionCertificate {
+	created := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	completed := created.Add(3 * time.Hour)
+
+	certificate := CompletionCertificate{
+		DocumentID:   "6f1c2a4e-0000-4000-8000-000000000001",
+		DocumentName: "Lease (2024)",
+		DocumentHash: strings.Repeat("ab", 32),
+		CreatedAt:    created,
+		CompletedAt:  completed,
+		Signers: []CertificateSigner{
+			{Order: 1, Name: "Ada Lovelace", Email: "ada@example.com", Status: "completed", CompletedAt: &completed},
+		},
+	}
+	for i := 0; i < events; i++ {
+		certificate.Events = append(certificate.Events, CertificateEvent{
+			Time:      created.Add(time.Duration(i) * time.Minute),
+			Action:    fmt.Sprintf("Event %d", i),
+			IPAddress: "203.0.113.7",
+			UserAgent: "Mozilla/5.0 (X11; Linux x86_64) " + strings.Repeat("VeryLongUserAgentToken", 8),
+		})
+	}
+	return certificate
+}
+
+func pageCount(t *testing.T, data []byte) int {
+	t.Helper()
+
+	ctx, err := api.ReadContext(bytes.NewReader(data), model.NewDefaultConfiguration())
+	if err != nil {
+		t.Fatalf("failed to read PDF: %v", err)
+	}
+	if err := api.ValidateContext(ctx); err != nil {
+		t.Fatalf("PDF is invalid: %v", err)
+	}
+	return ctx.PageCount
+}
+
+func TestRenderCertificate(t *testing.T) {
+	certificate := testCertificate(1)
+	data := RenderCertificate(certificate)
+
+	if !bytes.Equal(data, RenderCertificate(certificate)) {
+		t.Error("RenderCertificate() output is not deterministic")
+	}
+
+	content := pageContent(t, data, 1)
+	for _, want := range []string{
+		"(Certificate of Completion)",
+		`(Name: Lease \(2024\))`,
+		"(1. Ada Lovelace <ada@example.com>)",
+		"(Signed: 2024-05-01 12:00:00 UTC)",
+		"(2024-05-01 09:00:00 UTC  Event 0)",
+		"(IP address: 203.0.113.7)",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("certificate missing %q", want)
+		}
+	}
+}
+
+func TestRenderCertificatePaginates(t *testing.T) {
+	data := RenderCertificate(testCertificate(60))
+
+	pages := pageCount(t, data)
+	if pages < 2 {
+		t.Fatalf("page count = %d, want several pages", pages)
+	}
+
+	last := pageContent(t, data, pages)
+	if !strings.Contains(last, "Event 59") {
+		t.Error("last event should appear on the last page")
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	lines := wrapText("short "+strings.Repeat("x", 400), certificateFont, 9, 200)
+	if len(lines) < 3 || lines[0] != "short" {
+		t.Fatalf("wrapText() = %q", lines)
+	}
+	for _, line := range lines {
+		if width := font.TextWidth(line, certificateFont, 9000) / 1000; width > 200 {
+			t.Errorf("line %q is %.1fpt wide", line, width)
+		}
+	}
+}
+
+func TestAppendPDF(t *testing.T) {
+	doc := testPDF(t, "", [4]float64{0, 0, 600, 800}, [4]float64{0, 0, 600, 800})
+
+	merged, err := AppendPDF(doc, RenderCertificate(testCertificate(1)))
+	if err != nil {
+		t.Fatalf("AppendPDF() error = %v", err)
+	}
+
+	if pages := pageCount(t, merged); pages != 3 {
+		t.Fatalf("page count = %d, want 3", pages)
+	}
+	if !strings.Contains(pageContent(t, merged, 3), "(Certificate of Completion)") {
+		t.Error("certificate should be the last page")
+	}
+}
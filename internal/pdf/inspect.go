@@ -0,0 +1,118 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// headerSearchSize is how far into a file the "%PDF-" header may start. Readers accept a
+// little leading junk, so the header is not required at offset 0.
+const headerSearchSize = 1024
+
+var (
+	// ErrNotPDF is returned by Inspect for files without a PDF header
+	ErrNotPDF = errors.New("file is not a PDF")
+	// ErrEncrypted is returned by Inspect for password-protected PDFs, which cannot be stamped
+	ErrEncrypted = errors.New("PDF is password-protected")
+	// ErrMalformed is returned by Inspect for PDFs whose structure or page tree cannot be read
+	ErrMalformed = errors.New("PDF is damaged or malformed")
+)
+
+// Page is the geometry of one page. Width and Height are the size of the page as displayed, in
+// points: its crop box (or media box) turned by Rotation, which is what a Position's fractions
+// refer to. MediaBox is the page's media box as [llx lly urx ury].
+type Page struct {
+	Number   int        `json:"page"`
+	Width    float64    `json:"width"`
+	Height   float64    `json:"height"`
+	Rotation int        `json:"rotation"`
+	MediaBox [4]float64 `json:"media_box"`
+}
+
+// Inspect reads an uploaded PDF and returns its pages. It rejects files that are not PDFs,
+// password-protected PDFs and PDFs whose pages cannot be read. The whole document structure is
+// parsed, as StampFields will have to do later.
+func Inspect(r io.ReadSeeker) (pages []Page, err error) {
+	// pdfcpu can panic on some damaged files; uploads are untrusted, so that must not crash us
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			pages, err = nil, fmt.Errorf("%w: %v", ErrMalformed, recovered)
+		}
+	}()
+
+	header := make([]byte, headerSearchSize)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if !bytes.Contains(header[:n], []byte("%PDF-")) {
+		return nil, ErrNotPDF
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	ctx, err := api.ReadContext(r, model.NewDefaultConfiguration())
+	if errors.Is(err, pdfcpu.ErrWrongPassword) {
+		return nil, ErrEncrypted
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	// PDFs with only an owner password open without one, but would be written back encrypted
+	if ctx.Encrypt != nil {
+		return nil, ErrEncrypted
+	}
+
+	if err := ctx.EnsurePageCount(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	if ctx.PageCount < 1 {
+		return nil, fmt.Errorf("%w: document has no pages", ErrMalformed)
+	}
+
+	pages = make([]Page, ctx.PageCount)
+	for pageNr := 1; pageNr <= ctx.PageCount; pageNr++ {
+		_, _, inherited, err := ctx.PageDict(pageNr, false)
+		if err != nil || inherited == nil {
+			return nil, fmt.Errorf("%w: page %d cannot be read", ErrMalformed, pageNr)
+		}
+
+		media := inherited.MediaBox
+		if media == nil {
+			return nil, fmt.Errorf("%w: page %d has no media box", ErrMalformed, pageNr)
+		}
+		box := inherited.CropBox
+		if box == nil {
+			box = media
+		}
+
+		rotation := ((inherited.Rotate % 360) + 360) % 360
+		if rotation%90 != 0 {
+			return nil, fmt.Errorf("%w: page %d has an invalid rotation of %d", ErrMalformed, pageNr, inherited.Rotate)
+		}
+		width, height := box.Width(), box.Height()
+		if width <= 0 || height <= 0 {
+			return nil, fmt.Errorf("%w: page %d has an empty page box", ErrMalformed, pageNr)
+		}
+		if rotation == 90 || rotation == 270 {
+			width, height = height, width
+		}
+
+		pages[pageNr-1] = Page{
+			Number:   pageNr,
+			Width:    width,
+			Height:   height,
+			Rotation: rotation,
+			MediaBox: [4]float64{media.LL.X, media.LL.Y, media.UR.X, media.UR.Y},
+		}
+	}
+
+	return pages, nil
+}
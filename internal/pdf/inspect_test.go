@@ -0,0 +1,73 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+func TestInspect(t *testing.T) {
+	letter := [4]float64{0, 0, 612, 792}
+	a4 := [4]float64{10, 20, 605, 862}
+
+	pages, err := Inspect(bytes.NewReader(testPDF(t, "", letter, a4)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Page{
+		{Number: 1, Width: 612, Height: 792, MediaBox: letter},
+		{Number: 2, Width: 595, Height: 842, MediaBox: a4},
+	}
+	if len(pages) != len(want) {
+		t.Fatalf("Inspect = %d pages, want %d", len(pages), len(want))
+	}
+	for i := range want {
+		if pages[i] != want[i] {
+			t.Errorf("page %d = %+v, want %+v", i+1, pages[i], want[i])
+		}
+	}
+
+	// Width and height are as displayed
+	pages, err = Inspect(bytes.NewReader(testPDF(t, "/Rotate -90", letter)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pages[0].Rotation != 270 || pages[0].Width != 792 || pages[0].Height != 612 {
+		t.Errorf("rotated page = %+v", pages[0])
+	}
+}
+
+func TestInspectRejectsInvalidFiles(t *testing.T) {
+	valid := testPDF(t, "", [4]float64{0, 0, 612, 792})
+
+	var encrypted bytes.Buffer
+	if err := api.Encrypt(bytes.NewReader(valid), &encrypted, model.NewAESConfiguration("user", "owner", 256)); err != nil {
+		t.Fatal(err)
+	}
+	var ownerOnly bytes.Buffer
+	if err := api.Encrypt(bytes.NewReader(valid), &ownerOnly, model.NewAESConfiguration("", "owner", 256)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, ErrNotPDF},
+		{"PNG renamed to .pdf", []byte("\x89PNG\r\n\x1a\n...."), ErrNotPDF},
+		{"user password", encrypted.Bytes(), ErrEncrypted},
+		{"owner password", ownerOnly.Bytes(), ErrEncrypted},
+		{"truncated", valid[:len(valid)/2], ErrMalformed},
+		{"header only", []byte("%PDF-1.7\n%%EOF\n"), ErrMalformed},
+		{"empty page box", testPDF(t, "", [4]float64{0, 0, 0, 792}), ErrMalformed},
+	}
+	for _, tt := range tests {
+		if _, err := Inspect(bytes.NewReader(tt.data)); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Inspect error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,413 @@
+package pdf
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hhrutter/pkcs7"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+const (
+	// signatureSize is the space reserved for the DER-encoded CMS signature
+	signatureSize = 16384
+	// byteRangePlaceholder is wide enough to hold any offset in a file below 10 GB
+	byteRangePlaceholder = 9999999999
+)
+
+// oidSigningCertificateV2 is the ESS signing-certificate-v2 attribute (RFC 5035)
+var oidSigningCertificateV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+
+// Signer applies a detached PKCS#7 signature to PDFs with a platform X.509 key
+type Signer struct {
+	certificate *x509.Certificate
+	chain       []*x509.Certificate
+	key         crypto.Signer
+}
+
+// SignatureInfo is the human-readable metadata stored in the PDF signature dictionary
+type SignatureInfo struct {
+	Name     string
+	Reason   string
+	Location string
+	SignedAt time.Time
+}
+
+// SignedPDF is a signed document together with the raw signature that was embedded in it
+type SignedPDF struct {
+	Data      []byte
+	Signature []byte // DER-encoded PKCS#7 SignedData
+}
+
+// NewSigner creates a signer from PEM data. certPEM holds the signing certificate followed
+// by any intermediate certificates; keyPEM holds an RSA or ECDSA private key.
+func NewSigner(certPEM, keyPEM []byte) (*Signer, error) {
+	var certificates []*x509.Certificate
+	for block, rest := pem.Decode(certPEM); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse signing certificate: %w", err)
+		}
+		certificates = append(certificates, certificate)
+	}
+	if len(certificates) == 0 {
+		return nil, fmt.Errorf("no certificate found in signing certificate PEM")
+	}
+
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("no private key found in signing key PEM")
+	}
+
+	key, err := parsePrivateKey(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if !publicKeysMatch(certificates[0].PublicKey, key.Public()) {
+		return nil, fmt.Errorf("signing key does not match signing certificate")
+	}
+
+	return &Signer{
+		certificate: certificates[0],
+		chain:       certificates[1:],
+		key:         key,
+	}, nil
+}
+
+// NewSignerFromEnv loads the platform signing key from SIGNING_CERT_FILE and SIGNING_KEY_FILE,
+// or from PEM data in SIGNING_CERT_PEM and SIGNING_KEY_PEM. It returns nil when no key is
+// configured, in which case completed documents are stored unsigned.
+func NewSignerFromEnv() (*Signer, error) {
+	certPEM, err := pemFromEnv("SIGNING_CERT_FILE", "SIGNING_CERT_PEM")
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := pemFromEnv("SIGNING_KEY_FILE", "SIGNING_KEY_PEM")
+	if err != nil {
+		return nil, err
+	}
+
+	if certPEM == nil && keyPEM == nil {
+		return nil, nil
+	}
+	if certPEM == nil || keyPEM == nil {
+		return nil, fmt.Errorf("both a signing certificate and a signing key must be configured")
+	}
+
+	return NewSigner(certPEM, keyPEM)
+}
+
+func pemFromEnv(fileVar, pemVar string) ([]byte, error) {
+	if path := os.Getenv(fileVar); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", fileVar, err)
+		}
+		return data, nil
+	}
+
+	if value := os.Getenv(pemVar); value != "" {
+		// Allow single-line values with escaped newlines, as most env files require
+		return []byte(strings.ReplaceAll(value, `\n`, "\n")), nil
+	}
+
+	return nil, nil
+}
+
+func parsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse signing key: %w", err)
+		}
+		switch k := key.(type) {
+		case *rsa.PrivateKey:
+			return k, nil
+		case *ecdsa.PrivateKey:
+			return k, nil
+		}
+		return nil, fmt.Errorf("signing key must be RSA or ECDSA")
+	default:
+		return nil, fmt.Errorf("unsupported signing key type %q", block.Type)
+	}
+}
+
+func publicKeysMatch(certificateKey, privateKey crypto.PublicKey) bool {
+	key, ok := certificateKey.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(privateKey)
+}
+
+// Algorithm names the signature algorithm in the form stored in digital_signatures
+func (s *Signer) Algorithm() string {
+	if _, ok := s.key.(*ecdsa.PrivateKey); ok {
+		return "ECDSA-SHA256"
+	}
+	return "RSA-SHA256"
+}
+
+// CertificatePEM returns the signing certificate and its chain as PEM
+func (s *Signer) CertificatePEM() string {
+	var b bytes.Buffer
+	for _, certificate := range append([]*x509.Certificate{s.certificate}, s.chain...) {
+		pem.Encode(&b, &pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw})
+	}
+	return b.String()
+}
+
+// SignPDF adds an invisible signature field to the document and signs every byte of the
+// file except the signature itself, producing an adbe.pkcs7.detached signature that
+// Acrobat and other PDF readers can validate.
+func (s *Signer) SignPDF(input []byte, info SignatureInfo) (*SignedPDF, error) {
+	prepared, err := prepareSignature(input, info)
+	if err != nil {
+		return nil, err
+	}
+
+	contentsPlaceholder := types.HexLiteral(strings.Repeat("0", 2*signatureSize)).PDFString()
+	contentsStart := bytes.Index(prepared, []byte(contentsPlaceholder))
+	if contentsStart < 0 {
+		return nil, fmt.Errorf("signature placeholder not found")
+	}
+	contentsEnd := contentsStart + len(contentsPlaceholder)
+
+	rangePlaceholder := placeholderByteRange().PDFString()
+	rangeStart := bytes.Index(prepared, []byte(rangePlaceholder))
+	if rangeStart < 0 {
+		return nil, fmt.Errorf("byte range placeholder not found")
+	}
+
+	// Fill in the byte range, padding with spaces so no offsets move
+	byteRange := fmt.Sprintf("[0 %d %d %d", contentsStart, contentsEnd, len(prepared)-contentsEnd)
+	byteRange += strings.Repeat(" ", len(rangePlaceholder)-len(byteRange)-1) + "]"
+	copy(prepared[rangeStart:], byteRange)
+
+	signedContent := make([]byte, 0, len(prepared)-(contentsEnd-contentsStart))
+	signedContent = append(signedContent, prepared[:contentsStart]...)
+	signedContent = append(signedContent, prepared[contentsEnd:]...)
+
+	signature, err := s.sign(signedContent)
+	if err != nil {
+		return nil, err
+	}
+	if len(signature) > signatureSize {
+		return nil, fmt.Errorf("signature is %d bytes but only %d are reserved", len(signature), signatureSize)
+	}
+
+	// The hex string sits between the angle brackets of the placeholder
+	copy(prepared[contentsStart+1:], strings.ToUpper(hex.EncodeToString(signature)))
+
+	return &SignedPDF{Data: prepared, Signature: signature}, nil
+}
+
+// sign produces a detached PKCS#7 SignedData over content
+func (s *Signer) sign(content []byte) ([]byte, error) {
+	signedData, err := pkcs7.NewSignedData(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create signed data: %w", err)
+	}
+	signedData.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+
+	// Bind the signature to this exact certificate (ESS signing-certificate-v2)
+	certificateHash := sha256.Sum256(s.certificate.Raw)
+	signingCertificate := struct {
+		Certs []struct{ CertHash []byte }
+	}{Certs: []struct{ CertHash []byte }{{CertHash: certificateHash[:]}}}
+
+	config := pkcs7.SignerInfoConfig{
+		ExtraSignedAttributes: []pkcs7.Attribute{{Type: oidSigningCertificateV2, Value: signingCertificate}},
+	}
+	if err := signedData.AddSignerChain(s.certificate, s.key, s.chain, config); err != nil {
+		return nil, fmt.Errorf("failed to sign document: %w", err)
+	}
+	signedData.Detach()
+
+	signature, err := signedData.Finish()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode signature: %w", err)
+	}
+	return signature, nil
+}
+
+func placeholderByteRange() types.Array {
+	return types.Array{
+		types.Integer(0),
+		types.Integer(byteRangePlaceholder),
+		types.Integer(byteRangePlaceholder),
+		types.Integer(byteRangePlaceholder),
+	}
+}
+
+// prepareSignature writes the document with an empty signature field whose /Contents and
+// /ByteRange are placeholders of a fixed width, ready to be patched in place
+func prepareSignature(input []byte, info SignatureInfo) ([]byte, error) {
+	conf := model.NewDefaultConfiguration()
+	// The placeholders must be written verbatim, not inside a compressed object stream
+	conf.WriteObjectStream = false
+	conf.WriteXRefStream = false
+
+	ctx, err := api.ReadContext(bytes.NewReader(input), conf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF: %w", err)
+	}
+
+	if err := ctx.EnsurePageCount(); err != nil {
+		return nil, fmt.Errorf("failed to count pages: %w", err)
+	}
+
+	rootDict, err := ctx.Catalog()
+	if err != nil {
+		return nil, err
+	}
+	if _, found := rootDict.Find("AcroForm"); found {
+		return nil, fmt.Errorf("document already contains a form")
+	}
+
+	pageDict, pageRef, _, err := ctx.PageDict(1, false)
+	if err != nil {
+		return nil, err
+	}
+
+	signatureDict := types.Dict(map[string]types.Object{
+		"Type":      types.Name("Sig"),
+		"Filter":    types.Name("Adobe.PPKLite"),
+		"SubFilter": types.Name("adbe.pkcs7.detached"),
+		"ByteRange": placeholderByteRange(),
+		"Contents":  types.HexLiteral(strings.Repeat("0", 2*signatureSize)),
+		"M":         types.StringLiteral(types.DateString(info.SignedAt)),
+	})
+	if info.Name != "" {
+		signatureDict["Name"] = types.StringLiteral(types.EncodeUTF16String(info.Name))
+	}
+	if info.Reason != "" {
+		signatureDict["Reason"] = types.StringLiteral(types.EncodeUTF16String(info.Reason))
+	}
+	if info.Location != "" {
+		signatureDict["Location"] = types.StringLiteral(types.EncodeUTF16String(info.Location))
+	}
+
+	signatureRef, err := ctx.IndRefForNewObject(signatureDict)
+	if err != nil {
+		return nil, err
+	}
+
+	// An invisible widget on the first page carries the signature field
+	widgetRef, err := ctx.IndRefForNewObject(types.Dict(map[string]types.Object{
+		"Type":    types.Name("Annot"),
+		"Subtype": types.Name("Widget"),
+		"FT":      types.Name("Sig"),
+		"T":       types.StringLiteral("FinalSign"),
+		"V":       *signatureRef,
+		"Rect":    types.Array{types.Integer(0), types.Integer(0), types.Integer(0), types.Integer(0)},
+		"F":       types.Integer(132), // Print | Locked
+		"P":       *pageRef,
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	annots := types.Array{}
+	if obj, found := pageDict.Find("Annots"); found {
+		existing, err := ctx.DereferenceArray(obj)
+		if err != nil {
+			return nil, err
+		}
+		annots = append(annots, existing...)
+	}
+	pageDict.Update("Annots", append(annots, *widgetRef))
+
+	rootDict.Insert("AcroForm", types.Dict(map[string]types.Object{
+		"Fields":   types.Array{*widgetRef},
+		"SigFlags": types.Integer(3), // SignaturesExist | AppendOnly
+	}))
+
+	var out bytes.Buffer
+	if err := api.WriteContext(ctx, &out); err != nil {
+		return nil, fmt.Errorf("failed to write PDF: %w", err)
+	}
+
+	return out.Bytes(), nil
+}
+
+// VerifySignature checks the PKCS#7 signature embedded in a signed PDF against roots and
+// returns the signing certificate. It only accepts a signature that covers the whole file.
+func VerifySignature(data []byte, roots *x509.CertPool) (*x509.Certificate, error) {
+	signature, signedContent, err := extractSignature(data)
+	if err != nil {
+		return nil, err
+	}
+
+	p7, err := pkcs7.Parse(signature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signature: %w", err)
+	}
+	p7.Content = signedContent
+
+	if err := p7.VerifyWithChain(roots); err != nil {
+		return nil, fmt.Errorf("signature is not valid: %w", err)
+	}
+
+	return p7.GetOnlySigner(), nil
+}
+
+// extractSignature locates the last /ByteRange in the file and returns the DER signature and
+// the bytes it covers
+func extractSignature(data []byte) ([]byte, []byte, error) {
+	index := bytes.LastIndex(data, []byte("/ByteRange"))
+	if index < 0 {
+		return nil, nil, fmt.Errorf("document is not signed")
+	}
+
+	var start1, length1, start2, length2 int
+	rest := strings.TrimLeft(string(data[index+len("/ByteRange"):min(len(data), index+128)]), " \r\n\t")
+	if _, err := fmt.Sscanf(rest, "[%d %d %d %d", &start1, &length1, &start2, &length2); err != nil {
+		return nil, nil, fmt.Errorf("invalid signature byte range")
+	}
+
+	if start1 != 0 || length1 <= 0 || start2 <= length1 || length2 < 0 || start2+length2 != len(data) {
+		return nil, nil, fmt.Errorf("signature does not cover the whole document")
+	}
+
+	contents := strings.TrimSpace(string(data[length1:start2]))
+	if !strings.HasPrefix(contents, "<") || !strings.HasSuffix(contents, ">") {
+		return nil, nil, fmt.Errorf("invalid signature contents")
+	}
+
+	padded, err := hex.DecodeString(contents[1 : len(contents)-1])
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid signature contents: %w", err)
+	}
+
+	// Drop the zero padding after the DER structure
+	var raw asn1.RawValue
+	if _, err := asn1.Unmarshal(padded, &raw); err != nil {
+		return nil, nil, fmt.Errorf("invalid signature contents: %w", err)
+	}
+
+	signedContent := make([]byte, 0, length1+length2)
+	signedContent = append(signedContent, data[:length1]...)
+	signedContent = append(signedContent, data[start2:]...)
+
+	return raw.FullBytes, signedContent, nil
+}
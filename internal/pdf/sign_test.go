@@ -0,0 +1,245 @@
+package pdf
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+type testCA struct {
+	certificate *x509.Certificate
+	key         *rsa.PrivateKey
+	pool        *x509.CertPool
+}
+
+// newTestCA generates a self-signed root certificate
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate CA key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "FinalSign Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create CA certificate: %v", err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse CA certificate: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(certificate)
+
+	return &testCA{certificate: certificate, key: key, pool: pool}
+}
+
+// issue creates a document signing certificate for key and returns the certificate chain and key as PEM
+func (ca *testCA) issue(t *testing.T, key crypto.Signer, keyDER []byte, keyType string) ([]byte, []byte) {
+	t.Helper()
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "FinalSign Document Signing", Organization: []string{"FinalSign"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.certificate, key.Public(), ca.key)
+	if err != nil {
+		t.Fatalf("failed to issue certificate: %v", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.certificate.Raw})...)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: keyType, Bytes: keyDER})
+
+	return certPEM, keyPEM
+}
+
+func newTestSigner(t *testing.T, ca *testCA) *Signer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	certPEM, keyPEM := ca.issue(t, key, x509.MarshalPKCS1PrivateKey(key), "RSA PRIVATE KEY")
+
+	signer, err := NewSigner(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("NewSigner() error = %v", err)
+	}
+	return signer
+}
+
+func TestSignPDF(t *testing.T) {
+	ca := newTestCA(t)
+	signer := newTestSigner(t, ca)
+
+	input := testPDF(t, "", [4]float64{0, 0, 600, 800})
+	signed, err := signer.SignPDF(input, SignatureInfo{
+		Name:     "FinalSign",
+		Reason:   "Completed by all signers",
+		SignedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("SignPDF() error = %v", err)
+	}
+
+	for _, want := range []string{"/SubFilter/adbe.pkcs7.detached", "/FT/Sig", "/SigFlags 3"} {
+		if !bytes.Contains(signed.Data, []byte(want)) {
+			t.Errorf("signed PDF missing %q", want)
+		}
+	}
+
+	certificate, err := VerifySignature(signed.Data, ca.pool)
+	if err != nil {
+		t.Fatalf("VerifySignature() error = %v", err)
+	}
+	if certificate.Subject.CommonName != "FinalSign Document Signing" {
+		t.Errorf("signing certificate = %q", certificate.Subject.CommonName)
+	}
+
+	// The signed file must still be a readable PDF
+	ctx, err := api.ReadContext(bytes.NewReader(signed.Data), model.NewDefaultConfiguration())
+	if err != nil {
+		t.Fatalf("failed to read signed PDF: %v", err)
+	}
+	if err := api.ValidateContext(ctx); err != nil {
+		t.Fatalf("signed PDF is invalid: %v", err)
+	}
+
+	if signer.Algorithm() != "RSA-SHA256" {
+		t.Errorf("Algorithm() = %q", signer.Algorithm())
+	}
+	if strings.Count(signer.CertificatePEM(), "BEGIN CERTIFICATE") != 2 {
+		t.Errorf("CertificatePEM() should include the chain")
+	}
+}
+
+func TestVerifySignatureDetectsTampering(t *testing.T) {
+	ca := newTestCA(t)
+	signer := newTestSigner(t, ca)
+
+	signed, err := signer.SignPDF(testPDF(t, "", [4]float64{0, 0, 600, 800}), SignatureInfo{SignedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("SignPDF() error = %v", err)
+	}
+
+	tampered := bytes.Replace(signed.Data, []byte("/MediaBox[0 0 600 800]"), []byte("/MediaBox[0 0 600 900]"), 1)
+	if bytes.Equal(tampered, signed.Data) {
+		t.Fatal("test did not modify the document")
+	}
+	if _, err := VerifySignature(tampered, ca.pool); err == nil {
+		t.Error("expected tampered document to fail verification")
+	}
+
+	if _, err := VerifySignature(signed.Data, x509.NewCertPool()); err == nil {
+		t.Error("expected verification against an unrelated root to fail")
+	}
+
+	if _, err := VerifySignature(testPDF(t, "", [4]float64{0, 0, 600, 800}), ca.pool); err == nil {
+		t.Error("expected unsigned document to fail verification")
+	}
+}
+
+func TestNewSignerECDSA(t *testing.T) {
+	ca := newTestCA(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	certPEM, keyPEM := ca.issue(t, key, keyDER, "PRIVATE KEY")
+
+	signer, err := NewSigner(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("NewSigner() error = %v", err)
+	}
+	if signer.Algorithm() != "ECDSA-SHA256" {
+		t.Errorf("Algorithm() = %q", signer.Algorithm())
+	}
+
+	signed, err := signer.SignPDF(testPDF(t, "", [4]float64{0, 0, 600, 800}), SignatureInfo{SignedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("SignPDF() error = %v", err)
+	}
+	if _, err := VerifySignature(signed.Data, ca.pool); err != nil {
+		t.Errorf("VerifySignature() error = %v", err)
+	}
+}
+
+func TestNewSignerRejectsMismatchedKey(t *testing.T) {
+	ca := newTestCA(t)
+
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	certPEM, _ := ca.issue(t, key, x509.MarshalPKCS1PrivateKey(key), "RSA PRIVATE KEY")
+	otherPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(other)})
+
+	if _, err := NewSigner(certPEM, otherPEM); err == nil {
+		t.Error("expected an error for a key that does not match the certificate")
+	}
+}
+
+func TestNewSignerFromEnv(t *testing.T) {
+	t.Setenv("SIGNING_CERT_FILE", "")
+	t.Setenv("SIGNING_KEY_FILE", "")
+	t.Setenv("SIGNING_CERT_PEM", "")
+	t.Setenv("SIGNING_KEY_PEM", "")
+
+	signer, err := NewSignerFromEnv()
+	if err != nil || signer != nil {
+		t.Fatalf("NewSignerFromEnv() = %v, %v; want nil, nil when unconfigured", signer, err)
+	}
+
+	ca := newTestCA(t)
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	certPEM, keyPEM := ca.issue(t, key, x509.MarshalPKCS1PrivateKey(key), "RSA PRIVATE KEY")
+
+	// Inline PEM with escaped newlines, as it would appear in an env file
+	t.Setenv("SIGNING_CERT_PEM", strings.ReplaceAll(string(certPEM), "\n", `\n`))
+	t.Setenv("SIGNING_KEY_PEM", strings.ReplaceAll(string(keyPEM), "\n", `\n`))
+
+	signer, err = NewSignerFromEnv()
+	if err != nil || signer == nil {
+		t.Fatalf("NewSignerFromEnv() = %v, %v", signer, err)
+	}
+
+	t.Setenv("SIGNING_KEY_PEM", "")
+	if _, err := NewSignerFromEnv(); err == nil {
+		t.Error("expected an error when only the certificate is configured")
+	}
+}
@@ -0,0 +1,444 @@
+// Package pdf renders submitted field values onto template PDFs.
+package pdf
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/font"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+const (
+	stampFont        = "Helvetica"
+	stampFontID      = "FinalSignHelv"
+	stampImagePrefix = "FinalSignImg"
+	maxFontSize      = 14.0
+	minFontSize      = 4.0
+	textPadding      = 2.0
+)
+
+func init() {
+	// Only the core fonts are needed, so never touch the user's config directory
+	api.DisableConfigDir()
+}
+
+// Position is a field's placement as stored in template_fields.position_data.
+// X, Y, Width and Height are fractions of the displayed page with the origin at the
+// top-left corner, as drawn in the template editor. Page is 1-based.
+type Position struct {
+	Page   int     `json:"page"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// ParsePosition decodes a position_data JSON document
+func ParsePosition(positionData string) (Position, error) {
+	var position Position
+	if err := json.Unmarshal([]byte(positionData), &position); err != nil {
+		return Position{}, fmt.Errorf("invalid position data: %w", err)
+	}
+
+	if position.Page < 1 {
+		return Position{}, fmt.Errorf("invalid position data: page must be at least 1")
+	}
+	if position.Width <= 0 || position.Height <= 0 {
+		return Position{}, fmt.Errorf("invalid position data: width and height must be positive")
+	}
+
+	return position, nil
+}
+
+// Stamp is one field value to draw onto the document
+type Stamp struct {
+	Position
+	FieldType string // text, email, phone, date, checkbox or signature
+	Value     string // plain text, "true"/"false" for checkboxes, or a data URL for signatures
+}
+
+// StampFields draws every stamp onto a copy of the input PDF and returns the flattened result.
+// Interactive form fields are removed so the output cannot be edited in a viewer.
+func StampFields(input []byte, stamps []Stamp) ([]byte, error) {
+	ctx, err := api.ReadContext(bytes.NewReader(input), model.NewDefaultConfiguration())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF: %w", err)
+	}
+
+	if err := ctx.EnsurePageCount(); err != nil {
+		return nil, fmt.Errorf("failed to count pages: %w", err)
+	}
+
+	stampsByPage := make(map[int][]Stamp)
+	for _, stamp := range stamps {
+		if stamp.Page > ctx.PageCount {
+			return nil, fmt.Errorf("field is on page %d but the document has %d pages", stamp.Page, ctx.PageCount)
+		}
+		stampsByPage[stamp.Page] = append(stampsByPage[stamp.Page], stamp)
+	}
+
+	var fontRef *types.IndirectRef
+	for pageNr := 1; pageNr <= ctx.PageCount; pageNr++ {
+		pageStamps := stampsByPage[pageNr]
+		if len(pageStamps) == 0 {
+			continue
+		}
+
+		if fontRef == nil {
+			fontRef, err = ctx.IndRefForNewObject(types.Dict(map[string]types.Object{
+				"Type":     types.Name("Font"),
+				"Subtype":  types.Name("Type1"),
+				"BaseFont": types.Name(stampFont),
+				"Encoding": types.Name("WinAnsiEncoding"),
+			}))
+			if err != nil {
+				return nil, fmt.Errorf("failed to create font: %w", err)
+			}
+		}
+
+		if err := stampPage(ctx, pageNr, pageStamps, *fontRef); err != nil {
+			return nil, fmt.Errorf("failed to stamp page %d: %w", pageNr, err)
+		}
+	}
+
+	if err := flatten(ctx); err != nil {
+		return nil, fmt.Errorf("failed to flatten form fields: %w", err)
+	}
+
+	var out bytes.Buffer
+	if err := api.WriteContext(ctx, &out); err != nil {
+		return nil, fmt.Errorf("failed to write PDF: %w", err)
+	}
+
+	return out.Bytes(), nil
+}
+
+// stampPage appends an overlay content stream to a single page
+func stampPage(ctx *model.Context, pageNr int, stamps []Stamp, fontRef types.IndirectRef) error {
+	pageDict, _, inherited, err := ctx.PageDict(pageNr, false)
+	if err != nil {
+		return err
+	}
+
+	resources := inherited.Resources
+	if resources == nil {
+		resources = types.NewDict()
+	}
+
+	fonts, err := subDict(ctx, resources, "Font")
+	if err != nil {
+		return err
+	}
+	fonts.Update(stampFontID, fontRef)
+
+	box := inherited.CropBox
+	if box == nil {
+		box = inherited.MediaBox
+	}
+	if box == nil {
+		return fmt.Errorf("page has no media box")
+	}
+
+	rotation := ((inherited.Rotate % 360) + 360) % 360
+	width, height := box.Width(), box.Height()
+	if rotation == 90 || rotation == 270 {
+		width, height = height, width
+	}
+
+	var content bytes.Buffer
+	content.WriteString("Q\nq\n")
+	content.WriteString(displayMatrix(box, rotation))
+
+	for i, stamp := range stamps {
+		// Convert the top-left fractional box to bottom-left user space
+		x := stamp.X * width
+		w := stamp.Width * width
+		h := stamp.Height * height
+		y := height - stamp.Y*height - h
+
+		fmt.Fprintf(&content, "q %s %s %s %s re W n\n", num(x), num(y), num(w), num(h))
+
+		switch stamp.FieldType {
+		case "checkbox":
+			if stamp.Value == "true" {
+				writeCheckmark(&content, x, y, w, h)
+			}
+		case "signature":
+			imageData, err := decodeDataURL(stamp.Value)
+			if err != nil {
+				return err
+			}
+
+			imageRef, imageWidth, imageHeight, err := model.CreateImageResource(ctx.XRefTable, bytes.NewReader(imageData))
+			if err != nil {
+				return fmt.Errorf("failed to embed signature image: %w", err)
+			}
+
+			xObjects, err := subDict(ctx, resources, "XObject")
+			if err != nil {
+				return err
+			}
+			// Pages can share a resource dictionary, so the name must be unique to this page
+			imageID := fmt.Sprintf("%s%d_%d", stampImagePrefix, pageNr, i)
+			xObjects.Update(imageID, *imageRef)
+
+			writeImage(&content, imageID, x, y, w, h, float64(imageWidth), float64(imageHeight))
+		default:
+			writeText(&content, stamp.Value, x, y, w, h)
+		}
+
+		content.WriteString("Q\n")
+	}
+
+	content.WriteString("Q\n")
+
+	pageDict.Update("Resources", resources)
+
+	return wrapPageContents(ctx, pageDict, content.Bytes())
+}
+
+// displayMatrix maps the page as displayed (after /Rotate) onto PDF user space
+func displayMatrix(box *types.Rectangle, rotation int) string {
+	llx, lly := box.LL.X, box.LL.Y
+	switch rotation {
+	case 90:
+		return fmt.Sprintf("0 1 -1 0 %s %s cm\n", num(llx+box.Width()), num(lly))
+	case 180:
+		return fmt.Sprintf("-1 0 0 -1 %s %s cm\n", num(llx+box.Width()), num(lly+box.Height()))
+	case 270:
+		return fmt.Sprintf("0 -1 1 0 %s %s cm\n", num(llx), num(lly+box.Height()))
+	default:
+		return fmt.Sprintf("1 0 0 1 %s %s cm\n", num(llx), num(lly))
+	}
+}
+
+// writeText draws a single line of text, shrinking the font until it fits the box
+func writeText(content *bytes.Buffer, value string, x, y, w, h float64) {
+	if value == "" {
+		return
+	}
+
+	encoded := encodeWinAnsi(strings.Join(strings.Fields(value), " "))
+
+	// Width of the text at a 1pt font size
+	unitWidth := font.TextWidth(encoded, stampFont, 1000) / 1000
+
+	size := math.Min(h*0.7, maxFontSize)
+	if available := w - 2*textPadding; unitWidth > 0 && unitWidth*size > available {
+		size = available / unitWidth
+	}
+	size = math.Max(size, minFontSize)
+
+	// Centre the cap height of the text vertically in the box
+	baseline := y + (h-size*0.718)/2
+
+	fmt.Fprintf(content, "BT /%s %s Tf 0 g %s %s Td (%s) Tj ET\n",
+		stampFontID, num(size), num(x+textPadding), num(baseline), escapeString(encoded))
+}
+
+// writeCheckmark strokes a tick centred in the box
+func writeCheckmark(content *bytes.Buffer, x, y, w, h float64) {
+	side := math.Min(w, h) * 0.8
+	left := x + (w-side)/2
+	bottom := y + (h-side)/2
+
+	fmt.Fprintf(content, "0 G %s w 1 J 1 j %s %s m %s %s l %s %s l S\n",
+		num(side*0.1),
+		num(left+side*0.15), num(bottom+side*0.5),
+		num(left+side*0.4), num(bottom+side*0.2),
+		num(left+side*0.85), num(bottom+side*0.8))
+}
+
+// writeImage draws an image XObject scaled to fit the box while keeping its aspect ratio
+func writeImage(content *bytes.Buffer, imageID string, x, y, w, h, imageWidth, imageHeight float64) {
+	scale := math.Min(w/imageWidth, h/imageHeight)
+	drawWidth := imageWidth * scale
+	drawHeight := imageHeight * scale
+
+	fmt.Fprintf(content, "q %s 0 0 %s %s %s cm /%s Do Q\n",
+		num(drawWidth), num(drawHeight),
+		num(x+(w-drawWidth)/2), num(y+(h-drawHeight)/2), imageID)
+}
+
+// wrapPageContents isolates the existing page content in its own graphics state and
+// appends the overlay, so whatever state the original content leaves behind cannot
+// shift or recolour the stamped values.
+func wrapPageContents(ctx *model.Context, pageDict types.Dict, overlay []byte) error {
+	var existing types.Array
+
+	if obj, found := pageDict.Find("Contents"); found {
+		switch contents := obj.(type) {
+		case types.IndirectRef:
+			resolved, err := ctx.Dereference(contents)
+			if err != nil {
+				return err
+			}
+			if array, ok := resolved.(types.Array); ok {
+				existing = array
+			} else {
+				existing = types.Array{contents}
+			}
+		case types.Array:
+			existing = contents
+		default:
+			return fmt.Errorf("page has unsupported content")
+		}
+	}
+
+	prefix, err := newContentStream(ctx, []byte("q\n"))
+	if err != nil {
+		return err
+	}
+	suffix, err := newContentStream(ctx, overlay)
+	if err != nil {
+		return err
+	}
+
+	contents := types.Array{*prefix}
+	contents = append(contents, existing...)
+	contents = append(contents, *suffix)
+	pageDict.Update("Contents", contents)
+
+	return nil
+}
+
+func newContentStream(ctx *model.Context, content []byte) (*types.IndirectRef, error) {
+	sd, err := ctx.NewStreamDictForBuf(content)
+	if err != nil {
+		return nil, err
+	}
+	if err := sd.Encode(); err != nil {
+		return nil, err
+	}
+	return ctx.IndRefForNewObject(*sd)
+}
+
+// subDict returns the named resource sub-dictionary, creating it if necessary
+func subDict(ctx *model.Context, resources types.Dict, name string) (types.Dict, error) {
+	obj, found := resources.Find(name)
+	if !found {
+		d := types.NewDict()
+		resources.Insert(name, d)
+		return d, nil
+	}
+
+	d, err := ctx.DereferenceDict(obj)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		d = types.NewDict()
+		resources.Update(name, d)
+	}
+	return d, nil
+}
+
+// flatten removes the interactive form and its widget annotations. Stamped values are
+// part of the page content, so leaving the fields behind would let a viewer paint
+// editable boxes over them.
+func flatten(ctx *model.Context) error {
+	rootDict, err := ctx.Catalog()
+	if err != nil {
+		return err
+	}
+	rootDict.Delete("AcroForm")
+
+	for pageNr := 1; pageNr <= ctx.PageCount; pageNr++ {
+		pageDict, _, _, err := ctx.PageDict(pageNr, false)
+		if err != nil {
+			return err
+		}
+
+		obj, found := pageDict.Find("Annots")
+		if !found {
+			continue
+		}
+
+		annots, err := ctx.DereferenceArray(obj)
+		if err != nil {
+			return err
+		}
+
+		var kept types.Array
+		for _, annot := range annots {
+			d, err := ctx.DereferenceDict(annot)
+			if err != nil {
+				return err
+			}
+			if d != nil && d.Subtype() != nil && *d.Subtype() == "Widget" {
+				continue
+			}
+			kept = append(kept, annot)
+		}
+
+		if len(kept) == 0 {
+			pageDict.Delete("Annots")
+		} else {
+			pageDict.Update("Annots", kept)
+		}
+	}
+
+	return nil
+}
+
+// decodeDataURL extracts the image bytes from a PNG or JPEG data URL
+func decodeDataURL(value string) ([]byte, error) {
+	comma := strings.Index(value, ",")
+	if !strings.HasPrefix(value, "data:image/") || comma < 0 || !strings.HasSuffix(value[:comma], ";base64") {
+		return nil, fmt.Errorf("signature is not an image data URL")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(value[comma+1:])
+	if err != nil {
+		return nil, fmt.Errorf("signature image is not valid base64: %w", err)
+	}
+	return data, nil
+}
+
+// encodeWinAnsi converts text to the single-byte encoding used by the core fonts.
+// Characters the encoding cannot represent are replaced.
+func encodeWinAnsi(value string) string {
+	encoder := encoding.ReplaceUnsupported(charmap.Windows1252.NewEncoder())
+	encoded, err := encoder.String(value)
+	if err != nil {
+		return strings.Map(func(r rune) rune {
+			if r > 0x7e {
+				return '?'
+			}
+			return r
+		}, value)
+	}
+	return encoded
+}
+
+// escapeString escapes a byte string for use inside a PDF literal string
+func escapeString(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '\\' || c == '(' || c == ')':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c > 0x7e:
+			fmt.Fprintf(&b, "\\%03o", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// num formats a coordinate with fixed precision so output is reproducible
+func num(value float64) string {
+	return fmt.Sprintf("%.2f", value)
+}
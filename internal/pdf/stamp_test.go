@@ -0,0 +1,271 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// testPDF builds a minimal PDF with one blank page per media box. The extra page
+// dictionary entries (e.g. "/Rotate 90") are applied to every page.
+func testPDF(t *testing.T, pageEntries string, mediaBoxes ...[4]float64) []byte {
+	t.Helper()
+
+	var objects []string
+	kids := make([]string, len(mediaBoxes))
+	for i, box := range mediaBoxes {
+		pageObj := 3 + 2*i
+		kids[i] = fmt.Sprintf("%d 0 R", pageObj)
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [%g %g %g %g] /Contents %d 0 R /Resources << >> %s >>",
+				box[0], box[1], box[2], box[3], pageObj+1, pageEntries),
+			"<< /Length 0 >>\nstream\n\nendstream")
+	}
+	objects = append([]string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(mediaBoxes)),
+	}, objects...)
+
+	return writePDF(objects)
+}
+
+// writePDF numbers the objects from 1 and adds the cross-reference table. The first object
+// must be the catalog.
+func writePDF(objects []string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	return buf.Bytes()
+}
+
+func pageContent(t *testing.T, data []byte, pageNr int) string {
+	t.Helper()
+
+	ctx, err := api.ReadContext(bytes.NewReader(data), model.NewDefaultConfiguration())
+	if err != nil {
+		t.Fatalf("failed to read stamped PDF: %v", err)
+	}
+	if err := api.ValidateContext(ctx); err != nil {
+		t.Fatalf("stamped PDF is invalid: %v", err)
+	}
+
+	r, err := pdfcpu.ExtractPageContent(ctx, pageNr)
+	if err != nil {
+		t.Fatalf("failed to extract page %d: %v", pageNr, err)
+	}
+	content, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("failed to read page %d content: %v", pageNr, err)
+	}
+	return string(content)
+}
+
+func TestStampFieldsText(t *testing.T) {
+	input := testPDF(t, "", [4]float64{0, 0, 600, 800}, [4]float64{0, 0, 600, 800})
+
+	out, err := StampFields(input, []Stamp{
+		{Position: Position{Page: 1, X: 0.1, Y: 0.1, Width: 0.5, Height: 0.025}, FieldType: "text", Value: "Jane (Doe)"},
+		{Position: Position{Page: 2, X: 0.5, Y: 0.5, Width: 0.2, Height: 0.025}, FieldType: "date", Value: "2024-05-01"},
+	})
+	if err != nil {
+		t.Fatalf("StampFields() error = %v", err)
+	}
+
+	page1 := pageContent(t, out, 1)
+	// Box is 300x20 at (60, 800-80-20)
+	for _, want := range []string{"q 60.00 700.00 300.00 20.00 re W n", "(Jane \\(Doe\\)) Tj", "/FinalSignHelv 14.00 Tf"} {
+		if !strings.Contains(page1, want) {
+			t.Errorf("page 1 content missing %q:\n%s", want, page1)
+		}
+	}
+	if strings.Contains(page1, "2024-05-01") {
+		t.Errorf("page 1 should not contain the page 2 value")
+	}
+
+	page2 := pageContent(t, out, 2)
+	if !strings.Contains(page2, "(2024-05-01) Tj") {
+		t.Errorf("page 2 content missing date:\n%s", page2)
+	}
+
+	// Output must be reproducible for the same input
+	again, err := StampFields(input, []Stamp{
+		{Position: Position{Page: 1, X: 0.1, Y: 0.1, Width: 0.5, Height: 0.025}, FieldType: "text", Value: "Jane (Doe)"},
+		{Position: Position{Page: 2, X: 0.5, Y: 0.5, Width: 0.2, Height: 0.025}, FieldType: "date", Value: "2024-05-01"},
+	})
+	if err != nil {
+		t.Fatalf("StampFields() error = %v", err)
+	}
+	if pageContent(t, again, 1) != page1 {
+		t.Errorf("stamped content is not deterministic")
+	}
+}
+
+func TestStampFieldsShrinksLongText(t *testing.T) {
+	input := testPDF(t, "", [4]float64{0, 0, 600, 800})
+
+	out, err := StampFields(input, []Stamp{
+		{Position: Position{Page: 1, X: 0, Y: 0, Width: 0.1, Height: 0.05}, FieldType: "text", Value: "A rather long company name"},
+	})
+	if err != nil {
+		t.Fatalf("StampFields() error = %v", err)
+	}
+
+	content := pageContent(t, out, 1)
+	if strings.Contains(content, "14.00 Tf") {
+		t.Errorf("expected font to shrink to fit a 60pt box:\n%s", content)
+	}
+}
+
+func TestStampFieldsCheckboxAndSignature(t *testing.T) {
+	input := testPDF(t, "", [4]float64{0, 0, 600, 800})
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 40, 10))); err != nil {
+		t.Fatalf("failed to encode test image: %v", err)
+	}
+	signature := "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	out, err := StampFields(input, []Stamp{
+		{Position: Position{Page: 1, X: 0.1, Y: 0.1, Width: 0.05, Height: 0.05}, FieldType: "checkbox", Value: "true"},
+		{Position: Position{Page: 1, X: 0.2, Y: 0.2, Width: 0.05, Height: 0.05}, FieldType: "checkbox", Value: "false"},
+		{Position: Position{Page: 1, X: 0.5, Y: 0.5, Width: 0.2, Height: 0.05}, FieldType: "signature", Value: signature},
+	})
+	if err != nil {
+		t.Fatalf("StampFields() error = %v", err)
+	}
+
+	content := pageContent(t, out, 1)
+	if strings.Count(content, " S\n") != 1 {
+		t.Errorf("expected exactly one checkmark stroke:\n%s", content)
+	}
+	// 120x40 box holds a 4:1 image as 120x30, centred vertically
+	if !strings.Contains(content, "q 120.00 0 0 30.00 300.00 365.00 cm /FinalSignImg1_2 Do Q") {
+		t.Errorf("signature image not drawn as expected:\n%s", content)
+	}
+}
+
+func TestStampFieldsSharedResources(t *testing.T) {
+	// Both pages use the same indirect resource dictionary
+	input := writePDF([]string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 600 800] /Contents 5 0 R /Resources 6 0 R >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 600 800] /Contents 5 0 R /Resources 6 0 R >>",
+		"<< /Length 0 >>\nstream\n\nendstream",
+		"<< >>",
+	})
+
+	signature := func(width, height int) string {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, width, height))); err != nil {
+			t.Fatalf("failed to encode test image: %v", err)
+		}
+		return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+	}
+	box := Position{X: 0.5, Y: 0.5, Width: 0.2, Height: 0.05}
+	page1, page2 := box, box
+	page1.Page, page2.Page = 1, 2
+
+	out, err := StampFields(input, []Stamp{
+		{Position: page1, FieldType: "signature", Value: signature(40, 10)},
+		{Position: page2, FieldType: "signature", Value: signature(10, 40)},
+	})
+	if err != nil {
+		t.Fatalf("StampFields() error = %v", err)
+	}
+
+	ctx, err := api.ReadContext(bytes.NewReader(out), model.NewDefaultConfiguration())
+	if err != nil {
+		t.Fatalf("failed to read stamped PDF: %v", err)
+	}
+	if err := ctx.EnsurePageCount(); err != nil {
+		t.Fatal(err)
+	}
+	for pageNr, wantWidth := range map[int]int{1: 40, 2: 10} {
+		imageID := fmt.Sprintf("FinalSignImg%d_0", pageNr)
+		if content := pageContent(t, out, pageNr); !strings.Contains(content, "/"+imageID+" Do") {
+			t.Fatalf("page %d does not draw %s:\n%s", pageNr, imageID, content)
+		}
+
+		_, _, inherited, err := ctx.PageDict(pageNr, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		xObjects, err := ctx.DereferenceDict(inherited.Resources["XObject"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		imageDict, _, err := ctx.DereferenceStreamDict(xObjects[imageID])
+		if err != nil || imageDict == nil {
+			t.Fatalf("page %d image %s: %v", pageNr, imageID, err)
+		}
+		if width := imageDict.IntEntry("Width"); width == nil || *width != wantWidth {
+			t.Errorf("page %d draws an image %v wide, want %d", pageNr, width, wantWidth)
+		}
+	}
+}
+
+func TestStampFieldsRotatedPage(t *testing.T) {
+	input := testPDF(t, "/Rotate 90", [4]float64{0, 0, 600, 800})
+
+	out, err := StampFields(input, []Stamp{
+		{Position: Position{Page: 1, X: 0, Y: 0, Width: 0.5, Height: 0.1}, FieldType: "text", Value: "Rotated"},
+	})
+	if err != nil {
+		t.Fatalf("StampFields() error = %v", err)
+	}
+
+	content := pageContent(t, out, 1)
+	// Displayed page is 800x600, so the top-left box starts at y = 600 - 60
+	for _, want := range []string{"0 1 -1 0 600.00 0.00 cm", "q 0.00 540.00 400.00 60.00 re W n"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("rotated page content missing %q:\n%s", want, content)
+		}
+	}
+}
+
+func TestStampFieldsRejectsMissingPage(t *testing.T) {
+	input := testPDF(t, "", [4]float64{0, 0, 600, 800})
+
+	_, err := StampFields(input, []Stamp{
+		{Position: Position{Page: 2, X: 0, Y: 0, Width: 0.1, Height: 0.1}, FieldType: "text", Value: "x"},
+	})
+	if err == nil {
+		t.Fatal("expected an error for a field on a missing page")
+	}
+}
+
+func TestParsePosition(t *testing.T) {
+	position, err := ParsePosition(`{"x": 0.1, "y": 0.2, "width": 0.3, "height": 0.05, "page": 2}`)
+	if err != nil {
+		t.Fatalf("ParsePosition() error = %v", err)
+	}
+	if position.Page != 2 || position.X != 0.1 || position.Height != 0.05 {
+		t.Errorf("ParsePosition() = %+v", position)
+	}
+
+	if _, err := ParsePosition(`{"x": 0.1, "y": 0.2, "width": 0.3, "height": 0.05, "page": 0}`); err == nil {
+		t.Error("expected an error for page 0")
+	}
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"finalsign/internal/database"
+)
+
+// defaultAllowedOrigins may call every route, with credentials. Override with a comma-separated
+// CORS_ALLOWED_ORIGINS.
+var defaultAllowedOrigins = []string{"http://localhost:3000", "https://finalsign.io", "https://www.finalsign.io"}
+
+// embedOriginRefresh is how long workspace embed origin changes take to reach CORS
+const embedOriginRefresh = time.Minute
+
+func allowedOrigins() []string {
+	value := os.Getenv("CORS_ALLOWED_ORIGINS")
+	if value == "" {
+		return defaultAllowedOrigins
+	}
+
+	var origins []string
+	for _, origin := range strings.Split(value, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// isEmbedPath reports whether a route is part of the signing experience, which workspaces may
+// embed in their own applications
+func isEmbedPath(path string) bool {
+	return strings.HasPrefix(path, "/sign/") || strings.HasPrefix(path, "/embed/")
+}
+
+// embedOriginCache holds the origins workspaces allow to embed signing sessions. It is reloaded
+// at most once per embedOriginRefresh so CORS preflights don't each hit the database.
+type embedOriginCache struct {
+	db       database.Service
+	mu       sync.Mutex
+	origins  map[string]bool
+	loadedAt time.Time
+}
+
+func newEmbedOriginCache(db database.Service) *embedOriginCache {
+	return &embedOriginCache{db: db}
+}
+
+func (c *embedOriginCache) allows(origin string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.loadedAt) > embedOriginRefresh {
+		origins, err := c.db.ListEmbedOrigins()
+		if err != nil {
+			// Keep serving the last known origins rather than failing every embedded request
+			log.Printf("Failed to load embed origins: %v", err)
+		} else {
+			c.origins = make(map[string]bool, len(origins))
+			for _, allowed := range origins {
+				c.origins[allowed] = true
+			}
+		}
+		c.loadedAt = time.Now()
+	}
+
+	return c.origins[strings.ToLower(origin)]
+}
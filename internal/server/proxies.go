@@ -0,0 +1,20 @@
+package server
+
+import (
+	"os"
+	"strings"
+)
+
+// trustedProxies are the reverse proxies whose X-Forwarded-For and X-Real-IP headers are believed
+// when working out a client's IP address, set as a comma-separated TRUSTED_PROXIES of IPs or
+// CIDRs. Client IPs are rate limited and written to the audit log, so by default no proxy is
+// trusted and a client cannot choose its own address.
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"finalsign/internal/database"
+)
+
+// verifyDB answers every verification with no matching document
+type verifyDB struct {
+	database.Service
+	clientIPs []string
+}
+
+func (db *verifyDB) VerifyDocumentHash(hash, ipAddress, userAgent string) (*database.DocumentVerification, error) {
+	db.clientIPs = append(db.clientIPs, ipAddress)
+	return nil, fmt.Errorf("document not found")
+}
+
+func verifyRequest(handler http.Handler, remoteAddr, forwardedFor string) int {
+	req := httptest.NewRequest(http.MethodPost, "/verify", strings.NewReader(`{"sha256":"`+strings.Repeat("ab", 32)+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestVerifyIgnoresSpoofedForwardedFor(t *testing.T) {
+	db := &verifyDB{}
+	handler := (&Server{db: db}).RegisterRoutes()
+
+	// A new X-Forwarded-For on every request neither resets the limit nor reaches the audit log
+	limited := false
+	for i := 0; i < 40 && !limited; i++ {
+		limited = verifyRequest(handler, "203.0.113.7:4000", fmt.Sprintf("198.51.100.%d", i)) == http.StatusTooManyRequests
+	}
+	if !limited {
+		t.Fatal("spoofed X-Forwarded-For headers got past the rate limit")
+	}
+	for _, ip := range db.clientIPs {
+		if ip != "203.0.113.7" {
+			t.Fatalf("audit log recorded client IP %s", ip)
+		}
+	}
+}
+
+func TestVerifyTrustsConfiguredProxies(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8")
+	db := &verifyDB{}
+	handler := (&Server{db: db}).RegisterRoutes()
+
+	if code := verifyRequest(handler, "10.1.2.3:4000", "198.51.100.1"); code != http.StatusNotFound {
+		t.Fatalf("status = %d", code)
+	}
+	if code := verifyRequest(handler, "203.0.113.7:4000", "198.51.100.2"); code != http.StatusNotFound {
+		t.Fatalf("status = %d", code)
+	}
+	if want := []string{"198.51.100.1", "203.0.113.7"}; strings.Join(db.clientIPs, ",") != strings.Join(want, ",") {
+		t.Errorf("client IPs = %v, want %v", db.clientIPs, want)
+	}
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"log"
 	"net/http"
 	"os"
 
@@ -18,13 +19,21 @@ func (s *Server) RegisterRoutes() http.Handler {
 	auth.InitGothProviders()
 
 	r := gin.Default()
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 
 	// Set up sessions
 	store := cookie.NewStore([]byte(os.Getenv("SESSION_SECRET")))
 	r.Use(sessions.Sessions("finalsign-session", store))
 
+	// Workspace embed origins are only allowed on the signing routes they embed
+	embedOrigins := newEmbedOriginCache(s.db)
 	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:3000", "https://finalsign.io", "https://www.finalsign.io"},
+		AllowOrigins: allowedOrigins(),
+		AllowOriginWithContextFunc: func(c *gin.Context, origin string) bool {
+			return isEmbedPath(c.Request.URL.Path) && embedOrigins.allows(origin)
+		},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
 		AllowHeaders:     []string{"Accept", "Authorization", "Content-Type"},
 		AllowCredentials: true,
@@ -38,6 +47,12 @@ func (s *Server) RegisterRoutes() http.Handler {
 	workspaceRoutes := routes.NewWorkspaceRoutes(s)
 	notificationRoutes := routes.NewNotificationRoutes(s)
 	templateRoutes := routes.NewTemplateRoutes(s)
+	documentRoutes := routes.NewDocumentRoutes(s)
+	signingRoutes := routes.NewSigningRoutes(s)
+	bulkSendRoutes := routes.NewBulkSendRoutes(s)
+	embedRoutes := routes.NewEmbedRoutes(s)
+	webhookRoutes := routes.NewWebhookRoutes(s)
+	verifyRoutes := routes.NewVerifyRoutes(s)
 
 	// Register route groups
 	authRoutes.RegisterRoutes(r)
@@ -45,10 +60,20 @@ func (s *Server) RegisterRoutes() http.Handler {
 	workspaceRoutes.RegisterRoutes(r)
 	notificationRoutes.RegisterRoutes(r)
 	templateRoutes.RegisterRoutes(r)
+	documentRoutes.RegisterRoutes(r)
+	signingRoutes.RegisterRoutes(r)
+	bulkSendRoutes.RegisterRoutes(r)
+	embedRoutes.RegisterRoutes(r)
+	webhookRoutes.RegisterRoutes(r)
+	verifyRoutes.RegisterRoutes(r)
 
 	return r
 }
 
 func (s *Server) healthHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, s.db.Health())
+	health := s.db.Health()
+	for name, stats := range s.scheduler.Stats() {
+		health["job_"+name] = stats.String()
+	}
+	c.JSON(http.StatusOK, health)
 }
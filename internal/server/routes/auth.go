@@ -9,6 +9,7 @@ import (
 	"github.com/markbates/goth/gothic"
 
 	"finalsign/internal/database"
+	"finalsign/internal/pdf"
 	"finalsign/internal/storage"
 )
 
@@ -18,7 +19,9 @@ type AuthRoutes struct {
 
 type ServerInterface interface {
 	GetDB() database.Service
-	GetS3Service() *storage.S3Service
+	GetStorage() *storage.Service
+	GetPDFSigner() *pdf.Signer
+	GetFrontendURL() string
 }
 
 func NewAuthRoutes(server ServerInterface) *AuthRoutes {
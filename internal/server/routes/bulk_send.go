@@ -0,0 +1,465 @@
+package routes
+
+import (
+	"encoding/csv"
+	"errors"
+	"finalsign/internal/database"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	maxBulkSendRows     = 1000
+	maxBulkSendFileSize = 5 << 20 // 5 MB
+	// documentNameColumn optionally names each row's document
+	documentNameColumn = "document_name"
+)
+
+type BulkSendRoutes struct {
+	server ServerInterface
+}
+
+func NewBulkSendRoutes(server ServerInterface) *BulkSendRoutes {
+	return &BulkSendRoutes{server: server}
+}
+
+func (br *BulkSendRoutes) RegisterRoutes(r *gin.Engine) {
+	// Create middleware instance
+	middleware := NewMiddleware(br.server)
+
+	// Bulk send routes - all require authentication and workspace context
+	bulkSends := r.Group("/workspaces/:slug/bulk-sends")
+	bulkSends.Use(middleware.AuthMiddleware())
+	bulkSends.Use(middleware.WorkspaceMiddleware())
+	{
+		bulkSends.POST("", br.createBulkSendHandler)
+		bulkSends.GET("/:batchID", br.getBulkSendHandler)
+	}
+}
+
+// BulkSendRowError lists everything wrong with one CSV row
+type BulkSendRowError struct {
+	Row    int      `json:"row"`
+	Errors []string `json:"errors"`
+}
+
+// bulkSendCSVRow is a CSV row that passed validation, before prefill values are encrypted
+type bulkSendCSVRow struct {
+	rowNumber    int
+	documentName string
+	recipients   []database.BulkSendRecipient
+	prefill      []bulkSendPrefillValue
+}
+
+type bulkSendPrefillValue struct {
+	field       database.TemplateField
+	signerOrder int
+	value       string
+}
+
+// bulkSendColumn describes what one CSV column holds
+type bulkSendColumn struct {
+	documentName bool
+	signer       *database.TemplateSigner
+	signerEmail  bool // otherwise the signer's name
+	field        *database.TemplateField
+}
+
+// createBulkSendHandler validates a CSV with one row per document and queues the batch. Every
+// row is checked before anything is stored; the documents are created and sent in the background.
+//
+// Columns are "<signer>:email" and "<signer>:name" for each template signer role, where <signer>
+// is the role's signer_name or signer_order, an optional "document_name", and optional prefill
+// values in columns named after a template field_name.
+func (br *BulkSendRoutes) createBulkSendHandler(c *gin.Context) {
+	user := c.MustGet("user").(*database.User)
+	workspace := c.MustGet("workspace").(*database.UserWorkspace)
+
+	// Check if user has permission to create documents (member or higher)
+	if workspace.Role == "viewer" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions to create documents"})
+		return
+	}
+
+	err := c.Request.ParseMultipartForm(maxBulkSendFileSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form data"})
+		return
+	}
+
+	templateID, err := uuid.Parse(c.PostForm("template_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template ID"})
+		return
+	}
+
+	var expiresAt *time.Time
+	if value := c.PostForm("expires_at"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Expiration date must be an RFC 3339 timestamp"})
+			return
+		}
+		if !parsed.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Expiration date must be in the future"})
+			return
+		}
+		expiresAt = &parsed
+	}
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "CSV file is required"})
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxBulkSendFileSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "CSV file must be 5 MB or less"})
+		return
+	}
+
+	db := br.server.GetDB()
+	template, err := db.GetTemplateWithSignersAndFields(templateID, user.ID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "access denied") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch template"})
+		return
+	}
+
+	// Ensure template belongs to the current workspace
+	if template.WorkspaceID != workspace.WorkspaceID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found in this workspace"})
+		return
+	}
+
+	csvRows, rowErrors, err := parseBulkSendCSV(file, template)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid CSV: %v", err)})
+		return
+	}
+	if len(rowErrors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":      "Some rows are invalid; nothing was sent",
+			"row_errors": rowErrors,
+		})
+		return
+	}
+
+	snapshotHash, err := database.TemplateSnapshotHash(template)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to snapshot template"})
+		return
+	}
+
+	fileStorage := br.server.GetStorage()
+
+	rows := make([]database.BulkSendRow, 0, len(csvRows))
+	for _, csvRow := range csvRows {
+		prefill := make([]database.BulkSendPrefill, 0, len(csvRow.prefill))
+		for _, value := range csvRow.prefill {
+			encrypted, keyID, err := fileStorage.EncryptValue(c.Request.Context(), template.WorkspaceID, value.value)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt field value"})
+				return
+			}
+			prefill = append(prefill, database.BulkSendPrefill{
+				FieldID:         value.field.ID,
+				FieldName:       value.field.FieldName,
+				FieldType:       value.field.FieldType,
+				SignerOrder:     value.signerOrder,
+				EncryptedValue:  encrypted,
+				EncryptionKeyID: keyID,
+			})
+		}
+
+		rows = append(rows, database.BulkSendRow{
+			RowNumber:    csvRow.rowNumber,
+			DocumentName: csvRow.documentName,
+			Recipients:   csvRow.recipients,
+			Prefill:      prefill,
+		})
+	}
+
+	batch := &database.BulkSendBatch{
+		WorkspaceID:          workspace.WorkspaceID,
+		TemplateID:           template.ID,
+		TemplateVersionID:    *template.PublishedVersionID,
+		TemplateSnapshotHash: snapshotHash,
+		CreatedBy:            user.ID,
+		ExpiresAt:            expiresAt,
+		ParallelSigning:      template.ParallelSigning,
+	}
+
+	createdBatch, err := db.CreateBulkSendBatch(batch, rows)
+	if err != nil {
+		if strings.Contains(err.Error(), "insufficient permissions") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions to create documents"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create bulk send"})
+		return
+	}
+
+	// Row details are available from the status endpoint
+	createdBatch.Rows = nil
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Bulk send queued",
+		"batch":   createdBatch,
+	})
+}
+
+// getBulkSendHandler reports a batch's progress and the outcome of every row
+func (br *BulkSendRoutes) getBulkSendHandler(c *gin.Context) {
+	user := c.MustGet("user").(*database.User)
+	workspace := c.MustGet("workspace").(*database.UserWorkspace)
+
+	batchID, err := uuid.Parse(c.Param("batchID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bulk send ID"})
+		return
+	}
+
+	db := br.server.GetDB()
+	batch, err := db.GetBulkSendBatch(batchID, user.ID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "access denied") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Bulk send not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch bulk send"})
+		return
+	}
+
+	// Ensure batch belongs to the current workspace
+	if batch.WorkspaceID != workspace.WorkspaceID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Bulk send not found in this workspace"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"batch": batch})
+}
+
+// parseBulkSendCSV reads and validates every row of a bulk send CSV against the template.
+// A returned error means the file itself is unusable; problems with individual rows are
+// collected in the row errors so they can all be fixed in one go.
+func parseBulkSendCSV(r io.Reader, template *database.TemplateWithSignersAndFields) ([]bulkSendCSVRow, []BulkSendRowError, error) {
+	if len(template.Signers) == 0 {
+		return nil, nil, fmt.Errorf("template has no signers")
+	}
+
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil, fmt.Errorf("file is empty")
+		}
+		return nil, nil, err
+	}
+
+	columns, err := parseBulkSendHeader(header, template)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	signerOrders := make(map[uuid.UUID]int, len(template.Signers))
+	for _, signer := range template.Signers {
+		signerOrders[signer.ID] = signer.SignerOrder
+	}
+
+	var rows []bulkSendCSVRow
+	var rowErrors []BulkSendRowError
+
+	for rowNumber := 1; ; rowNumber++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if rowNumber > maxBulkSendRows {
+			return nil, nil, fmt.Errorf("a bulk send is limited to %d rows", maxBulkSendRows)
+		}
+
+		row := bulkSendCSVRow{rowNumber: rowNumber, documentName: template.Name}
+		recipients := make(map[int]*database.BulkSendRecipient, len(template.Signers))
+		for i := range template.Signers {
+			recipients[template.Signers[i].SignerOrder] = &database.BulkSendRecipient{
+				TemplateSignerID: template.Signers[i].ID,
+				SignerOrder:      template.Signers[i].SignerOrder,
+			}
+		}
+
+		var problems []string
+		for i, column := range columns {
+			value := strings.TrimSpace(record[i])
+
+			switch {
+			case column.documentName:
+				if value == "" {
+					continue
+				}
+				if len(value) > 255 {
+					problems = append(problems, "document_name must be 255 characters or less")
+					continue
+				}
+				row.documentName = value
+			case column.signer != nil && column.signerEmail:
+				recipients[column.signer.SignerOrder].Email = strings.ToLower(value)
+			case column.signer != nil:
+				if len(value) > 255 {
+					problems = append(problems, fmt.Sprintf("name for signer '%s' must be 255 characters or less", column.signer.SignerName))
+					continue
+				}
+				recipients[column.signer.SignerOrder].Name = value
+			case column.field != nil:
+				// Required fields may be left for the signer to fill in
+				if value == "" {
+					continue
+				}
+				normalized, err := validateFieldValue(*column.field, value)
+				if err != nil {
+					problems = append(problems, fmt.Sprintf("%s: %v", column.field.FieldName, err))
+					continue
+				}
+				row.prefill = append(row.prefill, bulkSendPrefillValue{
+					field:       *column.field,
+					signerOrder: signerOrders[column.field.SignerID],
+					value:       normalized,
+				})
+			}
+		}
+
+		usedEmails := make(map[string]bool)
+		for _, signer := range template.Signers {
+			recipient := recipients[signer.SignerOrder]
+			if !signerEmailPattern.MatchString(recipient.Email) {
+				problems = append(problems, fmt.Sprintf("invalid email '%s' for signer '%s'", recipient.Email, signer.SignerName))
+				continue
+			}
+			if usedEmails[recipient.Email] {
+				problems = append(problems, fmt.Sprintf("duplicate email '%s'", recipient.Email))
+				continue
+			}
+			usedEmails[recipient.Email] = true
+			row.recipients = append(row.recipients, *recipient)
+		}
+
+		if len(problems) > 0 {
+			rowErrors = append(rowErrors, BulkSendRowError{Row: rowNumber, Errors: problems})
+			continue
+		}
+		rows = append(rows, row)
+	}
+
+	if len(rows) == 0 && len(rowErrors) == 0 {
+		return nil, nil, fmt.Errorf("file has no rows")
+	}
+
+	return rows, rowErrors, nil
+}
+
+// parseBulkSendHeader maps each CSV column onto a signer role, a template field or the
+// document name. Every signer role needs an email column.
+func parseBulkSendHeader(header []string, template *database.TemplateWithSignersAndFields) ([]bulkSendColumn, error) {
+	fieldsByName := make(map[string]*database.TemplateField, len(template.Fields))
+	for i := range template.Fields {
+		fieldsByName[template.Fields[i].FieldName] = &template.Fields[i]
+	}
+
+	columns := make([]bulkSendColumn, len(header))
+	seen := make(map[string]bool)
+	hasEmail := make(map[int]bool)
+
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		if name == "" {
+			return nil, fmt.Errorf("column %d has no name", i+1)
+		}
+
+		var key string
+		if name == documentNameColumn {
+			columns[i].documentName = true
+			key = name
+		} else if field, exists := fieldsByName[name]; exists {
+			if field.FieldType == "signature" {
+				return nil, fmt.Errorf("signature field '%s' cannot be prefilled", name)
+			}
+			columns[i].field = field
+			key = "field:" + name
+		} else {
+			separator := strings.LastIndex(name, ":")
+			if separator < 0 {
+				return nil, fmt.Errorf("column '%s' is not a signer column or a template field", name)
+			}
+
+			role := strings.TrimSpace(name[:separator])
+			attribute := strings.ToLower(strings.TrimSpace(name[separator+1:]))
+			if attribute != "email" && attribute != "name" {
+				return nil, fmt.Errorf("column '%s' must end in ':email' or ':name'", name)
+			}
+
+			signer := findTemplateSignerByRole(template.Signers, role)
+			if signer == nil {
+				return nil, fmt.Errorf("column '%s' references unknown signer '%s'", name, role)
+			}
+
+			columns[i].signer = signer
+			columns[i].signerEmail = attribute == "email"
+			if columns[i].signerEmail {
+				hasEmail[signer.SignerOrder] = true
+			}
+			key = fmt.Sprintf("signer:%d:%s", signer.SignerOrder, attribute)
+		}
+
+		if seen[key] {
+			return nil, fmt.Errorf("column '%s' appears more than once", name)
+		}
+		seen[key] = true
+	}
+
+	for _, signer := range template.Signers {
+		if !hasEmail[signer.SignerOrder] {
+			return nil, fmt.Errorf("missing email column for signer '%s' (%d)", signer.SignerName, signer.SignerOrder)
+		}
+	}
+
+	return columns, nil
+}
+
+// findTemplateSignerByRole resolves a signer by signer_order or, case-insensitively, signer_name
+func findTemplateSignerByRole(signers []database.TemplateSigner, role string) *database.TemplateSigner {
+	if order, err := strconv.Atoi(role); err == nil {
+		for i := range signers {
+			if signers[i].SignerOrder == order {
+				return &signers[i]
+			}
+		}
+		return nil
+	}
+
+	for i := range signers {
+		if strings.EqualFold(signers[i].SignerName, role) {
+			return &signers[i]
+		}
+	}
+	return nil
+}
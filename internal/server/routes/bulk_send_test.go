@@ -0,0 +1,115 @@
+package routes
+
+import (
+	"finalsign/internal/database"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func bulkSendTestTemplate() *database.TemplateWithSignersAndFields {
+	client := database.TemplateSigner{ID: uuid.New(), SignerOrder: 1, SignerName: "Client"}
+	witness := database.TemplateSigner{ID: uuid.New(), SignerOrder: 2, SignerName: "Witness"}
+	return &database.TemplateWithSignersAndFields{
+		Template: database.Template{Name: "NDA"},
+		Signers:  []database.TemplateSigner{client, witness},
+		Fields: []database.TemplateField{
+			{ID: uuid.New(), SignerID: client.ID, FieldName: "company", FieldType: "text", Required: true},
+			{ID: uuid.New(), SignerID: witness.ID, FieldName: "start_date", FieldType: "date"},
+			{ID: uuid.New(), SignerID: client.ID, FieldName: "client_signature", FieldType: "signature"},
+		},
+	}
+}
+
+func TestParseBulkSendCSV(t *testing.T) {
+	template := bulkSendTestTemplate()
+	csvData := "Client:email,client:name,2:email,company,start_date,document_name\n" +
+		"Ada@Example.com,Ada,grace@example.com,Acme,2024-03-01T10:00:00Z,Ada NDA\n" +
+		"bob@example.com,Bob,carol@example.com,,,\n"
+
+	rows, rowErrors, err := parseBulkSendCSV(strings.NewReader(csvData), template)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rowErrors) != 0 {
+		t.Fatalf("unexpected row errors: %+v", rowErrors)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(rows))
+	}
+
+	first := rows[0]
+	if first.rowNumber != 1 || first.documentName != "Ada NDA" {
+		t.Errorf("first row = %d %q, want 1 \"Ada NDA\"", first.rowNumber, first.documentName)
+	}
+	if len(first.recipients) != 2 || first.recipients[0].Email != "ada@example.com" || first.recipients[0].Name != "Ada" {
+		t.Errorf("unexpected recipients: %+v", first.recipients)
+	}
+	if first.recipients[1].TemplateSignerID != template.Signers[1].ID {
+		t.Errorf("second recipient not mapped to the witness role: %+v", first.recipients[1])
+	}
+	if len(first.prefill) != 2 {
+		t.Fatalf("got %d prefill values, want 2", len(first.prefill))
+	}
+	if first.prefill[1].value != "2024-03-01" || first.prefill[1].signerOrder != 2 {
+		t.Errorf("date prefill = %q for signer %d, want 2024-03-01 for signer 2", first.prefill[1].value, first.prefill[1].signerOrder)
+	}
+
+	// Blank optional columns fall back to the template name and leave fields for the signer
+	second := rows[1]
+	if second.documentName != "NDA" || len(second.prefill) != 0 {
+		t.Errorf("second row = %q with %d prefill values, want \"NDA\" with none", second.documentName, len(second.prefill))
+	}
+}
+
+func TestParseBulkSendCSVRowErrors(t *testing.T) {
+	csvData := "1:email,2:email,start_date\n" +
+		"ada@example.com,grace@example.com,2024-03-01\n" +
+		"not-an-email,grace@example.com,2023-02-29\n" +
+		"ada@example.com,ADA@example.com,\n"
+
+	rows, rowErrors, err := parseBulkSendCSV(strings.NewReader(csvData), bulkSendTestTemplate())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rows) != 1 {
+		t.Errorf("got %d valid rows, want 1", len(rows))
+	}
+	if len(rowErrors) != 2 {
+		t.Fatalf("got %d row errors, want 2: %+v", len(rowErrors), rowErrors)
+	}
+	if rowErrors[0].Row != 2 || len(rowErrors[0].Errors) != 2 {
+		t.Errorf("row 2 errors = %+v, want an email and a date error", rowErrors[0])
+	}
+	if rowErrors[1].Row != 3 || !strings.Contains(rowErrors[1].Errors[0], "duplicate email") {
+		t.Errorf("row 3 errors = %+v, want a duplicate email error", rowErrors[1])
+	}
+}
+
+func TestParseBulkSendCSVHeaderErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		csvData string
+		wantErr string
+	}{
+		{"empty file", "", "file is empty"},
+		{"no rows", "1:email,2:email\n", "no rows"},
+		{"missing signer email", "1:email,2:name\na@example.com,Bob\n", "missing email column for signer 'Witness'"},
+		{"unknown signer", "1:email,2:email,Notary:email\n", "unknown signer 'Notary'"},
+		{"unknown column", "1:email,2:email,favourite_colour\n", "not a signer column or a template field"},
+		{"bad attribute", "1:email,2:email,1:phone\n", "must end in ':email' or ':name'"},
+		{"duplicate column", "1:email,Client:email,2:email\n", "appears more than once"},
+		{"signature prefill", "1:email,2:email,client_signature\n", "cannot be prefilled"},
+		{"ragged row", "1:email,2:email\na@example.com\n", "wrong number of fields"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := parseBulkSendCSV(strings.NewReader(tt.csvData), bulkSendTestTemplate())
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
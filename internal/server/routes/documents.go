@@ -0,0 +1,691 @@
+package routes
+
+import (
+	"errors"
+	"finalsign/internal/database"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// signerEmailPattern mirrors the document_signers_valid_email check constraint
+var signerEmailPattern = regexp.MustCompile(`^[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}$`)
+
+type DocumentRoutes struct {
+	server ServerInterface
+}
+
+func NewDocumentRoutes(server ServerInterface) *DocumentRoutes {
+	return &DocumentRoutes{server: server}
+}
+
+func (dr *DocumentRoutes) RegisterRoutes(r *gin.Engine) {
+	// Create middleware instance
+	middleware := NewMiddleware(dr.server)
+
+	// Document routes - all require authentication and workspace context
+	documents := r.Group("/workspaces/:slug/documents")
+	documents.Use(middleware.AuthMiddleware())
+	documents.Use(middleware.WorkspaceMiddleware())
+	{
+		documents.GET("", dr.listDocumentsHandler)
+		documents.POST("", dr.createDocumentHandler)
+		documents.GET("/:documentID", dr.getDocumentHandler)
+		documents.POST("/:documentID/send", dr.sendDocumentHandler)
+		documents.GET("/:documentID/audit", dr.getDocumentAuditHandler)
+		documents.POST("/:documentID/signers/:signerID/remind", dr.remindSignerHandler)
+		documents.POST("/:documentID/void", dr.voidDocumentHandler)
+		documents.POST("/:documentID/signers/:signerID/reassign", dr.reassignSignerHandler)
+	}
+}
+
+type CreateDocumentRequest struct {
+	TemplateID string             `json:"template_id" binding:"required"`
+	Name       string             `json:"name" binding:"max=255"`
+	ExpiresAt  *time.Time         `json:"expires_at"`
+	Recipients []RecipientRequest `json:"recipients" binding:"required"`
+	Reminders  *ReminderPolicy    `json:"reminders"`
+}
+
+// ReminderPolicy schedules automatic reminders: the first FirstAfterDays after a signer's turn
+// starts, then every RepeatEveryDays (if set) until they complete or the document expires
+type ReminderPolicy struct {
+	FirstAfterDays  int  `json:"first_after_days" binding:"min=1,max=365"`
+	RepeatEveryDays *int `json:"repeat_every_days" binding:"omitempty,min=1,max=365"`
+}
+
+type VoidDocumentRequest struct {
+	Reason string `json:"reason" binding:"required,max=1000"`
+}
+
+type ReassignSignerRequest struct {
+	Email string `json:"email" binding:"required"`
+	Name  string `json:"name"`
+}
+
+type RecipientRequest struct {
+	SignerOrder int    `json:"signer_order"`
+	Email       string `json:"email"`
+	Name        string `json:"name"`
+}
+
+// documentStatuses are the values accepted by the status filter
+var documentStatuses = map[string]bool{
+	"draft": true, "scheduled": true, "sent": true, "in_progress": true,
+	"completed": true, "expired": true, "cancelled": true, "declined": true,
+}
+
+// listDocumentsHandler returns a page of the workspace's documents. Filters: status (repeatable
+// or comma-separated), template_id, created_by, signer_email, created_from, created_to (RFC 3339)
+// and q (name search). Ordering: sort (created_at, updated_at or name) and order (asc or desc).
+// Pass next_cursor from a response as cursor, with the same filters, to get the next page.
+func (dr *DocumentRoutes) listDocumentsHandler(c *gin.Context) {
+	user := c.MustGet("user").(*database.User)
+	workspace := c.MustGet("workspace").(*database.UserWorkspace)
+
+	filter := database.DocumentListFilter{
+		SignerEmail: strings.TrimSpace(c.Query("signer_email")),
+		Search:      strings.TrimSpace(c.Query("q")),
+		SortBy:      c.DefaultQuery("sort", "created_at"),
+		Cursor:      c.Query("cursor"),
+	}
+
+	for _, value := range c.QueryArray("status") {
+		for _, status := range strings.Split(value, ",") {
+			status = strings.TrimSpace(status)
+			if status == "" {
+				continue
+			}
+			if !documentStatuses[status] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid status '%s'", status)})
+				return
+			}
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+
+	if value := c.Query("template_id"); value != "" {
+		templateID, err := uuid.Parse(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template ID"})
+			return
+		}
+		filter.TemplateID = &templateID
+	}
+
+	if value := c.Query("created_by"); value != "" {
+		createdBy, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid created_by user ID"})
+			return
+		}
+		filter.CreatedBy = &createdBy
+	}
+
+	if value := c.Query("created_from"); value != "" {
+		createdFrom, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "created_from must be an RFC 3339 timestamp"})
+			return
+		}
+		filter.CreatedFrom = &createdFrom
+	}
+
+	if value := c.Query("created_to"); value != "" {
+		createdTo, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "created_to must be an RFC 3339 timestamp"})
+			return
+		}
+		filter.CreatedTo = &createdTo
+	}
+
+	switch c.DefaultQuery("order", "desc") {
+	case "asc":
+		filter.Ascending = true
+	case "desc":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order must be 'asc' or 'desc'"})
+		return
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+			return
+		}
+		filter.Limit = limit
+	}
+
+	db := dr.server.GetDB()
+	list, err := db.ListWorkspaceDocuments(workspace.WorkspaceID, user.ID, filter)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "invalid sort field"):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be one of created_at, updated_at or name"})
+		case strings.Contains(err.Error(), "invalid cursor"):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		case strings.Contains(err.Error(), "does not have access"):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to workspace"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list documents"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+func (dr *DocumentRoutes) createDocumentHandler(c *gin.Context) {
+	user := c.MustGet("user").(*database.User)
+	workspace := c.MustGet("workspace").(*database.UserWorkspace)
+
+	// Check if user has permission to create documents (member or higher)
+	if workspace.Role == "viewer" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions to create documents"})
+		return
+	}
+
+	var req CreateDocumentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	templateID, err := uuid.Parse(req.TemplateID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template ID"})
+		return
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expiration date must be in the future"})
+		return
+	}
+
+	db := dr.server.GetDB()
+	template, err := db.GetTemplateWithSignersAndFields(templateID, user.ID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "access denied") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch template"})
+		return
+	}
+
+	// Ensure template belongs to the current workspace
+	if template.WorkspaceID != workspace.WorkspaceID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found in this workspace"})
+		return
+	}
+
+	signers, err := convertAndValidateRecipients(req.Recipients, template.Signers)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid recipients: %v", err)})
+		return
+	}
+
+	snapshotHash, err := database.TemplateSnapshotHash(template)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to snapshot template"})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = template.Name
+	}
+
+	document := &database.Document{
+		TemplateID:           template.ID,
+		TemplateVersionID:    *template.PublishedVersionID,
+		Name:                 name,
+		TemplateSnapshotHash: snapshotHash,
+		CreatedBy:            user.ID,
+		WorkspaceID:          workspace.WorkspaceID,
+		ExpiresAt:            req.ExpiresAt,
+		ParallelSigning:      template.ParallelSigning,
+	}
+	if req.Reminders != nil {
+		document.ReminderFirstAfterDays = &req.Reminders.FirstAfterDays
+		document.ReminderRepeatDays = req.Reminders.RepeatEveryDays
+	}
+
+	createdDocument, err := db.CreateDocumentWithSigners(document, signers)
+	if err != nil {
+		if strings.Contains(err.Error(), "insufficient permissions") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions to create documents"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create document"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "Document created successfully",
+		"document": createdDocument,
+	})
+}
+
+func (dr *DocumentRoutes) getDocumentHandler(c *gin.Context) {
+	user := c.MustGet("user").(*database.User)
+	workspace := c.MustGet("workspace").(*database.UserWorkspace)
+
+	documentIDStr := c.Param("documentID")
+	documentID, err := uuid.Parse(documentIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
+		return
+	}
+
+	db := dr.server.GetDB()
+	document, err := db.GetDocumentWithSigners(documentID, user.ID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "access denied") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch document"})
+		return
+	}
+
+	// Ensure document belongs to the current workspace
+	if document.WorkspaceID != workspace.WorkspaceID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found in this workspace"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"document": document})
+}
+
+// sendDocumentHandler moves a draft document to sent so signers can open their links
+func (dr *DocumentRoutes) sendDocumentHandler(c *gin.Context) {
+	user := c.MustGet("user").(*database.User)
+	workspace := c.MustGet("workspace").(*database.UserWorkspace)
+
+	documentIDStr := c.Param("documentID")
+	documentID, err := uuid.Parse(documentIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
+		return
+	}
+
+	db := dr.server.GetDB()
+	document, err := db.GetDocumentByID(documentID, user.ID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "access denied") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch document"})
+		return
+	}
+
+	// Ensure document belongs to the current workspace
+	if document.WorkspaceID != workspace.WorkspaceID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found in this workspace"})
+		return
+	}
+
+	notified, err := db.SendDocument(documentID, user.ID)
+	if err != nil {
+		if strings.Contains(err.Error(), "insufficient permissions") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions to send document"})
+			return
+		}
+		if strings.Contains(err.Error(), "already sent") {
+			c.JSON(http.StatusConflict, gin.H{"error": "Document has already been sent or has expired"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send document"})
+		return
+	}
+
+	recipients := make([]gin.H, 0, len(notified))
+	for _, signer := range notified {
+		recipients = append(recipients, gin.H{
+			"id":           signer.ID,
+			"email":        signer.SignerEmail,
+			"signer_order": signer.SignerOrder,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Document sent successfully",
+		"notified_signers": recipients,
+		"parallel_signing": document.ParallelSigning,
+	})
+}
+
+// getDocumentAuditHandler returns the document's audit trail in the order events happened
+func (dr *DocumentRoutes) getDocumentAuditHandler(c *gin.Context) {
+	user := c.MustGet("user").(*database.User)
+	workspace := c.MustGet("workspace").(*database.UserWorkspace)
+
+	documentIDStr := c.Param("documentID")
+	documentID, err := uuid.Parse(documentIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
+		return
+	}
+
+	db := dr.server.GetDB()
+	document, err := db.GetDocumentByID(documentID, user.ID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "access denied") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch document"})
+		return
+	}
+
+	// Ensure document belongs to the current workspace
+	if document.WorkspaceID != workspace.WorkspaceID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found in this workspace"})
+		return
+	}
+
+	entries, err := db.GetDocumentAuditLog(documentID, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"audit_log": entries})
+}
+
+// remindSignerHandler emails a signer a reminder to sign. Reminders to the same signer are
+// limited to one per database.ReminderCooldown.
+func (dr *DocumentRoutes) remindSignerHandler(c *gin.Context) {
+	user := c.MustGet("user").(*database.User)
+	workspace := c.MustGet("workspace").(*database.UserWorkspace)
+
+	documentID, err := uuid.Parse(c.Param("documentID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
+		return
+	}
+
+	signerID, err := uuid.Parse(c.Param("signerID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid signer ID"})
+		return
+	}
+
+	db := dr.server.GetDB()
+	document, err := db.GetDocumentByID(documentID, user.ID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "access denied") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch document"})
+		return
+	}
+
+	// Ensure document belongs to the current workspace
+	if document.WorkspaceID != workspace.WorkspaceID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found in this workspace"})
+		return
+	}
+
+	signer, err := db.RemindDocumentSigner(documentID, signerID, user.ID)
+	if err != nil {
+		var rateLimited *database.ReminderRateLimitError
+		if errors.As(err, &rateLimited) {
+			retryAfter := int(math.Ceil(rateLimited.RetryAfter.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":       "This signer was reminded recently",
+				"retry_after": retryAfter,
+			})
+			return
+		}
+		switch {
+		case strings.Contains(err.Error(), "insufficient permissions"):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions to remind signers"})
+		case strings.Contains(err.Error(), "signer not found"):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Signer not found"})
+		case strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "access denied"):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		case strings.Contains(err.Error(), "not awaiting signatures"):
+			c.JSON(http.StatusConflict, gin.H{"error": "Document is not awaiting signatures"})
+		case strings.Contains(err.Error(), "already completed"):
+			c.JSON(http.StatusConflict, gin.H{"error": "Signer has already completed this document"})
+		case strings.Contains(err.Error(), "waiting on a previous signer"):
+			c.JSON(http.StatusConflict, gin.H{"error": "It is not this signer's turn yet"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send reminder"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Reminder sent",
+		"signer": gin.H{
+			"id":               signer.ID,
+			"email":            signer.SignerEmail,
+			"last_reminded_at": signer.LastRemindedAt,
+		},
+	})
+}
+
+// voidDocumentHandler cancels an in-flight document. Signing links stop working immediately and
+// signers who already acted are told why.
+func (dr *DocumentRoutes) voidDocumentHandler(c *gin.Context) {
+	user := c.MustGet("user").(*database.User)
+	workspace := c.MustGet("workspace").(*database.UserWorkspace)
+
+	documentID, err := uuid.Parse(c.Param("documentID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
+		return
+	}
+
+	var req VoidDocumentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A reason is required to void a document"})
+		return
+	}
+
+	db := dr.server.GetDB()
+	document, err := db.GetDocumentByID(documentID, user.ID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "access denied") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch document"})
+		return
+	}
+
+	// Ensure document belongs to the current workspace
+	if document.WorkspaceID != workspace.WorkspaceID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found in this workspace"})
+		return
+	}
+
+	notified, err := db.VoidDocument(documentID, user.ID, reason)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "insufficient permissions"):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only the document creator or workspace admins can void this document"})
+		case strings.Contains(err.Error(), "can no longer be voided"):
+			c.JSON(http.StatusConflict, gin.H{"error": "Document has already completed, expired or been voided"})
+		case strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "access denied"):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to void document"})
+		}
+		return
+	}
+
+	recipients := make([]gin.H, 0, len(notified))
+	for _, signer := range notified {
+		recipients = append(recipients, gin.H{
+			"id":     signer.ID,
+			"email":  signer.SignerEmail,
+			"status": signer.Status,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Document voided",
+		"notified_signers": recipients,
+	})
+}
+
+// reassignSignerHandler replaces a signer who has not started signing with someone else. The
+// previous signer's link stops working and the new signer is sent one if it is their turn.
+func (dr *DocumentRoutes) reassignSignerHandler(c *gin.Context) {
+	user := c.MustGet("user").(*database.User)
+	workspace := c.MustGet("workspace").(*database.UserWorkspace)
+
+	documentID, err := uuid.Parse(c.Param("documentID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
+		return
+	}
+
+	signerID, err := uuid.Parse(c.Param("signerID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid signer ID"})
+		return
+	}
+
+	var req ReassignSignerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if !signerEmailPattern.MatchString(email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid email address '%s'", req.Email)})
+		return
+	}
+
+	db := dr.server.GetDB()
+	document, err := db.GetDocumentByID(documentID, user.ID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "access denied") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch document"})
+		return
+	}
+
+	// Ensure document belongs to the current workspace
+	if document.WorkspaceID != workspace.WorkspaceID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found in this workspace"})
+		return
+	}
+
+	signer, err := db.ReassignDocumentSigner(documentID, signerID, user.ID, email, req.Name)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "insufficient permissions"):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only the document creator or workspace admins can reassign signers"})
+		case strings.Contains(err.Error(), "signer not found"):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Signer not found"})
+		case strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "access denied"):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		case strings.Contains(err.Error(), "already started signing"):
+			c.JSON(http.StatusConflict, gin.H{"error": "Signer has already started or finished signing"})
+		case strings.Contains(err.Error(), "no longer awaiting"):
+			c.JSON(http.StatusConflict, gin.H{"error": "Document is not awaiting signatures"})
+		case strings.Contains(err.Error(), "already a signer"), strings.Contains(err.Error(), "same as the current"):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reassign signer"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Signer reassigned",
+		"signer": gin.H{
+			"id":           signer.ID,
+			"email":        signer.SignerEmail,
+			"name":         signer.SignerName,
+			"signer_order": signer.SignerOrder,
+			"status":       signer.Status,
+		},
+	})
+}
+
+// convertAndValidateRecipients maps each recipient onto a template signer role.
+// Every role must be filled exactly once and no email may appear twice.
+func convertAndValidateRecipients(recipients []RecipientRequest, templateSigners []database.TemplateSigner) ([]database.DocumentSigner, error) {
+	if len(templateSigners) == 0 {
+		return nil, fmt.Errorf("template has no signers")
+	}
+
+	signersByOrder := make(map[int]database.TemplateSigner)
+	for _, signer := range templateSigners {
+		signersByOrder[signer.SignerOrder] = signer
+	}
+
+	var signers []database.DocumentSigner
+	usedOrders := make(map[int]bool)
+	usedEmails := make(map[string]bool)
+
+	for i, recipient := range recipients {
+		templateSigner, exists := signersByOrder[recipient.SignerOrder]
+		if !exists {
+			return nil, fmt.Errorf("recipient at index %d references non-existent signer %d", i, recipient.SignerOrder)
+		}
+
+		if usedOrders[recipient.SignerOrder] {
+			return nil, fmt.Errorf("duplicate recipient for signer %d", recipient.SignerOrder)
+		}
+		usedOrders[recipient.SignerOrder] = true
+
+		email := strings.ToLower(strings.TrimSpace(recipient.Email))
+		if !signerEmailPattern.MatchString(email) {
+			return nil, fmt.Errorf("invalid email '%s' at index %d", recipient.Email, i)
+		}
+
+		if usedEmails[email] {
+			return nil, fmt.Errorf("duplicate email '%s' at index %d", email, i)
+		}
+		usedEmails[email] = true
+
+		name := strings.TrimSpace(recipient.Name)
+		if len(name) > 255 {
+			return nil, fmt.Errorf("recipient name too long at index %d", i)
+		}
+
+		signers = append(signers, database.DocumentSigner{
+			TemplateSignerID: templateSigner.ID,
+			SignerOrder:      templateSigner.SignerOrder,
+			SignerEmail:      email,
+			SignerName:       name,
+		})
+	}
+
+	for order, templateSigner := range signersByOrder {
+		if !usedOrders[order] {
+			return nil, fmt.Errorf("no recipient provided for signer '%s' (%d)", templateSigner.SignerName, order)
+		}
+	}
+
+	return signers, nil
+}
@@ -0,0 +1,448 @@
+package routes
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"finalsign/internal/database"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultEmbedSessionTTL = 5 * time.Minute
+	minEmbedSessionTTL     = 30 * time.Second
+	maxEmbedSessionTTL     = time.Hour
+	maxEmbedOrigins        = 20
+	// embedAccessTokenTTL is how long the token issued for a redeemed session stays valid
+	embedAccessTokenTTL = 2 * time.Hour
+)
+
+// Events passed back to the host application in the return URL's "event" query parameter
+const (
+	EmbedEventSigningComplete  = "signing_complete"
+	EmbedEventSigningDeclined  = "signing_declined"
+	EmbedEventSigningDelegated = "signing_delegated"
+)
+
+// EmbedRoutes let a workspace show the signing experience inside its own application. The
+// application mints a short-lived, single-use signing URL for a signer and frames it; once the
+// signer is done they are sent back to the application's return URL.
+type EmbedRoutes struct {
+	server ServerInterface
+}
+
+func NewEmbedRoutes(server ServerInterface) *EmbedRoutes {
+	return &EmbedRoutes{server: server}
+}
+
+func (er *EmbedRoutes) RegisterRoutes(r *gin.Engine) {
+	// Create middleware instance
+	middleware := NewMiddleware(er.server)
+
+	r.POST("/workspaces/:slug/documents/:documentID/signers/:signerID/embedded-sessions",
+		middleware.AuthMiddleware(), middleware.WorkspaceMiddleware(), er.createEmbeddedSessionHandler)
+	r.GET("/workspaces/:slug/embed-settings", middleware.AuthMiddleware(), middleware.WorkspaceMiddleware(), er.getEmbedSettingsHandler)
+	r.PUT("/workspaces/:slug/embed-settings", middleware.AuthMiddleware(), middleware.WorkspaceMiddleware(), er.updateEmbedSettingsHandler)
+
+	// Opened by the framed signing page - authenticated by the signed token only
+	r.POST("/embed/sign/:token", er.redeemEmbeddedSessionHandler)
+}
+
+type CreateEmbeddedSessionRequest struct {
+	ReturnURL string `json:"return_url" binding:"required"`
+	// ExpiresIn is the lifetime of the signing URL in seconds. Defaults to five minutes.
+	ExpiresIn int `json:"expires_in"`
+}
+
+// createEmbeddedSessionHandler mints a signing URL for one signer to be shown inside the
+// workspace's own application. The return URL must be on one of the workspace's embed origins.
+func (er *EmbedRoutes) createEmbeddedSessionHandler(c *gin.Context) {
+	user := c.MustGet("user").(*database.User)
+	workspace := c.MustGet("workspace").(*database.UserWorkspace)
+
+	documentID, err := uuid.Parse(c.Param("documentID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
+		return
+	}
+
+	signerID, err := uuid.Parse(c.Param("signerID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid signer ID"})
+		return
+	}
+
+	var req CreateEmbeddedSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ttl := defaultEmbedSessionTTL
+	if req.ExpiresIn != 0 {
+		ttl = time.Duration(req.ExpiresIn) * time.Second
+		if ttl < minEmbedSessionTTL || ttl > maxEmbedSessionTTL {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("expires_in must be between %d and %d seconds",
+				int(minEmbedSessionTTL.Seconds()), int(maxEmbedSessionTTL.Seconds()))})
+			return
+		}
+	}
+
+	returnURL, origin, err := parseReturnURL(req.ReturnURL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	secret := embedSigningSecret()
+	if len(secret) == 0 {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Embedded signing is not configured"})
+		return
+	}
+
+	db := er.server.GetDB()
+	origins, err := db.GetWorkspaceEmbedOrigins(workspace.WorkspaceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch embed settings"})
+		return
+	}
+
+	allowed := false
+	for _, candidate := range origins {
+		if candidate == origin {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Return URL origin '%s' is not an allowed embed origin for this workspace", origin)})
+		return
+	}
+
+	document, err := db.GetDocumentByID(documentID, user.ID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "access denied") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch document"})
+		return
+	}
+
+	// Ensure document belongs to the current workspace
+	if document.WorkspaceID != workspace.WorkspaceID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found in this workspace"})
+		return
+	}
+
+	// The token carries the expiry in whole seconds, so store it that way too
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+	session, err := db.CreateEmbeddedSigningSession(documentID, signerID, user.ID, returnURL, expiresAt)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "insufficient permissions"):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only the document creator or workspace admins can create embedded signing sessions"})
+		case strings.Contains(err.Error(), "signer not found"):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Signer not found"})
+		case strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "access denied"):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		case strings.Contains(err.Error(), "not awaiting signatures"):
+			c.JSON(http.StatusConflict, gin.H{"error": "Document is not awaiting signatures"})
+		case strings.Contains(err.Error(), "already completed or declined"):
+			c.JSON(http.StatusConflict, gin.H{"error": "Signer has already completed or declined this document"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create embedded signing session"})
+		}
+		return
+	}
+
+	token := signEmbedToken(secret, session.ID, session.ExpiresAt, session.ReturnURL)
+	signingURL := strings.TrimRight(er.server.GetFrontendURL(), "/") + "/embed/sign/" + token
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "Embedded signing session created",
+		"session_id": session.ID,
+		"url":        signingURL,
+		"expires_at": session.ExpiresAt,
+	})
+}
+
+// redeemEmbeddedSessionHandler exchanges an embedded signing URL token for an access token that
+// only works for this session and expires after embedAccessTokenTTL. Each URL works once, so a
+// leaked URL cannot be replayed.
+func (er *EmbedRoutes) redeemEmbeddedSessionHandler(c *gin.Context) {
+	secret := embedSigningSecret()
+	if len(secret) == 0 {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Embedded signing is not configured"})
+		return
+	}
+
+	token, err := parseEmbedToken(c.Param("token"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invalid embedded signing link"})
+		return
+	}
+
+	if !token.expiresAt.After(time.Now()) {
+		c.JSON(http.StatusGone, gin.H{"error": "This embedded signing link has expired"})
+		return
+	}
+
+	db := er.server.GetDB()
+	session, err := db.GetEmbeddedSigningSession(token.sessionID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invalid embedded signing link"})
+		return
+	}
+
+	if !token.verify(secret, session.ExpiresAt, session.ReturnURL) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invalid embedded signing link"})
+		return
+	}
+
+	session, err = db.RedeemEmbeddedSigningSession(token.sessionID, time.Now().Add(embedAccessTokenTTL))
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "revoked"):
+			c.JSON(http.StatusGone, gin.H{"error": "This document is no longer available for signing"})
+		case strings.Contains(err.Error(), "not found, expired or already used"):
+			c.JSON(http.StatusGone, gin.H{"error": "This embedded signing link has expired or was already used"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to redeem embedded signing link"})
+		}
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{
+		"access_token":            session.AccessToken,
+		"access_token_expires_at": session.AccessTokenExpiresAt,
+		"document_id":             session.DocumentID,
+		"signer_id":               session.SignerID,
+		"return_url":              session.ReturnURL,
+	})
+}
+
+// getEmbedSettingsHandler returns the origins allowed to embed the workspace's signing sessions
+func (er *EmbedRoutes) getEmbedSettingsHandler(c *gin.Context) {
+	workspace := c.MustGet("workspace").(*database.UserWorkspace)
+
+	db := er.server.GetDB()
+	origins, err := db.GetWorkspaceEmbedOrigins(workspace.WorkspaceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch embed settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"allowed_origins": origins})
+}
+
+type UpdateEmbedSettingsRequest struct {
+	AllowedOrigins []string `json:"allowed_origins"`
+}
+
+// updateEmbedSettingsHandler replaces the origins allowed to frame the workspace's signing
+// sessions and call the signing API from the browser
+func (er *EmbedRoutes) updateEmbedSettingsHandler(c *gin.Context) {
+	user := c.MustGet("user").(*database.User)
+	workspace := c.MustGet("workspace").(*database.UserWorkspace)
+
+	var req UpdateEmbedSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(req.AllowedOrigins) > maxEmbedOrigins {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d origins can be allowed", maxEmbedOrigins)})
+		return
+	}
+
+	origins := make([]string, 0, len(req.AllowedOrigins))
+	seen := make(map[string]bool)
+	for _, raw := range req.AllowedOrigins {
+		origin, err := normalizeOrigin(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !seen[origin] {
+			seen[origin] = true
+			origins = append(origins, origin)
+		}
+	}
+
+	db := er.server.GetDB()
+	err := db.UpdateWorkspaceEmbedOrigins(workspace.WorkspaceID, origins, user.ID)
+	if err != nil {
+		if strings.Contains(err.Error(), "insufficient permissions") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions to update workspace"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update embed settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Embed settings updated",
+		"allowed_origins": origins,
+	})
+}
+
+// embedSigningSecret is the HMAC key for embedded signing URLs. It falls back to the session
+// secret so existing deployments work without new configuration.
+func embedSigningSecret() []byte {
+	if secret := os.Getenv("EMBED_SIGNING_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	return []byte(os.Getenv("SESSION_SECRET"))
+}
+
+// embedToken is a parsed embedded signing URL token: the session ID and expiry, followed by an
+// HMAC over them and the session's return URL
+type embedToken struct {
+	sessionID uuid.UUID
+	expiresAt time.Time
+	mac       []byte
+}
+
+const embedTokenPayloadLength = 16 + 8
+
+func embedTokenPayload(sessionID uuid.UUID, expiresAt time.Time) []byte {
+	payload := make([]byte, embedTokenPayloadLength)
+	copy(payload, sessionID[:])
+	binary.BigEndian.PutUint64(payload[16:], uint64(expiresAt.Unix()))
+	return payload
+}
+
+func embedTokenMAC(secret, payload []byte, returnURL string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	mac.Write([]byte(returnURL))
+	return mac.Sum(nil)
+}
+
+// signEmbedToken returns the URL token for an embedded signing session
+func signEmbedToken(secret []byte, sessionID uuid.UUID, expiresAt time.Time, returnURL string) string {
+	payload := embedTokenPayload(sessionID, expiresAt)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(embedTokenMAC(secret, payload, returnURL))
+}
+
+func parseEmbedToken(token string) (*embedToken, error) {
+	encodedPayload, encodedMAC, found := strings.Cut(token, ".")
+	if !found {
+		return nil, errors.New("malformed token")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil || len(payload) != embedTokenPayloadLength {
+		return nil, errors.New("malformed token")
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil || len(mac) != sha256.Size {
+		return nil, errors.New("malformed token")
+	}
+
+	sessionID, err := uuid.FromBytes(payload[:16])
+	if err != nil {
+		return nil, errors.New("malformed token")
+	}
+
+	return &embedToken{
+		sessionID: sessionID,
+		expiresAt: time.Unix(int64(binary.BigEndian.Uint64(payload[16:])), 0),
+		mac:       mac,
+	}, nil
+}
+
+// verify checks the token was issued for a session with this expiry and return URL
+func (t *embedToken) verify(secret []byte, expiresAt time.Time, returnURL string) bool {
+	if t.expiresAt.Unix() != expiresAt.Unix() {
+		return false
+	}
+	expected := embedTokenMAC(secret, embedTokenPayload(t.sessionID, t.expiresAt), returnURL)
+	return hmac.Equal(t.mac, expected)
+}
+
+// normalizeOrigin validates an origin such as "https://app.example.com" and returns it in the
+// form browsers send in the Origin header. Plain http is only accepted for local development.
+func normalizeOrigin(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" || u.User != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("invalid origin '%s': expected a scheme and host such as https://app.example.com", raw)
+	}
+
+	origin, err := urlOrigin(u)
+	if err != nil {
+		return "", fmt.Errorf("invalid origin '%s': %s", raw, err.Error())
+	}
+	return origin, nil
+}
+
+// parseReturnURL validates an embedded session's return URL and returns it with its origin
+func parseReturnURL(raw string) (string, string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" || u.User != nil {
+		return "", "", fmt.Errorf("invalid return URL '%s'", raw)
+	}
+
+	origin, err := urlOrigin(u)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid return URL '%s': %s", raw, err.Error())
+	}
+
+	// The fragment never reaches the server, and would swallow the event parameter
+	u.Fragment = ""
+	return u.String(), origin, nil
+}
+
+func urlOrigin(u *url.URL) (string, error) {
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Host)
+	hostname := strings.ToLower(u.Hostname())
+
+	switch {
+	case scheme == "https":
+	case scheme == "http" && (hostname == "localhost" || hostname == "127.0.0.1"):
+	default:
+		return "", errors.New("must use https")
+	}
+
+	return scheme + "://" + host, nil
+}
+
+// embedRedirectURL is where an embedded signer is sent after an event, with the event added to
+// the return URL's query string
+func embedRedirectURL(returnURL, event string) string {
+	u, err := url.Parse(returnURL)
+	if err != nil {
+		return returnURL
+	}
+	query := u.Query()
+	query.Set("event", event)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// frameAncestorsPolicy is the Content-Security-Policy for signing pages: they may be framed by
+// FinalSign itself and by the document's workspace's embed origins
+func frameAncestorsPolicy(frontendURL string, embedOrigins []string) string {
+	sources := []string{"'self'"}
+	if u, err := url.Parse(frontendURL); err == nil && u.Scheme != "" && u.Host != "" {
+		sources = append(sources, u.Scheme+"://"+u.Host)
+	}
+	sources = append(sources, embedOrigins...)
+	return "frame-ancestors " + strings.Join(sources, " ")
+}
@@ -0,0 +1,96 @@
+package routes
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestEmbedTokenRoundTrip(t *testing.T) {
+	secret := []byte("test-secret")
+	sessionID := uuid.New()
+	expiresAt := time.Now().Add(5 * time.Minute).Truncate(time.Second)
+	returnURL := "https://app.example.com/contracts/42"
+
+	token, err := parseEmbedToken(signEmbedToken(secret, sessionID, expiresAt, returnURL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token.sessionID != sessionID || !token.expiresAt.Equal(expiresAt) {
+		t.Errorf("parsed %s expiring %s, want %s expiring %s", token.sessionID, token.expiresAt, sessionID, expiresAt)
+	}
+	if !token.verify(secret, expiresAt, returnURL) {
+		t.Error("token did not verify against the values it was signed with")
+	}
+
+	// The token is bound to the secret, the session's expiry and its return URL
+	if token.verify([]byte("other-secret"), expiresAt, returnURL) {
+		t.Error("token verified with the wrong secret")
+	}
+	if token.verify(secret, expiresAt.Add(time.Hour), returnURL) {
+		t.Error("token verified against a different expiry")
+	}
+	if token.verify(secret, expiresAt, "https://evil.example.com/") {
+		t.Error("token verified against a different return URL")
+	}
+}
+
+func TestParseEmbedTokenRejectsMalformedTokens(t *testing.T) {
+	valid := signEmbedToken([]byte("test-secret"), uuid.New(), time.Now(), "https://app.example.com/")
+	payload, mac, _ := strings.Cut(valid, ".")
+
+	tokens := []string{"", "no-separator", payload + ".", "." + mac, payload[:10] + "." + mac, payload + "." + mac[:10], "!!!." + mac}
+	for _, token := range tokens {
+		if _, err := parseEmbedToken(token); err == nil {
+			t.Errorf("parseEmbedToken(%q) succeeded, want an error", token)
+		}
+	}
+}
+
+func TestNormalizeOrigin(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{raw: "https://App.Example.com", want: "https://app.example.com"},
+		{raw: " https://app.example.com:8443/ ", want: "https://app.example.com:8443"},
+		{raw: "http://localhost:3000", want: "http://localhost:3000"},
+		{raw: "http://app.example.com", wantErr: true},
+		{raw: "https://app.example.com/path", wantErr: true},
+		{raw: "https://app.example.com?x=1", wantErr: true},
+		{raw: "app.example.com", wantErr: true},
+		{raw: "*", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := normalizeOrigin(tt.raw)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("normalizeOrigin(%q) = %q, want an error", tt.raw, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("normalizeOrigin(%q) = %q, %v, want %q", tt.raw, got, err, tt.want)
+		}
+	}
+}
+
+func TestEmbedRedirectURL(t *testing.T) {
+	returnURL, origin, err := parseReturnURL("https://App.example.com/done?contract=42#top")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if origin != "https://app.example.com" {
+		t.Errorf("origin = %q, want https://app.example.com", origin)
+	}
+
+	got := embedRedirectURL(returnURL, EmbedEventSigningComplete)
+	want := "https://App.example.com/done?contract=42&event=signing_complete"
+	if got != want {
+		t.Errorf("redirect = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,178 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"finalsign/internal/database"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	maxTextFieldLength    = 10000
+	maxSignatureImageSize = 1 << 20 // 1 MB decoded
+)
+
+var phonePattern = regexp.MustCompile(`^\+?[0-9 ().-]+$`)
+
+// FieldValidationRules mirrors the template_fields.validation_rules JSONB column
+type FieldValidationRules struct {
+	Required  bool   `json:"required"`
+	MinLength *int   `json:"min_length"`
+	MaxLength *int   `json:"max_length"`
+	Pattern   string `json:"pattern"`
+}
+
+// validateFieldValue checks a submitted value against the field's type and validation rules.
+// It returns the normalized value to store, or "" for an empty optional field.
+func validateFieldValue(field database.TemplateField, value string) (string, error) {
+	var rules FieldValidationRules
+	if field.ValidationRules != "" {
+		if err := json.Unmarshal([]byte(field.ValidationRules), &rules); err != nil {
+			return "", fmt.Errorf("field has invalid validation rules")
+		}
+	}
+	required := field.Required || rules.Required
+
+	if field.FieldType != "signature" {
+		value = strings.TrimSpace(value)
+	}
+
+	if value == "" {
+		if required {
+			return "", fmt.Errorf("this field is required")
+		}
+		return "", nil
+	}
+
+	if !utf8.ValidString(value) {
+		return "", fmt.Errorf("value must be valid UTF-8 text")
+	}
+
+	var err error
+	switch field.FieldType {
+	case "text":
+		if utf8.RuneCountInString(value) > maxTextFieldLength {
+			return "", fmt.Errorf("value must be %d characters or less", maxTextFieldLength)
+		}
+	case "email":
+		if !signerEmailPattern.MatchString(value) {
+			return "", fmt.Errorf("must be a valid email address")
+		}
+	case "phone":
+		value, err = normalizePhone(value)
+	case "date":
+		value, err = normalizeDate(value)
+	case "checkbox":
+		value, err = normalizeCheckbox(value, required)
+	case "signature":
+		err = validateSignatureImage(value)
+	default:
+		return "", fmt.Errorf("unsupported field type '%s'", field.FieldType)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Length and pattern rules apply to the textual field types only
+	if field.FieldType == "signature" || field.FieldType == "checkbox" {
+		return value, nil
+	}
+
+	length := utf8.RuneCountInString(value)
+	if rules.MinLength != nil && length < *rules.MinLength {
+		return "", fmt.Errorf("value must be at least %d characters", *rules.MinLength)
+	}
+	if rules.MaxLength != nil && length > *rules.MaxLength {
+		return "", fmt.Errorf("value must be %d characters or less", *rules.MaxLength)
+	}
+	if rules.Pattern != "" {
+		pattern, err := regexp.Compile(rules.Pattern)
+		if err != nil {
+			return "", fmt.Errorf("field has an invalid pattern rule")
+		}
+		if !pattern.MatchString(value) {
+			return "", fmt.Errorf("value does not match the required format")
+		}
+	}
+
+	return value, nil
+}
+
+func normalizePhone(value string) (string, error) {
+	if !phonePattern.MatchString(value) {
+		return "", fmt.Errorf("must be a valid phone number")
+	}
+
+	digits := 0
+	for _, r := range value {
+		if r >= '0' && r <= '9' {
+			digits++
+		}
+	}
+	if digits < 7 || digits > 15 {
+		return "", fmt.Errorf("must be a valid phone number")
+	}
+
+	return value, nil
+}
+
+func normalizeDate(value string) (string, error) {
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed.Format("2006-01-02"), nil
+		}
+	}
+	return "", fmt.Errorf("must be a date in YYYY-MM-DD format")
+}
+
+func normalizeCheckbox(value string, required bool) (string, error) {
+	checked, err := strconv.ParseBool(value)
+	if err != nil {
+		return "", fmt.Errorf("must be true or false")
+	}
+	if required && !checked {
+		return "", fmt.Errorf("this box must be checked")
+	}
+	return strconv.FormatBool(checked), nil
+}
+
+// validateSignatureImage accepts a PNG or JPEG data URL such as the one produced by a canvas
+func validateSignatureImage(value string) error {
+	var encoded string
+	switch {
+	case strings.HasPrefix(value, "data:image/png;base64,"):
+		encoded = strings.TrimPrefix(value, "data:image/png;base64,")
+	case strings.HasPrefix(value, "data:image/jpeg;base64,"):
+		encoded = strings.TrimPrefix(value, "data:image/jpeg;base64,")
+	default:
+		return fmt.Errorf("signature must be a PNG or JPEG data URL")
+	}
+
+	if base64.StdEncoding.DecodedLen(len(encoded)) > maxSignatureImageSize {
+		return fmt.Errorf("signature image is too large")
+	}
+
+	imageData, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("signature image is not valid base64")
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(imageData))
+	if err != nil {
+		return fmt.Errorf("signature image could not be decoded")
+	}
+	if config.Width == 0 || config.Height == 0 {
+		return fmt.Errorf("signature image is empty")
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/base64"
+	"finalsign/internal/database"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func signatureDataURL(t *testing.T) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 2))); err != nil {
+		t.Fatalf("failed to encode test image: %v", err)
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestValidateFieldValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		field   database.TemplateField
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"text ok", database.TemplateField{FieldType: "text"}, "  hello ", "hello", false},
+		{"optional empty", database.TemplateField{FieldType: "text"}, "", "", false},
+		{"required empty", database.TemplateField{FieldType: "text", Required: true}, " ", "", true},
+		{"required via rules", database.TemplateField{FieldType: "text", ValidationRules: `{"required": true}`}, "", "", true},
+		{"min length", database.TemplateField{FieldType: "text", ValidationRules: `{"min_length": 3}`}, "ab", "", true},
+		{"max length", database.TemplateField{FieldType: "text", ValidationRules: `{"max_length": 3}`}, "abcd", "", true},
+		{"pattern ok", database.TemplateField{FieldType: "text", ValidationRules: `{"pattern": "^[A-Z]{2}[0-9]+$"}`}, "AB12", "AB12", false},
+		{"pattern mismatch", database.TemplateField{FieldType: "text", ValidationRules: `{"pattern": "^[A-Z]{2}[0-9]+$"}`}, "ab12", "", true},
+		{"email ok", database.TemplateField{FieldType: "email"}, "jane@example.com", "jane@example.com", false},
+		{"email bad", database.TemplateField{FieldType: "email"}, "jane@", "", true},
+		{"phone ok", database.TemplateField{FieldType: "phone"}, "+1 (555) 123-4567", "+1 (555) 123-4567", false},
+		{"phone too short", database.TemplateField{FieldType: "phone"}, "12345", "", true},
+		{"phone letters", database.TemplateField{FieldType: "phone"}, "555-CALL-NOW", "", true},
+		{"date ok", database.TemplateField{FieldType: "date"}, "2024-02-29", "2024-02-29", false},
+		{"date rfc3339", database.TemplateField{FieldType: "date"}, "2024-03-01T10:00:00Z", "2024-03-01", false},
+		{"date bad", database.TemplateField{FieldType: "date"}, "2023-02-29", "", true},
+		{"checkbox ok", database.TemplateField{FieldType: "checkbox"}, "TRUE", "true", false},
+		{"checkbox required unchecked", database.TemplateField{FieldType: "checkbox", Required: true}, "false", "", true},
+		{"checkbox bad", database.TemplateField{FieldType: "checkbox"}, "yes", "", true},
+		{"signature bad prefix", database.TemplateField{FieldType: "signature"}, "data:image/gif;base64,AAAA", "", true},
+		{"signature bad image", database.TemplateField{FieldType: "signature"}, "data:image/png;base64,AAAA", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validateFieldValue(tt.field, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateFieldValue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("validateFieldValue() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("signature ok", func(t *testing.T) {
+		dataURL := signatureDataURL(t)
+		got, err := validateFieldValue(database.TemplateField{FieldType: "signature", Required: true}, dataURL)
+		if err != nil {
+			t.Fatalf("validateFieldValue() error = %v", err)
+		}
+		if got != dataURL {
+			t.Errorf("validateFieldValue() altered the signature data URL")
+		}
+	})
+}
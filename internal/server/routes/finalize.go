@@ -0,0 +1,218 @@
+package routes
+
+import (
+	"context"
+	"encoding/base64"
+	"finalsign/internal/database"
+	"finalsign/internal/jobs"
+	"finalsign/internal/pdf"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// finalizeMaxAttempts is how many times a document's final PDF is tried before giving up
+	finalizeMaxAttempts = 10
+	finalizeBatchSize   = 10
+	finalizeBaseBackoff = time.Minute
+	finalizeMaxBackoff  = 6 * time.Hour
+	// finalizeTimeout bounds the attempt made when the last signer completes
+	finalizeTimeout = 2 * time.Minute
+)
+
+var finalizeBackoff = jobs.Backoff{Base: finalizeBaseBackoff, Max: finalizeMaxBackoff, MaxAttempts: finalizeMaxAttempts}
+
+// FinalizePending renders the final PDF of every completed document that is due one and returns
+// how many it attempted. Failures are retried with exponential backoff. It is meant to run as a
+// background job.
+func FinalizePending(ctx context.Context, server ServerInterface) (int, error) {
+	db := server.GetDB()
+	processed := 0
+	for {
+		claimed, err := db.ClaimPendingFinalizations(ctx, finalizeBatchSize)
+		if err != nil {
+			return processed, err
+		}
+
+		for _, pending := range claimed {
+			if err := attemptFinalization(ctx, server, pending); err != nil {
+				return processed, err
+			}
+			processed++
+		}
+
+		if len(claimed) < finalizeBatchSize || ctx.Err() != nil {
+			return processed, ctx.Err()
+		}
+	}
+}
+
+// tryFinalizeDocument makes one attempt at the final PDF of a document whose last signer has
+// just completed. It is detached from ctx's cancellation so a client that disconnects does not
+// abort the render; a failed attempt is left for FinalizePending to retry.
+func tryFinalizeDocument(ctx context.Context, server ServerInterface, documentID uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), finalizeTimeout)
+	defer cancel()
+
+	pending, err := server.GetDB().ClaimDocumentFinalization(ctx, documentID)
+	if err != nil || pending == nil {
+		return err
+	}
+	return attemptFinalization(ctx, server, *pending)
+}
+
+// attemptFinalization renders a claimed document and records a failure for retry. Only failures
+// to record the outcome are returned.
+func attemptFinalization(ctx context.Context, server ServerInterface, pending database.PendingFinalization) error {
+	err := finalizeDocument(ctx, server, pending.DocumentID)
+	if err == nil {
+		return nil
+	}
+
+	retryAt := finalizeBackoff.RetryAt(pending.Attempts, time.Now())
+	if retryAt == nil {
+		log.Printf("Finalizing document %s failed permanently after %d attempts: %v", pending.DocumentID, pending.Attempts, err)
+	} else {
+		log.Printf("Finalizing document %s failed, retrying at %s: %v", pending.DocumentID, retryAt.Format(time.RFC3339), err)
+	}
+	return server.GetDB().MarkFinalizationFailed(ctx, pending.DocumentID, fmt.Sprintf("attempt %d: %v", pending.Attempts, err), retryAt)
+}
+
+// finalizeDocument renders every submitted value onto the template PDF, appends a certificate
+// of completion, signs it with the platform key when one is configured, uploads the result as
+// the document's signed copy and records its hash. It is a no-op for documents that already
+// have a final PDF.
+func finalizeDocument(ctx context.Context, server ServerInterface, documentID uuid.UUID) error {
+	db := server.GetDB()
+	input, err := db.GetDocumentFinalizationInput(documentID)
+	if err != nil {
+		return err
+	}
+
+	if input.Document.FinalDocumentHash != nil {
+		return nil
+	}
+
+	fileStorage := server.GetStorage()
+	template, err := fileStorage.DownloadFile(ctx, input.TemplateS3Key)
+	if err != nil {
+		return fmt.Errorf("failed to download template: %w", err)
+	}
+
+	if err := fileStorage.ValidateFileIntegrity(template.Data, input.TemplatePDFHash); err != nil {
+		return fmt.Errorf("template failed integrity check: %w", err)
+	}
+
+	stamps := make([]pdf.Stamp, 0, len(input.Values))
+	for _, value := range input.Values {
+		position, err := pdf.ParsePosition(value.PositionData)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", value.FieldName, err)
+		}
+
+		plaintext, err := fileStorage.DecryptValue(ctx, value.EncryptedValue)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt field %s: %w", value.FieldName, err)
+		}
+
+		stamps = append(stamps, pdf.Stamp{
+			Position:  position,
+			FieldType: value.FieldType,
+			Value:     plaintext,
+		})
+	}
+
+	finalPDF, err := pdf.StampFields(template.Data, stamps)
+	if err != nil {
+		return fmt.Errorf("failed to render final document: %w", err)
+	}
+
+	document := input.Document
+
+	// The certificate is appended before signing so the signature covers it too
+	finalPDF, err = pdf.AppendPDF(finalPDF, pdf.RenderCertificate(completionCertificate(input)))
+	if err != nil {
+		return fmt.Errorf("failed to append certificate of completion: %w", err)
+	}
+
+	// Seal the document with the platform key so any later change is detectable
+	var signature *database.FinalSignature
+	if signer := server.GetPDFSigner(); signer != nil {
+		signedAt := time.Now().UTC()
+		if document.CompletedAt != nil {
+			signedAt = document.CompletedAt.UTC()
+		}
+
+		signed, err := signer.SignPDF(finalPDF, pdf.SignatureInfo{
+			Name:     "FinalSign",
+			Reason:   "Completed by all signers",
+			SignedAt: signedAt,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to sign final document: %w", err)
+		}
+
+		finalPDF = signed.Data
+		signature = &database.FinalSignature{
+			DigitalSignature:   base64.StdEncoding.EncodeToString(signed.Signature),
+			Certificate:        signer.CertificatePEM(),
+			SignatureAlgorithm: signer.Algorithm(),
+		}
+	}
+
+	uploadResult, err := fileStorage.UploadSignedDocument(ctx, finalPDF, document.CreatedBy, document.WorkspaceID, document.ID)
+	if err != nil {
+		return err
+	}
+
+	return db.RecordFinalDocument(document.ID, uploadResult.S3Bucket, uploadResult.S3Key, uploadResult.FileHash,
+		uploadResult.EncryptionKeyID, signature)
+}
+
+// completionCertificate lists a document's signers and audit trail for its certificate of completion
+func completionCertificate(input *database.FinalizationInput) pdf.CompletionCertificate {
+	document := input.Document
+	certificate := pdf.CompletionCertificate{
+		DocumentID:   document.ID.String(),
+		DocumentName: document.Name,
+		DocumentHash: input.TemplatePDFHash,
+		CreatedAt:    document.CreatedAt,
+	}
+	if document.CompletedAt != nil {
+		certificate.CompletedAt = *document.CompletedAt
+	}
+
+	for _, signer := range input.Signers {
+		certificate.Signers = append(certificate.Signers, pdf.CertificateSigner{
+			Order:       signer.SignerOrder,
+			Name:        signer.SignerName,
+			Email:       signer.SignerEmail,
+			Status:      signer.Status,
+			ViewedAt:    signer.ViewedAt,
+			CompletedAt: signer.CompletedAt,
+		})
+	}
+
+	for _, entry := range input.AuditTrail {
+		// Signer actions carry the signer's email; staff actions carry the user
+		actor := entry.UserEmail
+		if email, ok := entry.Details["signer_email"].(string); ok && email != "" {
+			actor = email
+		}
+
+		action := strings.ReplaceAll(entry.Action, "_", " ")
+		certificate.Events = append(certificate.Events, pdf.CertificateEvent{
+			Time:      entry.CreatedAt,
+			Action:    strings.ToUpper(action[:1]) + action[1:],
+			Actor:     actor,
+			IPAddress: entry.IPAddress,
+			UserAgent: entry.UserAgent,
+		})
+	}
+
+	return certificate
+}
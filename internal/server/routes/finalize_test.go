@@ -0,0 +1,89 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"finalsign/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// finalizationDB hands out claims and records failed attempts. Loading the document always
+// fails, standing in for a storage or KMS outage.
+type finalizationDB struct {
+	database.Service
+	pending []database.PendingFinalization
+	failed  map[uuid.UUID]*time.Time
+}
+
+func (db *finalizationDB) ClaimPendingFinalizations(ctx context.Context, limit int) ([]database.PendingFinalization, error) {
+	claimed := db.pending[:min(limit, len(db.pending))]
+	db.pending = db.pending[len(claimed):]
+	return claimed, nil
+}
+
+func (db *finalizationDB) ClaimDocumentFinalization(ctx context.Context, documentID uuid.UUID) (*database.PendingFinalization, error) {
+	return &database.PendingFinalization{DocumentID: documentID, Attempts: 1}, nil
+}
+
+func (db *finalizationDB) GetDocumentFinalizationInput(documentID uuid.UUID) (*database.FinalizationInput, error) {
+	return nil, fmt.Errorf("storage unavailable")
+}
+
+func (db *finalizationDB) MarkFinalizationFailed(ctx context.Context, documentID uuid.UUID, lastError string, retryAt *time.Time) error {
+	db.failed[documentID] = retryAt
+	return nil
+}
+
+func TestFinalizePendingReschedulesFailures(t *testing.T) {
+	retrying, exhausted := uuid.New(), uuid.New()
+	db := &finalizationDB{
+		pending: []database.PendingFinalization{
+			{DocumentID: retrying, Attempts: 2},
+			{DocumentID: exhausted, Attempts: finalizeMaxAttempts},
+		},
+		failed: map[uuid.UUID]*time.Time{},
+	}
+
+	processed, err := FinalizePending(context.Background(), &testServer{db: db})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if processed != 2 {
+		t.Errorf("processed = %d, want 2", processed)
+	}
+	if retryAt, ok := db.failed[retrying]; !ok || retryAt == nil {
+		t.Errorf("document with attempts left was not rescheduled")
+	}
+	if retryAt, ok := db.failed[exhausted]; !ok || retryAt != nil {
+		t.Errorf("document out of attempts was rescheduled for %v", retryAt)
+	}
+}
+
+func TestTryFinalizeDocumentOutlivesRequest(t *testing.T) {
+	db := &finalizationDB{failed: map[uuid.UUID]*time.Time{}}
+	documentID := uuid.New()
+
+	// The signer has already gone, but the failure is still recorded for the job to retry
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := tryFinalizeDocument(ctx, &testServer{db: db}, documentID); err != nil {
+		t.Fatal(err)
+	}
+	if retryAt := db.failed[documentID]; retryAt == nil {
+		t.Errorf("failed attempt was not rescheduled")
+	}
+}
+
+func TestFinalizeBackoff(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	if retryAt := finalizeBackoff.RetryAt(1, now); retryAt == nil || retryAt.Sub(now) != finalizeBaseBackoff {
+		t.Errorf("first retry at %v", retryAt)
+	}
+	if retryAt := finalizeBackoff.RetryAt(finalizeMaxAttempts, now); retryAt != nil {
+		t.Errorf("RetryAt(%d) = %v, want nil", finalizeMaxAttempts, retryAt)
+	}
+}
@@ -2,6 +2,7 @@ package routes
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
@@ -67,4 +68,42 @@ func (m *Middleware) WorkspaceMiddleware() gin.HandlerFunc {
 		c.Set("workspace", userWorkspace)
 		c.Next()
 	}
-}
\ No newline at end of file
+}
+
+// SignerMiddleware resolves the signer access token in the URL for unauthenticated signing routes
+func (m *Middleware) SignerMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accessToken := c.Param("accessToken")
+
+		db := m.server.GetDB()
+		session, err := db.GetSigningSessionByToken(accessToken)
+		if err != nil {
+			if strings.Contains(err.Error(), "cancelled") || strings.Contains(err.Error(), "declined") ||
+				strings.Contains(err.Error(), "expired") {
+				c.AbortWithStatusJSON(http.StatusGone, gin.H{"error": "This document is no longer available for signing"})
+				return
+			}
+			if strings.Contains(err.Error(), "not been sent") {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "This document has not been sent yet"})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Invalid or expired signing link"})
+			return
+		}
+
+		// Refuse out-of-turn access until the previous signer has completed
+		if session.WaitingOnSignerOrder != nil {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"error":                   "Waiting on previous signer",
+				"waiting_on_signer_order": *session.WaitingOnSignerOrder,
+			})
+			return
+		}
+
+		// Only FinalSign and the workspace's own application may frame the signing experience
+		c.Header("Content-Security-Policy", frameAncestorsPolicy(m.server.GetFrontendURL(), session.EmbedOrigins))
+
+		c.Set("signing_session", session)
+		c.Next()
+	}
+}
@@ -0,0 +1,387 @@
+package routes
+
+import (
+	"finalsign/internal/database"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SigningRoutes serve external signers who authenticate with their document access token
+// instead of a FinalSign account
+type SigningRoutes struct {
+	server ServerInterface
+}
+
+func NewSigningRoutes(server ServerInterface) *SigningRoutes {
+	return &SigningRoutes{server: server}
+}
+
+func (sr *SigningRoutes) RegisterRoutes(r *gin.Engine) {
+	// Create middleware instance
+	middleware := NewMiddleware(sr.server)
+
+	// Signing routes - authenticated by access token only
+	signing := r.Group("/sign/:accessToken")
+	signing.Use(middleware.SignerMiddleware())
+	{
+		signing.GET("", sr.getSigningSessionHandler)
+		signing.GET("/pdf", sr.getSigningDocumentPDFHandler)
+		signing.POST("/start", sr.startSigningHandler)
+		signing.PUT("/fields", sr.submitFieldsHandler)
+		signing.POST("/complete", sr.completeSigningHandler)
+		signing.POST("/decline", sr.declineSigningHandler)
+		signing.POST("/delegate", sr.delegateSigningHandler)
+	}
+}
+
+// getSigningSessionHandler returns the document and the fields assigned to this signer
+func (sr *SigningRoutes) getSigningSessionHandler(c *gin.Context) {
+	session := c.MustGet("signing_session").(*database.SigningSession)
+
+	db := sr.server.GetDB()
+	fields, err := db.GetTemplateFieldsForSigner(session.Signer.TemplateSignerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch signer fields"})
+		return
+	}
+
+	submissions, err := db.GetSignerFormSubmissions(session.Signer.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch submitted values"})
+		return
+	}
+
+	// Return previously saved values so the signer can resume where they left off
+	fileStorage := sr.server.GetStorage()
+	values := make(map[string]string)
+	for _, submission := range submissions {
+		if submission.EncryptedValue == nil {
+			continue
+		}
+		value, err := fileStorage.DecryptValue(c.Request.Context(), *submission.EncryptedValue)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decrypt submitted values"})
+			return
+		}
+		values[submission.FieldID.String()] = value
+	}
+
+	if session.Signer.Status == "pending" {
+		if err := db.MarkDocumentSignerViewed(session.Signer.ID, c.ClientIP(), c.Request.UserAgent()); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update signer status"})
+			return
+		}
+		session.Signer.Status = "viewed"
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"document": gin.H{
+			"id":         session.Document.ID,
+			"name":       session.Document.Name,
+			"status":     session.Document.Status,
+			"expires_at": session.Document.ExpiresAt,
+		},
+		"signer": gin.H{
+			"id":           session.Signer.ID,
+			"email":        session.Signer.SignerEmail,
+			"name":         session.Signer.SignerName,
+			"signer_order": session.Signer.SignerOrder,
+			"status":       session.Signer.Status,
+		},
+		"fields": fields,
+		"values": values,
+	})
+}
+
+// getSigningDocumentPDFHandler streams the decrypted template PDF to the signer
+func (sr *SigningRoutes) getSigningDocumentPDFHandler(c *gin.Context) {
+	session := c.MustGet("signing_session").(*database.SigningSession)
+
+	// A file that does not match its hash is cut off before the end rather than served whole
+	fileStorage := sr.server.GetStorage()
+	file, err := fileStorage.OpenFile(c.Request.Context(), session.TemplateS3Key, session.TemplatePDFHash)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to download document"})
+		return
+	}
+	defer file.Close()
+
+	allowLargeFileTransfer(c)
+	c.DataFromReader(http.StatusOK, file.Size(), "application/pdf", file, map[string]string{
+		"Content-Disposition": fmt.Sprintf("inline; filename=%q", session.Document.Name+".pdf"),
+		"Cache-Control":       "no-store",
+	})
+}
+
+// startSigningHandler marks the signer as in progress
+func (sr *SigningRoutes) startSigningHandler(c *gin.Context) {
+	session := c.MustGet("signing_session").(*database.SigningSession)
+
+	db := sr.server.GetDB()
+	err := db.StartDocumentSigner(session.Signer.ID)
+	if err != nil {
+		if strings.Contains(err.Error(), "already completed") {
+			c.JSON(http.StatusConflict, gin.H{"error": "You have already completed this document"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start signing"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Signing started", "status": "in_progress"})
+}
+
+type SubmitFieldsRequest struct {
+	Values []FieldValueRequest `json:"values" binding:"required"`
+}
+
+type FieldValueRequest struct {
+	FieldID string `json:"field_id"`
+	Value   string `json:"value"`
+}
+
+// submitFieldsHandler validates, encrypts and saves the signer's field values
+func (sr *SigningRoutes) submitFieldsHandler(c *gin.Context) {
+	session := c.MustGet("signing_session").(*database.SigningSession)
+
+	if session.Signer.Status == "completed" {
+		c.JSON(http.StatusConflict, gin.H{"error": "You have already completed this document"})
+		return
+	}
+
+	var req SubmitFieldsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	db := sr.server.GetDB()
+	fields, err := db.GetTemplateFieldsForSigner(session.Signer.TemplateSignerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch signer fields"})
+		return
+	}
+
+	fieldsByID := make(map[string]database.TemplateField)
+	for _, field := range fields {
+		fieldsByID[field.ID.String()] = field
+	}
+
+	fileStorage := sr.server.GetStorage()
+	ipAddress := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+
+	var submissions []database.FormSubmission
+	fieldErrors := make(map[string]string)
+	seen := make(map[string]bool)
+
+	for _, fieldValue := range req.Values {
+		field, exists := fieldsByID[fieldValue.FieldID]
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Field %s is not assigned to you", fieldValue.FieldID)})
+			return
+		}
+
+		if seen[fieldValue.FieldID] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Duplicate value for field %s", field.FieldName)})
+			return
+		}
+		seen[fieldValue.FieldID] = true
+
+		value, err := validateFieldValue(field, fieldValue.Value)
+		if err != nil {
+			fieldErrors[field.FieldName] = err.Error()
+			continue
+		}
+
+		var encryptedValue *string
+		var keyID string
+		if value != "" {
+			encrypted, valueKeyID, err := fileStorage.EncryptValue(c.Request.Context(), session.Document.WorkspaceID, value)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt field value"})
+				return
+			}
+			encryptedValue, keyID = &encrypted, valueKeyID
+		}
+
+		submissions = append(submissions, database.FormSubmission{
+			FieldID:         field.ID,
+			FieldName:       field.FieldName,
+			FieldType:       field.FieldType,
+			EncryptedValue:  encryptedValue,
+			EncryptionKeyID: keyID,
+			IPAddress:       ipAddress,
+			UserAgent:       userAgent,
+		})
+	}
+
+	if len(fieldErrors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":        "Some fields are invalid",
+			"field_errors": fieldErrors,
+		})
+		return
+	}
+
+	err = db.UpsertFormSubmissions(session.Signer.ID, submissions)
+	if err != nil {
+		if strings.Contains(err.Error(), "already completed") {
+			c.JSON(http.StatusConflict, gin.H{"error": "You have already completed this document"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save field values"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Field values saved",
+		"saved_count": len(submissions),
+	})
+}
+
+// completeSigningHandler marks the signer as completed once every required field is filled.
+// Signers who came through an embedded session get a redirect_url back to the host application.
+func (sr *SigningRoutes) completeSigningHandler(c *gin.Context) {
+	session := c.MustGet("signing_session").(*database.SigningSession)
+
+	db := sr.server.GetDB()
+	missing, err := db.GetMissingRequiredFields(session.Signer.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check required fields"})
+		return
+	}
+
+	if len(missing) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":          "Required fields are missing",
+			"missing_fields": missing,
+		})
+		return
+	}
+
+	progress, err := db.CompleteDocumentSigner(session.Signer.ID, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		if strings.Contains(err.Error(), "already completed") {
+			c.JSON(http.StatusConflict, gin.H{"error": "You have already completed this document or have not opened it yet"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete signing"})
+		return
+	}
+
+	// The signer is done either way; the finalize_documents job retries a failed render
+	if progress.DocumentCompleted {
+		if err := tryFinalizeDocument(c.Request.Context(), sr.server, progress.DocumentID); err != nil {
+			log.Printf("Failed to finalize document %s: %v", progress.DocumentID, err)
+		}
+	}
+
+	response := gin.H{
+		"message":            "Signing completed",
+		"status":             "completed",
+		"document_completed": progress.DocumentCompleted,
+	}
+	if session.EmbedReturnURL != "" {
+		response["redirect_url"] = embedRedirectURL(session.EmbedReturnURL, EmbedEventSigningComplete)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+type DeclineSigningRequest struct {
+	Reason string `json:"reason" binding:"required,max=1000"`
+}
+
+// declineSigningHandler lets the signer refuse to sign, which ends the document for everyone
+func (sr *SigningRoutes) declineSigningHandler(c *gin.Context) {
+	session := c.MustGet("signing_session").(*database.SigningSession)
+
+	var req DeclineSigningRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A reason for declining is required"})
+		return
+	}
+
+	db := sr.server.GetDB()
+	err := db.DeclineDocumentSigner(session.Signer.ID, reason, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		if strings.Contains(err.Error(), "already completed") || strings.Contains(err.Error(), "no longer awaiting") {
+			c.JSON(http.StatusConflict, gin.H{"error": "This document can no longer be declined"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decline document"})
+		return
+	}
+
+	response := gin.H{"message": "Document declined", "status": "declined"}
+	if session.EmbedReturnURL != "" {
+		response["redirect_url"] = embedRedirectURL(session.EmbedReturnURL, EmbedEventSigningDeclined)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+type DelegateSigningRequest struct {
+	Email  string `json:"email" binding:"required"`
+	Name   string `json:"name"`
+	Reason string `json:"reason" binding:"max=1000"`
+}
+
+// delegateSigningHandler hands the signer's part of the document to someone else. The new
+// signer is sent their own link and this signer's access token stops working.
+func (sr *SigningRoutes) delegateSigningHandler(c *gin.Context) {
+	session := c.MustGet("signing_session").(*database.SigningSession)
+
+	var req DelegateSigningRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if !signerEmailPattern.MatchString(email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid email address '%s'", req.Email)})
+		return
+	}
+
+	db := sr.server.GetDB()
+	signer, err := db.DelegateDocumentSigner(session.Signer.ID, email, req.Name, strings.TrimSpace(req.Reason),
+		c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "not allowed"):
+			c.JSON(http.StatusForbidden, gin.H{"error": "This document does not allow delegation"})
+		case strings.Contains(err.Error(), "already completed"), strings.Contains(err.Error(), "no longer awaiting"):
+			c.JSON(http.StatusConflict, gin.H{"error": "This document can no longer be delegated"})
+		case strings.Contains(err.Error(), "already a signer"), strings.Contains(err.Error(), "same as the current"):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delegate document"})
+		}
+		return
+	}
+
+	response := gin.H{
+		"message": "Document delegated",
+		"signer": gin.H{
+			"email": signer.SignerEmail,
+			"name":  signer.SignerName,
+		},
+	}
+	if session.EmbedReturnURL != "" {
+		response["redirect_url"] = embedRedirectURL(session.EmbedReturnURL, EmbedEventSigningDelegated)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,388 @@
+package routes
+
+import (
+	"errors"
+	"finalsign/internal/database"
+	"finalsign/internal/pdf"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Template versions: signers, fields and the PDF are edited on a draft, and documents are only
+// ever created from the published version. Publishing a draft leaves documents created from
+// earlier versions untouched.
+
+// workspaceTemplate loads the template in the URL and checks it belongs to the current workspace,
+// writing the error response when it does not
+func (tr *TemplateRoutes) workspaceTemplate(c *gin.Context) (*database.Template, bool) {
+	user := c.MustGet("user").(*database.User)
+	workspace := c.MustGet("workspace").(*database.UserWorkspace)
+
+	templateID, err := uuid.Parse(c.Param("templateID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template ID"})
+		return nil, false
+	}
+
+	db := tr.server.GetDB()
+	template, err := db.GetTemplateByID(templateID, user.ID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "access denied") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch template"})
+		return nil, false
+	}
+
+	if template.WorkspaceID != workspace.WorkspaceID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found in this workspace"})
+		return nil, false
+	}
+
+	return template, true
+}
+
+// respondTemplateVersionError maps template version errors to responses
+func respondTemplateVersionError(c *gin.Context, err error, fallback string) {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "insufficient permissions"):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions to modify template"})
+	case strings.Contains(msg, "template version not found"):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template version not found"})
+	case strings.Contains(msg, "no draft"):
+		c.JSON(http.StatusConflict, gin.H{"error": "Template has no unpublished draft"})
+	case strings.Contains(msg, "draft has no signers"):
+		c.JSON(http.StatusConflict, gin.H{"error": "Add at least one signer before publishing the draft"})
+	case strings.Contains(msg, "pages the template PDF"):
+		c.JSON(http.StatusConflict, gin.H{"error": msg + "; move or remove them before publishing"})
+	case strings.Contains(msg, "not in the template draft"):
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+	case strings.Contains(msg, "not found") || strings.Contains(msg, "access denied"):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+func (tr *TemplateRoutes) listTemplateVersionsHandler(c *gin.Context) {
+	user := c.MustGet("user").(*database.User)
+
+	template, ok := tr.workspaceTemplate(c)
+	if !ok {
+		return
+	}
+
+	db := tr.server.GetDB()
+	versions, err := db.ListTemplateVersions(template.ID, user.ID)
+	if err != nil {
+		respondTemplateVersionError(c, err, "Failed to fetch template versions")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"versions":          versions,
+		"published_version": template.Version,
+		"draft_version":     template.DraftVersion,
+	})
+}
+
+func (tr *TemplateRoutes) getTemplateVersionHandler(c *gin.Context) {
+	user := c.MustGet("user").(*database.User)
+
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version number"})
+		return
+	}
+
+	template, ok := tr.workspaceTemplate(c)
+	if !ok {
+		return
+	}
+
+	db := tr.server.GetDB()
+	templateVersion, err := db.GetTemplateVersion(template.ID, version, user.ID)
+	if err != nil {
+		respondTemplateVersionError(c, err, "Failed to fetch template version")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"version": templateVersion})
+}
+
+func (tr *TemplateRoutes) publishTemplateDraftHandler(c *gin.Context) {
+	user := c.MustGet("user").(*database.User)
+
+	template, ok := tr.workspaceTemplate(c)
+	if !ok {
+		return
+	}
+
+	db := tr.server.GetDB()
+	published, err := db.PublishTemplateDraft(template.ID, user.ID)
+	if err != nil {
+		respondTemplateVersionError(c, err, "Failed to publish template draft")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Template draft published successfully",
+		"version": published,
+	})
+}
+
+func (tr *TemplateRoutes) discardTemplateDraftHandler(c *gin.Context) {
+	user := c.MustGet("user").(*database.User)
+
+	template, ok := tr.workspaceTemplate(c)
+	if !ok {
+		return
+	}
+
+	db := tr.server.GetDB()
+	orphanedKey, err := db.DiscardTemplateDraft(template.ID, user.ID)
+	if err != nil {
+		respondTemplateVersionError(c, err, "Failed to discard template draft")
+		return
+	}
+
+	if orphanedKey != "" {
+		tr.server.GetStorage().DeleteFile(c.Request.Context(), orphanedKey)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Template draft discarded successfully"})
+}
+
+// replaceTemplatePDFHandler uploads a new PDF to the template's draft. Fields keep their layout;
+// those on pages the new PDF does not have are listed in the response and have to be moved
+// before the draft can be published. Set the "publish" form field to publish straight away.
+func (tr *TemplateRoutes) replaceTemplatePDFHandler(c *gin.Context) {
+	user := c.MustGet("user").(*database.User)
+
+	template, ok := tr.workspaceTemplate(c)
+	if !ok {
+		return
+	}
+
+	allowLargeFileTransfer(c)
+	err := c.Request.ParseMultipartForm(uploadMemoryLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form data"})
+		return
+	}
+
+	publish := c.PostForm("publish") == "true"
+
+	file, header, err := c.Request.FormFile("pdf")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "PDF file is required"})
+		return
+	}
+	defer file.Close()
+
+	if !strings.HasSuffix(strings.ToLower(header.Filename), ".pdf") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only PDF files are allowed"})
+		return
+	}
+
+	if header.Size == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is empty"})
+		return
+	}
+
+	pages, ok := inspectTemplatePDF(c, file)
+	if !ok {
+		return
+	}
+
+	fileStorage := tr.server.GetStorage()
+	uploadResult, err := fileStorage.UploadTemplate(c.Request.Context(), file, header, user.ID, template.WorkspaceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload PDF"})
+		return
+	}
+
+	db := tr.server.GetDB()
+	replacement, err := db.ReplaceTemplatePDF(template.ID, database.TemplatePDF{
+		S3Bucket:   uploadResult.S3Bucket,
+		S3Key:      uploadResult.S3Key,
+		PDFHash:    uploadResult.FileHash,
+		FileSize:   uploadResult.FileSize,
+		MimeType:   uploadResult.MimeType,
+		TotalPages: len(pages),
+		Pages:      pages,
+
+		EncryptionKeyID: uploadResult.EncryptionKeyID,
+	}, user.ID)
+	if err != nil {
+		// Clean up uploaded file if the draft could not be updated
+		fileStorage.DeleteFile(c.Request.Context(), uploadResult.S3Key)
+		respondTemplateVersionError(c, err, "Failed to replace template PDF")
+		return
+	}
+
+	// The old PDF is only deleted once the draft no longer references it
+	if replacement.OrphanedS3Key != "" {
+		fileStorage.DeleteFile(c.Request.Context(), replacement.OrphanedS3Key)
+	}
+
+	version := replacement.Version
+	message := "Template PDF replaced successfully. Publish the draft to use it for new documents."
+	if publish && len(replacement.FieldsOffPage) == 0 {
+		if version, err = db.PublishTemplateDraft(template.ID, user.ID); err != nil {
+			respondTemplateVersionError(c, err, "Template PDF was saved to the draft but it could not be published")
+			return
+		}
+		message = "Template PDF replaced and published successfully"
+	} else if len(replacement.FieldsOffPage) > 0 {
+		message = "Template PDF replaced, but some fields are on pages the new PDF does not have. Move or remove them before publishing the draft."
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         message,
+		"version":         version,
+		"fields_off_page": replacement.FieldsOffPage,
+	})
+}
+
+// getTemplatePDFHandler streams a template's decrypted PDF. Template PDFs are encrypted before
+// upload, so they cannot be handed out as presigned S3 URLs. Defaults to the published version;
+// ?version=N returns any other version, including the draft.
+func (tr *TemplateRoutes) getTemplatePDFHandler(c *gin.Context) {
+	user := c.MustGet("user").(*database.User)
+
+	template, ok := tr.workspaceTemplate(c)
+	if !ok {
+		return
+	}
+
+	s3Key, pdfHash := template.S3Key, template.PDFHash
+	if value := c.Query("version"); value != "" {
+		version, err := strconv.Atoi(value)
+		if err != nil || version < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version number"})
+			return
+		}
+
+		db := tr.server.GetDB()
+		templateVersion, err := db.GetTemplateVersion(template.ID, version, user.ID)
+		if err != nil {
+			respondTemplateVersionError(c, err, "Failed to fetch template version")
+			return
+		}
+		s3Key, pdfHash = templateVersion.S3Key, templateVersion.PDFHash
+	}
+
+	// The hash identifies the content, so a cached copy can be revalidated without a download
+	if match := c.GetHeader("If-None-Match"); match != "" && match == pdfETag(pdfHash) {
+		c.Header("ETag", pdfETag(pdfHash))
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	// The PDF is decrypted as it is sent. If it does not match its hash, a full response is cut off
+	// before the end, so a tampered file is never delivered whole. A range does not read the whole
+	// file, which that check needs, so the whole file is checked before any range is answered.
+	// Verified files are only remembered per process, so each API replica decrypts the whole PDF
+	// before answering its first range, and again once verifiedFileTTL passes. Each segment is
+	// authenticated on its own, but only the hash ties the stored file to this template version.
+	fileStorage := tr.server.GetStorage()
+	file, err := fileStorage.OpenFile(c.Request.Context(), s3Key, pdfHash)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to download template PDF"})
+		return
+	}
+	defer file.Close()
+
+	allowLargeFileTransfer(c)
+	if c.GetHeader("Range") != "" {
+		if err := file.Verify(); err != nil {
+			log.Printf("Template PDF %s failed verification: %v", s3Key, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to download template PDF"})
+			return
+		}
+	}
+
+	disposition := "inline"
+	if c.Query("download") == "true" {
+		disposition = "attachment"
+	}
+	servePDF(c, file, pdfHash, disposition, template.Name+".pdf")
+}
+
+// pdfETag is the strong ETag of a PDF with the given SHA-256 hash
+func pdfETag(hash string) string {
+	return `"` + hash + `"`
+}
+
+// servePDF writes a PDF with its ETag and answers Range and conditional requests, so viewers such
+// as PDF.js can load large documents a few pages at a time. Callers serving a storage.File must
+// call its Verify before answering a Range request.
+func servePDF(c *gin.Context, content io.ReadSeeker, hash, disposition, filename string) {
+	c.Header("Content-Type", "application/pdf")
+	c.Header("Content-Disposition", fmt.Sprintf("%s; filename=%q", disposition, filename))
+	c.Header("ETag", pdfETag(hash))
+	c.Header("Cache-Control", "private, no-cache")
+	http.ServeContent(c.Writer, c.Request, filename, time.Time{}, content)
+}
+
+// inspectTemplatePDF reads the pages of an uploaded template PDF and rewinds the file for upload,
+// writing the error response when the file is not a PDF that can be used as a template
+func inspectTemplatePDF(c *gin.Context, file multipart.File) ([]database.TemplatePage, bool) {
+	pdfPages, err := pdf.Inspect(file)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+
+	switch {
+	case errors.Is(err, pdf.ErrNotPDF):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is not a PDF"})
+	case errors.Is(err, pdf.ErrEncrypted):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password-protected PDFs are not supported. Remove the password and upload the file again."})
+	case errors.Is(err, pdf.ErrMalformed):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The PDF is damaged and could not be read"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+	default:
+		pages := make([]database.TemplatePage, len(pdfPages))
+		for i, page := range pdfPages {
+			pages[i] = database.TemplatePage{
+				Page:     page.Number,
+				Width:    page.Width,
+				Height:   page.Height,
+				Rotation: page.Rotation,
+				MediaBox: page.MediaBox,
+			}
+		}
+		return pages, true
+	}
+	return nil, false
+}
+
+// uploadMemoryLimit is how much of a multipart upload is held in memory; larger files are spooled
+// to a temporary file while the form is parsed and then streamed to storage
+const uploadMemoryLimit = 1 << 20
+
+// largeFileTimeout is how long an upload or download of a PDF may take. The server's timeouts
+// suit API calls, not a multi-hundred-megabyte scan over a slow connection.
+const largeFileTimeout = 10 * time.Minute
+
+// allowLargeFileTransfer extends the connection's deadlines for a file upload or download
+func allowLargeFileTransfer(c *gin.Context) {
+	deadline := time.Now().Add(largeFileTimeout)
+	controller := http.NewResponseController(c.Writer)
+	// Writers that do not support deadlines, such as test recorders, keep the server's timeouts
+	controller.SetReadDeadline(deadline)
+	controller.SetWriteDeadline(deadline)
+}
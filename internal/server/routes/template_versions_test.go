@@ -0,0 +1,165 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"finalsign/internal/database"
+	"finalsign/internal/pdf"
+	"finalsign/internal/storage"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// testServer serves handlers from in-memory storage and a database that only knows the
+// methods a test overrides
+type testServer struct {
+	db      database.Service
+	storage *storage.Service
+}
+
+func (s *testServer) GetDB() database.Service      { return s.db }
+func (s *testServer) GetStorage() *storage.Service { return s.storage }
+func (s *testServer) GetPDFSigner() *pdf.Signer    { return nil }
+func (s *testServer) GetFrontendURL() string       { return "https://finalsign.test" }
+
+type templateDB struct {
+	database.Service
+	template *database.Template
+}
+
+func (db *templateDB) GetTemplateByID(templateID uuid.UUID, userID int) (*database.Template, error) {
+	if templateID != db.template.ID {
+		return nil, fmt.Errorf("template not found or access denied")
+	}
+	return db.template, nil
+}
+
+func TestGetTemplatePDFHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cipher, err := storage.NewRandomCipher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring := storage.NewKeyring(storage.NewMasterKeys(cipher), storage.NewMemoryKeyRegistry())
+	fileStorage := storage.NewService(storage.NewMemoryStore(), keyring)
+
+	workspaceID := uuid.New()
+	data := []byte("%PDF-1.7 template")
+	upload, err := fileStorage.UploadSignedDocument(context.Background(), data, 1, workspaceID, uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &database.Template{
+		ID: uuid.New(), Name: "NDA", WorkspaceID: workspaceID, S3Key: upload.S3Key, PDFHash: upload.FileHash,
+	}
+
+	tr := NewTemplateRoutes(&testServer{db: &templateDB{template: template}, storage: fileStorage})
+	router := gin.New()
+	router.GET("/templates/:templateID/pdf", func(c *gin.Context) {
+		c.Set("user", &database.User{ID: 1})
+		c.Set("workspace", &database.UserWorkspace{WorkspaceID: workspaceID})
+	}, tr.getTemplatePDFHandler)
+
+	request := func(templateID uuid.UUID, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/templates/"+templateID.String()+"/pdf", nil)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request(template.ID, nil)
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), data) {
+		t.Fatalf("GET pdf = %d %q", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Disposition"); got != `inline; filename="NDA.pdf"` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+
+	w = request(template.ID, http.Header{"If-None-Match": {`"` + upload.FileHash + `"`}})
+	if w.Code != http.StatusNotModified {
+		t.Errorf("conditional GET = %d, want 304", w.Code)
+	}
+
+	if w = request(uuid.New(), nil); w.Code != http.StatusNotFound {
+		t.Errorf("unknown template = %d, want 404", w.Code)
+	}
+
+	w = request(template.ID, http.Header{"Range": {"bytes=0-7"}})
+	if w.Code != http.StatusPartialContent || w.Body.String() != "%PDF-1.7" {
+		t.Errorf("range request = %d %q", w.Code, w.Body.String())
+	}
+
+	// A file that no longer matches the stored hash is never served whole, and no range of it
+	// is served at all
+	template.PDFHash = storage.HashFile([]byte("something else"))
+	if w = request(template.ID, nil); bytes.Equal(w.Body.Bytes(), data) {
+		t.Errorf("tampered file was served whole")
+	}
+	w = request(template.ID, http.Header{"Range": {"bytes=0-7"}})
+	if w.Code != http.StatusInternalServerError || bytes.Contains(w.Body.Bytes(), data[:8]) {
+		t.Errorf("range of tampered file = %d %q, want 500", w.Code, w.Body.String())
+	}
+
+	// A missing file fails before anything is sent
+	template.S3Key = "templates/missing.pdf"
+	if w = request(template.ID, nil); w.Code != http.StatusInternalServerError {
+		t.Errorf("missing file = %d, want 500", w.Code)
+	}
+}
+
+func TestServePDF(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	data := []byte("%PDF-1.7 test document")
+	hash := "abc123"
+
+	serve := func(header http.Header) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/pdf", nil)
+		for key, values := range header {
+			c.Request.Header[key] = values
+		}
+		servePDF(c, bytes.NewReader(data), hash, "inline", "Contract.pdf")
+		// gin flushes the status of body-less responses once the handler returns
+		c.Writer.WriteHeaderNow()
+		return w
+	}
+
+	w := serve(nil)
+	if w.Code != http.StatusOK || w.Body.String() != string(data) {
+		t.Fatalf("full request = %d %q", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/pdf" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got := w.Header().Get("ETag"); got != `"abc123"` {
+		t.Errorf("ETag = %q", got)
+	}
+	if got := w.Header().Get("Content-Disposition"); got != `inline; filename="Contract.pdf"` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	if got := w.Header().Get("Accept-Ranges"); got != "bytes" {
+		t.Errorf("Accept-Ranges = %q", got)
+	}
+
+	w = serve(http.Header{"Range": {"bytes=0-7"}})
+	if w.Code != http.StatusPartialContent || w.Body.String() != "%PDF-1.7" {
+		t.Errorf("range request = %d %q", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Range"); got != "bytes 0-7/22" {
+		t.Errorf("Content-Range = %q", got)
+	}
+
+	w = serve(http.Header{"If-None-Match": {`"abc123"`}})
+	if w.Code != http.StatusNotModified {
+		t.Errorf("conditional request = %d, want 304", w.Code)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"finalsign/internal/database"
 	"fmt"
-	"io"
 	"net/http"
 	"strings"
 
@@ -36,14 +35,21 @@ func (tr *TemplateRoutes) RegisterRoutes(r *gin.Engine) {
 		templates.DELETE("/:templateID", tr.deactivateTemplateHandler)
 		templates.PUT("/:templateID/fields", tr.UpdateTemplateFieldsHandler)
 		templates.PUT("/:templateID/signers", tr.UpdateTemplateSignersHandler)
+		templates.GET("/:templateID/pdf", tr.getTemplatePDFHandler)
+		templates.PUT("/:templateID/pdf", tr.replaceTemplatePDFHandler)
+		templates.POST("/:templateID/publish", tr.publishTemplateDraftHandler)
+		templates.DELETE("/:templateID/draft", tr.discardTemplateDraftHandler)
+		templates.GET("/:templateID/versions", tr.listTemplateVersionsHandler)
+		templates.GET("/:templateID/versions/:version", tr.getTemplateVersionHandler)
 	}
 }
 
 type CreateTemplateRequest struct {
-	Document   string         `json:"document"`
-	TotalPages int            `json:"totalPages"`
-	Fields     []FieldRequest `json:"fields"`
-	Signers    []SignerRequest `json:"signers"`
+	Document        string          `json:"document"`
+	ParallelSigning bool            `json:"parallelSigning"`
+	AllowDelegation bool            `json:"allowDelegation"`
+	Fields          []FieldRequest  `json:"fields"`
+	Signers         []SignerRequest `json:"signers"`
 }
 
 type SignerRequest struct {
@@ -74,7 +80,8 @@ func (tr *TemplateRoutes) createTemplateHandler(c *gin.Context) {
 		return
 	}
 
-	err := c.Request.ParseMultipartForm(32 << 20) // 32 MB max
+	allowLargeFileTransfer(c)
+	err := c.Request.ParseMultipartForm(uploadMemoryLimit)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form data"})
 		return
@@ -116,19 +123,15 @@ func (tr *TemplateRoutes) createTemplateHandler(c *gin.Context) {
 	}
 
 	// Validate file content
-	fileBytes, err := io.ReadAll(file)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
-		return
-	}
-	if len(fileBytes) == 0 {
+	if header.Size == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "File is empty"})
 		return
 	}
 
-	// Reset file position for S3 upload
-	if seeker, ok := file.(io.Seeker); ok {
-		seeker.Seek(0, io.SeekStart)
+	// The page count and sizes come from the file itself, not from the client
+	pages, ok := inspectTemplatePDF(c, file)
+	if !ok {
+		return
 	}
 
 	// Parse template data JSON
@@ -140,15 +143,9 @@ func (tr *TemplateRoutes) createTemplateHandler(c *gin.Context) {
 		}
 	}
 
-	// Use totalPages from JSON, fallback to 1 if not provided
-	totalPages := 1
-	if templateReq.TotalPages > 0 {
-		totalPages = templateReq.TotalPages
-	}
-
 	// Upload to S3
-	s3Service := tr.server.GetS3Service()
-	uploadResult, err := s3Service.UploadTemplate(c.Request.Context(), file, header, user.ID, workspace.WorkspaceID)
+	fileStorage := tr.server.GetStorage()
+	uploadResult, err := fileStorage.UploadTemplate(c.Request.Context(), file, header, user.ID, workspace.WorkspaceID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload PDF"})
 		return
@@ -158,16 +155,16 @@ func (tr *TemplateRoutes) createTemplateHandler(c *gin.Context) {
 	signers, signerOrderToID, err := tr.convertAndValidateSigners(templateReq.Signers)
 	if err != nil {
 		// Clean up uploaded file if signer validation fails
-		s3Service.DeleteFile(c.Request.Context(), uploadResult.S3Key)
+		fileStorage.DeleteFile(c.Request.Context(), uploadResult.S3Key)
 		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid signers: %v", err)})
 		return
 	}
 
 	// Convert and validate fields
-	fields, err := tr.convertAndValidateFields(templateReq.Fields, signerOrderToID)
+	fields, err := tr.convertAndValidateFields(templateReq.Fields, signerOrderToID, len(pages))
 	if err != nil {
 		// Clean up uploaded file if field validation fails
-		s3Service.DeleteFile(c.Request.Context(), uploadResult.S3Key)
+		fileStorage.DeleteFile(c.Request.Context(), uploadResult.S3Key)
 		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid fields: %v", err)})
 		return
 	}
@@ -181,18 +178,23 @@ func (tr *TemplateRoutes) createTemplateHandler(c *gin.Context) {
 		PDFHash:     uploadResult.FileHash,
 		FileSize:    uploadResult.FileSize,
 		MimeType:    uploadResult.MimeType,
-		TotalPages:  totalPages,
+		TotalPages:  len(pages),
 		CreatedBy:   user.ID,
 		WorkspaceID: workspace.WorkspaceID,
 		IsActive:    true,
 		Version:     1,
+
+		ParallelSigning: templateReq.ParallelSigning,
+		AllowDelegation: templateReq.AllowDelegation,
+		EncryptionKeyID: uploadResult.EncryptionKeyID,
+		Pages:           pages,
 	}
 
 	db := tr.server.GetDB()
 	createdTemplate, err := db.CreateTemplateWithSignersAndFields(template, signers, fields)
 	if err != nil {
 		// Clean up uploaded file if database creation fails
-		s3Service.DeleteFile(c.Request.Context(), uploadResult.S3Key)
+		fileStorage.DeleteFile(c.Request.Context(), uploadResult.S3Key)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create template"})
 		return
 	}
@@ -200,14 +202,17 @@ func (tr *TemplateRoutes) createTemplateHandler(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Template created successfully",
 		"template": gin.H{
-			"id":           createdTemplate.ID,
-			"name":         createdTemplate.Name,
-			"description":  createdTemplate.Description,
-			"file_size":    createdTemplate.FileSize,
-			"total_pages":  createdTemplate.TotalPages,
-			"signer_count": len(signers),
-			"field_count":  len(fields),
-			"created_at":   createdTemplate.CreatedAt,
+			"id":               createdTemplate.ID,
+			"name":             createdTemplate.Name,
+			"description":      createdTemplate.Description,
+			"file_size":        createdTemplate.FileSize,
+			"total_pages":      createdTemplate.TotalPages,
+			"pages":            createdTemplate.Pages,
+			"parallel_signing": createdTemplate.ParallelSigning,
+			"allow_delegation": createdTemplate.AllowDelegation,
+			"signer_count":     len(signers),
+			"field_count":      len(fields),
+			"created_at":       createdTemplate.CreatedAt,
 		},
 	})
 }
@@ -264,7 +269,9 @@ func (tr *TemplateRoutes) convertAndValidateSigners(signerRequests []SignerReque
 }
 
 
-func (tr *TemplateRoutes) convertAndValidateFields(fieldRequests []FieldRequest, signerOrderToID map[int]uuid.UUID) ([]database.TemplateField, error) {
+// convertAndValidateFields checks fields against the template's signers and its PDF, which has
+// totalPages pages
+func (tr *TemplateRoutes) convertAndValidateFields(fieldRequests []FieldRequest, signerOrderToID map[int]uuid.UUID, totalPages int) ([]database.TemplateField, error) {
 	validFieldTypes := map[string]bool{
 		"text":      true,
 		"signature": true,
@@ -300,6 +307,11 @@ func (tr *TemplateRoutes) convertAndValidateFields(fieldRequests []FieldRequest,
 			return nil, fmt.Errorf("field at index %d references non-existent signer %d", i, req.Signer)
 		}
 
+		// Validate the page against the PDF's actual page count
+		if req.Page < 1 || req.Page > totalPages {
+			return nil, fmt.Errorf("field '%s' at index %d is on page %d but the PDF has %d pages", req.ID, i, req.Page, totalPages)
+		}
+
 		// Validate position data
 		if err := tr.validatePositionData(req.Position); err != nil {
 			return nil, fmt.Errorf("invalid position data for field '%s' at index %d: %v", req.ID, i, err)
@@ -359,9 +371,20 @@ func (tr *TemplateRoutes) validatePositionData(positionData map[string]interface
 		}
 	}
 
+	// Positions are fractions of the displayed page, so the field must fit on it
+	if positionData["x"].(float64)+positionData["width"].(float64) > 1+positionTolerance {
+		return fmt.Errorf("field extends past the right edge of the page")
+	}
+	if positionData["y"].(float64)+positionData["height"].(float64) > 1+positionTolerance {
+		return fmt.Errorf("field extends past the bottom edge of the page")
+	}
+
 	return nil
 }
 
+// positionTolerance allows for rounding in positions computed by the template editor
+const positionTolerance = 0.001
+
 
 func isValidHexColor(color string) bool {
 	if len(color) != 7 || color[0] != '#' {
@@ -447,8 +470,10 @@ func (tr *TemplateRoutes) updateTemplateHandler(c *gin.Context) {
 	}
 
 	var req struct {
-		Name        string `json:"name" binding:"required,min=1,max=255"`
-		Description string `json:"description" binding:"max=500"`
+		Name            string `json:"name" binding:"required,min=1,max=255"`
+		Description     string `json:"description" binding:"max=500"`
+		ParallelSigning *bool  `json:"parallel_signing"`
+		AllowDelegation *bool  `json:"allow_delegation"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -474,7 +499,7 @@ func (tr *TemplateRoutes) updateTemplateHandler(c *gin.Context) {
 		return
 	}
 
-	err = db.UpdateTemplate(templateID, req.Name, req.Description, user.ID)
+	err = db.UpdateTemplate(templateID, req.Name, req.Description, req.ParallelSigning, req.AllowDelegation, user.ID)
 	if err != nil {
 		if strings.Contains(err.Error(), "insufficient permissions") {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions to update template"})
@@ -544,6 +569,8 @@ func (tr *TemplateRoutes) UpdateTemplateFieldsHandler(c *gin.Context) {
 
 	var req struct {
 		Fields []FieldRequest `json:"fields" binding:"required"`
+		// Publish publishes the draft once the fields are saved
+		Publish bool `json:"publish"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -568,39 +595,44 @@ func (tr *TemplateRoutes) UpdateTemplateFieldsHandler(c *gin.Context) {
 		return
 	}
 
-	// Get existing signers to build the mapping
-	signers, err := db.GetTemplateSigners(templateID, user.ID)
+	// Fields are edited on the draft, or on a copy of the published version; map signer roles
+	// using the version being edited
+	editable, err := db.GetEditableTemplateVersion(templateID, user.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch template signers"})
 		return
 	}
 
 	signerOrderToID := make(map[int]uuid.UUID)
-	for _, signer := range signers {
+	for _, signer := range editable.Signers {
 		signerOrderToID[signer.SignerOrder] = signer.ID
 	}
 
 
-	fields, err := tr.convertAndValidateFields(req.Fields, signerOrderToID)
+	fields, err := tr.convertAndValidateFields(req.Fields, signerOrderToID, editable.TotalPages)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid fields: %v", err)})
 		return
 	}
 
-	// Replace all fields
-	err = db.ReplaceTemplateFields(templateID, fields, user.ID)
+	// Replace all fields on the draft
+	version, err := db.ReplaceTemplateFields(templateID, fields, user.ID)
 	if err != nil {
-		if strings.Contains(err.Error(), "insufficient permissions") {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions to modify template"})
+		respondTemplateVersionError(c, err, "Failed to update template fields")
+		return
+	}
+
+	if req.Publish {
+		if version, err = db.PublishTemplateDraft(templateID, user.ID); err != nil {
+			respondTemplateVersionError(c, err, "Template fields were saved to the draft but it could not be published")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update template fields"})
-		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":     "Template fields updated successfully",
 		"field_count": len(fields),
+		"version":     version,
 	})
 }
 
@@ -618,6 +650,8 @@ func (tr *TemplateRoutes) UpdateTemplateSignersHandler(c *gin.Context) {
 
 	var req struct {
 		Signers []SignerRequest `json:"signers" binding:"required"`
+		// Publish publishes the draft once the signers are saved
+		Publish bool `json:"publish"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -651,25 +685,29 @@ func (tr *TemplateRoutes) UpdateTemplateSignersHandler(c *gin.Context) {
 		return
 	}
 
-	err = db.ReplaceTemplateSigners(templateID, signers, user.ID)
+	version, err := db.ReplaceTemplateSigners(templateID, signers, user.ID)
 	if err != nil {
-		if strings.Contains(err.Error(), "insufficient permissions") {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions to modify template"})
-			return
-		}
 		if strings.Contains(err.Error(), "fields exist") {
 			c.JSON(http.StatusConflict, gin.H{
 				"error": "Cannot update signers while template has fields. Update fields first or use the complete template update endpoint.",
 			})
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update template signers"})
+		respondTemplateVersionError(c, err, "Failed to update template signers")
 		return
 	}
 
+	if req.Publish {
+		if version, err = db.PublishTemplateDraft(templateID, user.ID); err != nil {
+			respondTemplateVersionError(c, err, "Template signers were saved to the draft but it could not be published")
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message":      "Template signers updated successfully",
 		"signer_count": len(signers),
-		"note":         "All existing fields have been removed. Please update fields to reassign them to the new signers.",
+		"version":      version,
+		"note":         "All of the draft's fields have been removed. Please update fields to reassign them to the new signers.",
 	})
 }
\ No newline at end of file
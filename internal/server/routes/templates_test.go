@@ -0,0 +1,42 @@
+package routes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestConvertAndValidateFieldsChecksPages(t *testing.T) {
+	tr := &TemplateRoutes{}
+	signers := map[int]uuid.UUID{1: uuid.New()}
+	field := func(page int, x, width float64) FieldRequest {
+		return FieldRequest{
+			ID: "signature_1", Type: "signature", Page: page, Signer: 1,
+			Position: map[string]interface{}{"x": x, "y": 0.8, "width": width, "height": 0.05},
+		}
+	}
+
+	if _, err := tr.convertAndValidateFields([]FieldRequest{field(3, 0.1, 0.3)}, signers, 3); err != nil {
+		t.Errorf("field on the last page: %v", err)
+	}
+	if _, err := tr.convertAndValidateFields([]FieldRequest{field(1, 0.7, 0.3)}, signers, 3); err != nil {
+		t.Errorf("field touching the right edge: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		field FieldRequest
+		want  string
+	}{
+		{"past the last page", field(4, 0.1, 0.3), "on page 4 but the PDF has 3 pages"},
+		{"page 0", field(0, 0.1, 0.3), "on page 0"},
+		{"off the page", field(1, 0.8, 0.3), "right edge"},
+	}
+	for _, tt := range tests {
+		_, err := tr.convertAndValidateFields([]FieldRequest{tt.field}, signers, 3)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package routes
+
+import (
+	"encoding/hex"
+	"finalsign/internal/storage"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxVerifyFileSize = 32 << 20 // 32 MB, the same as template uploads
+	// Every verification is written to the audit log, so anonymous callers are limited per IP
+	verifyRateLimit  = 30
+	verifyRateWindow = time.Minute
+)
+
+// VerifyRoutes let anyone holding a PDF check that it is the final version of a document
+// completed on FinalSign, without an account
+type VerifyRoutes struct {
+	server  ServerInterface
+	limiter *rateLimiter
+}
+
+func NewVerifyRoutes(server ServerInterface) *VerifyRoutes {
+	return &VerifyRoutes{server: server, limiter: newRateLimiter(verifyRateLimit, verifyRateWindow)}
+}
+
+func (vr *VerifyRoutes) RegisterRoutes(r *gin.Engine) {
+	// Public - no authentication required
+	r.POST("/verify", vr.verifyDocumentHandler)
+}
+
+type VerifyDocumentRequest struct {
+	SHA256 string `json:"sha256" binding:"required"`
+}
+
+// verifyDocumentHandler accepts either a multipart upload of the PDF in "file" (or its hash in
+// "sha256"), or a JSON body with "sha256". Only the document name, completion time and masked
+// signer details are returned; nothing about the workspace is revealed.
+func (vr *VerifyRoutes) verifyDocumentHandler(c *gin.Context) {
+	if ok, wait := vr.limiter.allow(c.ClientIP()); !ok {
+		retryAfter := int(math.Ceil(wait.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       "Too many verification requests",
+			"retry_after": retryAfter,
+		})
+		return
+	}
+
+	var hash string
+
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxVerifyFileSize+1<<20)
+		if err := c.Request.ParseMultipartForm(maxVerifyFileSize); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form data; files must be 32 MB or less"})
+			return
+		}
+
+		file, header, err := c.Request.FormFile("file")
+		switch {
+		case err == nil:
+			defer file.Close()
+			if header.Size > maxVerifyFileSize {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "File must be 32 MB or less"})
+				return
+			}
+			data, err := io.ReadAll(file)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+				return
+			}
+			hash = storage.HashFile(data)
+		case c.PostForm("sha256") != "":
+			hash = c.PostForm("sha256")
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Upload the PDF as 'file' or provide its 'sha256' hash"})
+			return
+		}
+	} else {
+		var req VerifyDocumentRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Upload the PDF as 'file' or provide its 'sha256' hash"})
+			return
+		}
+		hash = req.SHA256
+	}
+
+	hash, ok := normalizeSHA256(hash)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sha256 must be a 64 character hex-encoded SHA-256 hash"})
+		return
+	}
+
+	db := vr.server.GetDB()
+	verification, err := db.VerifyDocumentHash(hash, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, gin.H{
+				"verified": false,
+				"sha256":   hash,
+				"error":    "No completed document matches this file",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify document"})
+		return
+	}
+
+	for i := range verification.Signers {
+		verification.Signers[i].Name = maskName(verification.Signers[i].Name)
+		verification.Signers[i].Email = maskEmail(verification.Signers[i].Email)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"verified": true,
+		"sha256":   hash,
+		"document": verification,
+	})
+}
+
+// normalizeSHA256 lower-cases a hex SHA-256 hash and reports whether it is well formed
+func normalizeSHA256(raw string) (string, bool) {
+	hash := strings.ToLower(strings.TrimSpace(raw))
+	if len(hash) != 64 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return "", false
+	}
+	return hash, true
+}
+
+// maskName keeps the first letter of each word: "Jane Doe" becomes "J*** D***"
+func maskName(name string) string {
+	words := strings.Fields(name)
+	for i, word := range words {
+		words[i] = string([]rune(word)[:1]) + "***"
+	}
+	return strings.Join(words, " ")
+}
+
+// maskEmail keeps the first letter of the mailbox and of the domain, and the top-level domain:
+// "jane.doe@example.com" becomes "j***@e***.com"
+func maskEmail(email string) string {
+	local, domain, found := strings.Cut(email, "@")
+	if !found || local == "" || domain == "" {
+		return "***"
+	}
+
+	maskedDomain := string([]rune(domain)[:1]) + "***"
+	if dot := strings.LastIndex(domain, "."); dot > 0 {
+		maskedDomain += domain[dot:]
+	}
+
+	return string([]rune(local)[:1]) + "***@" + maskedDomain
+}
+
+// rateLimiter counts requests per key in fixed windows. Counts are kept in memory, so each API
+// replica applies the limit separately.
+type rateLimiter struct {
+	limit  int
+	window time.Duration
+	now    func() time.Time
+
+	mu          sync.Mutex
+	windowStart time.Time
+	counts      map[string]int
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window, now: time.Now, counts: make(map[string]int)}
+}
+
+// allow counts a request for key. When the key is over its limit it returns false and how long
+// until the window resets.
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.windowStart) >= l.window {
+		l.windowStart = now
+		clear(l.counts)
+	}
+
+	if l.counts[key] >= l.limit {
+		return false, l.windowStart.Add(l.window).Sub(now)
+	}
+	l.counts[key]++
+	return true, 0
+}
@@ -0,0 +1,70 @@
+package routes
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaskSignerDetails(t *testing.T) {
+	names := map[string]string{
+		"Jane Doe":        "J*** D***",
+		"  Émile   Zola ": "É*** Z***",
+		"":                "",
+	}
+	for name, want := range names {
+		if got := maskName(name); got != want {
+			t.Errorf("maskName(%q) = %q, want %q", name, got, want)
+		}
+	}
+
+	emails := map[string]string{
+		"jane.doe@example.com": "j***@e***.com",
+		"a@mail.example.co.uk": "a***@m***.uk",
+		"root@localhost":       "r***@l***",
+		"not-an-email":         "***",
+	}
+	for email, want := range emails {
+		if got := maskEmail(email); got != want {
+			t.Errorf("maskEmail(%q) = %q, want %q", email, got, want)
+		}
+	}
+}
+
+func TestNormalizeSHA256(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+
+	if got, ok := normalizeSHA256(" " + strings.ToUpper(hash) + "\n"); !ok || got != hash {
+		t.Errorf("normalizeSHA256 = %q, %v, want %q", got, ok, hash)
+	}
+	for _, raw := range []string{"", hash[:62], hash + "00", strings.Repeat("zz", 32)} {
+		if _, ok := normalizeSHA256(raw); ok {
+			t.Errorf("normalizeSHA256(%q) accepted a malformed hash", raw)
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter := newRateLimiter(2, time.Minute)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := limiter.allow("203.0.113.1"); !ok {
+			t.Fatalf("request %d was limited", i+1)
+		}
+	}
+
+	now = now.Add(15 * time.Second)
+	if ok, wait := limiter.allow("203.0.113.1"); ok || wait != 45*time.Second {
+		t.Errorf("third request = %v, %s, want limited for 45s", ok, wait)
+	}
+	if ok, _ := limiter.allow("203.0.113.2"); !ok {
+		t.Error("another client was limited")
+	}
+
+	now = now.Add(45 * time.Second)
+	if ok, _ := limiter.allow("203.0.113.1"); !ok {
+		t.Error("limit did not reset with the window")
+	}
+}
@@ -0,0 +1,352 @@
+package routes
+
+import (
+	"errors"
+	"finalsign/internal/database"
+	"finalsign/internal/webhooks"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	maxWebhookDescriptionLength = 500
+	defaultWebhookDeliveryLimit = 50
+	maxWebhookDeliveryLimit     = 100
+)
+
+// WebhookRoutes let workspace owners and admins register endpoints that receive signed POSTs when
+// documents and memberships change, inspect each endpoint's delivery log and redeliver events.
+type WebhookRoutes struct {
+	server ServerInterface
+}
+
+func NewWebhookRoutes(server ServerInterface) *WebhookRoutes {
+	return &WebhookRoutes{server: server}
+}
+
+func (wr *WebhookRoutes) RegisterRoutes(r *gin.Engine) {
+	// Create middleware instance
+	middleware := NewMiddleware(wr.server)
+
+	webhooks := r.Group("/workspaces/:slug/webhooks", middleware.AuthMiddleware(), middleware.WorkspaceMiddleware())
+	{
+		webhooks.GET("", wr.listWebhooksHandler)
+		webhooks.POST("", wr.createWebhookHandler)
+		webhooks.GET("/events", wr.listWebhookEventTypesHandler)
+		webhooks.GET("/:webhookID", wr.getWebhookHandler)
+		webhooks.PUT("/:webhookID", wr.updateWebhookHandler)
+		webhooks.DELETE("/:webhookID", wr.deleteWebhookHandler)
+		webhooks.GET("/:webhookID/deliveries", wr.listWebhookDeliveriesHandler)
+		webhooks.POST("/:webhookID/deliveries/:deliveryID/redeliver", wr.redeliverWebhookHandler)
+	}
+}
+
+type CreateWebhookRequest struct {
+	URL         string   `json:"url" binding:"required"`
+	Description string   `json:"description"`
+	Events      []string `json:"events"` // empty subscribes to every event
+}
+
+type UpdateWebhookRequest struct {
+	URL          *string   `json:"url"`
+	Description  *string   `json:"description"`
+	Events       *[]string `json:"events"`
+	IsActive     *bool     `json:"is_active"`
+	RotateSecret bool      `json:"rotate_secret"`
+}
+
+// listWebhookEventTypesHandler returns the event types an endpoint can subscribe to
+func (wr *WebhookRoutes) listWebhookEventTypesHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"events": database.WebhookEventTypes})
+}
+
+func (wr *WebhookRoutes) listWebhooksHandler(c *gin.Context) {
+	user := c.MustGet("user").(*database.User)
+	workspace := c.MustGet("workspace").(*database.UserWorkspace)
+
+	db := wr.server.GetDB()
+	endpoints, err := db.ListWebhookEndpoints(workspace.WorkspaceID, user.ID)
+	if err != nil {
+		respondWebhookError(c, err, "Failed to fetch webhooks")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhooks": endpoints})
+}
+
+// createWebhookHandler registers an endpoint. The response is the only time the signing secret
+// is shown until it is rotated.
+func (wr *WebhookRoutes) createWebhookHandler(c *gin.Context) {
+	user := c.MustGet("user").(*database.User)
+	workspace := c.MustGet("workspace").(*database.UserWorkspace)
+
+	var req CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	endpoint := &database.WebhookEndpoint{WorkspaceID: workspace.WorkspaceID}
+	if err := applyWebhookFields(endpoint, &req.URL, &req.Description, &req.Events); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	db := wr.server.GetDB()
+	created, err := db.CreateWebhookEndpoint(endpoint, user.ID)
+	if err != nil {
+		respondWebhookError(c, err, "Failed to create webhook")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Webhook created",
+		"webhook": created,
+	})
+}
+
+func (wr *WebhookRoutes) getWebhookHandler(c *gin.Context) {
+	user := c.MustGet("user").(*database.User)
+	workspace := c.MustGet("workspace").(*database.UserWorkspace)
+
+	webhookID, err := uuid.Parse(c.Param("webhookID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	db := wr.server.GetDB()
+	endpoint, err := db.GetWebhookEndpoint(workspace.WorkspaceID, webhookID, user.ID)
+	if err != nil {
+		respondWebhookError(c, err, "Failed to fetch webhook")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhook": endpoint})
+}
+
+// updateWebhookHandler changes the fields present in the request. Setting rotate_secret
+// replaces the signing secret and returns the new one.
+func (wr *WebhookRoutes) updateWebhookHandler(c *gin.Context) {
+	user := c.MustGet("user").(*database.User)
+	workspace := c.MustGet("workspace").(*database.UserWorkspace)
+
+	webhookID, err := uuid.Parse(c.Param("webhookID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	var req UpdateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	db := wr.server.GetDB()
+	endpoint, err := db.GetWebhookEndpoint(workspace.WorkspaceID, webhookID, user.ID)
+	if err != nil {
+		respondWebhookError(c, err, "Failed to fetch webhook")
+		return
+	}
+
+	if err := applyWebhookFields(endpoint, req.URL, req.Description, req.Events); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.IsActive != nil {
+		endpoint.IsActive = *req.IsActive
+	}
+
+	updated, err := db.UpdateWebhookEndpoint(endpoint, req.RotateSecret, user.ID)
+	if err != nil {
+		respondWebhookError(c, err, "Failed to update webhook")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Webhook updated",
+		"webhook": updated,
+	})
+}
+
+func (wr *WebhookRoutes) deleteWebhookHandler(c *gin.Context) {
+	user := c.MustGet("user").(*database.User)
+	workspace := c.MustGet("workspace").(*database.UserWorkspace)
+
+	webhookID, err := uuid.Parse(c.Param("webhookID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	db := wr.server.GetDB()
+	if err := db.DeleteWebhookEndpoint(workspace.WorkspaceID, webhookID, user.ID); err != nil {
+		respondWebhookError(c, err, "Failed to delete webhook")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+}
+
+// listWebhookDeliveriesHandler returns the endpoint's most recent deliveries, newest first
+func (wr *WebhookRoutes) listWebhookDeliveriesHandler(c *gin.Context) {
+	user := c.MustGet("user").(*database.User)
+	workspace := c.MustGet("workspace").(*database.UserWorkspace)
+
+	webhookID, err := uuid.Parse(c.Param("webhookID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultWebhookDeliveryLimit)))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+		return
+	}
+	limit = min(limit, maxWebhookDeliveryLimit)
+
+	db := wr.server.GetDB()
+	deliveries, err := db.ListWebhookDeliveries(workspace.WorkspaceID, webhookID, user.ID, limit)
+	if err != nil {
+		respondWebhookError(c, err, "Failed to fetch webhook deliveries")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
+
+// redeliverWebhookHandler queues a delivery's event to be sent to the endpoint again
+func (wr *WebhookRoutes) redeliverWebhookHandler(c *gin.Context) {
+	user := c.MustGet("user").(*database.User)
+	workspace := c.MustGet("workspace").(*database.UserWorkspace)
+
+	webhookID, err := uuid.Parse(c.Param("webhookID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	deliveryID, err := uuid.Parse(c.Param("deliveryID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery ID"})
+		return
+	}
+
+	db := wr.server.GetDB()
+	delivery, err := db.RedeliverWebhook(workspace.WorkspaceID, webhookID, deliveryID, user.ID)
+	if err != nil {
+		respondWebhookError(c, err, "Failed to redeliver webhook")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":  "Webhook redelivery queued",
+		"delivery": delivery,
+	})
+}
+
+// respondWebhookError maps webhook database errors to responses
+func respondWebhookError(c *gin.Context, err error, fallback string) {
+	switch {
+	case strings.Contains(err.Error(), "insufficient permissions"):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only workspace owners and admins can manage webhooks"})
+	case strings.Contains(err.Error(), "does not have access"):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+	case strings.Contains(err.Error(), "webhook endpoint not found"):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+	case strings.Contains(err.Error(), "webhook delivery not found"):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// applyWebhookFields validates and copies the fields that were supplied onto the endpoint
+func applyWebhookFields(endpoint *database.WebhookEndpoint, rawURL, description *string, events *[]string) error {
+	if rawURL != nil {
+		webhookURL, err := parseWebhookURL(*rawURL)
+		if err != nil {
+			return err
+		}
+		endpoint.URL = webhookURL
+	}
+
+	if description != nil {
+		trimmed := strings.TrimSpace(*description)
+		if len(trimmed) > maxWebhookDescriptionLength {
+			return fmt.Errorf("description must be at most %d characters", maxWebhookDescriptionLength)
+		}
+		endpoint.Description = trimmed
+	}
+
+	if events != nil {
+		normalized, err := normalizeWebhookEvents(*events)
+		if err != nil {
+			return err
+		}
+		endpoint.Events = normalized
+	}
+
+	return nil
+}
+
+// parseWebhookURL checks that a webhook URL is absolute, uses https and does not name a private
+// address. The dispatcher checks the resolved address again when it connects. Plain http on
+// localhost is only allowed when webhooks.AllowPrivateNetworks is set for development.
+func parseWebhookURL(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" {
+		return "", errors.New("url must be an absolute URL")
+	}
+	if u.User != nil {
+		return "", errors.New("url must not contain credentials")
+	}
+
+	if webhooks.AllowPrivateNetworks() {
+		if _, err := urlOrigin(u); err != nil {
+			return "", fmt.Errorf("url %s", err)
+		}
+	} else {
+		if !strings.EqualFold(u.Scheme, "https") {
+			return "", errors.New("url must use https")
+		}
+		hostname := strings.ToLower(u.Hostname())
+		if addr, err := netip.ParseAddr(hostname); hostname == "localhost" || (err == nil && !webhooks.IsPublicAddress(addr)) {
+			return "", errors.New("url must not point to a private or loopback address")
+		}
+	}
+
+	u.Fragment = ""
+	return u.String(), nil
+}
+
+// normalizeWebhookEvents rejects unknown event types and drops duplicates
+func normalizeWebhookEvents(events []string) ([]string, error) {
+	known := make(map[string]bool, len(database.WebhookEventTypes))
+	for _, eventType := range database.WebhookEventTypes {
+		known[eventType] = true
+	}
+
+	normalized := make([]string, 0, len(events))
+	seen := make(map[string]bool)
+	for _, eventType := range events {
+		eventType = strings.TrimSpace(eventType)
+		if !known[eventType] {
+			return nil, fmt.Errorf("unknown event type '%s'", eventType)
+		}
+		if !seen[eventType] {
+			seen[eventType] = true
+			normalized = append(normalized, eventType)
+		}
+	}
+	return normalized, nil
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -11,34 +12,106 @@ import (
 	_ "github.com/joho/godotenv/autoload"
 
 	"finalsign/internal/database"
+	"finalsign/internal/jobs"
+	"finalsign/internal/mail"
+	"finalsign/internal/pdf"
+	"finalsign/internal/server/routes"
 	"finalsign/internal/storage"
+	"finalsign/internal/webhooks"
 )
 
 type Server struct {
 	port      int
 	db        database.Service
-	s3Service *storage.S3Service
+	storage   *storage.Service
+	pdfSigner *pdf.Signer
+	scheduler *jobs.Scheduler
 }
 
 func (s *Server) GetDB() database.Service {
 	return s.db
 }
 
-func (s *Server) GetS3Service() *storage.S3Service {
-	return s.s3Service
+// GetStorage returns the encrypted file storage for template PDFs and completed documents
+func (s *Server) GetStorage() *storage.Service {
+	return s.storage
 }
 
-func NewServer() *http.Server {
+// GetPDFSigner returns the platform signing key, or nil if none is configured
+func (s *Server) GetPDFSigner() *pdf.Signer {
+	return s.pdfSigner
+}
+
+// GetFrontendURL returns the base URL of the web app, used for links handed to users
+func (s *Server) GetFrontendURL() string {
+	return frontendURL()
+}
+
+// NewServer builds the HTTP server and starts the background scheduler.
+// Set SCHEDULER_DISABLED=true to run an API replica without background jobs.
+// The caller must stop the returned scheduler when shutting down.
+func NewServer() (*http.Server, *jobs.Scheduler) {
 	port, _ := strconv.Atoi(os.Getenv("PORT"))
-	s3Service, err := storage.NewS3Service()
+	db := database.New()
+	fileStorage, err := storage.NewServiceFromEnv(db)
 	if err != nil {
-		log.Fatalf("Failed to initialize S3 service: %v", err)
+		log.Fatalf("Failed to initialize file storage: %v", err)
+	}
+
+	pdfSigner, err := pdf.NewSignerFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load document signing key: %v", err)
+	}
+	if pdfSigner == nil {
+		log.Println("No document signing key configured; completed documents will not be digitally signed")
+	}
+
+	mailer, err := mail.NewMailerFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to initialize mailer: %v", err)
+	}
+	renderer, err := mail.NewRenderer(frontendURL())
+	if err != nil {
+		log.Fatalf("Failed to load email templates: %v", err)
+	}
+
+	dispatcher := mail.NewDispatcher(db, renderer, mailer)
+	webhookDispatcher := webhooks.NewDispatcher(db, nil)
+
+	backgroundJobs := append(jobs.MaintenanceJobs(db),
+		jobs.EmailDeliveryJob(dispatcher.DeliverPending),
+		jobs.WebhookDeliveryJob(webhookDispatcher.DeliverPending),
+	)
+	// Re-encrypting rewrites every stored file, so it only runs after a key rotation asks for it
+	if os.Getenv("STORAGE_REENCRYPT_OBJECTS") == "true" {
+		var pass storage.ReencryptionPass
+		backgroundJobs = append(backgroundJobs, jobs.ReencryptionJob(func(ctx context.Context) (int, error) {
+			// Items that failed are tried again once a pass over everything has finished
+			if pass.Done {
+				if pass.Failed > 0 {
+					log.Printf("Re-encryption pass finished with %d items still using an old key", pass.Failed)
+				}
+				pass = storage.ReencryptionPass{}
+			}
+			return fileStorage.ReencryptPending(ctx, db, &pass)
+		}))
 	}
 
 	NewServer := &Server{
 		port:      port,
-		db:        database.New(),
-		s3Service: s3Service,
+		db:        db,
+		storage:   fileStorage,
+		pdfSigner: pdfSigner,
+	}
+	backgroundJobs = append(backgroundJobs, jobs.FinalizationJob(func(ctx context.Context) (int, error) {
+		return routes.FinalizePending(ctx, NewServer)
+	}))
+	NewServer.scheduler = jobs.NewScheduler(db, backgroundJobs)
+
+	if os.Getenv("SCHEDULER_DISABLED") == "true" {
+		log.Println("Background scheduler disabled")
+	} else {
+		NewServer.scheduler.Start()
 	}
 
 	// Declare Server config
@@ -50,5 +123,13 @@ func NewServer() *http.Server {
 		WriteTimeout: 30 * time.Second,
 	}
 
-	return server
+	return server, NewServer.scheduler
+}
+
+// frontendURL is the base URL used for links in outgoing email
+func frontendURL() string {
+	if url := os.Getenv("FRONTEND_URL"); url != "" {
+		return url
+	}
+	return "https://finalsign.io"
 }
@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/google/uuid"
+)
+
+const awsKMSKeyIDPrefix = "aws-kms:"
+
+// AWSKMSProvider wraps data keys with a symmetric AWS KMS key. The workspace ID is passed as
+// encryption context. It talks to the KMS JSON API directly, so any KMS-compatible endpoint
+// such as local-kms works too.
+type AWSKMSProvider struct {
+	client      *http.Client
+	credentials aws.CredentialsProvider
+	signer      *v4.Signer
+	endpoint    string
+	region      string
+	keyARN      string
+}
+
+// NewAWSKMSProviderFromEnv uses the key in AWS_KMS_KEY_ID (a key ID, ARN or alias) with the
+// default AWS credentials. AWS_KMS_REGION falls back to AWS_REGION, and AWS_KMS_ENDPOINT_URL
+// points the provider at a local KMS stand-in.
+func NewAWSKMSProviderFromEnv(ctx context.Context) (*AWSKMSProvider, error) {
+	keyID := os.Getenv("AWS_KMS_KEY_ID")
+	if keyID == "" {
+		return nil, fmt.Errorf("AWS_KMS_KEY_ID environment variable is required")
+	}
+
+	region := os.Getenv("AWS_KMS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = "us-east-1" // default region
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	return NewAWSKMSProvider(ctx, cfg.Credentials, region, os.Getenv("AWS_KMS_ENDPOINT_URL"), keyID)
+}
+
+// NewAWSKMSProvider resolves keyID to the key's ARN, which becomes the provider's KeyID. An
+// empty endpoint uses the regional AWS endpoint.
+func NewAWSKMSProvider(ctx context.Context, credentials aws.CredentialsProvider, region, endpoint, keyID string) (*AWSKMSProvider, error) {
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://kms.%s.amazonaws.com", region)
+	}
+
+	p := &AWSKMSProvider{
+		client:      &http.Client{Timeout: 10 * time.Second},
+		credentials: credentials,
+		signer:      v4.NewSigner(),
+		endpoint:    strings.TrimSuffix(endpoint, "/"),
+		region:      region,
+	}
+
+	var described struct {
+		KeyMetadata struct {
+			Arn      string
+			KeyState string
+		}
+	}
+	if err := p.call(ctx, "DescribeKey", map[string]any{"KeyId": keyID}, &described); err != nil {
+		return nil, err
+	}
+	if described.KeyMetadata.KeyState != "Enabled" {
+		return nil, fmt.Errorf("KMS key %s is %s", described.KeyMetadata.Arn, described.KeyMetadata.KeyState)
+	}
+	p.keyARN = described.KeyMetadata.Arn
+
+	return p, nil
+}
+
+func (p *AWSKMSProvider) KeyID() string {
+	return awsKMSKeyIDPrefix + p.keyARN
+}
+
+func (p *AWSKMSProvider) Wrap(ctx context.Context, dataKey []byte, workspaceID uuid.UUID) ([]byte, error) {
+	var encrypted struct {
+		CiphertextBlob []byte
+	}
+	err := p.call(ctx, "Encrypt", map[string]any{
+		"KeyId":             p.keyARN,
+		"Plaintext":         dataKey,
+		"EncryptionContext": map[string]string{"workspace_id": workspaceID.String()},
+	}, &encrypted)
+	if err != nil {
+		return nil, err
+	}
+	return encrypted.CiphertextBlob, nil
+}
+
+func (p *AWSKMSProvider) Unwrap(ctx context.Context, masterKeyID string, wrappedKey []byte, workspaceID uuid.UUID) ([]byte, error) {
+	keyARN, found := strings.CutPrefix(masterKeyID, awsKMSKeyIDPrefix)
+	if !found {
+		return nil, fmt.Errorf("master key %s is not an AWS KMS key", masterKeyID)
+	}
+
+	var decrypted struct {
+		Plaintext []byte
+	}
+	err := p.call(ctx, "Decrypt", map[string]any{
+		"KeyId":             keyARN,
+		"CiphertextBlob":    wrappedKey,
+		"EncryptionContext": map[string]string{"workspace_id": workspaceID.String()},
+	}, &decrypted)
+	if err != nil {
+		return nil, err
+	}
+	return decrypted.Plaintext, nil
+}
+
+// call sends a signed request to the KMS JSON API. []byte fields are base64 encoded both ways,
+// as KMS expects.
+func (p *AWSKMSProvider) call(ctx context.Context, operation string, input, output any) error {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("failed to encode KMS request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create KMS request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+operation)
+
+	credentials, err := p.credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS credentials: %w", err)
+	}
+	payloadHash := sha256.Sum256(body)
+	err = p.signer.SignHTTP(ctx, credentials, req, hex.EncodeToString(payloadHash[:]), "kms", p.region, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to sign KMS request: %w", err)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("KMS %s request failed: %w", operation, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read KMS %s response: %w", operation, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		// KMS sends "message" or "Message"; decoding field names is case-insensitive
+		var kmsErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(respBody, &kmsErr)
+		return fmt.Errorf("KMS %s failed with status %d: %s %s", operation, resp.StatusCode, kmsErr.Type, kmsErr.Message)
+	}
+
+	if err := json.Unmarshal(respBody, output); err != nil {
+		return fmt.Errorf("failed to decode KMS %s response: %w", operation, err)
+	}
+	return nil
+}
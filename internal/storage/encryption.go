@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Cipher encrypts with a single AES-256-GCM key. Each ciphertext starts with its random nonce.
+// A Cipher is used directly as a master key, which wraps workspace data keys and reads files
+// written before data keys existed.
+type Cipher struct {
+	key  []byte // 32-byte AES-256 key
+	aead cipher.AEAD
+}
+
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes (64 hex characters)")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	return &Cipher{key: key, aead: gcm}, nil
+}
+
+// NewCipherFromEnv loads the key from DOCUMENT_ENCRYPTION_KEY
+func NewCipherFromEnv() (*Cipher, error) {
+	encryptionKeyHex := os.Getenv("DOCUMENT_ENCRYPTION_KEY")
+	if encryptionKeyHex == "" {
+		return nil, fmt.Errorf("DOCUMENT_ENCRYPTION_KEY environment variable is required (64 hex characters)")
+	}
+
+	encryptionKey, err := hex.DecodeString(encryptionKeyHex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key format: %w", err)
+	}
+
+	return NewCipher(encryptionKey)
+}
+
+// NewRandomCipher uses a fresh key, for data that does not outlive the process
+func NewRandomCipher() (*Cipher, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("failed to generate encryption key: %w", err)
+	}
+	return NewCipher(key)
+}
+
+// Encrypt encrypts data using AES-256-GCM
+func (c *Cipher) Encrypt(data []byte) ([]byte, error) {
+	return c.seal(data, nil)
+}
+
+// Decrypt decrypts data using AES-256-GCM
+func (c *Cipher) Decrypt(encryptedData []byte) ([]byte, error) {
+	return c.open(encryptedData, nil)
+}
+
+// seal encrypts data and binds it to additionalData, which open must be given to decrypt it
+func (c *Cipher) seal(data, additionalData []byte) ([]byte, error) {
+	// Generate a random nonce
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	return c.aead.Seal(nonce, nonce, data, additionalData), nil
+}
+
+func (c *Cipher) open(encryptedData, additionalData []byte) ([]byte, error) {
+	nonceSize := c.aead.NonceSize()
+	if len(encryptedData) < nonceSize {
+		return nil, fmt.Errorf("encrypted data too short")
+	}
+
+	// Extract nonce and ciphertext
+	nonce, ciphertext := encryptedData[:nonceSize], encryptedData[nonceSize:]
+
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+// EncryptValue encrypts a small value and returns it base64 encoded
+func (c *Cipher) EncryptValue(value string) (string, error) {
+	encryptedData, err := c.Encrypt([]byte(value))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(encryptedData), nil
+}
+
+// DecryptValue reverses EncryptValue
+func (c *Cipher) DecryptValue(encodedValue string) (string, error) {
+	encryptedData, err := base64.StdEncoding.DecodeString(encodedValue)
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value encoding: %w", err)
+	}
+
+	plaintext, err := c.Decrypt(encryptedData)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// KeyID returns a stable, non-secret identifier for the key
+func (c *Cipher) KeyID() string {
+	fingerprint := sha256.Sum256(c.key)
+	return "sha256:" + hex.EncodeToString(fingerprint[:8])
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// KeyProvider holds the master key that wraps workspace data keys. Wrapped keys are bound to
+// their workspace, so a wrapped key copied to another workspace does not unwrap.
+type KeyProvider interface {
+	// KeyID identifies the master key Wrap uses. It is stored with each wrapped data key.
+	KeyID() string
+	Wrap(ctx context.Context, dataKey []byte, workspaceID uuid.UUID) ([]byte, error)
+	// Unwrap reverses Wrap for a data key wrapped by masterKeyID, which may be an older
+	// version of the provider's key
+	Unwrap(ctx context.Context, masterKeyID string, wrappedKey []byte, workspaceID uuid.UUID) ([]byte, error)
+}
+
+// MasterKeys is the static KeyProvider: AES-256 keys from the environment. New keys are wrapped
+// with the current master key; the previous ones are kept to unwrap keys that have not been
+// rewrapped yet and to read legacy files.
+type MasterKeys struct {
+	current  *Cipher
+	previous []*Cipher
+}
+
+func NewMasterKeys(current *Cipher, previous ...*Cipher) *MasterKeys {
+	return &MasterKeys{current: current, previous: previous}
+}
+
+// MasterKeysFromEnv loads the current master key from DOCUMENT_ENCRYPTION_KEY and retired ones
+// from DOCUMENT_ENCRYPTION_PREVIOUS_KEYS, a comma-separated list of 64 hex character keys
+func MasterKeysFromEnv() (*MasterKeys, error) {
+	current, err := NewCipherFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	var previous []*Cipher
+	for _, keyHex := range strings.Split(os.Getenv("DOCUMENT_ENCRYPTION_PREVIOUS_KEYS"), ",") {
+		keyHex = strings.TrimSpace(keyHex)
+		if keyHex == "" {
+			continue
+		}
+		key, err := hex.DecodeString(keyHex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key in DOCUMENT_ENCRYPTION_PREVIOUS_KEYS: %w", err)
+		}
+		cipher, err := NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key in DOCUMENT_ENCRYPTION_PREVIOUS_KEYS: %w", err)
+		}
+		previous = append(previous, cipher)
+	}
+
+	return NewMasterKeys(current, previous...), nil
+}
+
+// KeyID identifies the master key new data keys are wrapped with
+func (m *MasterKeys) KeyID() string {
+	return m.current.KeyID()
+}
+
+func (m *MasterKeys) Wrap(ctx context.Context, dataKey []byte, workspaceID uuid.UUID) ([]byte, error) {
+	return m.current.seal(dataKey, workspaceID[:])
+}
+
+func (m *MasterKeys) Unwrap(ctx context.Context, masterKeyID string, wrappedKey []byte, workspaceID uuid.UUID) ([]byte, error) {
+	master := m.byID(masterKeyID)
+	if master == nil {
+		return nil, fmt.Errorf("unknown master key %s", masterKeyID)
+	}
+	return master.open(wrappedKey, workspaceID[:])
+}
+
+func (m *MasterKeys) all() []*Cipher {
+	return append([]*Cipher{m.current}, m.previous...)
+}
+
+func (m *MasterKeys) byID(keyID string) *Cipher {
+	for _, cipher := range m.all() {
+		if cipher.KeyID() == keyID {
+			return cipher
+		}
+	}
+	return nil
+}
+
+// KeyringFromEnv picks a KeyProvider from ENCRYPTION_KEY_PROVIDER: "static" (the default, using
+// DOCUMENT_ENCRYPTION_KEY), "aws-kms" or "vault-transit". With a KMS provider,
+// DOCUMENT_ENCRYPTION_KEY is optional and only reads data written before the switch.
+// DATA_KEY_CACHE_TTL overrides how long unwrapped data keys are cached (e.g. "5m").
+func KeyringFromEnv(ctx context.Context, registry KeyRegistry) (*Keyring, error) {
+	var legacy *MasterKeys
+	if os.Getenv("DOCUMENT_ENCRYPTION_KEY") != "" {
+		var err error
+		if legacy, err = MasterKeysFromEnv(); err != nil {
+			return nil, err
+		}
+	}
+
+	var provider KeyProvider
+	var err error
+	switch name := os.Getenv("ENCRYPTION_KEY_PROVIDER"); name {
+	case "", "static":
+		if legacy == nil {
+			return nil, fmt.Errorf("DOCUMENT_ENCRYPTION_KEY environment variable is required (64 hex characters)")
+		}
+		provider = legacy
+	case "aws-kms":
+		provider, err = NewAWSKMSProviderFromEnv(ctx)
+	case "vault-transit":
+		provider, err = NewVaultTransitProviderFromEnv(ctx)
+	default:
+		return nil, fmt.Errorf("unknown ENCRYPTION_KEY_PROVIDER %q", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	keyring := NewKeyring(provider, registry).WithLegacyKeys(legacy)
+	if value := os.Getenv("DATA_KEY_CACHE_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl < 0 {
+			log.Printf("Ignoring invalid DATA_KEY_CACHE_TTL=%q, using %s", value, DefaultKeyCacheTTL)
+		} else {
+			keyring.WithCacheTTL(ttl)
+		}
+	}
+	return keyring, nil
+}
@@ -0,0 +1,280 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/google/uuid"
+)
+
+const fakeKMSKeyARN = "arn:aws:kms:us-east-1:111122223333:key/finalsign"
+
+// fakeKMS speaks enough of the KMS JSON API for the provider, like local-kms does
+func fakeKMS(t *testing.T, decrypts *atomic.Int32) *httptest.Server {
+	master := mustRandomCipher(t)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		var input struct {
+			KeyID             string `json:"KeyId"`
+			Plaintext         []byte
+			CiphertextBlob    []byte
+			EncryptionContext map[string]string
+		}
+		json.NewDecoder(r.Body).Decode(&input)
+		aad := []byte(input.EncryptionContext["workspace_id"])
+
+		var output any
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.DescribeKey":
+			output = map[string]any{"KeyMetadata": map[string]string{"Arn": fakeKMSKeyARN, "KeyState": "Enabled"}}
+		case "TrentService.Encrypt":
+			blob, _ := master.seal(input.Plaintext, aad)
+			output = map[string]any{"CiphertextBlob": blob, "KeyId": fakeKMSKeyARN}
+		case "TrentService.Decrypt":
+			decrypts.Add(1)
+			plaintext, err := master.open(input.CiphertextBlob, aad)
+			if err != nil || input.KeyID != fakeKMSKeyARN {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"__type": "InvalidCiphertextException", "message": "bad"})
+				return
+			}
+			output = map[string]any{"Plaintext": plaintext, "KeyId": fakeKMSKeyARN}
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(output)
+	}))
+}
+
+func testKMSProvider(t *testing.T, decrypts *atomic.Int32) *AWSKMSProvider {
+	t.Helper()
+	server := fakeKMS(t, decrypts)
+	t.Cleanup(server.Close)
+
+	credentials := aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		return aws.Credentials{AccessKeyID: "test", SecretAccessKey: "test"}, nil
+	})
+	provider, err := NewAWSKMSProvider(context.Background(), credentials, "us-east-1", server.URL, "alias/finalsign")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+func TestAWSKMSProvider(t *testing.T) {
+	ctx := context.Background()
+	var decrypts atomic.Int32
+	provider := testKMSProvider(t, &decrypts)
+	if provider.KeyID() != "aws-kms:"+fakeKMSKeyARN {
+		t.Errorf("KeyID = %s", provider.KeyID())
+	}
+
+	workspaceID := uuid.New()
+	dataKey := []byte(strings.Repeat("k", 32))
+	wrapped, err := provider.Wrap(ctx, dataKey, workspaceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unwrapped, err := provider.Unwrap(ctx, provider.KeyID(), wrapped, workspaceID); err != nil || string(unwrapped) != string(dataKey) {
+		t.Errorf("Unwrap = %q, %v", unwrapped, err)
+	}
+	if _, err := provider.Unwrap(ctx, provider.KeyID(), wrapped, uuid.New()); err == nil {
+		t.Error("data key unwrapped for another workspace")
+	}
+	if _, err := provider.Unwrap(ctx, testCipher(t).KeyID(), wrapped, workspaceID); err == nil {
+		t.Error("unwrapped a key wrapped by a static master key")
+	}
+}
+
+func TestKeyringCachesUnwrappedKeys(t *testing.T) {
+	ctx := context.Background()
+	var decrypts atomic.Int32
+	provider := testKMSProvider(t, &decrypts)
+	registry := NewMemoryKeyRegistry()
+	workspaceID := uuid.New()
+
+	encrypted, _, err := NewKeyring(provider, registry).Encrypt(ctx, workspaceID, []byte("contract"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decrypts.Store(0)
+	keyring := NewKeyring(provider, registry)
+	for i := 0; i < 3; i++ {
+		if _, err := keyring.Decrypt(ctx, encrypted); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if decrypts.Load() != 1 {
+		t.Errorf("KMS was called %d times for one data key, want 1", decrypts.Load())
+	}
+
+	decrypts.Store(0)
+	uncached := NewKeyring(provider, registry).WithCacheTTL(0)
+	for i := 0; i < 2; i++ {
+		if _, err := uncached.Decrypt(ctx, encrypted); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if decrypts.Load() != 2 {
+		t.Errorf("KMS was called %d times without a cache, want 2", decrypts.Load())
+	}
+}
+
+func TestSwitchingFromStaticKeysToKMS(t *testing.T) {
+	ctx := context.Background()
+	var decrypts atomic.Int32
+	static := NewMasterKeys(testCipher(t))
+	registry := NewMemoryKeyRegistry()
+	workspaceID := uuid.New()
+
+	legacy, err := static.current.Encrypt([]byte("written before data keys"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, keyID, err := NewKeyring(static, registry).Encrypt(ctx, workspaceID, []byte("nda"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring := NewKeyring(testKMSProvider(t, &decrypts), registry).WithLegacyKeys(static)
+	for _, data := range [][]byte{legacy, encrypted} {
+		if _, err := keyring.Decrypt(ctx, data); err != nil {
+			t.Fatalf("Decrypt after switching providers: %v", err)
+		}
+	}
+
+	key, err := registry.GetDataKey(keyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped, err := keyring.Rewrap(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.keys[keyID].WrappedKey, registry.keys[keyID].MasterKeyID = wrapped, keyring.MasterKeyID()
+
+	// Once rewrapped, the static key is only needed for legacy data
+	kmsOnly := NewKeyring(keyring.provider, registry)
+	if plaintext, err := kmsOnly.Decrypt(ctx, encrypted); err != nil || string(plaintext) != "nda" {
+		t.Errorf("Decrypt after rewrap = %q, %v", plaintext, err)
+	}
+	if _, err := kmsOnly.Decrypt(ctx, legacy); err == nil {
+		t.Error("legacy data decrypted without a static key")
+	}
+}
+
+func TestVaultTransitProvider(t *testing.T) {
+	ctx := context.Background()
+	master := mustRandomCipher(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.test" {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string][]string{"errors": {"permission denied"}})
+			return
+		}
+
+		var input struct {
+			Plaintext      string `json:"plaintext"`
+			Ciphertext     string `json:"ciphertext"`
+			AssociatedData string `json:"associated_data"`
+		}
+		json.NewDecoder(r.Body).Decode(&input)
+		aad, _ := base64.StdEncoding.DecodeString(input.AssociatedData)
+
+		var data any
+		switch r.URL.Path {
+		case "/v1/transit/keys/finalsign":
+			data = map[string]int{"latest_version": 2}
+		case "/v1/transit/encrypt/finalsign":
+			plaintext, _ := base64.StdEncoding.DecodeString(input.Plaintext)
+			sealed, _ := master.seal(plaintext, aad)
+			data = map[string]string{"ciphertext": "vault:v2:" + base64.StdEncoding.EncodeToString(sealed)}
+		case "/v1/transit/decrypt/finalsign":
+			sealed, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(input.Ciphertext, "vault:v2:"))
+			plaintext, err := master.open(sealed, aad)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string][]string{"errors": {"cipher: message authentication failed"}})
+				return
+			}
+			data = map[string]string{"plaintext": base64.StdEncoding.EncodeToString(plaintext)}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}))
+	defer server.Close()
+
+	provider, err := NewVaultTransitProvider(ctx, server.URL, "s.test", "", "transit", "finalsign")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if provider.KeyID() != "vault-transit:transit/finalsign:v2" {
+		t.Errorf("KeyID = %s", provider.KeyID())
+	}
+
+	workspaceID := uuid.New()
+	wrapped, err := provider.Wrap(ctx, []byte("data key"), workspaceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Keys wrapped by an older version of the Transit key still unwrap
+	if unwrapped, err := provider.Unwrap(ctx, "vault-transit:transit/finalsign:v1", wrapped, workspaceID); err != nil || string(unwrapped) != "data key" {
+		t.Errorf("Unwrap = %q, %v", unwrapped, err)
+	}
+	if _, err := provider.Unwrap(ctx, provider.KeyID(), wrapped, uuid.New()); err == nil {
+		t.Error("data key unwrapped for another workspace")
+	}
+	if _, err := provider.Unwrap(ctx, "vault-transit:transit/other:v2", wrapped, workspaceID); err == nil {
+		t.Error("unwrapped a key from another Transit key")
+	}
+
+	if _, err := NewVaultTransitProvider(ctx, server.URL, "wrong", "", "transit", "finalsign"); err == nil ||
+		!strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("bad token error = %v", err)
+	}
+}
+
+func TestKeyringFromEnv(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("DOCUMENT_ENCRYPTION_KEY", "")
+	t.Setenv("ENCRYPTION_KEY_PROVIDER", "")
+	if _, err := KeyringFromEnv(ctx, NewMemoryKeyRegistry()); err == nil {
+		t.Error("static provider started without a key")
+	}
+
+	t.Setenv("DOCUMENT_ENCRYPTION_KEY", strings.Repeat("ab", 32))
+	t.Setenv("DATA_KEY_CACHE_TTL", "1m")
+	keyring, err := KeyringFromEnv(ctx, NewMemoryKeyRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyring.legacy == nil || keyring.cacheTTL.String() != "1m0s" {
+		t.Errorf("keyring = %+v", keyring)
+	}
+
+	t.Setenv("ENCRYPTION_KEY_PROVIDER", "vault-transit")
+	t.Setenv("VAULT_ADDR", "")
+	if _, err := KeyringFromEnv(ctx, NewMemoryKeyRegistry()); err == nil || !strings.Contains(err.Error(), "VAULT_ADDR") {
+		t.Errorf("missing VAULT_ADDR error = %v", err)
+	}
+
+	t.Setenv("ENCRYPTION_KEY_PROVIDER", "gcp")
+	if _, err := KeyringFromEnv(ctx, NewMemoryKeyRegistry()); err == nil {
+		t.Error("unknown provider accepted")
+	}
+}
@@ -0,0 +1,430 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"finalsign/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// Ciphertext written with a data key starts with a header naming the key:
+//
+//	"FSE" | version (1 byte) | data key ID (16 bytes) | nonce | AES-256-GCM ciphertext
+//
+// The header is authenticated as additional data. Form values use version 1; files are written in
+// segments with version 2 (see stream.go), and older files may still use version 1. Files and
+// values written before data keys existed have no header and are decrypted with the static
+// master keys directly.
+const (
+	envelopeMagic   = "FSE"
+	envelopeVersion = 1
+	envelopeHeader  = len(envelopeMagic) + 1 + 16
+)
+
+// DefaultKeyCacheTTL is how long unwrapped data keys stay in memory. It also bounds how long a
+// server keeps encrypting with a workspace's data key after rotate-keys retired it.
+const DefaultKeyCacheTTL = 10 * time.Minute
+
+// KeyRegistry stores wrapped workspace data keys. database.Service implements it.
+type KeyRegistry interface {
+	// GetActiveDataKey returns nil when the workspace has no active key
+	GetActiveDataKey(workspaceID uuid.UUID) (*database.WorkspaceDataKey, error)
+	// CreateDataKey returns the workspace's existing active key if it already has one
+	CreateDataKey(key *database.WorkspaceDataKey) (*database.WorkspaceDataKey, error)
+	GetDataKey(keyID uuid.UUID) (*database.WorkspaceDataKey, error)
+}
+
+// Keyring encrypts each workspace's data with that workspace's data key, creating the key the
+// first time the workspace stores something. Data keys are wrapped by the KeyProvider and kept
+// unwrapped in memory for the cache TTL, so most reads do not call the provider.
+type Keyring struct {
+	provider KeyProvider
+	registry KeyRegistry
+	// legacy reads data written before data keys existed, and unwraps data keys wrapped by a
+	// static master key before the provider was switched. It may be nil.
+	legacy   *MasterKeys
+	cacheTTL time.Duration
+
+	mu       sync.Mutex
+	dataKeys map[uuid.UUID]cachedDataKey
+	active   map[uuid.UUID]activeDataKey
+}
+
+type cachedDataKey struct {
+	cipher    *Cipher
+	expiresAt time.Time
+}
+
+type activeDataKey struct {
+	id        uuid.UUID
+	expiresAt time.Time
+}
+
+// NewKeyring wraps data keys with provider. When provider is a static MasterKeys it also reads
+// legacy data; other providers need WithLegacyKeys for that.
+func NewKeyring(provider KeyProvider, registry KeyRegistry) *Keyring {
+	legacy, _ := provider.(*MasterKeys)
+	return &Keyring{
+		provider: provider,
+		registry: registry,
+		legacy:   legacy,
+		cacheTTL: DefaultKeyCacheTTL,
+		dataKeys: make(map[uuid.UUID]cachedDataKey),
+		active:   make(map[uuid.UUID]activeDataKey),
+	}
+}
+
+// WithLegacyKeys sets the static master keys used for data written before data keys existed
+func (k *Keyring) WithLegacyKeys(masters *MasterKeys) *Keyring {
+	k.legacy = masters
+	return k
+}
+
+// WithCacheTTL changes how long unwrapped data keys are cached; zero disables the cache
+func (k *Keyring) WithCacheTTL(ttl time.Duration) *Keyring {
+	k.cacheTTL = ttl
+	return k
+}
+
+// MasterKeyID identifies the master key new data keys are wrapped with
+func (k *Keyring) MasterKeyID() string {
+	return k.provider.KeyID()
+}
+
+// Encrypt encrypts data with the workspace's active data key and returns the key's ID
+func (k *Keyring) Encrypt(ctx context.Context, workspaceID uuid.UUID, data []byte) ([]byte, uuid.UUID, error) {
+	keyID, cipher, err := k.activeKey(ctx, workspaceID)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+
+	header := make([]byte, 0, envelopeHeader)
+	header = append(header, envelopeMagic...)
+	header = append(header, envelopeVersion)
+	header = append(header, keyID[:]...)
+
+	sealed, err := cipher.seal(data, header)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+	return append(header, sealed...), keyID, nil
+}
+
+// Decrypt decrypts data written by Encrypt, or legacy data written with a static master key
+func (k *Keyring) Decrypt(ctx context.Context, encryptedData []byte) ([]byte, error) {
+	keyID, ok := envelopeKeyID(encryptedData)
+	if !ok {
+		return k.decryptLegacy(encryptedData)
+	}
+
+	plaintext, err := k.decryptEnvelope(ctx, keyID, encryptedData)
+	if err != nil {
+		// A legacy nonce can start with the header by chance
+		if legacy, legacyErr := k.decryptLegacy(encryptedData); legacyErr == nil {
+			return legacy, nil
+		}
+		return nil, err
+	}
+	return plaintext, nil
+}
+
+// EncryptStream encrypts src in segments of segmentSize bytes with the workspace's active data
+// key and returns the key's ID. src is read as the returned reader is read.
+func (k *Keyring) EncryptStream(ctx context.Context, workspaceID uuid.UUID, src io.Reader, segmentSize int) (io.Reader, uuid.UUID, error) {
+	keyID, cipher, err := k.activeKey(ctx, workspaceID)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+	return newSegmentEncrypter(src, cipher, streamHeader(keyID, segmentSize), segmentSize), keyID, nil
+}
+
+// DecryptStream decrypts a stored file of storedSize bytes and returns its plaintext size.
+// Files written by EncryptStream are decrypted as they are read; files written by Encrypt and
+// legacy files are decrypted in memory.
+func (k *Keyring) DecryptStream(ctx context.Context, src io.Reader, storedSize int64) (io.Reader, int64, error) {
+	header := make([]byte, streamHeaderSize)
+	n, err := io.ReadFull(src, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, 0, err
+	}
+	header = header[:n]
+
+	if keyID, segmentSize, ok := parseStreamHeader(header); ok {
+		cipher, err := k.dataKey(ctx, keyID)
+		if err == nil {
+			size, err := streamPlaintextSize(storedSize, segmentSize)
+			if err != nil {
+				return nil, 0, err
+			}
+			return newSegmentDecrypter(src, cipher, header, segmentSize), size, nil
+		}
+
+		// A legacy nonce can start with the header by chance
+		encryptedData, readErr := io.ReadAll(src)
+		if readErr != nil {
+			return nil, 0, readErr
+		}
+		plaintext, legacyErr := k.decryptLegacy(append(header, encryptedData...))
+		if legacyErr != nil {
+			return nil, 0, err
+		}
+		return bytes.NewReader(plaintext), int64(len(plaintext)), nil
+	}
+
+	encryptedData, err := io.ReadAll(src)
+	if err != nil {
+		return nil, 0, err
+	}
+	plaintext, err := k.Decrypt(ctx, append(header, encryptedData...))
+	if err != nil {
+		return nil, 0, err
+	}
+	return bytes.NewReader(plaintext), int64(len(plaintext)), nil
+}
+
+// KeyIDOf returns the data key data was encrypted with, or false for legacy data. data only
+// needs to hold the start of a file written by EncryptStream.
+func (k *Keyring) KeyIDOf(encryptedData []byte) (uuid.UUID, bool) {
+	if keyID, _, ok := parseStreamHeader(encryptedData); ok {
+		return keyID, true
+	}
+	return envelopeKeyID(encryptedData)
+}
+
+func envelopeKeyID(encryptedData []byte) (uuid.UUID, bool) {
+	if len(encryptedData) < envelopeHeader ||
+		!bytes.HasPrefix(encryptedData, []byte(envelopeMagic)) ||
+		encryptedData[len(envelopeMagic)] != envelopeVersion {
+		return uuid.Nil, false
+	}
+	keyID, err := uuid.FromBytes(encryptedData[len(envelopeMagic)+1 : envelopeHeader])
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return keyID, true
+}
+
+func (k *Keyring) decryptEnvelope(ctx context.Context, keyID uuid.UUID, encryptedData []byte) ([]byte, error) {
+	cipher, err := k.dataKey(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.open(encryptedData[envelopeHeader:], encryptedData[:envelopeHeader])
+}
+
+func (k *Keyring) decryptLegacy(encryptedData []byte) ([]byte, error) {
+	if k.legacy == nil {
+		return nil, fmt.Errorf("data has no key header and no static master key is configured")
+	}
+
+	var err error
+	for _, master := range k.legacy.all() {
+		var plaintext []byte
+		if plaintext, err = master.Decrypt(encryptedData); err == nil {
+			return plaintext, nil
+		}
+	}
+	return nil, err
+}
+
+// activeKey returns the workspace's active data key, creating it if the workspace has none
+func (k *Keyring) activeKey(ctx context.Context, workspaceID uuid.UUID) (uuid.UUID, *Cipher, error) {
+	k.mu.Lock()
+	cached, found := k.active[workspaceID]
+	if found && time.Now().Before(cached.expiresAt) {
+		if dataKey, found := k.dataKeys[cached.id]; found && time.Now().Before(dataKey.expiresAt) {
+			k.mu.Unlock()
+			return cached.id, dataKey.cipher, nil
+		}
+	}
+	k.mu.Unlock()
+
+	key, err := k.registry.GetActiveDataKey(workspaceID)
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
+	if key == nil {
+		if key, err = k.createDataKey(ctx, workspaceID); err != nil {
+			return uuid.Nil, nil, err
+		}
+	}
+
+	cipher, err := k.unwrap(ctx, key)
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
+
+	k.mu.Lock()
+	k.cache(key.ID, cipher)
+	k.active[workspaceID] = activeDataKey{id: key.ID, expiresAt: time.Now().Add(k.cacheTTL)}
+	k.mu.Unlock()
+
+	return key.ID, cipher, nil
+}
+
+func (k *Keyring) createDataKey(ctx context.Context, workspaceID uuid.UUID) (*database.WorkspaceDataKey, error) {
+	raw := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, raw); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	wrapped, err := k.provider.Wrap(ctx, raw, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	return k.registry.CreateDataKey(&database.WorkspaceDataKey{
+		WorkspaceID: workspaceID,
+		WrappedKey:  wrapped,
+		MasterKeyID: k.provider.KeyID(),
+	})
+}
+
+// dataKey returns an active or retired data key by ID
+func (k *Keyring) dataKey(ctx context.Context, keyID uuid.UUID) (*Cipher, error) {
+	k.mu.Lock()
+	cached, found := k.dataKeys[keyID]
+	k.mu.Unlock()
+	if found && time.Now().Before(cached.expiresAt) {
+		return cached.cipher, nil
+	}
+
+	key, err := k.registry.GetDataKey(keyID)
+	if err != nil {
+		return nil, err
+	}
+	cipher, err := k.unwrap(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	k.mu.Lock()
+	k.cache(keyID, cipher)
+	k.mu.Unlock()
+	return cipher, nil
+}
+
+// cache stores an unwrapped key and drops expired ones. k.mu must be held.
+func (k *Keyring) cache(keyID uuid.UUID, cipher *Cipher) {
+	now := time.Now()
+	for id, cached := range k.dataKeys {
+		if !now.Before(cached.expiresAt) {
+			delete(k.dataKeys, id)
+		}
+	}
+	if k.cacheTTL > 0 {
+		k.dataKeys[keyID] = cachedDataKey{cipher: cipher, expiresAt: now.Add(k.cacheTTL)}
+	}
+}
+
+func (k *Keyring) unwrap(ctx context.Context, key *database.WorkspaceDataKey) (*Cipher, error) {
+	raw, err := k.unwrapRaw(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return NewCipher(raw)
+}
+
+func (k *Keyring) unwrapRaw(ctx context.Context, key *database.WorkspaceDataKey) ([]byte, error) {
+	provider := k.provider
+	if k.legacy != nil && k.legacy.byID(key.MasterKeyID) != nil {
+		provider = k.legacy
+	}
+
+	raw, err := provider.Unwrap(ctx, key.MasterKeyID, key.WrappedKey, key.WorkspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key %s: %w", key.ID, err)
+	}
+	return raw, nil
+}
+
+// Rewrap returns the data key wrapped with the provider's current master key
+func (k *Keyring) Rewrap(ctx context.Context, key *database.WorkspaceDataKey) ([]byte, error) {
+	raw, err := k.unwrapRaw(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, err := k.provider.Wrap(ctx, raw, key.WorkspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key %s: %w", key.ID, err)
+	}
+	return wrapped, nil
+}
+
+// MemoryKeyRegistry keeps data keys in memory, for tests and the memory storage backend
+type MemoryKeyRegistry struct {
+	mu   sync.Mutex
+	keys map[uuid.UUID]*database.WorkspaceDataKey
+}
+
+func NewMemoryKeyRegistry() *MemoryKeyRegistry {
+	return &MemoryKeyRegistry{keys: make(map[uuid.UUID]*database.WorkspaceDataKey)}
+}
+
+func (r *MemoryKeyRegistry) GetActiveDataKey(workspaceID uuid.UUID) (*database.WorkspaceDataKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.activeKey(workspaceID), nil
+}
+
+func (r *MemoryKeyRegistry) activeKey(workspaceID uuid.UUID) *database.WorkspaceDataKey {
+	for _, key := range r.keys {
+		if key.WorkspaceID == workspaceID && key.Status == "active" {
+			copied := *key
+			return &copied
+		}
+	}
+	return nil
+}
+
+func (r *MemoryKeyRegistry) CreateDataKey(key *database.WorkspaceDataKey) (*database.WorkspaceDataKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing := r.activeKey(key.WorkspaceID); existing != nil {
+		return existing, nil
+	}
+
+	created := *key
+	created.ID = uuid.New()
+	created.Status = "active"
+	created.CreatedAt = time.Now()
+	r.keys[created.ID] = &created
+
+	copied := created
+	return &copied, nil
+}
+
+func (r *MemoryKeyRegistry) GetDataKey(keyID uuid.UUID) (*database.WorkspaceDataKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key, found := r.keys[keyID]
+	if !found {
+		return nil, fmt.Errorf("data key not found")
+	}
+	copied := *key
+	return &copied, nil
+}
+
+// RetireActiveDataKeys retires every active key, as rotate-keys -new-data-keys does
+func (r *MemoryKeyRegistry) RetireActiveDataKeys() (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	retired := 0
+	for _, key := range r.keys {
+		if key.Status == "active" {
+			now := time.Now()
+			key.Status = "retired"
+			key.RetiredAt = &now
+			retired++
+		}
+	}
+	return retired, nil
+}
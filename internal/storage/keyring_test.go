@@ -0,0 +1,312 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"finalsign/internal/database"
+
+	"github.com/google/uuid"
+)
+
+func TestKeyringUsesOneDataKeyPerWorkspace(t *testing.T) {
+	ctx := context.Background()
+	keyring := testKeyring(t)
+	first, second := uuid.New(), uuid.New()
+
+	encrypted, keyID, err := keyring.Encrypt(ctx, first, []byte("contract"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, ok := keyring.KeyIDOf(encrypted); !ok || id != keyID {
+		t.Errorf("KeyIDOf = %s, %v, want %s", id, ok, keyID)
+	}
+	if _, again, _ := keyring.Encrypt(ctx, first, []byte("other")); again != keyID {
+		t.Errorf("workspace got a second data key %s", again)
+	}
+	if _, other, _ := keyring.Encrypt(ctx, second, []byte("other")); other == keyID {
+		t.Error("two workspaces share a data key")
+	}
+
+	if plaintext, err := keyring.Decrypt(ctx, encrypted); err != nil || string(plaintext) != "contract" {
+		t.Errorf("Decrypt = %q, %v", plaintext, err)
+	}
+
+	tampered := append([]byte(nil), encrypted...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := keyring.Decrypt(ctx, tampered); err == nil {
+		t.Error("tampered ciphertext decrypted")
+	}
+}
+
+func TestKeyringReadsLegacyData(t *testing.T) {
+	ctx := context.Background()
+	previous, err := NewRandomCipher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := previous.Encrypt([]byte("written before data keys"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring := NewKeyring(NewMasterKeys(testCipher(t), previous), NewMemoryKeyRegistry())
+	if _, ok := keyring.KeyIDOf(legacy); ok {
+		t.Error("legacy data reported a data key")
+	}
+	if plaintext, err := keyring.Decrypt(ctx, legacy); err != nil || string(plaintext) != "written before data keys" {
+		t.Errorf("Decrypt = %q, %v", plaintext, err)
+	}
+
+	if _, err := testKeyring(t).Decrypt(ctx, legacy); err == nil {
+		t.Error("legacy data decrypted without its master key")
+	}
+}
+
+func TestMasterKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	oldMaster, newMaster := testCipher(t), mustRandomCipher(t)
+	registry := NewMemoryKeyRegistry()
+	workspaceID := uuid.New()
+
+	encrypted, keyID, err := NewKeyring(NewMasterKeys(oldMaster), registry).Encrypt(ctx, workspaceID, []byte("nda"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Until the data key is rewrapped, the old master key must still be configured
+	rotated := NewKeyring(NewMasterKeys(newMaster, oldMaster), registry)
+	if _, err := rotated.Decrypt(ctx, encrypted); err != nil {
+		t.Fatalf("Decrypt after rotation: %v", err)
+	}
+
+	key, err := registry.GetDataKey(keyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped, err := rotated.Rewrap(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.keys[keyID].WrappedKey, registry.keys[keyID].MasterKeyID = wrapped, rotated.MasterKeyID()
+
+	afterRewrap := NewKeyring(NewMasterKeys(newMaster), registry)
+	if plaintext, err := afterRewrap.Decrypt(ctx, encrypted); err != nil || string(plaintext) != "nda" {
+		t.Errorf("Decrypt after rewrap = %q, %v", plaintext, err)
+	}
+
+	// Retired data keys keep decrypting; new data gets a new key
+	if _, err := registry.RetireActiveDataKeys(); err != nil {
+		t.Fatal(err)
+	}
+	fresh := NewKeyring(NewMasterKeys(newMaster), registry)
+	if _, newKeyID, err := fresh.Encrypt(ctx, workspaceID, []byte("x")); err != nil || newKeyID == keyID {
+		t.Errorf("Encrypt after retiring = %s, %v", newKeyID, err)
+	}
+	if _, err := fresh.Decrypt(ctx, encrypted); err != nil {
+		t.Errorf("Decrypt with retired key: %v", err)
+	}
+}
+
+func TestMasterKeysFromEnv(t *testing.T) {
+	t.Setenv("DOCUMENT_ENCRYPTION_KEY", strings.Repeat("ab", 32))
+	t.Setenv("DOCUMENT_ENCRYPTION_PREVIOUS_KEYS", strings.Repeat("cd", 32)+", "+strings.Repeat("ef", 32))
+	masters, err := MasterKeysFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(masters.previous) != 2 {
+		t.Errorf("loaded %d previous keys, want 2", len(masters.previous))
+	}
+
+	t.Setenv("DOCUMENT_ENCRYPTION_PREVIOUS_KEYS", "not-hex")
+	if _, err := MasterKeysFromEnv(); err == nil {
+		t.Error("invalid previous key accepted")
+	}
+}
+
+// reencryptionQueue lists everything it holds until it is marked with the active key. Items must
+// be added in order.
+type reencryptionQueue struct {
+	objects []database.EncryptedObject
+	values  []database.EncryptedFormValue
+	prefill []database.EncryptedBulkSendPrefill
+	marked  map[string]string
+}
+
+func (q *reencryptionQueue) ListObjectsToReencrypt(after database.EncryptedObject, limit int) ([]database.EncryptedObject, error) {
+	var pending []database.EncryptedObject
+	for _, object := range q.objects {
+		if q.marked[object.S3Key] == "" && object.S3Key > after.S3Key && len(pending) < limit {
+			pending = append(pending, object)
+		}
+	}
+	return pending, nil
+}
+
+func (q *reencryptionQueue) MarkObjectReencrypted(object database.EncryptedObject, keyID string) error {
+	q.marked[object.S3Key] = keyID
+	return nil
+}
+
+func (q *reencryptionQueue) ListFormValuesToReencrypt(after uuid.UUID, limit int) ([]database.EncryptedFormValue, error) {
+	var pending []database.EncryptedFormValue
+	for _, value := range q.values {
+		if q.marked[value.ID.String()] == "" && value.ID.String() > after.String() && len(pending) < limit {
+			pending = append(pending, value)
+		}
+	}
+	return pending, nil
+}
+
+func (q *reencryptionQueue) UpdateFormValueEncryption(value database.EncryptedFormValue, encryptedValue, keyID string) error {
+	for i := range q.values {
+		if q.values[i].ID == value.ID {
+			q.values[i].EncryptedValue = encryptedValue
+		}
+	}
+	q.marked[value.ID.String()] = keyID
+	return nil
+}
+
+func (q *reencryptionQueue) ListBulkSendPrefillToReencrypt(after uuid.UUID, limit int) ([]database.EncryptedBulkSendPrefill, error) {
+	var pending []database.EncryptedBulkSendPrefill
+	for _, row := range q.prefill {
+		if q.marked[row.RowID.String()] == "" && row.RowID.String() > after.String() && len(pending) < limit {
+			pending = append(pending, row)
+		}
+	}
+	return pending, nil
+}
+
+func (q *reencryptionQueue) UpdateBulkSendPrefillEncryption(row database.EncryptedBulkSendPrefill, prefill []database.BulkSendPrefill) error {
+	for i := range q.prefill {
+		if q.prefill[i].RowID == row.RowID {
+			q.prefill[i].Prefill = prefill
+		}
+	}
+	q.marked[row.RowID.String()] = prefill[0].EncryptionKeyID
+	return nil
+}
+
+func TestReencryptPending(t *testing.T) {
+	ctx := context.Background()
+	master := testCipher(t)
+	store := NewMemoryStore()
+	workspaceID := uuid.New()
+
+	// A file and a value written with the master key before data keys existed
+	legacyFile, err := master.Encrypt([]byte("%PDF legacy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(ctx, "templates/legacy.pdf", bytes.NewReader(legacyFile), "application/pdf", nil); err != nil {
+		t.Fatal(err)
+	}
+	legacyValue, err := master.EncryptValue("Jane Doe")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewService(store, NewKeyring(NewMasterKeys(master), NewMemoryKeyRegistry()))
+	queue := &reencryptionQueue{
+		objects: []database.EncryptedObject{{Kind: "template_version", WorkspaceID: workspaceID, S3Key: "templates/legacy.pdf"}},
+		values:  []database.EncryptedFormValue{{ID: uuid.New(), WorkspaceID: workspaceID, EncryptedValue: legacyValue}},
+		prefill: []database.EncryptedBulkSendPrefill{{
+			RowID:       uuid.New(),
+			WorkspaceID: workspaceID,
+			Prefill:     []database.BulkSendPrefill{{FieldName: "full_name", EncryptedValue: legacyValue}},
+		}},
+		marked: make(map[string]string),
+	}
+
+	var pass ReencryptionPass
+	if count, err := service.ReencryptPending(ctx, queue, &pass); err != nil || count != 3 || !pass.Done || pass.Failed != 0 {
+		t.Fatalf("ReencryptPending = %d, %v, pass %+v, want 3", count, err, pass)
+	}
+	pass = ReencryptionPass{}
+	if count, err := service.ReencryptPending(ctx, queue, &pass); err != nil || count != 0 {
+		t.Fatalf("second ReencryptPending = %d, %v, want 0", count, err)
+	}
+
+	keyID, ok := service.keyring.KeyIDOf(readObject(t, store, "templates/legacy.pdf"))
+	if !ok || keyID.String() != queue.marked["templates/legacy.pdf"] {
+		t.Errorf("file key = %s, %v; marked %s", keyID, ok, queue.marked["templates/legacy.pdf"])
+	}
+	if download, err := service.DownloadFile(ctx, "templates/legacy.pdf"); err != nil || !bytes.Equal(download.Data, []byte("%PDF legacy")) {
+		t.Errorf("DownloadFile = %v", err)
+	}
+
+	encryptedValue, _ := base64.StdEncoding.DecodeString(queue.values[0].EncryptedValue)
+	if _, ok := service.keyring.KeyIDOf(encryptedValue); !ok {
+		t.Error("value was not moved to a data key")
+	}
+	if value, err := service.DecryptValue(ctx, queue.values[0].EncryptedValue); err != nil || value != "Jane Doe" {
+		t.Errorf("DecryptValue = %q, %v", value, err)
+	}
+
+	prefill := queue.prefill[0].Prefill[0]
+	if prefill.EncryptionKeyID == "" || prefill.EncryptedValue == legacyValue {
+		t.Errorf("prefill value was not moved to a data key: %+v", prefill)
+	}
+	if value, err := service.DecryptValue(ctx, prefill.EncryptedValue); err != nil || value != "Jane Doe" {
+		t.Errorf("DecryptValue(prefill) = %q, %v", value, err)
+	}
+}
+
+func TestReencryptPendingSkipsFailures(t *testing.T) {
+	ctx := context.Background()
+	master := testCipher(t)
+	store := NewMemoryStore()
+	workspaceID := uuid.New()
+
+	legacyFile, err := master.Encrypt([]byte("%PDF legacy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(ctx, "templates/legacy.pdf", bytes.NewReader(legacyFile), "application/pdf", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// More missing files than fit in a batch come before the one that can be re-encrypted
+	queue := &reencryptionQueue{marked: make(map[string]string)}
+	for i := 0; i < reencryptBatchSize+10; i++ {
+		key := fmt.Sprintf("templates/broken-%03d.pdf", i)
+		queue.objects = append(queue.objects, database.EncryptedObject{Kind: "template_version", WorkspaceID: workspaceID, S3Key: key})
+	}
+	queue.objects = append(queue.objects, database.EncryptedObject{Kind: "template_version", WorkspaceID: workspaceID, S3Key: "templates/legacy.pdf"})
+
+	service := NewService(store, NewKeyring(NewMasterKeys(master), NewMemoryKeyRegistry()))
+	var pass ReencryptionPass
+	total := 0
+	for calls := 0; !pass.Done; calls++ {
+		if calls == 5 {
+			t.Fatal("the pass never finished")
+		}
+		count, err := service.ReencryptPending(ctx, queue, &pass)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += count
+	}
+
+	if total != 1 || pass.Failed != reencryptBatchSize+10 {
+		t.Errorf("pass rewrote %d items with %d failures, want 1 and %d", total, pass.Failed, reencryptBatchSize+10)
+	}
+	if queue.marked["templates/legacy.pdf"] == "" {
+		t.Error("the file after the failures was not re-encrypted")
+	}
+}
+
+func mustRandomCipher(t *testing.T) *Cipher {
+	t.Helper()
+	cipher, err := NewRandomCipher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cipher
+}
@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// LocalStore keeps files in a directory on disk, using each key as a relative path. Use it in
+// development and single-node deployments. Metadata is not kept.
+type LocalStore struct {
+	dir string
+}
+
+func NewLocalStore(dir string) (*LocalStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	return &LocalStore{dir: dir}, nil
+}
+
+func (s *LocalStore) Bucket() string {
+	return "local"
+}
+
+// path maps a key to a file inside the store's directory, rejecting keys that would escape it
+func (s *LocalStore) path(key string) (string, error) {
+	name := filepath.FromSlash(key)
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(s.dir, name), nil
+}
+
+// Put writes the file through a temporary file, so readers never see a partial write
+func (s *LocalStore) Put(ctx context.Context, key string, body io.Reader, contentType string, metadata map[string]string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", key, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", key, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *LocalStore) Get(ctx context.Context, key string) (*Object, error) {
+	return s.GetRange(ctx, key, 0)
+}
+
+func (s *LocalStore) GetRange(ctx context.Context, key string, offset int64) (*Object, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+
+	info, err := file.Stat()
+	if err == nil {
+		_, err = file.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return &Object{Body: file, Size: max(info.Size()-offset, 0)}, nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *LocalStore) Exists(ctx context.Context, key string) (bool, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check %s: %w", key, err)
+	}
+	return true, nil
+}
+
+func (s *LocalStore) Presign(ctx context.Context, key string, expiration time.Duration) (string, error) {
+	return "", ErrPresignUnsupported
+}
+
+// MemoryStore keeps files in memory for tests
+type MemoryStore struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{files: make(map[string][]byte)}
+}
+
+func (s *MemoryStore) Bucket() string {
+	return "memory"
+}
+
+func (s *MemoryStore) Put(ctx context.Context, key string, body io.Reader, contentType string, metadata map[string]string) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[key] = data
+	return nil
+}
+
+// Get returns the file as it was when Get was called; later writes replace it without changing it
+func (s *MemoryStore) Get(ctx context.Context, key string) (*Object, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, found := s.files[key]
+	if !found {
+		return nil, ErrNotFound
+	}
+	return &Object{Body: io.NopCloser(bytes.NewReader(data)), Size: int64(len(data))}, nil
+}
+
+func (s *MemoryStore) GetRange(ctx context.Context, key string, offset int64) (*Object, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, found := s.files[key]
+	if !found {
+		return nil, ErrNotFound
+	}
+	data = data[min(offset, int64(len(data))):]
+	return &Object{Body: io.NopCloser(bytes.NewReader(data)), Size: int64(len(data))}, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.files, key)
+	return nil
+}
+
+func (s *MemoryStore) Exists(ctx context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, found := s.files[key]
+	return found, nil
+}
+
+func (s *MemoryStore) Presign(ctx context.Context, key string, expiration time.Duration) (string, error) {
+	return "", ErrPresignUnsupported
+}
@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+
+	"finalsign/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// reencryptBatchSize is how many files, form values and bulk send rows one ReencryptPending call
+// handles
+const reencryptBatchSize = 50
+
+// ReencryptionQueue lists stored data that is not encrypted with its workspace's active data key.
+// database.Service implements it.
+type ReencryptionQueue interface {
+	ListObjectsToReencrypt(after database.EncryptedObject, limit int) ([]database.EncryptedObject, error)
+	MarkObjectReencrypted(object database.EncryptedObject, keyID string) error
+	ListFormValuesToReencrypt(after uuid.UUID, limit int) ([]database.EncryptedFormValue, error)
+	UpdateFormValueEncryption(value database.EncryptedFormValue, encryptedValue, keyID string) error
+	ListBulkSendPrefillToReencrypt(after uuid.UUID, limit int) ([]database.EncryptedBulkSendPrefill, error)
+	UpdateBulkSendPrefillEncryption(row database.EncryptedBulkSendPrefill, prefill []database.BulkSendPrefill) error
+}
+
+// ReencryptFile rewrites a stored file with the workspace's active data key and returns the
+// key's ID. Files already streamed with that key are left alone.
+func (s *Service) ReencryptFile(ctx context.Context, workspaceID uuid.UUID, key string) (string, error) {
+	object, err := s.store.Get(ctx, key)
+	if err != nil {
+		return "", fmt.Errorf("failed to download file: %w", err)
+	}
+	defer object.Body.Close()
+
+	activeKeyID, _, err := s.keyring.activeKey(ctx, workspaceID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get workspace data key: %w", err)
+	}
+
+	body := bufio.NewReader(object.Body)
+	header, _ := body.Peek(streamHeaderSize)
+	if keyID, _, ok := parseStreamHeader(header); ok && keyID == activeKeyID {
+		return keyID.String(), nil
+	}
+
+	plain, _, err := s.keyring.DecryptStream(ctx, body, object.Size)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt file: %w", err)
+	}
+
+	// Every store keeps serving the old file to an open Get while it is replaced
+	result, err := s.upload(ctx, workspaceID, key, plain, map[string]string{
+		"workspace-id": workspaceID.String(),
+		"encrypted":    "true",
+	})
+	if err != nil {
+		return "", err
+	}
+	return result.EncryptionKeyID, nil
+}
+
+// ReencryptValue re-encrypts a value written by EncryptValue with the workspace's active data key
+func (s *Service) ReencryptValue(ctx context.Context, workspaceID uuid.UUID, encodedValue string) (string, string, error) {
+	value, err := s.DecryptValue(ctx, encodedValue)
+	if err != nil {
+		return "", "", err
+	}
+	return s.EncryptValue(ctx, workspaceID, value)
+}
+
+// ReencryptionPass is one walk over the data waiting to be re-encrypted. Items are listed in a
+// stable order after the last one seen, so an item that fails is skipped for the rest of the pass
+// instead of being listed again in every batch.
+type ReencryptionPass struct {
+	object      database.EncryptedObject
+	formValue   uuid.UUID
+	bulkSendRow uuid.UUID
+
+	// Failed counts the items that could not be re-encrypted; they still use an old key
+	Failed int
+	// Done is set once every item has been listed
+	Done bool
+}
+
+// ReencryptPending re-encrypts the next batch of files, form values and bulk send prefill values in
+// a pass that are not encrypted with their workspace's active data key, and returns how many it
+// rewrote. Items that fail are logged and counted in the pass.
+func (s *Service) ReencryptPending(ctx context.Context, queue ReencryptionQueue, pass *ReencryptionPass) (int, error) {
+	objects, err := queue.ListObjectsToReencrypt(pass.object, reencryptBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	reencrypted := 0
+	for _, object := range objects {
+		if err := ctx.Err(); err != nil {
+			return reencrypted, err
+		}
+		pass.object = object
+
+		keyID, err := s.ReencryptFile(ctx, object.WorkspaceID, object.S3Key)
+		if err != nil {
+			log.Printf("Failed to re-encrypt %s: %v", object.S3Key, err)
+			pass.Failed++
+			continue
+		}
+		if err := queue.MarkObjectReencrypted(object, keyID); err != nil {
+			return reencrypted, err
+		}
+		reencrypted++
+	}
+
+	values, err := queue.ListFormValuesToReencrypt(pass.formValue, reencryptBatchSize)
+	if err != nil {
+		return reencrypted, err
+	}
+
+	for _, value := range values {
+		pass.formValue = value.ID
+		encrypted, keyID, err := s.ReencryptValue(ctx, value.WorkspaceID, value.EncryptedValue)
+		if err != nil {
+			log.Printf("Failed to re-encrypt form value %s: %v", value.ID, err)
+			pass.Failed++
+			continue
+		}
+		if err := queue.UpdateFormValueEncryption(value, encrypted, keyID); err != nil {
+			return reencrypted, err
+		}
+		reencrypted++
+	}
+
+	// Bulk send rows hold prefilled values until the job turns them into form submissions
+	rows, err := queue.ListBulkSendPrefillToReencrypt(pass.bulkSendRow, reencryptBatchSize)
+	if err != nil {
+		return reencrypted, err
+	}
+
+	for _, row := range rows {
+		pass.bulkSendRow = row.RowID
+		prefill, err := s.reencryptPrefill(ctx, row)
+		if err != nil {
+			log.Printf("Failed to re-encrypt prefill values of bulk send row %s: %v", row.RowID, err)
+			pass.Failed++
+			continue
+		}
+		if err := queue.UpdateBulkSendPrefillEncryption(row, prefill); err != nil {
+			return reencrypted, err
+		}
+		reencrypted++
+	}
+
+	pass.Done = len(objects) < reencryptBatchSize && len(values) < reencryptBatchSize && len(rows) < reencryptBatchSize
+	return reencrypted, nil
+}
+
+// reencryptPrefill returns a bulk send row's prefilled values encrypted with the workspace's
+// active data key
+func (s *Service) reencryptPrefill(ctx context.Context, row database.EncryptedBulkSendPrefill) ([]database.BulkSendPrefill, error) {
+	prefill := make([]database.BulkSendPrefill, len(row.Prefill))
+	for i, value := range row.Prefill {
+		encrypted, keyID, err := s.ReencryptValue(ctx, row.WorkspaceID, value.EncryptedValue)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", value.FieldName, err)
+		}
+		value.EncryptedValue = encrypted
+		value.EncryptionKeyID = keyID
+		prefill[i] = value
+	}
+	return prefill, nil
+}
@@ -2,19 +2,11 @@
 package storage
 
 import (
-	"bytes"
 	"context"
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
-	"crypto/sha256"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
-	"mime/multipart"
 	"os"
-	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -23,35 +15,17 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
-	"github.com/google/uuid"
 )
 
+// S3Service is a Store backed by an S3 bucket, or MinIO when AWS_ENDPOINT_URL is set
 type S3Service struct {
-	client        *s3.Client
-	uploader      *manager.Uploader
-	downloader    *manager.Downloader
-	bucket        string
-	region        string
-	encryptionKey []byte // 32-byte AES-256 key
+	client   *s3.Client
+	uploader *manager.Uploader
+	bucket   string
+	region   string
 }
 
-type UploadResult struct {
-	S3Key      string
-	S3Bucket   string
-	FileHash   string // SHA-256 hash of original file
-	FileSize   int64
-	MimeType   string
-	UploadedAt time.Time
-}
-
-type DownloadResult struct {
-	Data     []byte
-	FileHash string
-	FileSize int64
-	MimeType string
-}
-
-// NewS3Service creates a new S3 service instance with MinIO support
+// NewS3Service creates a new S3 store instance with MinIO support
 func NewS3Service() (*S3Service, error) {
 	bucket := os.Getenv("AWS_S3_BUCKET")
 	if bucket == "" {
@@ -63,20 +37,6 @@ func NewS3Service() (*S3Service, error) {
 		region = "us-east-1" // default region
 	}
 
-	encryptionKeyHex := os.Getenv("DOCUMENT_ENCRYPTION_KEY")
-	if encryptionKeyHex == "" {
-		return nil, fmt.Errorf("DOCUMENT_ENCRYPTION_KEY environment variable is required (64 hex characters)")
-	}
-
-	encryptionKey, err := hex.DecodeString(encryptionKeyHex)
-	if err != nil {
-		return nil, fmt.Errorf("invalid encryption key format: %w", err)
-	}
-
-	if len(encryptionKey) != 32 {
-		return nil, fmt.Errorf("encryption key must be 32 bytes (64 hex characters)")
-	}
-
 	// Load AWS config with custom endpoint for MinIO
 	cfg, err := config.LoadDefaultConfig(context.TODO(),
 		config.WithRegion(region),
@@ -95,165 +55,76 @@ func NewS3Service() (*S3Service, error) {
 	})
 
 	return &S3Service{
-		client:        client,
-		uploader:      manager.NewUploader(client),
-		downloader:    manager.NewDownloader(client),
-		bucket:        bucket,
-		region:        region,
-		encryptionKey: encryptionKey,
+		client:   client,
+		uploader: manager.NewUploader(client),
+		bucket:   bucket,
+		region:   region,
 	}, nil
 }
 
-// UploadTemplate uploads a PDF template to S3 with encryption
-func (s *S3Service) UploadTemplate(ctx context.Context, file multipart.File, header *multipart.FileHeader, userID int, workspaceID uuid.UUID) (*UploadResult, error) {
-	// Validate file type
-	if !strings.HasSuffix(strings.ToLower(header.Filename), ".pdf") {
-		return nil, fmt.Errorf("only PDF files are allowed")
-	}
-
-	// Read file data
-	fileData, err := io.ReadAll(file)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %w", err)
-	}
-
-	// Reset file position for potential reuse
-	if seeker, ok := file.(io.Seeker); ok {
-		seeker.Seek(0, io.SeekStart)
-	}
-
-	// Calculate hash of original file
-	hash := sha256.Sum256(fileData)
-	fileHash := hex.EncodeToString(hash[:])
-
-	// Encrypt file data
-	encryptedData, err := s.encryptData(fileData)
-	if err != nil {
-		return nil, fmt.Errorf("failed to encrypt file: %w", err)
-	}
-
-	// Generate S3 key
-	templateID := uuid.New()
-	s3Key := fmt.Sprintf("templates/%d/%s/%s.pdf", userID, workspaceID.String(), templateID.String())
+func (s *S3Service) Bucket() string {
+	return s.bucket
+}
 
-	// Upload to S3
-	uploadInput := &s3.PutObjectInput{
-		Bucket:      aws.String(s.bucket),
-		Key:         aws.String(s3Key),
-		Body:        bytes.NewReader(encryptedData),
-		ContentType: aws.String("application/pdf"),
-		Metadata: map[string]string{
-			"original-filename": header.Filename,
-			"user-id":           fmt.Sprintf("%d", userID),
-			"workspace-id":      workspaceID.String(),
-			"template-id":       templateID.String(),
-			"original-hash":     fileHash,
-			"encrypted":         "true",
-		},
+// Put uploads an object to S3. Large bodies are sent as a multipart upload, one part at a time.
+func (s *S3Service) Put(ctx context.Context, key string, body io.Reader, contentType string, metadata map[string]string) error {
+	_, err := s.uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:               aws.String(s.bucket),
+		Key:                  aws.String(key),
+		Body:                 body,
+		ContentType:          aws.String(contentType),
+		Metadata:             metadata,
 		ServerSideEncryption: types.ServerSideEncryptionAes256, // Additional S3-level encryption
-	}
-
-	_, err = s.uploader.Upload(ctx, uploadInput)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to upload to S3: %w", err)
+		return fmt.Errorf("failed to upload to S3: %w", err)
 	}
-
-	return &UploadResult{
-		S3Key:      s3Key,
-		S3Bucket:   s.bucket,
-		FileHash:   fileHash,
-		FileSize:   int64(len(fileData)),
-		MimeType:   "application/pdf",
-		UploadedAt: time.Now().UTC(),
-	}, nil
+	return nil
 }
 
-// UploadSignedDocument uploads a completed/signed document to S3
-func (s *S3Service) UploadSignedDocument(ctx context.Context, documentData []byte, userID int, workspaceID uuid.UUID, documentID uuid.UUID) (*UploadResult, error) {
-	// Calculate hash of document
-	hash := sha256.Sum256(documentData)
-	fileHash := hex.EncodeToString(hash[:])
-
-	// Encrypt document data
-	encryptedData, err := s.encryptData(documentData)
-	if err != nil {
-		return nil, fmt.Errorf("failed to encrypt document: %w", err)
-	}
-
-	// Generate S3 key for signed document
-	s3Key := fmt.Sprintf("documents/%d/%s/%s-signed.pdf", userID, workspaceID.String(), documentID.String())
-
-	// Upload to S3
-	uploadInput := &s3.PutObjectInput{
-		Bucket:      aws.String(s.bucket),
-		Key:         aws.String(s3Key),
-		Body:        bytes.NewReader(encryptedData),
-		ContentType: aws.String("application/pdf"),
-		Metadata: map[string]string{
-			"user-id":       fmt.Sprintf("%d", userID),
-			"workspace-id":  workspaceID.String(),
-			"document-id":   documentID.String(),
-			"document-hash": fileHash,
-			"encrypted":     "true",
-			"document-type": "signed",
-		},
-		ServerSideEncryption: types.ServerSideEncryptionAes256,
-	}
-
-	_, err = s.uploader.Upload(ctx, uploadInput)
+// Get opens an object in S3 for streaming
+func (s *S3Service) Get(ctx context.Context, key string) (*Object, error) {
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to upload signed document to S3: %w", err)
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to download from S3: %w", err)
 	}
 
-	return &UploadResult{
-		S3Key:      s3Key,
-		S3Bucket:   s.bucket,
-		FileHash:   fileHash,
-		FileSize:   int64(len(documentData)),
-		MimeType:   "application/pdf",
-		UploadedAt: time.Now().UTC(),
-	}, nil
+	return &Object{Body: output.Body, Size: aws.ToInt64(output.ContentLength)}, nil
 }
 
-// DownloadFile downloads and decrypts a file from S3
-func (s *S3Service) DownloadFile(ctx context.Context, s3Key string) (*DownloadResult, error) {
-	// Create a buffer to write the downloaded data
-	buf := manager.NewWriteAtBuffer([]byte{})
-
-	// Download from S3
-	_, err := s.downloader.Download(ctx, buf, &s3.GetObjectInput{
+// GetRange opens an object in S3 from offset to its end
+func (s *S3Service) GetRange(ctx context.Context, key string, offset int64) (*Object, error) {
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(s.bucket),
-		Key:    aws.String(s3Key),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-", offset)),
 	})
 	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, ErrNotFound
+		}
 		return nil, fmt.Errorf("failed to download from S3: %w", err)
 	}
 
-	// Decrypt the data
-	decryptedData, err := s.decryptData(buf.Bytes())
-	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt file: %w", err)
-	}
-
-	// Calculate hash of decrypted data
-	hash := sha256.Sum256(decryptedData)
-	fileHash := hex.EncodeToString(hash[:])
-
-	return &DownloadResult{
-		Data:     decryptedData,
-		FileHash: fileHash,
-		FileSize: int64(len(decryptedData)),
-		MimeType: "application/pdf",
-	}, nil
+	return &Object{Body: output.Body, Size: aws.ToInt64(output.ContentLength)}, nil
 }
 
-// GeneratePresignedURL generates a presigned URL for temporary access (for previews, etc.)
-func (s *S3Service) GeneratePresignedURL(ctx context.Context, s3Key string, expiration time.Duration) (string, error) {
+// Presign generates a presigned URL for temporary access. Objects are stored encrypted, so the
+// URL serves ciphertext.
+func (s *S3Service) Presign(ctx context.Context, key string, expiration time.Duration) (string, error) {
 	presignClient := s3.NewPresignClient(s.client)
 
 	request, err := presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(s.bucket),
-		Key:    aws.String(s3Key),
+		Key:    aws.String(key),
 	}, func(opts *s3.PresignOptions) {
 		opts.Expires = expiration
 	})
@@ -265,11 +136,11 @@ func (s *S3Service) GeneratePresignedURL(ctx context.Context, s3Key string, expi
 	return request.URL, nil
 }
 
-// DeleteFile deletes a file from S3
-func (s *S3Service) DeleteFile(ctx context.Context, s3Key string) error {
+// Delete deletes an object from S3
+func (s *S3Service) Delete(ctx context.Context, key string) error {
 	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(s.bucket),
-		Key:    aws.String(s3Key),
+		Key:    aws.String(key),
 	})
 
 	if err != nil {
@@ -279,11 +150,11 @@ func (s *S3Service) DeleteFile(ctx context.Context, s3Key string) error {
 	return nil
 }
 
-// CheckFileExists checks if a file exists in S3
-func (s *S3Service) CheckFileExists(ctx context.Context, s3Key string) (bool, error) {
+// Exists checks if an object exists in S3
+func (s *S3Service) Exists(ctx context.Context, key string) (bool, error) {
 	_, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(s.bucket),
-		Key:    aws.String(s3Key),
+		Key:    aws.String(key),
 	})
 
 	if err != nil {
@@ -297,67 +168,3 @@ func (s *S3Service) CheckFileExists(ctx context.Context, s3Key string) (bool, er
 
 	return true, nil
 }
-
-// encryptData encrypts data using AES-256-GCM
-func (s *S3Service) encryptData(data []byte) ([]byte, error) {
-	block, err := aes.NewCipher(s.encryptionKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create cipher: %w", err)
-	}
-
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create GCM: %w", err)
-	}
-
-	// Generate a random nonce
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return nil, fmt.Errorf("failed to generate nonce: %w", err)
-	}
-
-	// Encrypt the data
-	ciphertext := gcm.Seal(nonce, nonce, data, nil)
-	return ciphertext, nil
-}
-
-// decryptData decrypts data using AES-256-GCM
-func (s *S3Service) decryptData(encryptedData []byte) ([]byte, error) {
-	block, err := aes.NewCipher(s.encryptionKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create cipher: %w", err)
-	}
-
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create GCM: %w", err)
-	}
-
-	nonceSize := gcm.NonceSize()
-	if len(encryptedData) < nonceSize {
-		return nil, fmt.Errorf("encrypted data too short")
-	}
-
-	// Extract nonce and ciphertext
-	nonce, ciphertext := encryptedData[:nonceSize], encryptedData[nonceSize:]
-
-	// Decrypt the data
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt data: %w", err)
-	}
-
-	return plaintext, nil
-}
-
-// ValidateFileIntegrity validates a file against its stored hash
-func (s *S3Service) ValidateFileIntegrity(data []byte, expectedHash string) error {
-	hash := sha256.Sum256(data)
-	actualHash := hex.EncodeToString(hash[:])
-
-	if actualHash != expectedHash {
-		return fmt.Errorf("file integrity check failed: expected %s, got %s", expectedHash, actualHash)
-	}
-
-	return nil
-}
@@ -0,0 +1,544 @@
+// Package storage keeps FinalSign's files: template PDFs and completed documents. Files are
+// encrypted with their workspace's data key before they reach a backend, so every Store only
+// ever holds ciphertext. Data keys are wrapped by a master key and kept in a KeyRegistry.
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"mime/multipart"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrNotFound is returned by a Store when the key does not exist
+var ErrNotFound = errors.New("file not found")
+
+// ErrPresignUnsupported is returned by stores that cannot hand out direct download URLs
+var ErrPresignUnsupported = errors.New("presigned URLs are not supported by this storage backend")
+
+// Store is a storage backend. It stores bytes exactly as given; encryption is done by Service.
+// Files are streamed in and out, so a store must not buffer whole files in memory.
+type Store interface {
+	Put(ctx context.Context, key string, body io.Reader, contentType string, metadata map[string]string) error
+	// Get opens a stored file; the caller must close its body
+	Get(ctx context.Context, key string) (*Object, error)
+	// GetRange opens a stored file from offset to its end; the caller must close its body
+	GetRange(ctx context.Context, key string, offset int64) (*Object, error)
+	Delete(ctx context.Context, key string) error
+	Exists(ctx context.Context, key string) (bool, error)
+	// Presign returns a temporary URL to download the stored bytes directly
+	Presign(ctx context.Context, key string, expiration time.Duration) (string, error)
+	// Bucket names where the store keeps files; it is recorded next to each key
+	Bucket() string
+}
+
+// Object is a stored file being read from a Store
+type Object struct {
+	Body io.ReadCloser
+	Size int64
+}
+
+// Service encrypts files on the way into a Store and decrypts them on the way out
+type Service struct {
+	store       Store
+	keyring     *Keyring
+	segmentSize int
+
+	verifiedMu sync.Mutex
+	verified   map[verifiedFile]time.Time // when each verification expires
+}
+
+// verifiedFileTTL is how long File.Verify trusts a file that matched its hash without reading it
+// again
+const verifiedFileTTL = 10 * time.Minute
+
+type verifiedFile struct {
+	key  string
+	hash string
+}
+
+type UploadResult struct {
+	S3Key      string
+	S3Bucket   string
+	FileHash   string // SHA-256 hash of original file
+	FileSize   int64
+	MimeType   string
+	UploadedAt time.Time
+	// EncryptionKeyID is the data key the file was encrypted with
+	EncryptionKeyID string
+}
+
+type DownloadResult struct {
+	Data     []byte
+	FileHash string
+	FileSize int64
+	MimeType string
+}
+
+func NewService(store Store, keyring *Keyring) *Service {
+	return &Service{store: store, keyring: keyring, segmentSize: DefaultSegmentSize, verified: make(map[verifiedFile]time.Time)}
+}
+
+// NewServiceFromEnv picks a backend from STORAGE_BACKEND: "s3", "local" or "memory".
+// When STORAGE_BACKEND is unset, S3 is used if AWS_S3_BUCKET is set and the local directory
+// otherwise. Data keys are kept in registry and wrapped by the provider KeyringFromEnv picks.
+// Only the memory backend may run without a configured master key.
+func NewServiceFromEnv(registry KeyRegistry) (*Service, error) {
+	backend := os.Getenv("STORAGE_BACKEND")
+	if backend == "" {
+		backend = "local"
+		if os.Getenv("AWS_S3_BUCKET") != "" {
+			backend = "s3"
+		}
+	}
+
+	var store Store
+	var err error
+	switch backend {
+	case "s3":
+		store, err = NewS3Service()
+	case "local":
+		dir := os.Getenv("STORAGE_DIR")
+		if dir == "" {
+			dir = "storage-data"
+		}
+		log.Printf("Files will be stored in %s", dir)
+		store, err = NewLocalStore(dir)
+	case "memory":
+		log.Println("Files will be kept in memory and lost on restart")
+		store = NewMemoryStore()
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %q", backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if backend == "memory" && os.Getenv("DOCUMENT_ENCRYPTION_KEY") == "" && os.Getenv("ENCRYPTION_KEY_PROVIDER") == "" {
+		// Nothing outlives the process, so a throwaway key is as good as a configured one.
+		// Data keys wrapped with it would be unreadable after a restart, so they stay in memory.
+		cipher, err := NewRandomCipher()
+		if err != nil {
+			return nil, err
+		}
+		return NewService(store, NewKeyring(NewMasterKeys(cipher), NewMemoryKeyRegistry())), nil
+	}
+
+	keyring, err := KeyringFromEnv(context.TODO(), registry)
+	if err != nil {
+		return nil, err
+	}
+	return NewService(store, keyring), nil
+}
+
+// UploadTemplate encrypts and stores a PDF template, streaming it from file
+func (s *Service) UploadTemplate(ctx context.Context, file io.Reader, header *multipart.FileHeader, userID int, workspaceID uuid.UUID) (*UploadResult, error) {
+	// Validate file type
+	if !strings.HasSuffix(strings.ToLower(header.Filename), ".pdf") {
+		return nil, fmt.Errorf("only PDF files are allowed")
+	}
+
+	// Generate storage key
+	templateID := uuid.New()
+	key := fmt.Sprintf("templates/%d/%s/%s.pdf", userID, workspaceID.String(), templateID.String())
+
+	return s.upload(ctx, workspaceID, key, file, map[string]string{
+		"original-filename": header.Filename,
+		"user-id":           fmt.Sprintf("%d", userID),
+		"workspace-id":      workspaceID.String(),
+		"template-id":       templateID.String(),
+		"encrypted":         "true",
+	})
+}
+
+// UploadSignedDocument encrypts and stores a completed/signed document
+func (s *Service) UploadSignedDocument(ctx context.Context, documentData []byte, userID int, workspaceID uuid.UUID, documentID uuid.UUID) (*UploadResult, error) {
+	// Generate storage key for signed document
+	key := fmt.Sprintf("documents/%d/%s/%s-signed.pdf", userID, workspaceID.String(), documentID.String())
+
+	return s.upload(ctx, workspaceID, key, bytes.NewReader(documentData), map[string]string{
+		"user-id":       fmt.Sprintf("%d", userID),
+		"workspace-id":  workspaceID.String(),
+		"document-id":   documentID.String(),
+		"encrypted":     "true",
+		"document-type": "signed",
+	})
+}
+
+// upload streams a PDF through the workspace's data key into the store, hashing it on the way.
+// The hash is only known once the upload finishes, so it is not part of the metadata.
+func (s *Service) upload(ctx context.Context, workspaceID uuid.UUID, key string, body io.Reader, metadata map[string]string) (*UploadResult, error) {
+	hash := sha256.New()
+	var size byteCounter
+	encrypted, keyID, err := s.keyring.EncryptStream(ctx, workspaceID, io.TeeReader(body, io.MultiWriter(hash, &size)), s.segmentSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt file: %w", err)
+	}
+	metadata["encryption-key-id"] = keyID.String()
+
+	if err := s.store.Put(ctx, key, encrypted, "application/pdf", metadata); err != nil {
+		return nil, fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	return &UploadResult{
+		S3Key:      key,
+		S3Bucket:   s.store.Bucket(),
+		FileHash:   hex.EncodeToString(hash.Sum(nil)),
+		FileSize:   int64(size),
+		MimeType:   "application/pdf",
+		UploadedAt: time.Now().UTC(),
+
+		EncryptionKeyID: keyID.String(),
+	}, nil
+}
+
+type byteCounter int64
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	*c += byteCounter(len(p))
+	return len(p), nil
+}
+
+// DownloadFile downloads and decrypts a whole file into memory. Use OpenFile to stream it.
+func (s *Service) DownloadFile(ctx context.Context, key string) (*DownloadResult, error) {
+	file, err := s.OpenFile(ctx, key, "")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	decryptedData, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt file: %w", err)
+	}
+
+	return &DownloadResult{
+		Data:     decryptedData,
+		FileHash: HashFile(decryptedData),
+		FileSize: int64(len(decryptedData)),
+		MimeType: "application/pdf",
+	}, nil
+}
+
+// File is a decrypted file being streamed from a Store. It reads forward without buffering the
+// file. Each segment is sealed on its own, so seeking reopens a segmented file at the segment
+// holding the new position; files in the whole-file formats are reopened from the start.
+type File struct {
+	ctx          context.Context
+	service      *Service
+	key          string
+	expectedHash string
+	size         int64
+
+	// header, cipher and segmentSize are set for segmented files
+	header      []byte
+	cipher      *Cipher
+	segmentSize int
+
+	body   io.ReadCloser
+	plain  io.Reader
+	hash   hash.Hash // nil unless plain was read from the start
+	offset int64     // how far plain has been read
+	pos    int64     // where the next Read starts
+	err    error
+}
+
+// OpenFile opens a stored file for streaming. When expectedHash is set, a read from the start that
+// reaches the end of the file fails instead of returning its last bytes if the file does not match
+// the hash, so a mismatched file is never served whole. The caller must close the file.
+func (s *Service) OpenFile(ctx context.Context, key string, expectedHash string) (*File, error) {
+	file := &File{ctx: ctx, service: s, key: key, expectedHash: expectedHash}
+	size, err := file.open()
+	if err != nil {
+		return nil, err
+	}
+	file.size = size
+
+	if size == 0 && expectedHash != "" && HashFile(nil) != expectedHash {
+		file.Close()
+		return nil, fmt.Errorf("file integrity check failed: expected %s, got %s", expectedHash, HashFile(nil))
+	}
+	return file, nil
+}
+
+// open (re)opens the stored file at its start and returns its plaintext size
+func (f *File) open() (int64, error) {
+	f.Close()
+
+	object, err := f.service.store.Get(f.ctx, f.key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to download file: %w", err)
+	}
+
+	plain, size, err := f.service.keyring.DecryptStream(f.ctx, object.Body, object.Size)
+	if err != nil {
+		object.Body.Close()
+		return 0, fmt.Errorf("failed to decrypt file: %w", err)
+	}
+
+	if segments, ok := plain.(*segmentDecrypter); ok {
+		f.header, f.cipher, f.segmentSize = segments.header, segments.cipher, segments.segmentSize
+	} else {
+		f.header, f.cipher, f.segmentSize = nil, nil, 0
+	}
+	f.body, f.plain, f.hash, f.offset = object.Body, plain, sha256.New(), 0
+	return size, nil
+}
+
+// reopen reopens the file at or before pos: at the start of the segment holding pos for a
+// segmented file, otherwise at the start of the file
+func (f *File) reopen() error {
+	var segment int64
+	if f.segmentSize > 0 {
+		segment = f.pos / int64(f.segmentSize)
+	}
+	if segment == 0 {
+		_, err := f.open()
+		return err
+	}
+
+	err := f.openSegment(segment)
+	if err != nil {
+		// The file may have been re-encrypted with another key since it was opened
+		if _, reopenErr := f.open(); reopenErr != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openSegment reopens a segmented file at the start of segment k. The hash is only checked when
+// the file is read from the start, so it is not kept.
+func (f *File) openSegment(k int64) error {
+	f.Close()
+
+	start := int64(streamHeaderSize) + k*int64(f.segmentSize+segmentOverhead)
+	object, err := f.service.store.GetRange(f.ctx, f.key, start)
+	if err != nil {
+		return fmt.Errorf("failed to download file: %w", err)
+	}
+
+	segments := newSegmentDecrypter(object.Body, f.cipher, f.header, f.segmentSize)
+	segments.seq = uint64(k)
+	// Decrypt the segment now, so a file replaced since it was opened fails here
+	if err := segments.openNext(); err != nil {
+		object.Body.Close()
+		return fmt.Errorf("failed to decrypt file: %w", err)
+	}
+
+	f.body, f.plain, f.hash, f.offset = object.Body, segments, nil, k*int64(f.segmentSize)
+	return nil
+}
+
+// Size returns the size of the decrypted file
+func (f *File) Size() int64 {
+	return f.size
+}
+
+func (f *File) Read(p []byte) (int, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	if f.pos >= f.size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	// A segmented file is reopened rather than read through a whole segment to skip forward
+	skipsSegment := f.segmentSize > 0 && f.pos/int64(f.segmentSize) > f.offset/int64(f.segmentSize)
+	if f.pos < f.offset || skipsSegment {
+		if err := f.reopen(); err != nil {
+			f.err = err
+			return 0, err
+		}
+	}
+	// Skip forward to pos, using p as scratch space
+	for f.offset < f.pos {
+		skip := min(f.pos-f.offset, int64(len(p)))
+		if _, err := f.read(p[:skip]); err != nil {
+			f.err = err
+			return 0, err
+		}
+	}
+
+	n, err := f.read(p)
+	f.pos = f.offset
+	if err != nil && err != io.EOF {
+		f.err = err
+		return 0, err
+	}
+	return n, err
+}
+
+// read reads the decrypted file in order, checking its hash once the end is reached
+func (f *File) read(p []byte) (int, error) {
+	n, err := f.plain.Read(p)
+	if f.hash != nil {
+		f.hash.Write(p[:n])
+	}
+	f.offset += int64(n)
+
+	if err == io.EOF && f.offset < f.size {
+		return n, fmt.Errorf("failed to decrypt file: %w", io.ErrUnexpectedEOF)
+	}
+	if err != nil && err != io.EOF {
+		return n, fmt.Errorf("failed to decrypt file: %w", err)
+	}
+
+	if f.offset >= f.size && f.expectedHash != "" && f.hash != nil {
+		if actualHash := hex.EncodeToString(f.hash.Sum(nil)); actualHash != f.expectedHash {
+			return 0, fmt.Errorf("file integrity check failed: expected %s, got %s", f.expectedHash, actualHash)
+		}
+	}
+	return n, err
+}
+
+// Verify reads the whole file and checks it against the expected hash. A caller serving only part
+// of the file must call it first, since only a read from the start to the end checks the hash. A
+// file that matched is trusted for verifiedFileTTL, so a viewer loading a PDF a few ranges at a
+// time reads it in full once per process rather than once per range. The read position is
+// unchanged.
+func (f *File) Verify() error {
+	if f.expectedHash == "" || f.service.recentlyVerified(f.key, f.expectedHash) {
+		return nil
+	}
+
+	pos := f.pos
+	f.pos = 0
+	buf := make([]byte, 32<<10)
+	for {
+		_, err := f.Read(buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	f.pos = pos
+
+	f.service.markVerified(f.key, f.expectedHash)
+	return nil
+}
+
+func (s *Service) recentlyVerified(key, hash string) bool {
+	s.verifiedMu.Lock()
+	defer s.verifiedMu.Unlock()
+	return time.Now().Before(s.verified[verifiedFile{key, hash}])
+}
+
+func (s *Service) markVerified(key, hash string) {
+	s.verifiedMu.Lock()
+	defer s.verifiedMu.Unlock()
+
+	now := time.Now()
+	for file, expiresAt := range s.verified {
+		if !now.Before(expiresAt) {
+			delete(s.verified, file)
+		}
+	}
+	s.verified[verifiedFile{key, hash}] = now.Add(verifiedFileTTL)
+}
+
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		offset += f.size
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative position %d", offset)
+	}
+
+	// Nothing is read until the next Read, so seeking to the end to find the size is free
+	f.pos = offset
+	return offset, nil
+}
+
+func (f *File) Close() error {
+	if f.body == nil {
+		return nil
+	}
+	err := f.body.Close()
+	f.body, f.plain = nil, nil
+	return err
+}
+
+// DeleteFile deletes a file. Deleting a file that does not exist is not an error.
+func (s *Service) DeleteFile(ctx context.Context, key string) error {
+	if err := s.store.Delete(ctx, key); err != nil {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	return nil
+}
+
+// CheckFileExists checks if a file exists
+func (s *Service) CheckFileExists(ctx context.Context, key string) (bool, error) {
+	exists, err := s.store.Exists(ctx, key)
+	if err != nil {
+		return false, fmt.Errorf("failed to check file existence: %w", err)
+	}
+	return exists, nil
+}
+
+// EncryptValue encrypts a small value (such as a form field) with the workspace's data key and
+// returns it base64 encoded for storage in a text column, along with the key's ID
+func (s *Service) EncryptValue(ctx context.Context, workspaceID uuid.UUID, value string) (string, string, error) {
+	encryptedData, keyID, err := s.keyring.Encrypt(ctx, workspaceID, []byte(value))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encrypt value: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(encryptedData), keyID.String(), nil
+}
+
+// DecryptValue reverses EncryptValue. It also reads values encrypted with a master key before
+// workspaces had data keys.
+func (s *Service) DecryptValue(ctx context.Context, encodedValue string) (string, error) {
+	encryptedData, err := base64.StdEncoding.DecodeString(encodedValue)
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value encoding: %w", err)
+	}
+
+	plaintext, err := s.keyring.Decrypt(ctx, encryptedData)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// HashFile returns the hex-encoded SHA-256 hash stored for files and compared by
+// ValidateFileIntegrity
+func HashFile(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// ValidateFileIntegrity validates a file against its stored hash
+func (s *Service) ValidateFileIntegrity(data []byte, expectedHash string) error {
+	actualHash := HashFile(data)
+
+	if actualHash != expectedHash {
+		return fmt.Errorf("file integrity check failed: expected %s, got %s", expectedHash, actualHash)
+	}
+
+	return nil
+}
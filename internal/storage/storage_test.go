@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/google/uuid"
+)
+
+func testCipher(t *testing.T) *Cipher {
+	t.Helper()
+	cipher, err := NewCipher(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cipher
+}
+
+func testKeyring(t *testing.T) *Keyring {
+	t.Helper()
+	return NewKeyring(NewMasterKeys(testCipher(t)), NewMemoryKeyRegistry())
+}
+
+// readObject reads a whole file from a store
+func readObject(t *testing.T, store Store, key string) []byte {
+	t.Helper()
+	object, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer object.Body.Close()
+
+	data, err := io.ReadAll(object.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(data)) != object.Size {
+		t.Errorf("object size = %d, read %d bytes", object.Size, len(data))
+	}
+	return data
+}
+
+func TestStores(t *testing.T) {
+	local, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, store := range []Store{local, NewMemoryStore()} {
+		t.Run(store.Bucket(), func(t *testing.T) {
+			ctx := context.Background()
+			key := "documents/1/" + uuid.NewString() + "-signed.pdf"
+
+			if exists, err := store.Exists(ctx, key); err != nil || exists {
+				t.Fatalf("Exists before Put = %v, %v", exists, err)
+			}
+			if _, err := store.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("Get before Put error = %v, want ErrNotFound", err)
+			}
+
+			if err := store.Put(ctx, key, strings.NewReader("first"), "application/pdf", nil); err != nil {
+				t.Fatal(err)
+			}
+			// A file being read keeps its contents while it is replaced
+			first, err := store.Get(ctx, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer first.Body.Close()
+			if err := store.Put(ctx, key, strings.NewReader("second"), "application/pdf", nil); err != nil {
+				t.Fatal(err)
+			}
+			if data, err := io.ReadAll(first.Body); err != nil || string(data) != "first" {
+				t.Errorf("reading the replaced file = %q, %v", data, err)
+			}
+			if data := readObject(t, store, key); string(data) != "second" {
+				t.Fatalf("Get = %q", data)
+			}
+			ranged, err := store.GetRange(ctx, key, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(ranged.Body)
+			ranged.Body.Close()
+			if err != nil || string(data) != "cond" || ranged.Size != 4 {
+				t.Errorf("GetRange = %q, size %d, %v", data, ranged.Size, err)
+			}
+
+			// A failed upload leaves the stored file alone
+			failing := io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(errors.New("connection reset")))
+			if err := store.Put(ctx, key, failing, "application/pdf", nil); err == nil {
+				t.Error("Put succeeded with a failing body")
+			}
+			if data := readObject(t, store, key); string(data) != "second" {
+				t.Errorf("Get after a failed Put = %q", data)
+			}
+			if exists, err := store.Exists(ctx, key); err != nil || !exists {
+				t.Fatalf("Exists after Put = %v, %v", exists, err)
+			}
+
+			if err := store.Delete(ctx, key); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Delete(ctx, key); err != nil {
+				t.Fatalf("deleting a missing file: %v", err)
+			}
+			if _, err := store.Presign(ctx, key, 0); !errors.Is(err, ErrPresignUnsupported) {
+				t.Errorf("Presign error = %v", err)
+			}
+		})
+	}
+}
+
+func TestLocalStoreRejectsKeysOutsideItsDirectory(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"../escape.pdf", "/etc/passwd", "templates/../../escape.pdf", ""} {
+		if err := store.Put(context.Background(), key, strings.NewReader("x"), "application/pdf", nil); err == nil {
+			t.Errorf("Put(%q) succeeded", key)
+		}
+	}
+}
+
+func TestServiceEncryptsFiles(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	service := NewService(store, testKeyring(t))
+	pdf := []byte("%PDF-1.7 signed contract")
+
+	result, err := service.UploadSignedDocument(ctx, pdf, 1, uuid.New(), uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.S3Bucket != "memory" || result.FileHash != HashFile(pdf) || result.FileSize != int64(len(pdf)) ||
+		result.EncryptionKeyID == "" {
+		t.Errorf("upload result = %+v", result)
+	}
+
+	if stored := readObject(t, store, result.S3Key); bytes.Contains(stored, []byte("signed contract")) {
+		t.Error("file was stored in plaintext")
+	}
+
+	download, err := service.DownloadFile(ctx, result.S3Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(download.Data, pdf) {
+		t.Errorf("downloaded %q, want %q", download.Data, pdf)
+	}
+	if err := service.ValidateFileIntegrity(download.Data, result.FileHash); err != nil {
+		t.Error(err)
+	}
+
+	// A different key cannot read the file
+	other, err := NewRandomCipher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKeyring := NewKeyring(NewMasterKeys(other), NewMemoryKeyRegistry())
+	if _, err := NewService(store, otherKeyring).DownloadFile(ctx, result.S3Key); err == nil {
+		t.Error("file decrypted with the wrong key")
+	}
+}
+
+func TestCipherValues(t *testing.T) {
+	cipher := testCipher(t)
+
+	encrypted, err := cipher.EncryptValue("Jane Doe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(encrypted, "Jane") {
+		t.Error("value was not encrypted")
+	}
+	if value, err := cipher.DecryptValue(encrypted); err != nil || value != "Jane Doe" {
+		t.Errorf("DecryptValue = %q, %v", value, err)
+	}
+	if !strings.HasPrefix(cipher.KeyID(), "sha256:") || len(cipher.KeyID()) != len("sha256:")+16 {
+		t.Errorf("KeyID = %q", cipher.KeyID())
+	}
+
+	if _, err := NewCipher([]byte("short")); err == nil {
+		t.Error("NewCipher accepted a short key")
+	}
+}
+
+func TestNewServiceFromEnv(t *testing.T) {
+	t.Setenv("AWS_S3_BUCKET", "")
+	t.Setenv("DOCUMENT_ENCRYPTION_KEY", "")
+
+	t.Setenv("STORAGE_BACKEND", "memory")
+	service, err := NewServiceFromEnv(NewMemoryKeyRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if service.store.Bucket() != "memory" {
+		t.Errorf("backend = %s, want memory", service.store.Bucket())
+	}
+
+	// Files on disk must be readable after a restart, so a key is required
+	t.Setenv("STORAGE_BACKEND", "")
+	t.Setenv("STORAGE_DIR", t.TempDir())
+	if _, err := NewServiceFromEnv(NewMemoryKeyRegistry()); err == nil {
+		t.Error("local storage started without an encryption key")
+	}
+
+	t.Setenv("DOCUMENT_ENCRYPTION_KEY", strings.Repeat("ab", 32))
+	service, err = NewServiceFromEnv(NewMemoryKeyRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if service.store.Bucket() != "local" {
+		t.Errorf("backend = %s, want local", service.store.Bucket())
+	}
+
+	t.Setenv("STORAGE_BACKEND", "ftp")
+	if _, err := NewServiceFromEnv(NewMemoryKeyRegistry()); err == nil {
+		t.Error("unknown backend accepted")
+	}
+}
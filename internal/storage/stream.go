@@ -0,0 +1,240 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/google/uuid"
+)
+
+// Files are encrypted as a stream of fixed-size segments, so they can be uploaded and downloaded
+// without being held in memory:
+//
+//	"FSE" | 2 | data key ID (16 bytes) | segment size (4 bytes) | segment | segment | ...
+//
+// Each segment is a random nonce (12 bytes) followed by up to segment size bytes of AES-256-GCM
+// ciphertext and its tag. Every segment but the last is full. The header, the segment's sequence
+// number and whether it is the last segment are authenticated as additional data, so segments
+// cannot be reordered, dropped or cut off without decryption failing.
+const (
+	streamVersion      = 2
+	streamHeaderSize   = envelopeHeader + 4
+	segmentNonceSize   = 12
+	segmentOverhead    = segmentNonceSize + 16
+	DefaultSegmentSize = 64 << 10
+	// maxSegmentSize stops a corrupt header from allocating a huge buffer
+	maxSegmentSize = 16 << 20
+)
+
+func streamHeader(keyID uuid.UUID, segmentSize int) []byte {
+	header := make([]byte, 0, streamHeaderSize)
+	header = append(header, envelopeMagic...)
+	header = append(header, streamVersion)
+	header = append(header, keyID[:]...)
+	return binary.BigEndian.AppendUint32(header, uint32(segmentSize))
+}
+
+// parseStreamHeader returns the data key and segment size of a segmented file
+func parseStreamHeader(header []byte) (uuid.UUID, int, bool) {
+	if len(header) < streamHeaderSize ||
+		!bytes.HasPrefix(header, []byte(envelopeMagic)) ||
+		header[len(envelopeMagic)] != streamVersion {
+		return uuid.Nil, 0, false
+	}
+
+	keyID, err := uuid.FromBytes(header[len(envelopeMagic)+1 : envelopeHeader])
+	if err != nil {
+		return uuid.Nil, 0, false
+	}
+	segmentSize := int(binary.BigEndian.Uint32(header[envelopeHeader:streamHeaderSize]))
+	if segmentSize == 0 || segmentSize > maxSegmentSize {
+		return uuid.Nil, 0, false
+	}
+	return keyID, segmentSize, true
+}
+
+// streamPlaintextSize works out the size of a segmented file's plaintext from its stored size
+func streamPlaintextSize(storedSize int64, segmentSize int) (int64, error) {
+	body := storedSize - int64(streamHeaderSize)
+	sealedSegment := int64(segmentSize + segmentOverhead)
+	if body < segmentOverhead {
+		return 0, fmt.Errorf("encrypted file is truncated")
+	}
+
+	full, rest := body/sealedSegment, body%sealedSegment
+	if rest == 0 {
+		return full * int64(segmentSize), nil
+	}
+	if rest < segmentOverhead {
+		return 0, fmt.Errorf("encrypted file is truncated")
+	}
+	return full*int64(segmentSize) + rest - segmentOverhead, nil
+}
+
+func segmentAAD(buf, header []byte, seq uint64, final bool) []byte {
+	buf = append(buf[:0], header...)
+	buf = binary.BigEndian.AppendUint64(buf, seq)
+	if final {
+		return append(buf, 1)
+	}
+	return append(buf, 0)
+}
+
+// segmentEncrypter reads plaintext from src and returns the header followed by sealed segments
+type segmentEncrypter struct {
+	src         io.Reader
+	cipher      *Cipher
+	header      []byte
+	segmentSize int
+
+	// plain holds one byte more than a segment, which tells whether another segment follows
+	plain    []byte
+	buffered int
+	seq      uint64
+	aad      []byte
+	sealed   []byte
+	pending  []byte
+	done     bool
+	err      error
+}
+
+func newSegmentEncrypter(src io.Reader, cipher *Cipher, header []byte, segmentSize int) *segmentEncrypter {
+	return &segmentEncrypter{
+		src:         src,
+		cipher:      cipher,
+		header:      header,
+		segmentSize: segmentSize,
+		plain:       make([]byte, segmentSize+1),
+		sealed:      make([]byte, 0, segmentSize+segmentOverhead),
+		pending:     header,
+	}
+}
+
+func (e *segmentEncrypter) Read(p []byte) (int, error) {
+	for len(e.pending) == 0 {
+		if e.err != nil {
+			return 0, e.err
+		}
+		if e.done {
+			return 0, io.EOF
+		}
+		e.err = e.sealNext()
+	}
+
+	n := copy(p, e.pending)
+	e.pending = e.pending[n:]
+	return n, nil
+}
+
+func (e *segmentEncrypter) sealNext() error {
+	n, err := io.ReadFull(e.src, e.plain[e.buffered:])
+	e.buffered += n
+	final := err == io.EOF || err == io.ErrUnexpectedEOF
+	if err != nil && !final {
+		return err
+	}
+
+	size := e.segmentSize
+	if final {
+		size = e.buffered
+	}
+
+	nonce := e.sealed[:segmentNonceSize]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	e.aad = segmentAAD(e.aad, e.header, e.seq, final)
+	e.sealed = e.cipher.aead.Seal(nonce, nonce, e.plain[:size], e.aad)
+	e.pending = e.sealed
+	e.seq++
+
+	if final {
+		e.done = true
+	} else {
+		e.plain[0] = e.plain[e.segmentSize]
+		e.buffered = 1
+	}
+	return nil
+}
+
+// segmentDecrypter reads sealed segments from src, which is positioned after the header, and
+// returns the plaintext
+type segmentDecrypter struct {
+	src         io.Reader
+	cipher      *Cipher
+	header      []byte
+	segmentSize int
+
+	// sealed holds one byte more than a sealed segment, which tells whether another follows
+	sealed   []byte
+	buffered int
+	seq      uint64
+	aad      []byte
+	plain    []byte
+	pending  []byte
+	done     bool
+	err      error
+}
+
+func newSegmentDecrypter(src io.Reader, cipher *Cipher, header []byte, segmentSize int) *segmentDecrypter {
+	return &segmentDecrypter{
+		src:         src,
+		cipher:      cipher,
+		header:      header,
+		segmentSize: segmentSize,
+		sealed:      make([]byte, segmentSize+segmentOverhead+1),
+		plain:       make([]byte, 0, segmentSize),
+	}
+}
+
+func (d *segmentDecrypter) Read(p []byte) (int, error) {
+	for len(d.pending) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.done {
+			return 0, io.EOF
+		}
+		d.err = d.openNext()
+	}
+
+	n := copy(p, d.pending)
+	d.pending = d.pending[n:]
+	return n, nil
+}
+
+func (d *segmentDecrypter) openNext() error {
+	n, err := io.ReadFull(d.src, d.sealed[d.buffered:])
+	d.buffered += n
+	final := err == io.EOF || err == io.ErrUnexpectedEOF
+	if err != nil && !final {
+		return err
+	}
+
+	size := d.segmentSize + segmentOverhead
+	if final {
+		size = d.buffered
+	}
+	if size < segmentOverhead {
+		return fmt.Errorf("encrypted file is truncated")
+	}
+
+	d.aad = segmentAAD(d.aad, d.header, d.seq, final)
+	plain, err := d.cipher.aead.Open(d.plain[:0], d.sealed[:segmentNonceSize], d.sealed[segmentNonceSize:size], d.aad)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt segment %d: %w", d.seq, err)
+	}
+	d.pending = plain
+	d.seq++
+
+	if final {
+		d.done = true
+	} else {
+		d.sealed[0] = d.sealed[size]
+		d.buffered = 1
+	}
+	return nil
+}
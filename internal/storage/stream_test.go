@@ -0,0 +1,312 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+const testSegmentSize = 16
+
+func encryptStream(t *testing.T, keyring *Keyring, workspaceID uuid.UUID, plaintext []byte) []byte {
+	t.Helper()
+	encrypted, _, err := keyring.EncryptStream(context.Background(), workspaceID, bytes.NewReader(plaintext), testSegmentSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func decryptStream(keyring *Keyring, encrypted []byte) ([]byte, int64, error) {
+	plain, size, err := keyring.DecryptStream(context.Background(), bytes.NewReader(encrypted), int64(len(encrypted)))
+	if err != nil {
+		return nil, 0, err
+	}
+	data, err := io.ReadAll(plain)
+	return data, size, err
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	keyring := testKeyring(t)
+	workspaceID := uuid.New()
+
+	for _, size := range []int{0, 1, testSegmentSize - 1, testSegmentSize, testSegmentSize + 1, 5*testSegmentSize + 3} {
+		plaintext := bytes.Repeat([]byte{'x'}, size)
+		encrypted := encryptStream(t, keyring, workspaceID, plaintext)
+
+		if bytes.Contains(encrypted, []byte("xxxx")) {
+			t.Errorf("%d bytes: stored in plaintext", size)
+		}
+		if keyID, ok := keyring.KeyIDOf(encrypted); !ok || keyID == uuid.Nil {
+			t.Errorf("%d bytes: KeyIDOf = %s, %v", size, keyID, ok)
+		}
+
+		decrypted, plaintextSize, err := decryptStream(keyring, encrypted)
+		if err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+		if !bytes.Equal(decrypted, plaintext) || plaintextSize != int64(size) {
+			t.Errorf("%d bytes: decrypted %d bytes, size %d", size, len(decrypted), plaintextSize)
+		}
+	}
+}
+
+func TestStreamReadsWholeFileFormats(t *testing.T) {
+	master := testCipher(t)
+	keyring := NewKeyring(NewMasterKeys(master), NewMemoryKeyRegistry())
+
+	envelope, _, err := keyring.Encrypt(context.Background(), uuid.New(), []byte("%PDF envelope"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := master.Encrypt([]byte("%PDF legacy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for want, encrypted := range map[string][]byte{"%PDF envelope": envelope, "%PDF legacy": legacy} {
+		decrypted, size, err := decryptStream(keyring, encrypted)
+		if err != nil || string(decrypted) != want || size != int64(len(want)) {
+			t.Errorf("DecryptStream = %q, %d, %v; want %q", decrypted, size, err, want)
+		}
+	}
+}
+
+func TestStreamDetectsTampering(t *testing.T) {
+	keyring := testKeyring(t)
+	plaintext := bytes.Repeat([]byte("contract "), 8)
+	encrypted := encryptStream(t, keyring, uuid.New(), plaintext)
+	sealedSegment := testSegmentSize + segmentOverhead
+	second := streamHeaderSize + sealedSegment
+
+	swapped := append([]byte(nil), encrypted[:streamHeaderSize]...)
+	swapped = append(swapped, encrypted[second:second+sealedSegment]...)
+	swapped = append(swapped, encrypted[streamHeaderSize:second]...)
+	swapped = append(swapped, encrypted[second+sealedSegment:]...)
+
+	flipped := append([]byte(nil), encrypted...)
+	flipped[second+segmentNonceSize] ^= 1
+
+	resized := append([]byte(nil), encrypted...)
+	resized[envelopeHeader+3] = testSegmentSize / 2
+
+	tampered := map[string][]byte{
+		"cut at a segment boundary": encrypted[:second],
+		"cut inside a segment":      encrypted[:second+segmentOverhead+1],
+		"last segment dropped":      encrypted[:len(encrypted)-(len(plaintext)%testSegmentSize+segmentOverhead)],
+		"segments swapped":          swapped,
+		"bit flipped":               flipped,
+		"segment size changed":      resized,
+		"bytes appended":            append(append([]byte(nil), encrypted...), encrypted[streamHeaderSize:second]...),
+	}
+	for name, data := range tampered {
+		if _, _, err := decryptStream(keyring, data); err == nil {
+			t.Errorf("%s: decrypted", name)
+		}
+	}
+}
+
+func TestStreamPlaintextSize(t *testing.T) {
+	header, overhead := int64(streamHeaderSize), int64(segmentOverhead)
+	sealed := testSegmentSize + overhead
+	tests := []struct {
+		stored int64
+		want   int64
+	}{
+		{header + overhead, 0},
+		{header + sealed, testSegmentSize},
+		{header + 2*sealed + overhead + 5, 2*testSegmentSize + 5},
+	}
+	for _, tt := range tests {
+		if got, err := streamPlaintextSize(tt.stored, testSegmentSize); err != nil || got != tt.want {
+			t.Errorf("streamPlaintextSize(%d) = %d, %v; want %d", tt.stored, got, err, tt.want)
+		}
+	}
+
+	for _, stored := range []int64{0, header, header + sealed + 3} {
+		if _, err := streamPlaintextSize(stored, testSegmentSize); err == nil {
+			t.Errorf("streamPlaintextSize(%d) accepted a truncated file", stored)
+		}
+	}
+}
+
+// countingStore records how many bytes are downloaded
+type countingStore struct {
+	*MemoryStore
+	downloaded int64
+	ranges     int
+}
+
+func (s *countingStore) Get(ctx context.Context, key string) (*Object, error) {
+	object, err := s.MemoryStore.Get(ctx, key)
+	if err == nil {
+		s.downloaded += object.Size
+	}
+	return object, err
+}
+
+func (s *countingStore) GetRange(ctx context.Context, key string, offset int64) (*Object, error) {
+	object, err := s.MemoryStore.GetRange(ctx, key, offset)
+	if err == nil {
+		s.downloaded += object.Size
+		s.ranges++
+	}
+	return object, err
+}
+
+func TestFileSeeksToSegment(t *testing.T) {
+	ctx := context.Background()
+	store := &countingStore{MemoryStore: NewMemoryStore()}
+	service := NewService(store, testKeyring(t))
+	service.segmentSize = testSegmentSize
+	pdf := []byte("%PDF-1.7 " + strings.Repeat("scanned page ", 40))
+
+	result, err := service.UploadTemplate(ctx, bytes.NewReader(pdf), &multipart.FileHeader{Filename: "scan.pdf"}, 1, uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := service.OpenFile(ctx, result.S3Key, result.FileHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	stored := store.downloaded
+
+	// Backwards and far forwards, each starting at the segment holding the range
+	for _, r := range [][2]int64{{400, 10}, {200, 5}, {21, 30}, {500, 4}} {
+		store.downloaded = 0
+		if _, err := file.Seek(r[0], io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, r[1])
+		if _, err := io.ReadFull(file, got); err != nil {
+			t.Fatalf("range %v: %v", r, err)
+		}
+		if want := pdf[r[0] : r[0]+r[1]]; !bytes.Equal(got, want) {
+			t.Errorf("range %v = %q, want %q", r, got, want)
+		}
+		segment := r[0] / testSegmentSize
+		if want := stored - int64(streamHeaderSize) - segment*(testSegmentSize+segmentOverhead); store.downloaded != want {
+			t.Errorf("range %v downloaded %d bytes, want %d", r, store.downloaded, want)
+		}
+	}
+	if store.ranges != 4 {
+		t.Errorf("%d ranged downloads, want 4", store.ranges)
+	}
+
+	// Reading to the end from within the file cannot check the hash, so Verify still reads it all
+	if err := file.Verify(); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	// A file replaced since it was opened is read again from the start
+	replaced, err := service.UploadTemplate(ctx, bytes.NewReader(pdf), &multipart.FileHeader{Filename: "scan.pdf"}, 1, uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	object, err := store.Get(ctx, replaced.S3Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(ctx, result.S3Key, object.Body, "application/pdf", nil); err != nil {
+		t.Fatal(err)
+	}
+	object.Body.Close()
+	if _, err := file.Seek(300, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, 8)
+	if _, err := io.ReadFull(file, got); err != nil || !bytes.Equal(got, pdf[300:308]) {
+		t.Errorf("read after the file was replaced = %q, %v", got, err)
+	}
+}
+
+func TestOpenFile(t *testing.T) {
+	ctx := context.Background()
+	service := NewService(NewMemoryStore(), testKeyring(t))
+	service.segmentSize = testSegmentSize
+	pdf := []byte("%PDF-1.7 " + strings.Repeat("scanned page ", 20))
+
+	result, err := service.UploadTemplate(ctx, bytes.NewReader(pdf), &multipart.FileHeader{Filename: "scan.pdf"}, 1, uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.FileHash != HashFile(pdf) || result.FileSize != int64(len(pdf)) {
+		t.Errorf("upload result = %+v", result)
+	}
+
+	file, err := service.OpenFile(ctx, result.S3Key, result.FileHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if file.Size() != int64(len(pdf)) {
+		t.Errorf("Size = %d, want %d", file.Size(), len(pdf))
+	}
+
+	// Ranges forwards, backwards and across segments
+	for _, r := range [][2]int64{{40, 20}, {3, 5}, {100, 70}, {int64(len(pdf)) - 7, 7}} {
+		if _, err := file.Seek(r[0], io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, r[1])
+		if _, err := io.ReadFull(file, got); err != nil {
+			t.Fatalf("range %v: %v", r, err)
+		}
+		if want := pdf[r[0] : r[0]+r[1]]; !bytes.Equal(got, want) {
+			t.Errorf("range %v = %q, want %q", r, got, want)
+		}
+	}
+	if end, err := file.Seek(0, io.SeekEnd); err != nil || end != int64(len(pdf)) {
+		t.Errorf("Seek to end = %d, %v", end, err)
+	}
+	if n, err := file.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Errorf("Read at end = %d, %v", n, err)
+	}
+
+	// Verifying reads the whole file without moving the read position
+	if _, err := file.Seek(9, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Verify(); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	got := make([]byte, 7)
+	if _, err := io.ReadFull(file, got); err != nil || string(got) != "scanned" {
+		t.Errorf("read after Verify = %q, %v", got, err)
+	}
+
+	// A file that does not match its hash never ends
+	mismatched, err := service.OpenFile(ctx, result.S3Key, HashFile([]byte("another file")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mismatched.Close()
+	if data, err := io.ReadAll(mismatched); err == nil || !strings.Contains(err.Error(), "integrity") {
+		t.Errorf("ReadAll = %d bytes, %v", len(data), err)
+	} else if len(data) >= len(pdf) {
+		t.Error("the whole mismatched file was returned")
+	}
+
+	mismatched, err = service.OpenFile(ctx, result.S3Key, HashFile([]byte("another file")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mismatched.Close()
+	if err := mismatched.Verify(); err == nil || !strings.Contains(err.Error(), "integrity") {
+		t.Errorf("Verify of mismatched file = %v", err)
+	}
+
+	if _, err := service.OpenFile(ctx, "templates/missing.pdf", ""); err == nil {
+		t.Error("missing file opened")
+	}
+}
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const vaultTransitKeyIDPrefix = "vault-transit:"
+
+// VaultTransitProvider wraps data keys with a HashiCorp Vault Transit key. The workspace ID is
+// passed as associated data, so the key must use an AEAD type such as aes256-gcm96. Rotating the
+// key in Vault changes KeyID, which lets rotate-keys find data keys wrapped by older versions.
+type VaultTransitProvider struct {
+	client    *http.Client
+	addr      string
+	token     string
+	namespace string
+	mount     string
+	key       string
+	version   int
+}
+
+// NewVaultTransitProviderFromEnv uses the key VAULT_TRANSIT_KEY on the Transit engine mounted at
+// VAULT_TRANSIT_MOUNT (default "transit") of the server at VAULT_ADDR, authenticating with
+// VAULT_TOKEN and the optional VAULT_NAMESPACE
+func NewVaultTransitProviderFromEnv(ctx context.Context) (*VaultTransitProvider, error) {
+	for _, name := range []string{"VAULT_ADDR", "VAULT_TOKEN", "VAULT_TRANSIT_KEY"} {
+		if os.Getenv(name) == "" {
+			return nil, fmt.Errorf("%s environment variable is required", name)
+		}
+	}
+
+	mount := os.Getenv("VAULT_TRANSIT_MOUNT")
+	if mount == "" {
+		mount = "transit"
+	}
+
+	return NewVaultTransitProvider(ctx, os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN"),
+		os.Getenv("VAULT_NAMESPACE"), mount, os.Getenv("VAULT_TRANSIT_KEY"))
+}
+
+// NewVaultTransitProvider reads the key's latest version, which becomes part of the provider's
+// KeyID
+func NewVaultTransitProvider(ctx context.Context, addr, token, namespace, mount, key string) (*VaultTransitProvider, error) {
+	p := &VaultTransitProvider{
+		client:    &http.Client{Timeout: 10 * time.Second},
+		addr:      strings.TrimSuffix(addr, "/"),
+		token:     token,
+		namespace: namespace,
+		mount:     strings.Trim(mount, "/"),
+		key:       key,
+	}
+
+	var described struct {
+		LatestVersion int `json:"latest_version"`
+	}
+	if err := p.call(ctx, http.MethodGet, "keys", nil, &described); err != nil {
+		return nil, err
+	}
+	if described.LatestVersion == 0 {
+		return nil, fmt.Errorf("vault transit key %s has no versions", key)
+	}
+	p.version = described.LatestVersion
+
+	return p, nil
+}
+
+// KeyID names the Transit key and its latest version, e.g. "vault-transit:transit/finalsign:v2"
+func (p *VaultTransitProvider) KeyID() string {
+	return fmt.Sprintf("%s%s:v%d", p.keyPrefix(), p.key, p.version)
+}
+
+func (p *VaultTransitProvider) keyPrefix() string {
+	return vaultTransitKeyIDPrefix + p.mount + "/"
+}
+
+func (p *VaultTransitProvider) Wrap(ctx context.Context, dataKey []byte, workspaceID uuid.UUID) ([]byte, error) {
+	var encrypted struct {
+		Ciphertext string `json:"ciphertext"`
+	}
+	err := p.call(ctx, http.MethodPost, "encrypt", map[string]any{
+		"plaintext":       base64.StdEncoding.EncodeToString(dataKey),
+		"associated_data": base64.StdEncoding.EncodeToString(workspaceID[:]),
+		"key_version":     p.version,
+	}, &encrypted)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(encrypted.Ciphertext), nil
+}
+
+// Unwrap decrypts data keys wrapped by any version of the provider's Transit key
+func (p *VaultTransitProvider) Unwrap(ctx context.Context, masterKeyID string, wrappedKey []byte, workspaceID uuid.UUID) ([]byte, error) {
+	if !strings.HasPrefix(masterKeyID, p.keyPrefix()+p.key+":") {
+		return nil, fmt.Errorf("master key %s is not the vault transit key %s", masterKeyID, p.key)
+	}
+
+	var decrypted struct {
+		Plaintext string `json:"plaintext"`
+	}
+	err := p.call(ctx, http.MethodPost, "decrypt", map[string]any{
+		"ciphertext":      string(wrappedKey),
+		"associated_data": base64.StdEncoding.EncodeToString(workspaceID[:]),
+	}, &decrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := base64.StdEncoding.DecodeString(decrypted.Plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("invalid plaintext from vault: %w", err)
+	}
+	return dataKey, nil
+}
+
+// call sends a request to the Transit endpoint for the provider's key, such as
+// /v1/transit/encrypt/finalsign, and decodes the response's data object into output
+func (p *VaultTransitProvider) call(ctx context.Context, method, endpoint string, input, output any) error {
+	var body io.Reader
+	if input != nil {
+		encoded, err := json.Marshal(input)
+		if err != nil {
+			return fmt.Errorf("failed to encode vault request: %w", err)
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	url := fmt.Sprintf("%s/v1/%s/%s/%s", p.addr, p.mount, endpoint, p.key)
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return fmt.Errorf("failed to create vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", p.token)
+	if p.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.namespace)
+	}
+	if input != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault %s request failed: %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read vault %s response: %w", endpoint, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var vaultErr struct {
+			Errors []string `json:"errors"`
+		}
+		json.Unmarshal(respBody, &vaultErr)
+		return fmt.Errorf("vault %s failed with status %d: %s", endpoint, resp.StatusCode, strings.Join(vaultErr.Errors, "; "))
+	}
+
+	envelope := struct {
+		Data any `json:"data"`
+	}{Data: output}
+	if err := json.Unmarshal(respBody, &envelope); err != nil {
+		return fmt.Errorf("failed to decode vault %s response: %w", endpoint, err)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package webhooks
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateAddress is returned when an endpoint resolves to an address inside a private network
+var ErrPrivateAddress = errors.New("endpoint address is loopback, private, link-local or unspecified")
+
+// AllowPrivateNetworks reports whether WEBHOOKS_ALLOW_PRIVATE_NETWORKS=true, which lets endpoints
+// use plain http on localhost and reach private addresses. It is meant for local development;
+// in production it would let workspace admins probe the internal network and read the responses
+// in the delivery log.
+func AllowPrivateNetworks() bool {
+	return os.Getenv("WEBHOOKS_ALLOW_PRIVATE_NETWORKS") == "true"
+}
+
+// IsPublicAddress reports whether addr may receive webhooks. Loopback, private, link-local
+// (including cloud metadata endpoints), multicast and unspecified addresses are refused.
+func IsPublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() && !addr.IsLoopback() && !addr.IsPrivate() && !addr.IsLinkLocalUnicast() &&
+		!addr.IsLinkLocalMulticast() && !addr.IsInterfaceLocalMulticast() && !addr.IsMulticast() &&
+		!addr.IsUnspecified()
+}
+
+// newTransport returns the transport used when the dispatcher is not given a client. The address
+// is checked after DNS resolution, just before connecting, so a hostname cannot be re-pointed at
+// an internal address once the URL has been accepted. Proxies are not used, as they would hide
+// the real destination from the check.
+func newTransport(allowPrivate bool) *http.Transport {
+	dialer := &net.Dialer{Timeout: requestTimeout, KeepAlive: 30 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, conn syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("unexpected dial address %q: %w", address, err)
+			}
+			if !IsPublicAddress(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", ErrPrivateAddress, addrPort.Addr())
+			}
+			return nil
+		}
+	}
+
+	return &http.Transport{
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   requestTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+}
@@ -0,0 +1,204 @@
+// Package webhooks delivers workspace events to customer endpoints as signed HTTP POSTs.
+//
+// Every request carries the event type, the delivery ID, a Unix timestamp and an HMAC-SHA256
+// signature of "<timestamp>.<body>" keyed with the endpoint's secret. Receivers should check the
+// signature with Verify and reject old timestamps to stop replays. The payload's "id" is the
+// event ID, which stays the same across retries and manual redeliveries.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"finalsign/internal/database"
+	"finalsign/internal/jobs"
+
+	"github.com/google/uuid"
+)
+
+// Request headers sent with every delivery
+const (
+	EventHeader     = "X-FinalSign-Event"
+	DeliveryHeader  = "X-FinalSign-Delivery"
+	TimestampHeader = "X-FinalSign-Timestamp"
+	SignatureHeader = "X-FinalSign-Signature"
+)
+
+const (
+	// MaxAttempts is how many times a delivery is tried before it is marked failed
+	MaxAttempts = 8
+	batchSize   = 50
+	baseBackoff = time.Minute
+	maxBackoff  = 6 * time.Hour
+	// requestTimeout bounds one delivery attempt, including reading the response
+	requestTimeout = 10 * time.Second
+	// maxResponseBody is how much of an endpoint's response is read and logged
+	maxResponseBody = 4096
+)
+
+var retryBackoff = jobs.Backoff{Base: baseBackoff, Max: maxBackoff, MaxAttempts: MaxAttempts}
+
+// Queue is the webhook delivery queue. database.Service implements it.
+type Queue interface {
+	ClaimPendingWebhookDeliveries(ctx context.Context, limit int) ([]database.PendingWebhookDelivery, error)
+	MarkWebhookDeliverySucceeded(ctx context.Context, deliveryID uuid.UUID, responseStatus int, responseBody string) error
+	MarkWebhookDeliveryFailed(ctx context.Context, deliveryID uuid.UUID, responseStatus int, responseBody, lastError string, retryAt *time.Time) error
+}
+
+// Payload is the JSON body of a delivery
+type Payload struct {
+	ID          uuid.UUID       `json:"id"`
+	Type        string          `json:"type"`
+	WorkspaceID uuid.UUID       `json:"workspace_id"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Data        json.RawMessage `json:"data"`
+}
+
+// Dispatcher delivers queued webhooks, retrying failures with exponential backoff
+type Dispatcher struct {
+	queue  Queue
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewDispatcher returns a dispatcher that sends with client, or with a default client if nil.
+// The default client refuses to connect to private addresses unless AllowPrivateNetworks is set.
+// Redirects are never followed: an endpoint that redirects has failed the delivery.
+func NewDispatcher(queue Queue, client *http.Client) *Dispatcher {
+	if client == nil {
+		client = &http.Client{Timeout: requestTimeout, Transport: newTransport(AllowPrivateNetworks())}
+	}
+	noRedirects := *client
+	noRedirects.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &Dispatcher{queue: queue, client: &noRedirects, now: time.Now}
+}
+
+// DeliverPending sends every due webhook and returns how many it processed. It is meant to run
+// as a background job.
+func (d *Dispatcher) DeliverPending(ctx context.Context) (int, error) {
+	processed := 0
+	for {
+		deliveries, err := d.queue.ClaimPendingWebhookDeliveries(ctx, batchSize)
+		if err != nil {
+			return processed, err
+		}
+
+		for _, delivery := range deliveries {
+			if err := d.deliver(ctx, delivery); err != nil {
+				return processed, err
+			}
+			processed++
+		}
+
+		if len(deliveries) < batchSize || ctx.Err() != nil {
+			return processed, ctx.Err()
+		}
+	}
+}
+
+// deliver sends one webhook and records the outcome. Only failures to record the outcome are
+// returned; a failed send is rescheduled.
+func (d *Dispatcher) deliver(ctx context.Context, delivery database.PendingWebhookDelivery) error {
+	statusCode, responseBody, err := d.send(ctx, delivery)
+	if err == nil {
+		return d.queue.MarkWebhookDeliverySucceeded(ctx, delivery.ID, statusCode, responseBody)
+	}
+
+	retryAt := retryBackoff.RetryAt(delivery.Attempts, d.now())
+	if retryAt == nil {
+		log.Printf("Webhook delivery %s to %s failed permanently after %d attempts: %v", delivery.ID, delivery.URL, delivery.Attempts, err)
+	}
+	return d.queue.MarkWebhookDeliveryFailed(ctx, delivery.ID, statusCode, responseBody,
+		fmt.Sprintf("attempt %d: %v", delivery.Attempts, err), retryAt)
+}
+
+// send POSTs the delivery and returns the response status and the start of the response body.
+// Any response other than 2xx is an error.
+func (d *Dispatcher) send(ctx context.Context, delivery database.PendingWebhookDelivery) (int, string, error) {
+	data := delivery.Data
+	if len(data) == 0 {
+		data = json.RawMessage("{}")
+	}
+	body, err := json.Marshal(Payload{
+		ID:          delivery.EventID,
+		Type:        delivery.EventType,
+		WorkspaceID: delivery.WorkspaceID,
+		CreatedAt:   delivery.EventCreatedAt.UTC(),
+		Data:        data,
+	})
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid endpoint URL: %w", err)
+	}
+
+	timestamp := d.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "FinalSign-Webhooks/1.0")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, delivery.ID.String())
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	responseBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, string(responseBody), fmt.Errorf("endpoint responded with %s", resp.Status)
+	}
+
+	return resp.StatusCode, string(responseBody), nil
+}
+
+// Sign returns the signature header value for a body sent at timestamp
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a delivery's signature and that its timestamp is within tolerance of now
+func Verify(secret, timestampHeader, signatureHeader string, body []byte, tolerance time.Duration, now time.Time) error {
+	timestamp, err := strconv.ParseInt(timestampHeader, 10, 64)
+	if err != nil {
+		return errors.New("invalid timestamp")
+	}
+
+	age := now.Sub(time.Unix(timestamp, 0))
+	if age > tolerance || age < -tolerance {
+		return errors.New("timestamp outside the allowed tolerance")
+	}
+
+	if !strings.HasPrefix(signatureHeader, "sha256=") ||
+		!hmac.Equal([]byte(signatureHeader), []byte(Sign(secret, timestamp, body))) {
+		return errors.New("signature mismatch")
+	}
+
+	return nil
+}
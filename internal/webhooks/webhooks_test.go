@@ -0,0 +1,267 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"finalsign/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// fakeQueue records what the dispatcher did with each delivery
+type fakeQueue struct {
+	pending   []database.PendingWebhookDelivery
+	succeeded map[uuid.UUID]int
+	failed    map[uuid.UUID]failedDelivery
+}
+
+type failedDelivery struct {
+	status    int
+	lastError string
+	retryAt   *time.Time
+}
+
+func (q *fakeQueue) ClaimPendingWebhookDeliveries(ctx context.Context, limit int) ([]database.PendingWebhookDelivery, error) {
+	n := min(limit, len(q.pending))
+	claimed := q.pending[:n]
+	q.pending = q.pending[n:]
+	for i := range claimed {
+		claimed[i].Attempts++
+	}
+	return claimed, nil
+}
+
+func (q *fakeQueue) MarkWebhookDeliverySucceeded(ctx context.Context, deliveryID uuid.UUID, responseStatus int, responseBody string) error {
+	if q.succeeded == nil {
+		q.succeeded = map[uuid.UUID]int{}
+	}
+	q.succeeded[deliveryID] = responseStatus
+	return nil
+}
+
+func (q *fakeQueue) MarkWebhookDeliveryFailed(ctx context.Context, deliveryID uuid.UUID, responseStatus int, responseBody, lastError string, retryAt *time.Time) error {
+	if q.failed == nil {
+		q.failed = map[uuid.UUID]failedDelivery{}
+	}
+	q.failed[deliveryID] = failedDelivery{status: responseStatus, lastError: lastError, retryAt: retryAt}
+	return nil
+}
+
+// receivedRequest is what the test receiver saw
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+func TestDispatcherDeliverPending(t *testing.T) {
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	secret := "whsec_test"
+
+	received := make(chan receivedRequest, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- receivedRequest{header: r.Header.Clone(), body: body}
+
+		switch r.URL.Path {
+		case "/ok":
+			w.WriteHeader(http.StatusNoContent)
+		case "/redirect":
+			http.Redirect(w, r, "/ok", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("try later"))
+		}
+	}))
+	defer receiver.Close()
+
+	ok, retry, exhausted, redirected, unreachable := uuid.New(), uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	eventID, workspaceID := uuid.New(), uuid.New()
+	delivery := func(id uuid.UUID, path string, attempts int) database.PendingWebhookDelivery {
+		return database.PendingWebhookDelivery{
+			ID:             id,
+			EventID:        eventID,
+			EventType:      database.WebhookDocumentCompleted,
+			WorkspaceID:    workspaceID,
+			Data:           json.RawMessage(`{"document_id":"abc"}`),
+			EventCreatedAt: now.Add(-time.Minute),
+			URL:            receiver.URL + path,
+			Secret:         secret,
+			Attempts:       attempts,
+		}
+	}
+
+	queue := &fakeQueue{pending: []database.PendingWebhookDelivery{
+		delivery(ok, "/ok", 0),
+		delivery(retry, "/down", 2),
+		delivery(exhausted, "/down", MaxAttempts-1),
+		delivery(redirected, "/redirect", 0),
+		{ID: unreachable, URL: "http://127.0.0.1:1/unreachable", Secret: secret},
+	}}
+
+	dispatcher := NewDispatcher(queue, receiver.Client())
+	dispatcher.now = func() time.Time { return now }
+
+	processed, err := dispatcher.DeliverPending(context.Background())
+	if err != nil {
+		t.Fatalf("DeliverPending() error = %v", err)
+	}
+	if processed != 5 {
+		t.Errorf("processed = %d, want 5", processed)
+	}
+
+	if len(queue.succeeded) != 1 || queue.succeeded[ok] != http.StatusNoContent {
+		t.Errorf("succeeded = %v, want only %s with 204", queue.succeeded, ok)
+	}
+
+	// Third attempt backs off 4 minutes
+	if failed := queue.failed[retry]; failed.status != http.StatusServiceUnavailable || failed.retryAt == nil ||
+		!failed.retryAt.Equal(now.Add(4*time.Minute)) {
+		t.Errorf("retry = %+v, want 503 retried at %v", failed, now.Add(4*time.Minute))
+	}
+	if failed, found := queue.failed[exhausted]; !found || failed.retryAt != nil {
+		t.Errorf("delivery out of attempts should fail permanently, got %+v", failed)
+	}
+	if failed := queue.failed[redirected]; failed.status != http.StatusFound || failed.retryAt == nil {
+		t.Errorf("redirect should be a retried failure, got %+v", failed)
+	}
+	if failed := queue.failed[unreachable]; failed.status != 0 || failed.lastError == "" || failed.retryAt == nil {
+		t.Errorf("unreachable endpoint should be retried without a status, got %+v", failed)
+	}
+
+	// The receiver sees a signed payload; the redirect was not followed
+	close(received)
+	var requests []receivedRequest
+	for request := range received {
+		requests = append(requests, request)
+	}
+	if len(requests) != 4 {
+		t.Fatalf("receiver got %d requests, want 4", len(requests))
+	}
+
+	first := requests[0]
+	if first.header.Get(EventHeader) != database.WebhookDocumentCompleted || first.header.Get(DeliveryHeader) != ok.String() {
+		t.Errorf("unexpected headers: %v", first.header)
+	}
+	err = Verify(secret, first.header.Get(TimestampHeader), first.header.Get(SignatureHeader), first.body, 5*time.Minute, now)
+	if err != nil {
+		t.Errorf("signature did not verify: %v", err)
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(first.body, &payload); err != nil {
+		t.Fatalf("payload is not JSON: %v", err)
+	}
+	if payload.ID != eventID || payload.Type != database.WebhookDocumentCompleted || payload.WorkspaceID != workspaceID ||
+		string(payload.Data) != `{"document_id":"abc"}` {
+		t.Errorf("unexpected payload: %s", first.body)
+	}
+}
+
+func TestDispatcherRefusesPrivateAddresses(t *testing.T) {
+	requests := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte("internal data"))
+	}))
+	defer receiver.Close()
+
+	deliveryID := uuid.New()
+	queue := &fakeQueue{pending: []database.PendingWebhookDelivery{{ID: deliveryID, URL: receiver.URL, Secret: "whsec_test"}}}
+	if _, err := NewDispatcher(queue, nil).DeliverPending(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if failed := queue.failed[deliveryID]; requests != 0 || !strings.Contains(failed.lastError, "loopback") {
+		t.Errorf("delivery to %s reached the receiver %d times, recorded %+v", receiver.URL, requests, failed)
+	}
+
+	t.Setenv("WEBHOOKS_ALLOW_PRIVATE_NETWORKS", "true")
+	queue = &fakeQueue{pending: []database.PendingWebhookDelivery{{ID: deliveryID, URL: receiver.URL, Secret: "whsec_test"}}}
+	if _, err := NewDispatcher(queue, nil).DeliverPending(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 1 || queue.succeeded[deliveryID] != http.StatusOK {
+		t.Errorf("delivery with private networks allowed: requests = %d, succeeded = %v", requests, queue.succeeded)
+	}
+}
+
+func TestIsPublicAddress(t *testing.T) {
+	tests := map[string]bool{
+		"203.0.113.10":    true,
+		"2001:db8::1":     true,
+		"127.0.0.1":       false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"0.0.0.0":         false,
+		"::1":             false,
+		"::":              false,
+		"fd00::1":         false,
+		"fe80::1":         false,
+		"::ffff:10.0.0.1": false,
+	}
+	for address, want := range tests {
+		if got := IsPublicAddress(netip.MustParseAddr(address)); got != want {
+			t.Errorf("IsPublicAddress(%s) = %v, want %v", address, got, want)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	body := []byte(`{"id":"1"}`)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	signature := Sign("secret", now.Unix(), body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		signature string
+		body      []byte
+		now       time.Time
+		wantErr   string
+	}{
+		{"valid", "secret", timestamp, signature, body, now, ""},
+		{"wrong secret", "other", timestamp, signature, body, now, "signature mismatch"},
+		{"tampered body", "secret", timestamp, signature, []byte(`{"id":"2"}`), now, "signature mismatch"},
+		{"replayed", "secret", timestamp, signature, body, now.Add(10 * time.Minute), "tolerance"},
+		{"bad timestamp", "secret", "yesterday", signature, body, now, "invalid timestamp"},
+		{"missing prefix", "secret", timestamp, strings.TrimPrefix(signature, "sha256="), body, now, "signature mismatch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.timestamp, tt.signature, tt.body, 5*time.Minute, tt.now)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Verify() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Verify() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRetryBackoffIsCapped(t *testing.T) {
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+
+	if retryAt := retryBackoff.RetryAt(1, now); !retryAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("first retry at %v", retryAt)
+	}
+	if retryAt := retryBackoff.RetryAt(MaxAttempts-1, now); retryAt.Sub(now) > maxBackoff {
+		t.Errorf("backoff %v exceeds cap", retryAt.Sub(now))
+	}
+}
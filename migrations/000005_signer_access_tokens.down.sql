@@ -0,0 +1,3 @@
+-- migrations/000005_signer_access_tokens.down.sql
+
+DROP INDEX IF EXISTS idx_document_signers_access_token_selector;
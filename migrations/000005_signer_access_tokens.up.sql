@@ -0,0 +1,7 @@
+-- migrations/000005_signer_access_tokens.up.sql
+
+-- Signer access tokens are resolved by their first 16 characters (the selector)
+-- and then compared in full in constant time by the application.
+CREATE INDEX idx_document_signers_access_token_selector
+    ON document_signers (left(access_token, 16))
+    WHERE access_token IS NOT NULL;
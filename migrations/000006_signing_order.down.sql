@@ -0,0 +1,9 @@
+-- migrations/000006_signing_order.down.sql
+
+-- Note: PostgreSQL cannot drop values from an enum, so the notification_type
+-- values added in the up migration are left in place.
+
+DROP INDEX IF EXISTS idx_document_signers_document_order;
+
+ALTER TABLE documents DROP COLUMN IF EXISTS parallel_signing;
+ALTER TABLE templates DROP COLUMN IF EXISTS parallel_signing;
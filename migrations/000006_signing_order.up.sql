@@ -0,0 +1,12 @@
+-- migrations/000006_signing_order.up.sql
+
+-- Templates can opt into parallel signing; documents pin the mode they were created with
+ALTER TABLE templates ADD COLUMN parallel_signing BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE documents ADD COLUMN parallel_signing BOOLEAN NOT NULL DEFAULT false;
+
+-- Lets the routing engine find the next signer of a document quickly
+CREATE INDEX idx_document_signers_document_order ON document_signers(document_id, signer_order);
+
+-- Notifications sent to signers who have a FinalSign account
+ALTER TYPE notification_type ADD VALUE IF NOT EXISTS 'signature_requested';
+ALTER TYPE notification_type ADD VALUE IF NOT EXISTS 'document_completed';
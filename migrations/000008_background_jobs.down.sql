@@ -0,0 +1,4 @@
+-- migrations/000008_background_jobs.down.sql
+
+-- Note: PostgreSQL cannot drop values from an enum, so the notification_type
+-- value added in the up migration is left in place.
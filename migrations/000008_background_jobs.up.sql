@@ -0,0 +1,4 @@
+-- migrations/000008_background_jobs.up.sql
+
+-- Lets the sender know a document expired before everyone signed
+ALTER TYPE notification_type ADD VALUE IF NOT EXISTS 'document_expired';
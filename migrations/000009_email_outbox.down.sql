@@ -0,0 +1,6 @@
+-- migrations/000009_email_outbox.down.sql
+
+DROP INDEX IF EXISTS idx_email_outbox_created_at;
+DROP INDEX IF EXISTS idx_email_outbox_due;
+
+DROP TABLE IF EXISTS email_outbox;
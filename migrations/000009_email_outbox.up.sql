@@ -0,0 +1,21 @@
+-- migrations/000009_email_outbox.up.sql
+
+-- Outgoing email is written here in the same transaction as the change that triggers it and
+-- delivered by a background job, so a slow or failing mail server never blocks a request.
+CREATE TABLE email_outbox (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    template VARCHAR(100) NOT NULL,
+    recipient_email VARCHAR(255) NOT NULL,
+    data JSONB NOT NULL DEFAULT '{}', -- Template variables
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_error TEXT,
+    sent_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    CONSTRAINT email_outbox_valid_status CHECK (status IN ('pending', 'sent', 'failed'))
+);
+
+CREATE INDEX idx_email_outbox_due ON email_outbox(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX idx_email_outbox_created_at ON email_outbox(created_at);
@@ -0,0 +1,20 @@
+-- migrations/000010_signer_reminders.down.sql
+
+-- Note: PostgreSQL cannot drop values from an enum, so the notification_type
+-- value added in the up migration is left in place.
+
+DELETE FROM document_audit_log WHERE action = 'reminder_sent';
+
+ALTER TABLE document_audit_log DROP CONSTRAINT document_audit_log_valid_action;
+ALTER TABLE document_audit_log ADD CONSTRAINT document_audit_log_valid_action CHECK (
+    action IN ('template_created', 'template_updated', 'document_created', 'document_sent',
+               'document_viewed', 'field_filled', 'document_signed', 'document_completed',
+               'document_expired', 'document_cancelled', 'document_finalized')
+);
+
+ALTER TABLE document_signers DROP COLUMN IF EXISTS reminder_count;
+ALTER TABLE document_signers DROP COLUMN IF EXISTS last_reminded_at;
+
+ALTER TABLE documents DROP CONSTRAINT IF EXISTS documents_valid_reminder_policy;
+ALTER TABLE documents DROP COLUMN IF EXISTS reminder_repeat_days;
+ALTER TABLE documents DROP COLUMN IF EXISTS reminder_first_after_days;
@@ -0,0 +1,22 @@
+-- migrations/000010_signer_reminders.up.sql
+
+-- Reminder policy: first reminder N days after a signer's turn starts, then every M days until
+-- the signer completes or the document expires. NULL first_after_days disables reminders.
+ALTER TABLE documents ADD COLUMN reminder_first_after_days INTEGER;
+ALTER TABLE documents ADD COLUMN reminder_repeat_days INTEGER;
+ALTER TABLE documents ADD CONSTRAINT documents_valid_reminder_policy CHECK (
+    (reminder_first_after_days IS NULL OR reminder_first_after_days > 0) AND
+    (reminder_repeat_days IS NULL OR reminder_repeat_days > 0)
+);
+
+ALTER TABLE document_signers ADD COLUMN last_reminded_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE document_signers ADD COLUMN reminder_count INTEGER NOT NULL DEFAULT 0;
+
+ALTER TYPE notification_type ADD VALUE IF NOT EXISTS 'signature_reminder';
+
+ALTER TABLE document_audit_log DROP CONSTRAINT document_audit_log_valid_action;
+ALTER TABLE document_audit_log ADD CONSTRAINT document_audit_log_valid_action CHECK (
+    action IN ('template_created', 'template_updated', 'document_created', 'document_sent',
+               'document_viewed', 'field_filled', 'document_signed', 'document_completed',
+               'document_expired', 'document_cancelled', 'document_finalized', 'reminder_sent')
+);
@@ -0,0 +1,8 @@
+-- migrations/000011_document_void.down.sql
+
+-- Note: PostgreSQL cannot drop values from an enum, so the notification_type
+-- value added in the up migration is left in place.
+
+ALTER TABLE documents DROP COLUMN IF EXISTS voided_by;
+ALTER TABLE documents DROP COLUMN IF EXISTS voided_at;
+ALTER TABLE documents DROP COLUMN IF EXISTS void_reason;
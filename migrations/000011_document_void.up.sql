@@ -0,0 +1,9 @@
+-- migrations/000011_document_void.up.sql
+
+-- Voiding moves a document to cancelled and keeps who did it and why
+ALTER TABLE documents ADD COLUMN void_reason TEXT;
+ALTER TABLE documents ADD COLUMN voided_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE documents ADD COLUMN voided_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+-- Lets signers with an account know a document they worked on was voided
+ALTER TYPE notification_type ADD VALUE IF NOT EXISTS 'document_voided';
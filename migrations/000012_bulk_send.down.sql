@@ -0,0 +1,7 @@
+-- migrations/000012_bulk_send.down.sql
+
+DROP INDEX IF EXISTS idx_bulk_send_rows_pending;
+DROP INDEX IF EXISTS idx_bulk_send_batches_workspace_id;
+
+DROP TABLE IF EXISTS bulk_send_rows;
+DROP TABLE IF EXISTS bulk_send_batches;
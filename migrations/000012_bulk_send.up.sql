@@ -0,0 +1,40 @@
+-- migrations/000012_bulk_send.up.sql
+
+-- A bulk send creates one document per CSV row from the same template. Rows are validated when
+-- the CSV is uploaded and turned into sent documents by a background job.
+CREATE TABLE bulk_send_batches (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    template_id UUID NOT NULL REFERENCES templates(id),
+    template_snapshot_hash VARCHAR(64) NOT NULL, -- Template layout every row was validated against
+    created_by INTEGER NOT NULL REFERENCES users(id),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    total_rows INTEGER NOT NULL,
+    expires_at TIMESTAMP,                        -- Applied to every document in the batch
+    parallel_signing BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    completed_at TIMESTAMP WITH TIME ZONE,
+
+    CONSTRAINT bulk_send_batches_valid_status CHECK (status IN ('pending', 'processing', 'completed')),
+    CONSTRAINT bulk_send_batches_positive_rows CHECK (total_rows > 0)
+);
+
+CREATE TABLE bulk_send_rows (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    batch_id UUID NOT NULL REFERENCES bulk_send_batches(id) ON DELETE CASCADE,
+    row_number INTEGER NOT NULL,                 -- 1-based position in the CSV, excluding the header
+    document_name VARCHAR(255) NOT NULL,
+    recipients JSONB NOT NULL,                   -- One entry per template signer role
+    prefill JSONB NOT NULL DEFAULT '[]',         -- Encrypted field values keyed by template field
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    document_id UUID REFERENCES documents(id) ON DELETE SET NULL,
+    error TEXT,
+    processed_at TIMESTAMP WITH TIME ZONE,
+
+    CONSTRAINT bulk_send_rows_valid_status CHECK (status IN ('pending', 'sent', 'failed')),
+    CONSTRAINT bulk_send_rows_unique_row_per_batch UNIQUE (batch_id, row_number)
+);
+
+CREATE INDEX idx_bulk_send_batches_workspace_id ON bulk_send_batches(workspace_id);
+CREATE INDEX idx_bulk_send_rows_pending ON bulk_send_rows(batch_id, row_number) WHERE status = 'pending';
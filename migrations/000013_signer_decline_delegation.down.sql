@@ -0,0 +1,32 @@
+-- migrations/000013_signer_decline_delegation.down.sql
+
+-- Note: PostgreSQL cannot drop values from an enum, so the notification_type
+-- value added in the up migration is left in place.
+
+DELETE FROM document_audit_log WHERE action IN ('signer_declined', 'signer_delegated', 'signer_reassigned');
+
+ALTER TABLE document_audit_log DROP CONSTRAINT document_audit_log_valid_action;
+ALTER TABLE document_audit_log ADD CONSTRAINT document_audit_log_valid_action CHECK (
+    action IN ('template_created', 'template_updated', 'document_created', 'document_sent',
+               'document_viewed', 'field_filled', 'document_signed', 'document_completed',
+               'document_expired', 'document_cancelled', 'document_finalized', 'reminder_sent')
+);
+
+ALTER TABLE templates DROP COLUMN IF EXISTS allow_delegation;
+
+-- Declined documents and signers have no equivalent in the old schema
+UPDATE documents SET status = 'cancelled' WHERE status = 'declined';
+UPDATE document_signers SET status = 'pending' WHERE status = 'declined';
+
+ALTER TABLE documents DROP CONSTRAINT documents_valid_status;
+ALTER TABLE documents ADD CONSTRAINT documents_valid_status CHECK (
+    status IN ('draft', 'scheduled', 'sent', 'in_progress', 'completed', 'expired', 'cancelled')
+);
+
+ALTER TABLE document_signers DROP CONSTRAINT document_signers_valid_status;
+ALTER TABLE document_signers ADD CONSTRAINT document_signers_valid_status CHECK (
+    status IN ('pending', 'viewed', 'in_progress', 'completed')
+);
+
+ALTER TABLE document_signers DROP COLUMN IF EXISTS decline_reason;
+ALTER TABLE document_signers DROP COLUMN IF EXISTS declined_at;
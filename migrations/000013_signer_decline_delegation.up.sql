@@ -0,0 +1,28 @@
+-- migrations/000013_signer_decline_delegation.up.sql
+
+-- A signer can decline, which ends the document for everyone
+ALTER TABLE document_signers ADD COLUMN declined_at TIMESTAMP;
+ALTER TABLE document_signers ADD COLUMN decline_reason TEXT;
+
+ALTER TABLE document_signers DROP CONSTRAINT document_signers_valid_status;
+ALTER TABLE document_signers ADD CONSTRAINT document_signers_valid_status CHECK (
+    status IN ('pending', 'viewed', 'in_progress', 'completed', 'declined')
+);
+
+ALTER TABLE documents DROP CONSTRAINT documents_valid_status;
+ALTER TABLE documents ADD CONSTRAINT documents_valid_status CHECK (
+    status IN ('draft', 'scheduled', 'sent', 'in_progress', 'completed', 'expired', 'cancelled', 'declined')
+);
+
+-- Lets a signer hand their part of a document to someone else
+ALTER TABLE templates ADD COLUMN allow_delegation BOOLEAN NOT NULL DEFAULT false;
+
+ALTER TYPE notification_type ADD VALUE IF NOT EXISTS 'document_declined';
+
+ALTER TABLE document_audit_log DROP CONSTRAINT document_audit_log_valid_action;
+ALTER TABLE document_audit_log ADD CONSTRAINT document_audit_log_valid_action CHECK (
+    action IN ('template_created', 'template_updated', 'document_created', 'document_sent',
+               'document_viewed', 'field_filled', 'document_signed', 'document_completed',
+               'document_expired', 'document_cancelled', 'document_finalized', 'reminder_sent',
+               'signer_declined', 'signer_delegated', 'signer_reassigned')
+);
@@ -0,0 +1,7 @@
+-- migrations/000014_embedded_signing.down.sql
+
+DROP INDEX IF EXISTS idx_embedded_signing_sessions_signer_id;
+
+DROP TABLE IF EXISTS embedded_signing_sessions;
+
+ALTER TABLE workspaces DROP COLUMN IF EXISTS embed_allowed_origins;
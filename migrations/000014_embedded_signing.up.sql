@@ -0,0 +1,19 @@
+-- migrations/000014_embedded_signing.up.sql
+
+-- Origins allowed to frame the signing experience and call the signing API from the browser,
+-- e.g. 'https://app.example.com'
+ALTER TABLE workspaces ADD COLUMN embed_allowed_origins TEXT[] NOT NULL DEFAULT '{}';
+
+-- An embedded signing session is a short-lived, single-use link into the signing experience
+-- for one signer, minted by the sender's application to show inside its own pages
+CREATE TABLE embedded_signing_sessions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    signer_id UUID NOT NULL REFERENCES document_signers(id) ON DELETE CASCADE,
+    return_url TEXT NOT NULL,                    -- Where the signer is sent once they are done
+    created_by INTEGER NOT NULL REFERENCES users(id),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    redeemed_at TIMESTAMP WITH TIME ZONE,        -- Set when the link is opened; it cannot be used again
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_embedded_signing_sessions_signer_id ON embedded_signing_sessions(signer_id);
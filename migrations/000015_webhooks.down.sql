@@ -0,0 +1,9 @@
+-- migrations/000015_webhooks.down.sql
+
+DROP INDEX IF EXISTS idx_webhook_deliveries_endpoint_id;
+DROP INDEX IF EXISTS idx_webhook_deliveries_due;
+DROP INDEX IF EXISTS idx_webhook_endpoints_workspace_id;
+
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhook_events;
+DROP TABLE IF EXISTS webhook_endpoints;
@@ -0,0 +1,10 @@
+-- migrations/000016_document_verification_audit.up.sql
+
+-- Public verification lookups that match a document are recorded in its audit log
+ALTER TABLE document_audit_log DROP CONSTRAINT document_audit_log_valid_action;
+ALTER TABLE document_audit_log ADD CONSTRAINT document_audit_log_valid_action CHECK (
+    action IN ('template_created', 'template_updated', 'document_created', 'document_sent',
+               'document_viewed', 'field_filled', 'document_signed', 'document_completed',
+               'document_expired', 'document_cancelled', 'document_finalized', 'reminder_sent',
+               'signer_declined', 'signer_delegated', 'signer_reassigned', 'document_verified')
+);
@@ -0,0 +1,28 @@
+-- migrations/000017_template_versions.down.sql
+
+-- Note: the old schema allows one set of signers and fields per template. Drafts are dropped,
+-- but this migration fails if any template has more than one published or superseded version;
+-- those older versions have to be removed by hand first.
+
+DELETE FROM template_versions WHERE status = 'draft';
+
+DROP INDEX IF EXISTS idx_documents_template_version_id;
+DROP INDEX IF EXISTS idx_template_fields_version_id;
+DROP INDEX IF EXISTS idx_template_signers_version_id;
+
+ALTER TABLE bulk_send_batches DROP COLUMN IF EXISTS template_version_id;
+ALTER TABLE documents DROP COLUMN IF EXISTS template_version_id;
+
+ALTER TABLE template_fields DROP CONSTRAINT IF EXISTS template_fields_unique_name_per_version;
+ALTER TABLE template_fields ADD CONSTRAINT template_fields_unique_name_per_template
+    UNIQUE (template_id, field_name);
+ALTER TABLE template_fields DROP COLUMN IF EXISTS template_version_id;
+
+ALTER TABLE template_signers DROP CONSTRAINT IF EXISTS template_signers_unique_order_per_version;
+ALTER TABLE template_signers ADD CONSTRAINT template_signers_unique_order_per_template
+    UNIQUE (template_id, signer_order);
+ALTER TABLE template_signers DROP COLUMN IF EXISTS template_version_id;
+
+ALTER TABLE templates DROP COLUMN IF EXISTS published_version_id;
+
+DROP TABLE IF EXISTS template_versions;
@@ -0,0 +1,77 @@
+-- migrations/000017_template_versions.up.sql
+
+-- Each template has a history of versions. Edits to signers, fields or the PDF are made on the
+-- template's single draft version; publishing the draft makes it the version new documents are
+-- created from. Published versions are never changed again, and documents pin the exact version
+-- they were created from.
+CREATE TABLE template_versions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    template_id UUID NOT NULL REFERENCES templates(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'draft', -- draft, published, superseded
+    s3_bucket VARCHAR(255) NOT NULL,
+    s3_key VARCHAR(255) NOT NULL,
+    pdf_hash VARCHAR(64) NOT NULL,
+    file_size BIGINT NOT NULL,
+    mime_type VARCHAR(100) DEFAULT 'application/pdf',
+    total_pages INTEGER NOT NULL DEFAULT 1,
+    changes JSONB NOT NULL DEFAULT '[]',         -- [{change, user_id, user_name, changed_at, details}]
+    created_by INTEGER NOT NULL REFERENCES users(id),
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW(),
+    published_by INTEGER REFERENCES users(id),
+    published_at TIMESTAMP,
+
+    CONSTRAINT template_versions_valid_status CHECK (status IN ('draft', 'published', 'superseded')),
+    CONSTRAINT template_versions_positive_version CHECK (version > 0),
+    CONSTRAINT template_versions_unique_version UNIQUE (template_id, version)
+);
+
+-- At most one draft and one published version per template
+CREATE UNIQUE INDEX idx_template_versions_one_draft ON template_versions(template_id) WHERE status = 'draft';
+CREATE UNIQUE INDEX idx_template_versions_one_published ON template_versions(template_id) WHERE status = 'published';
+
+-- Every existing template becomes its current version, already published
+INSERT INTO template_versions (template_id, version, status, s3_bucket, s3_key, pdf_hash, file_size,
+    mime_type, total_pages, created_by, created_at, updated_at, published_by, published_at)
+SELECT id, COALESCE(version, 1), 'published', s3_bucket, s3_key, pdf_hash, file_size,
+    mime_type, total_pages, created_by, created_at, updated_at, created_by, created_at
+FROM templates;
+
+-- The template row mirrors its published version's PDF. The column is only NULL while a new
+-- template is being inserted.
+ALTER TABLE templates ADD COLUMN published_version_id UUID REFERENCES template_versions(id);
+UPDATE templates t SET published_version_id = tv.id
+FROM template_versions tv WHERE tv.template_id = t.id;
+
+-- Signers and fields belong to one version
+ALTER TABLE template_signers ADD COLUMN template_version_id UUID REFERENCES template_versions(id) ON DELETE CASCADE;
+UPDATE template_signers ts SET template_version_id = t.published_version_id
+FROM templates t WHERE ts.template_id = t.id;
+ALTER TABLE template_signers ALTER COLUMN template_version_id SET NOT NULL;
+ALTER TABLE template_signers DROP CONSTRAINT template_signers_unique_order_per_template;
+ALTER TABLE template_signers ADD CONSTRAINT template_signers_unique_order_per_version
+    UNIQUE (template_version_id, signer_order);
+
+ALTER TABLE template_fields ADD COLUMN template_version_id UUID REFERENCES template_versions(id) ON DELETE CASCADE;
+UPDATE template_fields tf SET template_version_id = t.published_version_id
+FROM templates t WHERE tf.template_id = t.id;
+ALTER TABLE template_fields ALTER COLUMN template_version_id SET NOT NULL;
+ALTER TABLE template_fields DROP CONSTRAINT template_fields_unique_name_per_template;
+ALTER TABLE template_fields ADD CONSTRAINT template_fields_unique_name_per_version
+    UNIQUE (template_version_id, field_name);
+
+-- Documents and bulk sends pin the version they were created from
+ALTER TABLE documents ADD COLUMN template_version_id UUID REFERENCES template_versions(id);
+UPDATE documents d SET template_version_id = t.published_version_id
+FROM templates t WHERE d.template_id = t.id;
+ALTER TABLE documents ALTER COLUMN template_version_id SET NOT NULL;
+
+ALTER TABLE bulk_send_batches ADD COLUMN template_version_id UUID REFERENCES template_versions(id);
+UPDATE bulk_send_batches b SET template_version_id = t.published_version_id
+FROM templates t WHERE b.template_id = t.id;
+ALTER TABLE bulk_send_batches ALTER COLUMN template_version_id SET NOT NULL;
+
+CREATE INDEX idx_template_signers_version_id ON template_signers(template_version_id);
+CREATE INDEX idx_template_fields_version_id ON template_fields(template_version_id);
+CREATE INDEX idx_documents_template_version_id ON documents(template_version_id);
@@ -0,0 +1,11 @@
+-- migrations/000018_workspace_data_keys.down.sql
+
+-- Note: anything encrypted with a workspace data key cannot be read once this table is dropped.
+-- Only roll back before envelope-encrypted data has been written.
+
+ALTER TABLE documents DROP COLUMN IF EXISTS encryption_key_id;
+ALTER TABLE template_versions DROP COLUMN IF EXISTS encryption_key_id;
+
+DROP INDEX IF EXISTS idx_workspace_data_keys_master_key_id;
+DROP INDEX IF EXISTS idx_workspace_data_keys_one_active;
+DROP TABLE IF EXISTS workspace_data_keys;
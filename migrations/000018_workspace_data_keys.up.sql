@@ -0,0 +1,26 @@
+-- migrations/000018_workspace_data_keys.up.sql
+
+-- Envelope encryption: every workspace encrypts its files and form values with its own data key.
+-- Data keys are stored wrapped (encrypted) by a master key, identified by the master key's
+-- fingerprint, so rotating the master key only means re-wrapping these rows.
+CREATE TABLE workspace_data_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    wrapped_key BYTEA NOT NULL,
+    master_key_id VARCHAR(64) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'active', -- active, retired
+    created_at TIMESTAMP DEFAULT NOW(),
+    rewrapped_at TIMESTAMP,
+    retired_at TIMESTAMP,
+
+    CONSTRAINT workspace_data_keys_valid_status CHECK (status IN ('active', 'retired'))
+);
+
+-- New data is always encrypted with the workspace's one active key; retired keys only decrypt
+CREATE UNIQUE INDEX idx_workspace_data_keys_one_active ON workspace_data_keys(workspace_id) WHERE status = 'active';
+CREATE INDEX idx_workspace_data_keys_master_key_id ON workspace_data_keys(master_key_id);
+
+-- The data key that last encrypted each stored PDF. NULL means unknown: the file was stored
+-- before envelope encryption, or has not been checked by the re-encryption job yet.
+ALTER TABLE template_versions ADD COLUMN encryption_key_id VARCHAR(255);
+ALTER TABLE documents ADD COLUMN encryption_key_id VARCHAR(255);
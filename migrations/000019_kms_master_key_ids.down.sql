@@ -0,0 +1,4 @@
+-- migrations/000019_kms_master_key_ids.down.sql
+
+-- Note: this fails while any data key is wrapped by a KMS key with a longer ID
+ALTER TABLE workspace_data_keys ALTER COLUMN master_key_id TYPE VARCHAR(64);
@@ -0,0 +1,4 @@
+-- migrations/000019_kms_master_key_ids.up.sql
+
+-- KMS master key IDs (e.g. "aws-kms:" plus a full key ARN) do not fit in 64 characters
+ALTER TABLE workspace_data_keys ALTER COLUMN master_key_id TYPE VARCHAR(255);
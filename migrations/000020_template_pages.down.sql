@@ -0,0 +1,3 @@
+-- migrations/000020_template_pages.down.sql
+
+ALTER TABLE template_versions DROP COLUMN IF EXISTS pages;
@@ -0,0 +1,6 @@
+-- migrations/000020_template_pages.up.sql
+
+-- The size and rotation of each page of a version's PDF, read from the file on upload:
+-- [{page, width, height, rotation, media_box}]. NULL for PDFs uploaded before pages were
+-- inspected, whose total_pages was reported by the client.
+ALTER TABLE template_versions ADD COLUMN pages JSONB;
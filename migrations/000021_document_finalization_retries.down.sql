@@ -0,0 +1,8 @@
+-- migrations/000021_document_finalization_retries.down.sql
+
+DROP INDEX IF EXISTS idx_documents_pending_finalization;
+
+ALTER TABLE documents
+    DROP COLUMN IF EXISTS finalization_error,
+    DROP COLUMN IF EXISTS finalization_next_attempt_at,
+    DROP COLUMN IF EXISTS finalization_attempts;
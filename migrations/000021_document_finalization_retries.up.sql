@@ -0,0 +1,11 @@
+-- migrations/000021_document_finalization_retries.up.sql
+
+-- The final PDF of a completed document is rendered by a background job that retries failures
+-- with backoff. A NULL finalization_next_attempt_at means the job has given up on the document.
+ALTER TABLE documents
+    ADD COLUMN finalization_attempts INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN finalization_next_attempt_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    ADD COLUMN finalization_error TEXT;
+
+CREATE INDEX idx_documents_pending_finalization ON documents(finalization_next_attempt_at)
+    WHERE status = 'completed' AND final_document_hash IS NULL;
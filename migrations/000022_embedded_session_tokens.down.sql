@@ -0,0 +1,7 @@
+-- migrations/000022_embedded_session_tokens.down.sql
+
+DROP INDEX IF EXISTS idx_embedded_signing_sessions_access_token_selector;
+
+ALTER TABLE embedded_signing_sessions
+    DROP COLUMN IF EXISTS access_token_expires_at,
+    DROP COLUMN IF EXISTS access_token;
@@ -0,0 +1,12 @@
+-- migrations/000022_embedded_session_tokens.up.sql
+
+-- Redeeming an embedded session issues a token that only works for that session, so the
+-- signer's emailed access token is never handed to the embedding page. It is resolved like a
+-- signer access token, by its first 16 characters.
+ALTER TABLE embedded_signing_sessions
+    ADD COLUMN access_token TEXT,
+    ADD COLUMN access_token_expires_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_embedded_signing_sessions_access_token_selector
+    ON embedded_signing_sessions (left(access_token, 16))
+    WHERE access_token IS NOT NULL;